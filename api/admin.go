@@ -0,0 +1,390 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+	"github.com/coder/code-marketplace/api/httpapi"
+	"github.com/coder/code-marketplace/api/httpmw"
+	"github.com/coder/code-marketplace/audit"
+	"github.com/coder/code-marketplace/scan"
+	"github.com/coder/code-marketplace/storage"
+)
+
+// AdminResponse is the response sent after a successful admin operation.
+type AdminResponse struct {
+	Message string `json:"message"`
+}
+
+func (api *API) unpublishExtension(rw http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	publisher, name, version, err := storage.ParseExtensionID(id)
+	if err != nil {
+		writeInvalidID(rw, r, err)
+		return
+	}
+
+	err = storage.Unpublish(r.Context(), api.Storage, publisher, name, version)
+	api.recordAudit(r, audit.Event{
+		Action:    audit.ActionUnpublish,
+		Extension: storage.ExtensionIDWithoutVersion(publisher, name),
+		Version:   version,
+	}, err)
+	if err != nil {
+		api.writeMutationError(rw, r, err)
+		return
+	}
+
+	api.Logger.Info(r.Context(), "Unpublished extension",
+		slog.F("id", id),
+		slog.F("actor", httpmw.Actor(r)))
+	httpapi.Write(rw, http.StatusOK, AdminResponse{Message: "Unpublished " + id})
+}
+
+func (api *API) republishExtension(rw http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	publisher, name, version, err := storage.ParseExtensionID(id)
+	if err != nil {
+		writeInvalidID(rw, r, err)
+		return
+	}
+
+	err = storage.Republish(r.Context(), api.Storage, publisher, name, version)
+	api.recordAudit(r, audit.Event{
+		Action:    audit.ActionRepublish,
+		Extension: storage.ExtensionIDWithoutVersion(publisher, name),
+		Version:   version,
+	}, err)
+	if err != nil {
+		api.writeMutationError(rw, r, err)
+		return
+	}
+
+	api.Logger.Info(r.Context(), "Republished extension",
+		slog.F("id", id),
+		slog.F("actor", httpmw.Actor(r)))
+	httpapi.Write(rw, http.StatusOK, AdminResponse{Message: "Republished " + id})
+}
+
+func (api *API) featureExtension(rw http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	publisher, name, err := storage.ParseExtensionIDWithoutVersion(id)
+	if err != nil {
+		writeInvalidID(rw, r, err)
+		return
+	}
+
+	// The position is one-based with zero or omitted meaning the end.
+	position := 0
+	if value := r.URL.Query().Get("position"); value != "" {
+		position, err = strconv.Atoi(value)
+		if err != nil || position < 0 {
+			httpapi.Write(rw, http.StatusBadRequest, httpapi.ErrorResponse{
+				Message:   "Invalid position",
+				Detail:    "The position must be a non-negative integer",
+				RequestID: httpmw.RequestID(r),
+			})
+			return
+		}
+	}
+
+	err = storage.Feature(r.Context(), api.Storage, publisher, name, position-1)
+	api.recordAudit(r, audit.Event{
+		Action:    audit.ActionFeature,
+		Extension: storage.ExtensionIDWithoutVersion(publisher, name),
+	}, err)
+	if err != nil {
+		api.writeMutationError(rw, r, err)
+		return
+	}
+
+	api.Logger.Info(r.Context(), "Featured extension",
+		slog.F("id", id),
+		slog.F("position", position),
+		slog.F("actor", httpmw.Actor(r)))
+	httpapi.Write(rw, http.StatusOK, AdminResponse{Message: "Featured " + id})
+}
+
+func (api *API) unfeatureExtension(rw http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	publisher, name, err := storage.ParseExtensionIDWithoutVersion(id)
+	if err != nil {
+		writeInvalidID(rw, r, err)
+		return
+	}
+
+	err = storage.Unfeature(r.Context(), api.Storage, publisher, name)
+	api.recordAudit(r, audit.Event{
+		Action:    audit.ActionUnfeature,
+		Extension: storage.ExtensionIDWithoutVersion(publisher, name),
+	}, err)
+	if err != nil {
+		api.writeMutationError(rw, r, err)
+		return
+	}
+
+	api.Logger.Info(r.Context(), "Unfeatured extension",
+		slog.F("id", id),
+		slog.F("actor", httpmw.Actor(r)))
+	httpapi.Write(rw, http.StatusOK, AdminResponse{Message: "Unfeatured " + id})
+}
+
+func (api *API) removeExtension(rw http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	publisher, name, version, err := storage.ParseExtensionIDWithPlatform(id)
+	if err != nil {
+		writeInvalidID(rw, r, err)
+		return
+	}
+
+	// The platform can also be passed as a query parameter, which combined with
+	// all=true removes every version for that platform.
+	if platform := r.URL.Query().Get("platform"); platform != "" {
+		if version.TargetPlatform != "" {
+			writeInvalidID(rw, r, xerrors.Errorf("cannot specify both the platform query parameter and platform %s", version.TargetPlatform))
+			return
+		}
+		version.TargetPlatform = storage.Platform(platform)
+		if err := storage.ValidatePlatform(version.TargetPlatform); err != nil {
+			writeInvalidID(rw, r, err)
+			return
+		}
+	}
+
+	// Removing every version must be explicit.
+	if version.Version == "" && r.URL.Query().Get("all") != "true" {
+		httpapi.Write(rw, http.StatusBadRequest, httpapi.ErrorResponse{
+			Message:   "Missing version",
+			Detail:    "Include a version in the ID or pass all=true to remove every version",
+			RequestID: httpmw.RequestID(r),
+		})
+		return
+	}
+
+	err = api.Storage.RemoveExtension(r.Context(), publisher, name, version)
+	api.recordAudit(r, audit.Event{
+		Action:         audit.ActionRemove,
+		Extension:      storage.ExtensionIDWithoutVersion(publisher, name),
+		Version:        version.Version,
+		TargetPlatform: version.TargetPlatform,
+	}, err)
+	if err != nil {
+		api.writeMutationError(rw, r, err)
+		return
+	}
+
+	api.Logger.Info(r.Context(), "Removed extension",
+		slog.F("id", id),
+		slog.F("targetPlatform", version.TargetPlatform),
+		slog.F("actor", httpmw.Actor(r)))
+	httpapi.Write(rw, http.StatusOK, AdminResponse{Message: "Removed " + id})
+}
+
+// PendingExtension is an extension awaiting approval.
+type PendingExtension struct {
+	// ID is what to pass to the approve and reject endpoints.
+	ID string `json:"id"`
+	*storage.PendingExtension
+}
+
+// PendingSubmission is the response sent after submitting an extension.
+type PendingSubmission struct {
+	Message string `json:"message"`
+	// ID is what to pass to the approve and reject endpoints.
+	ID string `json:"id"`
+}
+
+func (api *API) listPending(rw http.ResponseWriter, r *http.Request) {
+	pending, err := storage.ReadPending(r.Context(), api.Storage)
+	if err != nil {
+		api.writeMutationError(rw, r, err)
+		return
+	}
+	resp := []PendingExtension{}
+	for _, ext := range pending.Sorted() {
+		resp = append(resp, PendingExtension{ID: ext.ID(), PendingExtension: ext})
+	}
+	httpapi.Write(rw, http.StatusOK, resp)
+}
+
+// maxSubmissionSize is the largest VSIX that can be submitted, which matches
+// what storage.ReadVSIX will download.
+const maxSubmissionSize = 100 * 1000 * 1000
+
+// submitPending adds the VSIX in the request body as pending approval.  The
+// submitter is the actor the admin token belongs to so they cannot approve it.
+func (api *API) submitPending(rw http.ResponseWriter, r *http.Request) {
+	event := audit.Event{Action: audit.ActionSubmit}
+	vsix, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, maxSubmissionSize))
+	if err != nil {
+		api.recordAudit(r, event, err)
+		var maxBytes *http.MaxBytesError
+		if errors.As(err, &maxBytes) {
+			httpapi.Write(rw, http.StatusRequestEntityTooLarge, httpapi.ErrorResponse{
+				Message:   "Extension is too large",
+				Detail:    err.Error(),
+				RequestID: httpmw.RequestID(r),
+			})
+			return
+		}
+		httpapi.Write(rw, http.StatusBadRequest, httpapi.ErrorResponse{
+			Message:   "Unable to read extension",
+			Detail:    err.Error(),
+			RequestID: httpmw.RequestID(r),
+		})
+		return
+	}
+	sum := sha256.Sum256(vsix)
+	event.SHA256 = hex.EncodeToString(sum[:])
+
+	manifest, err := storage.ReadVSIXManifest(vsix)
+	if err != nil {
+		api.recordAudit(r, event, err)
+		httpapi.Write(rw, http.StatusBadRequest, httpapi.ErrorResponse{
+			Message:   "Invalid extension",
+			Detail:    err.Error(),
+			RequestID: httpmw.RequestID(r),
+		})
+		return
+	}
+	identity := manifest.Metadata.Identity
+	event.Extension = storage.ExtensionIDWithoutVersion(identity.Publisher, identity.ID)
+	event.Version = identity.Version
+	event.TargetPlatform = identity.TargetPlatform
+
+	id, err := storage.AddPending(r.Context(), api.Storage, httpmw.Actor(r), manifest, vsix)
+	api.recordAudit(r, event, err)
+	if err != nil {
+		api.writeMutationError(rw, r, err)
+		return
+	}
+
+	api.Logger.Info(r.Context(), "Submitted extension",
+		slog.F("id", id),
+		slog.F("actor", httpmw.Actor(r)))
+	httpapi.Write(rw, http.StatusOK, PendingSubmission{ID: id, Message: "Submitted " + id + " for approval"})
+}
+
+func (api *API) approvePending(rw http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	publisher, name, version, err := storage.ParseExtensionIDWithPlatform(id)
+	if err != nil {
+		writeInvalidID(rw, r, err)
+		return
+	}
+
+	_, err = storage.ApprovePending(r.Context(), api.Storage, id, httpmw.Actor(r))
+	api.recordAudit(r, audit.Event{
+		Action:         audit.ActionApprove,
+		Extension:      storage.ExtensionIDWithoutVersion(publisher, name),
+		Version:        version.Version,
+		TargetPlatform: version.TargetPlatform,
+	}, err)
+	if err != nil {
+		api.writeMutationError(rw, r, err)
+		return
+	}
+
+	api.Logger.Info(r.Context(), "Approved extension",
+		slog.F("id", id),
+		slog.F("actor", httpmw.Actor(r)))
+	httpapi.Write(rw, http.StatusOK, AdminResponse{Message: "Approved " + id})
+}
+
+func (api *API) rejectPending(rw http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	publisher, name, version, err := storage.ParseExtensionIDWithPlatform(id)
+	if err != nil {
+		writeInvalidID(rw, r, err)
+		return
+	}
+
+	reason := r.URL.Query().Get("reason")
+	err = storage.RejectPending(r.Context(), api.Storage, id, httpmw.Actor(r), reason)
+	api.recordAudit(r, audit.Event{
+		Action:         audit.ActionReject,
+		Extension:      storage.ExtensionIDWithoutVersion(publisher, name),
+		Version:        version.Version,
+		TargetPlatform: version.TargetPlatform,
+	}, err)
+	if err != nil {
+		api.writeMutationError(rw, r, err)
+		return
+	}
+
+	api.Logger.Info(r.Context(), "Rejected extension",
+		slog.F("id", id),
+		slog.F("reason", reason),
+		slog.F("actor", httpmw.Actor(r)))
+	httpapi.Write(rw, http.StatusOK, AdminResponse{Message: "Rejected " + id})
+}
+
+// recordAudit records a change attempted through the admin API.  Failing to
+// record it is logged rather than failing the request since by then the change
+// has already been made.
+func (api *API) recordAudit(r *http.Request, event audit.Event, err error) {
+	event.Actor = httpmw.Actor(r)
+	event = event.Finish(err)
+	if err := api.Audit.Record(r.Context(), event); err != nil {
+		api.Logger.Error(r.Context(), "Unable to record audit event", slog.Error(err),
+			slog.F("action", event.Action),
+			slog.F("extension", event.Extension))
+	}
+}
+
+func writeInvalidID(rw http.ResponseWriter, r *http.Request, err error) {
+	httpapi.Write(rw, http.StatusBadRequest, httpapi.ErrorResponse{
+		Message:   "Invalid extension ID",
+		Detail:    err.Error(),
+		RequestID: httpmw.RequestID(r),
+	})
+}
+
+// writeMutationError writes the appropriate response for an error returned
+// while changing the marketplace.
+func (api *API) writeMutationError(rw http.ResponseWriter, r *http.Request, err error) {
+	var rejected *scan.RejectedError
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		httpapi.Write(rw, http.StatusNotFound, httpapi.ErrorResponse{
+			Message:   "Extension does not exist",
+			Detail:    err.Error(),
+			RequestID: httpmw.RequestID(r),
+		})
+	case errors.Is(err, storage.ErrAlreadyUnpublished), errors.Is(err, storage.ErrNotUnpublished),
+		errors.Is(err, storage.ErrAlreadyFeatured), errors.Is(err, storage.ErrNotFeatured):
+		httpapi.Write(rw, http.StatusConflict, httpapi.ErrorResponse{
+			Message:   "Conflicting change",
+			Detail:    err.Error(),
+			RequestID: httpmw.RequestID(r),
+		})
+	case errors.Is(err, storage.ErrSelfApproval):
+		httpapi.Write(rw, http.StatusForbidden, httpapi.ErrorResponse{
+			Message:   "Approval must come from someone else",
+			Detail:    err.Error(),
+			RequestID: httpmw.RequestID(r),
+		})
+	case errors.As(err, &rejected):
+		httpapi.Write(rw, http.StatusUnprocessableEntity, httpapi.ErrorResponse{
+			Message:   "Extension was rejected by scanning",
+			Detail:    err.Error(),
+			RequestID: httpmw.RequestID(r),
+		})
+	default:
+		api.Logger.Error(r.Context(), "Unable to change marketplace", slog.Error(err))
+		httpapi.Write(rw, http.StatusInternalServerError, httpapi.ErrorResponse{
+			Message:   "Internal server error while changing the marketplace",
+			Detail:    "Contact an administrator with the request ID",
+			RequestID: httpmw.RequestID(r),
+		})
+	}
+}
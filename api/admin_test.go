@@ -0,0 +1,491 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"cdr.dev/slog"
+	"cdr.dev/slog/sloggers/slogtest"
+	"github.com/coder/code-marketplace/api"
+	"github.com/coder/code-marketplace/api/httpapi"
+	"github.com/coder/code-marketplace/audit"
+	"github.com/coder/code-marketplace/scan"
+	"github.com/coder/code-marketplace/storage"
+	"github.com/coder/code-marketplace/testutil"
+)
+
+func TestAdminAPI(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		Name string
+		// Method defaults to POST.
+		Method string
+		// Paths are requested in order and only the last response is checked.
+		Paths   []string
+		Token   string
+		Status  int
+		Message string
+	}{
+		{
+			Name:   "Unauthorized",
+			Paths:  []string{"/api/admin/extensions/foo.zany/unpublish"},
+			Token:  "nope",
+			Status: http.StatusUnauthorized,
+		},
+		{
+			Name:    "Unpublish",
+			Paths:   []string{"/api/admin/extensions/foo.zany@1.0.0/unpublish"},
+			Status:  http.StatusOK,
+			Message: "Unpublished foo.zany@1.0.0",
+		},
+		{
+			Name:   "UnpublishNotExist",
+			Paths:  []string{"/api/admin/extensions/foo.zany@9.9.9/unpublish"},
+			Status: http.StatusNotFound,
+		},
+		{
+			Name:   "UnpublishInvalidID",
+			Paths:  []string{"/api/admin/extensions/foo/unpublish"},
+			Status: http.StatusBadRequest,
+		},
+		{
+			Name: "UnpublishTwice",
+			Paths: []string{
+				"/api/admin/extensions/foo.zany/unpublish",
+				"/api/admin/extensions/foo.zany/unpublish",
+			},
+			Status: http.StatusConflict,
+		},
+		{
+			Name: "Republish",
+			Paths: []string{
+				"/api/admin/extensions/foo.zany/unpublish",
+				"/api/admin/extensions/foo.zany/republish",
+			},
+			Status:  http.StatusOK,
+			Message: "Republished foo.zany",
+		},
+		{
+			Name:   "RepublishNotUnpublished",
+			Paths:  []string{"/api/admin/extensions/foo.zany/republish"},
+			Status: http.StatusConflict,
+		},
+		{
+			Name:    "Feature",
+			Paths:   []string{"/api/admin/extensions/foo.zany/feature?position=1"},
+			Status:  http.StatusOK,
+			Message: "Featured foo.zany",
+		},
+		{
+			Name:   "FeatureVersion",
+			Paths:  []string{"/api/admin/extensions/foo.zany@1.0.0/feature"},
+			Status: http.StatusBadRequest,
+		},
+		{
+			Name:   "FeatureInvalidPosition",
+			Paths:  []string{"/api/admin/extensions/foo.zany/feature?position=-1"},
+			Status: http.StatusBadRequest,
+		},
+		{
+			Name:   "FeatureNotExist",
+			Paths:  []string{"/api/admin/extensions/foo.nope/feature"},
+			Status: http.StatusNotFound,
+		},
+		{
+			Name: "FeatureTwice",
+			Paths: []string{
+				"/api/admin/extensions/foo.zany/feature",
+				"/api/admin/extensions/foo.zany/feature",
+			},
+			Status: http.StatusConflict,
+		},
+		{
+			Name: "Unfeature",
+			Paths: []string{
+				"/api/admin/extensions/foo.zany/feature",
+				"/api/admin/extensions/foo.zany/unfeature",
+			},
+			Status:  http.StatusOK,
+			Message: "Unfeatured foo.zany",
+		},
+		{
+			Name:   "UnfeatureNotFeatured",
+			Paths:  []string{"/api/admin/extensions/foo.zany/unfeature"},
+			Status: http.StatusConflict,
+		},
+		{
+			Name:    "Remove",
+			Method:  http.MethodDelete,
+			Paths:   []string{"/api/admin/extensions/foo.zany@3.0.0@linux-x64"},
+			Status:  http.StatusOK,
+			Message: "Removed foo.zany@3.0.0@linux-x64",
+		},
+		{
+			Name:    "RemoveAllPlatforms",
+			Method:  http.MethodDelete,
+			Paths:   []string{"/api/admin/extensions/foo.zany@3.0.0"},
+			Status:  http.StatusOK,
+			Message: "Removed foo.zany@3.0.0",
+		},
+		{
+			Name:    "RemovePlatformQuery",
+			Method:  http.MethodDelete,
+			Paths:   []string{"/api/admin/extensions/foo.zany@1.0.0?platform=win32-x64"},
+			Status:  http.StatusOK,
+			Message: "Removed foo.zany@1.0.0",
+		},
+		{
+			Name:    "RemoveAll",
+			Method:  http.MethodDelete,
+			Paths:   []string{"/api/admin/extensions/foo.zany?all=true"},
+			Status:  http.StatusOK,
+			Message: "Removed foo.zany",
+		},
+		{
+			Name:    "RemoveAllForPlatform",
+			Method:  http.MethodDelete,
+			Paths:   []string{"/api/admin/extensions/foo.zany?all=true&platform=win32-x64"},
+			Status:  http.StatusOK,
+			Message: "Removed foo.zany",
+		},
+		{
+			Name:   "RemoveMissingVersion",
+			Method: http.MethodDelete,
+			Paths:  []string{"/api/admin/extensions/foo.zany"},
+			Status: http.StatusBadRequest,
+		},
+		{
+			Name:   "RemoveInvalidPlatform",
+			Method: http.MethodDelete,
+			Paths:  []string{"/api/admin/extensions/foo.zany@3.0.0@linux-x86"},
+			Status: http.StatusBadRequest,
+		},
+		{
+			Name:   "RemovePlatformTwice",
+			Method: http.MethodDelete,
+			Paths:  []string{"/api/admin/extensions/foo.zany@3.0.0@linux-x64?platform=win32-x64"},
+			Status: http.StatusBadRequest,
+		},
+		{
+			Name:   "RemoveNotExist",
+			Method: http.MethodDelete,
+			Paths:  []string{"/api/admin/extensions/foo.zany@2.0.0@linux-x64"},
+			Status: http.StatusNotFound,
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			t.Parallel()
+
+			logger := slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}).Leveled(slog.LevelDebug)
+			apiServer := api.New(&api.Options{
+				AdminTokens: map[string]string{"secret": "tester"},
+				Database:    testutil.NewMockDB(nil),
+				Storage:     testutil.NewMockStorage(),
+				Logger:      logger,
+			})
+
+			server := httptest.NewServer(apiServer.Handler)
+			defer server.Close()
+
+			token := c.Token
+			if token == "" {
+				token = "secret"
+			}
+
+			var resp *http.Response
+			for _, path := range c.Paths {
+				method := c.Method
+				if method == "" {
+					method = http.MethodPost
+				}
+				req, err := http.NewRequest(method, server.URL+path, nil)
+				require.NoError(t, err)
+				req.Header.Set("Authorization", "Bearer "+token)
+				resp, err = http.DefaultClient.Do(req)
+				require.NoError(t, err)
+				defer resp.Body.Close()
+			}
+
+			require.Equal(t, c.Status, resp.StatusCode)
+			if c.Status == http.StatusOK {
+				var body api.AdminResponse
+				err := json.NewDecoder(resp.Body).Decode(&body)
+				require.NoError(t, err)
+				require.Equal(t, c.Message, body.Message)
+			} else {
+				var body httpapi.ErrorResponse
+				err := json.NewDecoder(resp.Body).Decode(&body)
+				require.NoError(t, err)
+				require.NotEmpty(t, body.Message)
+			}
+		})
+	}
+
+	t.Run("Audit", func(t *testing.T) {
+		t.Parallel()
+
+		sink := audit.NewFile(filepath.Join(t.TempDir(), "audit.jsonl"))
+		apiServer := api.New(&api.Options{
+			AdminTokens: map[string]string{"secret": "tester"},
+			Audit:       sink,
+			Database:    testutil.NewMockDB(nil),
+			Storage:     testutil.NewMockStorage(),
+			Logger:      slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}),
+		})
+		server := httptest.NewServer(apiServer.Handler)
+		defer server.Close()
+
+		requests := []struct {
+			method string
+			path   string
+		}{
+			{http.MethodPost, "/api/admin/extensions/foo.zany@1.0.0/unpublish"},
+			{http.MethodPost, "/api/admin/extensions/foo.nope/feature"},
+			{http.MethodDelete, "/api/admin/extensions/foo.zany@3.0.0@linux-x64"},
+			// Invalid requests are not recorded since nothing was attempted.
+			{http.MethodPost, "/api/admin/extensions/foo/unpublish"},
+		}
+		for _, request := range requests {
+			req, err := http.NewRequest(request.method, server.URL+request.path, nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer secret")
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+		}
+
+		events, err := sink.Read(audit.Filter{})
+		require.NoError(t, err)
+		require.Len(t, events, 3)
+		for i := range events {
+			require.NotZero(t, events[i].Time)
+			events[i].Time = time.Time{}
+		}
+		require.Equal(t, []audit.Event{
+			{
+				Actor:     "tester",
+				Action:    audit.ActionUnpublish,
+				Extension: "foo.zany",
+				Version:   "1.0.0",
+				Outcome:   audit.OutcomeSuccess,
+			},
+			{
+				Actor:     "tester",
+				Action:    audit.ActionFeature,
+				Extension: "foo.nope",
+				Outcome:   audit.OutcomeFailure,
+				Error:     "foo.nope: file does not exist",
+			},
+			{
+				Actor:          "tester",
+				Action:         audit.ActionRemove,
+				Extension:      "foo.zany",
+				Version:        "3.0.0",
+				TargetPlatform: storage.PlatformLinuxX64,
+				Outcome:        audit.OutcomeSuccess,
+			},
+		}, events)
+	})
+
+	t.Run("Pending", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		logger := slogtest.Make(t, &slogtest.Options{IgnoreErrors: true})
+		store, err := storage.NewLocalStorage(&storage.LocalOptions{ExtDir: t.TempDir()}, logger)
+		require.NoError(t, err)
+		sink := audit.NewFile(filepath.Join(t.TempDir(), "audit.jsonl"))
+
+		apiServer := api.New(&api.Options{
+			AdminTokens: map[string]string{"alice-token": "alice", "bob-token": "bob"},
+			Audit:       sink,
+			Database:    testutil.NewMockDB(nil),
+			Storage:     store,
+			Logger:      logger,
+		})
+		server := httptest.NewServer(apiServer.Handler)
+		defer server.Close()
+
+		upload := func(body []byte, token string) *http.Response {
+			req, err := http.NewRequest(http.MethodPost, server.URL+"/api/admin/pending", bytes.NewReader(body))
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+token)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = resp.Body.Close() })
+			return resp
+		}
+		do := func(method, path, token string) *http.Response {
+			req, err := http.NewRequest(method, server.URL+path, nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+token)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = resp.Body.Close() })
+			return resp
+		}
+
+		// Submissions need an admin token and a valid extension.
+		resp := upload([]byte("not a vsix"), "nope")
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		resp = upload([]byte("not a vsix"), "alice-token")
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		// The submitter is whoever the token belongs to.
+		for _, version := range []string{"1.0.0", "2.0.0"} {
+			manifest := testutil.ConvertExtensionToManifest(testutil.Extensions[0], storage.Version{Version: version})
+			resp = upload(testutil.CreateVSIXFromManifest(t, manifest), "alice-token")
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			var body api.PendingSubmission
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+			require.Equal(t, "foo.zany@"+version, body.ID)
+		}
+		versions, err := store.Versions(ctx, "foo", "zany")
+		require.Error(t, err)
+		require.Empty(t, versions)
+
+		// Pending files are never served, however the path is written.
+		for _, path := range []string{
+			"/files/.marketplace/pending/foo.zany-1.0.0/extension.vsix",
+			"/files/x/../.marketplace/pending/foo.zany-1.0.0/extension.vsix",
+			"/files/x/%2e%2e/.marketplace/pending/foo.zany-1.0.0/extension.vsix",
+			"/files//.marketplace/pending/foo.zany-1.0.0/extension.vsix",
+		} {
+			resp := do(http.MethodGet, path, "")
+			require.Equal(t, http.StatusNotFound, resp.StatusCode, path)
+		}
+
+		resp = do(http.MethodGet, "/api/admin/pending", "bob-token")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var pending []api.PendingExtension
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&pending))
+		require.Len(t, pending, 2)
+		require.Equal(t, "foo.zany@1.0.0", pending[0].ID)
+		require.Equal(t, "alice", pending[0].SubmittedBy)
+
+		// The submitter cannot approve their own extension.
+		resp = do(http.MethodPost, "/api/admin/pending/foo.zany@1.0.0/approve", "alice-token")
+		require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+		resp = do(http.MethodPost, "/api/admin/pending/foo.zany@1.0.0/approve", "bob-token")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var body api.AdminResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		require.Equal(t, "Approved foo.zany@1.0.0", body.Message)
+		versions, err = store.Versions(ctx, "foo", "zany")
+		require.NoError(t, err)
+		require.Equal(t, []storage.Version{{Version: "1.0.0"}}, versions)
+
+		resp = do(http.MethodPost, "/api/admin/pending/foo.zany@2.0.0/reject?reason=nope", "bob-token")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		resp = do(http.MethodPost, "/api/admin/pending/foo.zany@2.0.0/reject", "bob-token")
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+		resp = do(http.MethodPost, "/api/admin/pending/foo/approve", "bob-token")
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		reviews, err := storage.ReadReviews(ctx, store)
+		require.NoError(t, err)
+		require.Len(t, reviews, 2)
+		require.True(t, reviews[0].Approved)
+		require.Equal(t, "bob", reviews[0].ReviewedBy)
+		require.False(t, reviews[1].Approved)
+		require.Equal(t, "nope", reviews[1].Reason)
+
+		// Only authenticated requests are recorded.
+		events, err := sink.Read(audit.Filter{})
+		require.NoError(t, err)
+		recorded := []string{}
+		for _, event := range events {
+			recorded = append(recorded, fmt.Sprintf("%s %s %s", event.Actor, event.Action, event.Outcome))
+		}
+		require.Equal(t, []string{
+			"alice submit failure",
+			"alice submit success",
+			"alice submit success",
+			"alice approve failure",
+			"bob approve success",
+			"bob reject success",
+			"bob reject failure",
+		}, recorded)
+	})
+
+	t.Run("PendingRejected", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		logger := slogtest.Make(t, &slogtest.Options{IgnoreErrors: true})
+		local, err := storage.NewLocalStorage(&storage.LocalOptions{ExtDir: t.TempDir()}, logger)
+		require.NoError(t, err)
+		store := scan.NewStorage(local, rejectScanner{}, "", logger)
+		manifest := testutil.ConvertExtensionToManifest(testutil.Extensions[0], storage.Version{Version: "1.0.0"})
+		_, err = storage.AddPending(ctx, store, "alice", manifest, testutil.CreateVSIXFromManifest(t, manifest))
+		require.NoError(t, err)
+
+		apiServer := api.New(&api.Options{
+			AdminTokens: map[string]string{"bob-token": "bob"},
+			Database:    testutil.NewMockDB(nil),
+			Storage:     store,
+			Logger:      logger,
+		})
+		server := httptest.NewServer(apiServer.Handler)
+		defer server.Close()
+
+		// Extensions are scanned when they are approved.
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/api/admin/pending/foo.zany@1.0.0/approve", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer bob-token")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+		var body httpapi.ErrorResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		require.Contains(t, body.Detail, "suspicious")
+
+		pending, err := storage.ReadPending(ctx, store)
+		require.NoError(t, err)
+		require.Contains(t, pending, "foo.zany@1.0.0")
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		t.Parallel()
+
+		apiServer := api.New(&api.Options{
+			Database: testutil.NewMockDB(nil),
+			Storage:  testutil.NewMockStorage(),
+			Logger:   slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}),
+		})
+		server := httptest.NewServer(apiServer.Handler)
+		defer server.Close()
+
+		resp, err := http.Post(server.URL+"/api/admin/extensions/foo.zany/unpublish", "application/json", nil)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+// rejectScanner finds something suspicious in every extension.
+type rejectScanner struct{}
+
+func (rejectScanner) Name() string {
+	return "reject"
+}
+
+func (rejectScanner) Scan(_ context.Context, _ *storage.VSIXManifest, _ []byte) ([]scan.Finding, error) {
+	return []scan.Finding{{Scanner: "reject", Message: "suspicious"}}, nil
+}
@@ -2,21 +2,53 @@ package api
 
 import (
 	"encoding/json"
+	"maps"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
+	"sync/atomic"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
 
 	"cdr.dev/slog"
 	"github.com/coder/code-marketplace/api/httpapi"
 	"github.com/coder/code-marketplace/api/httpmw"
+	"github.com/coder/code-marketplace/audit"
 	"github.com/coder/code-marketplace/database"
+	"github.com/coder/code-marketplace/httpcache"
+	"github.com/coder/code-marketplace/ratelimit"
 	"github.com/coder/code-marketplace/storage"
 )
 
-const MaxPageSizeDefault int = 200
+// AdminPath is the prefix of the admin API routes.
+const AdminPath = "/api/admin"
+
+const (
+	MaxPageSizeDefault       int = 200
+	MaxFiltersDefault        int = 10
+	RateLimitDefault         int = 512
+	QueryRateLimitDefault    int = 512
+	DownloadRateLimitDefault int = 2048
+)
+
+// Rate limit budgets.  Queries and downloads have their own so browsing does
+// not use up the budget for installing extensions, or the other way around.
+const (
+	defaultBudget  = "default"
+	queryBudget    = "query"
+	downloadBudget = "download"
+)
+
+// filterConcurrency is the number of filters from a single query that will be
+// executed at the same time.
+const filterConcurrency = 4
 
 // QueryRequest implements an untyped object.  It is the data sent to the API to
 // query for extensions.
@@ -55,49 +87,134 @@ type ResultMetadataItem struct {
 }
 
 type Options struct {
+	// AdminTokens maps bearer tokens to the name of the actor they authenticate.
+	// Admin endpoints are disabled when there are no tokens.
+	AdminTokens map[string]string
+	// Audit records changes made through the admin API.  Defaults to discarding
+	// them.
+	Audit    audit.Sink
 	Database database.Database
 	Logger   slog.Logger
-	// Set to <0 to disable.
-	RateLimit   int
-	Storage     storage.Storage
+	// AdminCors is the CORS policy for the admin API.  Defaults to
+	// httpmw.AdminCors(), which allows no origins.
+	AdminCors *httpmw.CorsOptions
+	// GalleryCors is the CORS policy for every route outside the admin API.
+	// Defaults to httpmw.GalleryCors().
+	GalleryCors *httpmw.CorsOptions
+	// RateLimit, QueryRateLimit, and DownloadRateLimit are the requests per
+	// minute allowed from a client; see Settings.  Set to <0 to disable.
+	RateLimit         int
+	QueryRateLimit    int
+	DownloadRateLimit int
+	// RateLimitCounter stores rate limit counts.  Defaults to counting in
+	// memory, which means each replica has its own counts.
+	RateLimitCounter ratelimit.Counter
+	// TrustedProxies are the networks of proxies whose X-Forwarded-For and
+	// Forwarded headers are trusted to identify clients for rate limiting.
+	TrustedProxies []netip.Prefix
+	Storage        storage.Storage
+	MaxPageSize    int
+	// MaxFilters is the maximum number of filters in a single query.
+	MaxFilters int
+	// TracerProvider receives spans for each request.  Defaults to discarding
+	// them.
+	TracerProvider trace.TracerProvider
+}
+
+// Settings are the options that can be changed while the server is running.
+type Settings struct {
+	// AdminCors is the CORS policy for the admin API.
+	AdminCors *httpmw.CorsOptions
+	// GalleryCors is the CORS policy for every route outside the admin API.
+	GalleryCors *httpmw.CorsOptions
+	// MaxPageSize is the largest page size a query can request.
 	MaxPageSize int
+	// RateLimit is the number of requests per minute allowed from a client to
+	// routes other than queries and downloads.  Clients are identified by their
+	// admin token if they have one and their IP otherwise.  Set to <0 to
+	// disable.
+	RateLimit int
+	// QueryRateLimit is the number of extension queries per minute allowed from
+	// a client.  Set to <0 to disable.
+	QueryRateLimit int
+	// DownloadRateLimit is the number of file and asset requests per minute
+	// allowed from a client.  Set to <0 to disable.
+	DownloadRateLimit int
+}
+
+// settingsState pairs settings with the handler built from them so requests
+// always see both from the same update.
+type settingsState struct {
+	settings Settings
+	handler  http.Handler
 }
 
 type API struct {
-	Database    database.Database
-	Handler     http.Handler
-	Logger      slog.Logger
-	MaxPageSize int
+	Audit      audit.Sink
+	Database   database.Database
+	Handler    http.Handler
+	Logger     slog.Logger
+	MaxFilters int
+	Storage    storage.Storage
+
+	// router serves the API behind the middleware built from the settings.
+	router   http.Handler
+	settings atomic.Pointer[settingsState]
+	// These are used to rebuild the rate limit middleware.
+	adminTokens      map[string]string
+	rateLimitCounter ratelimit.Counter
+	trustedProxies   []netip.Prefix
 }
 
 // New creates a new API server.
 func New(options *Options) *API {
-	if options.RateLimit == 0 {
-		options.RateLimit = 512
+	if options.MaxFilters == 0 {
+		options.MaxFilters = MaxFiltersDefault
 	}
 
-	if options.MaxPageSize == 0 {
-		options.MaxPageSize = MaxPageSizeDefault
+	if options.Audit == nil {
+		options.Audit = audit.Nop{}
 	}
 
 	r := chi.NewRouter()
 
+	// CORS and rate limiting depend on the settings so they wrap the router
+	// instead; see UpdateSettings.
 	r.Use(
-		httpmw.Cors(),
-		httpmw.RateLimitPerMinute(options.RateLimit),
 		middleware.GetHead,
 		httpmw.AttachRequestID,
+		httpmw.Trace(options.TracerProvider),
 		httpmw.Recover(options.Logger),
 		httpmw.AttachBuildInfo,
 		httpmw.Logger(options.Logger),
 	)
 
 	api := &API{
-		Database:    options.Database,
-		Handler:     r,
-		Logger:      options.Logger,
-		MaxPageSize: options.MaxPageSize,
+		Audit:      options.Audit,
+		Database:   options.Database,
+		Logger:     options.Logger,
+		MaxFilters: options.MaxFilters,
+		Storage:    options.Storage,
+		router:     r,
+
+		adminTokens:      options.AdminTokens,
+		rateLimitCounter: options.RateLimitCounter,
+		trustedProxies:   options.TrustedProxies,
 	}
+	if api.rateLimitCounter == nil {
+		api.rateLimitCounter = ratelimit.NewMemory()
+	}
+	api.Handler = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		api.settings.Load().handler.ServeHTTP(rw, r)
+	})
+	api.UpdateSettings(Settings{
+		AdminCors:         options.AdminCors,
+		GalleryCors:       options.GalleryCors,
+		MaxPageSize:       options.MaxPageSize,
+		RateLimit:         options.RateLimit,
+		QueryRateLimit:    options.QueryRateLimit,
+		DownloadRateLimit: options.DownloadRateLimit,
+	})
 
 	r.Get("/", func(rw http.ResponseWriter, r *http.Request) {
 		httpapi.WriteBytes(rw, http.StatusOK, []byte("Marketplace is running"))
@@ -107,6 +224,14 @@ func New(options *Options) *API {
 		httpapi.WriteBytes(rw, http.StatusOK, []byte("API server running"))
 	})
 
+	// Kubernetes-style probes.  /healthz predates these and is kept for
+	// existing deployments; it behaves like /livez.
+	r.Get("/livez", livez)
+	r.Get("/readyz", api.readyz)
+
+	// Progress of seeding the Artifactory manifest cache at startup.
+	r.Get("/status/seed", api.seedStatus)
+
 	// TODO: Read API version header and output a warning if it has changed since
 	// that could indicate something needs to be updated.
 	r.Post("/api/extensionquery", api.extensionQuery)
@@ -128,6 +253,10 @@ func New(options *Options) *API {
 	r.Get("/publishers/{publisher}/vsextensions/{extension}/{version}/{type}", api.assetRedirect)
 	r.Get("/api/publishers/{publisher}/vsextensions/{extension}/{version}/{type}", api.assetRedirect)
 
+	// The extensions control manifest lists deprecated and malicious extensions.
+	// VS Code fetches it from the gallery's `controlUrl`.
+	r.Get("/extensions/control", api.extensionsControl)
+
 	// Return the specified extension with only the latest version included.
 	r.Get("/api/vscode/{publisher}/{extension}/latest", api.latestExtension)
 
@@ -148,9 +277,143 @@ func New(options *Options) *API {
 		httpapi.WriteBytes(rw, http.StatusOK, []byte("Extension stats are not supported"))
 	})
 
+	// Endpoints for managing the marketplace.  These are only enabled when admin
+	// tokens have been configured.
+	if len(options.AdminTokens) > 0 {
+		r.Route(AdminPath, func(r chi.Router) {
+			r.Use(httpmw.Authorize(options.AdminTokens))
+			r.Post("/extensions/{id}/unpublish", api.unpublishExtension)
+			r.Post("/extensions/{id}/republish", api.republishExtension)
+			r.Post("/extensions/{id}/feature", api.featureExtension)
+			r.Post("/extensions/{id}/unfeature", api.unfeatureExtension)
+			r.Delete("/extensions/{id}", api.removeExtension)
+			r.Get("/pending", api.listPending)
+			r.Post("/pending", api.submitPending)
+			r.Post("/pending/{id}/approve", api.approvePending)
+			r.Post("/pending/{id}/reject", api.rejectPending)
+		})
+	}
+
 	return api
 }
 
+// convertTotalsToMetadata converts totals into the result count followed by the
+// category and target platform facets, if there are any.  Facet items are
+// sorted by name so responses are stable.
+func convertTotalsToMetadata(totals *database.Totals) []ResultMetadata {
+	metadata := []ResultMetadata{{
+		Type: "ResultCount",
+		Items: []ResultMetadataItem{{
+			Count: totals.Count,
+			Name:  "TotalCount",
+		}},
+	}}
+	facet := func(name string, counts map[string]int) {
+		if len(counts) == 0 {
+			return
+		}
+		items := []ResultMetadataItem{}
+		for _, name := range slices.Sorted(maps.Keys(counts)) {
+			items = append(items, ResultMetadataItem{Count: counts[name], Name: name})
+		}
+		metadata = append(metadata, ResultMetadata{Type: name, Items: items})
+	}
+	facet("Categories", totals.Categories)
+	platforms := map[string]int{}
+	for platform, count := range totals.TargetPlatforms {
+		platforms[string(platform)] = count
+	}
+	facet("TargetPlatforms", platforms)
+	return metadata
+}
+
+// Settings returns the settings currently in effect.
+func (api *API) Settings() Settings {
+	settings := api.settings.Load().settings
+	settings.AdminCors = cloneCors(settings.AdminCors)
+	settings.GalleryCors = cloneCors(settings.GalleryCors)
+	return settings
+}
+
+// UpdateSettings atomically replaces the settings, filling in defaults for
+// zero values.  In-flight requests finish with the previous settings.  Rate
+// limit counts carry over.
+func (api *API) UpdateSettings(settings Settings) {
+	if settings.RateLimit == 0 {
+		settings.RateLimit = RateLimitDefault
+	}
+	if settings.QueryRateLimit == 0 {
+		settings.QueryRateLimit = QueryRateLimitDefault
+	}
+	if settings.DownloadRateLimit == 0 {
+		settings.DownloadRateLimit = DownloadRateLimitDefault
+	}
+	if settings.MaxPageSize == 0 {
+		settings.MaxPageSize = MaxPageSizeDefault
+	}
+	if settings.AdminCors == nil {
+		adminCors := httpmw.AdminCors()
+		settings.AdminCors = &adminCors
+	}
+	if settings.GalleryCors == nil {
+		galleryCors := httpmw.GalleryCors()
+		settings.GalleryCors = &galleryCors
+	}
+	settings.AdminCors = cloneCors(settings.AdminCors)
+	settings.GalleryCors = cloneCors(settings.GalleryCors)
+
+	// CORS goes first so preflight requests are not rate limited and rate
+	// limited responses still have CORS headers.
+	handler := httpmw.RateLimit(httpmw.RateLimitOptions{
+		Limits: map[string]int{
+			defaultBudget:  settings.RateLimit,
+			queryBudget:    settings.QueryRateLimit,
+			downloadBudget: settings.DownloadRateLimit,
+		},
+		Budget:         rateLimitBudget,
+		Tokens:         api.adminTokens,
+		TrustedProxies: api.trustedProxies,
+		Counter:        api.rateLimitCounter,
+		Logger:         api.Logger,
+	})(api.router)
+	admin := httpmw.Cors(*settings.AdminCors)(handler)
+	gallery := httpmw.Cors(*settings.GalleryCors)(handler)
+
+	api.settings.Store(&settingsState{
+		settings: settings,
+		handler: http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == AdminPath || strings.HasPrefix(r.URL.Path, AdminPath+"/") {
+				admin.ServeHTTP(rw, r)
+			} else {
+				gallery.ServeHTTP(rw, r)
+			}
+		}),
+	})
+}
+
+// rateLimitBudget returns the rate limit budget a request counts against.
+// Probes are not limited since they come from the orchestrator.
+func rateLimitBudget(r *http.Request) string {
+	path := r.URL.Path
+	switch {
+	case path == "/livez", path == "/readyz":
+		return ""
+	case path == "/api/extensionquery", strings.HasPrefix(path, "/api/vscode/"):
+		return queryBudget
+	case strings.HasPrefix(path, "/files/"),
+		strings.HasPrefix(path, "/assets/"),
+		strings.Contains(path, "/vsextensions/"):
+		return downloadBudget
+	default:
+		return defaultBudget
+	}
+}
+
+func cloneCors(options *httpmw.CorsOptions) *httpmw.CorsOptions {
+	clone := options.Clone()
+	return &clone
+}
+
 func (api *API) extensionQuery(rw http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -172,57 +435,63 @@ func (api *API) extensionQuery(rw http.ResponseWriter, r *http.Request) {
 	// Validate query sizes.
 	if len(query.Filters) == 0 {
 		query.Filters = append(query.Filters, database.Filter{})
-	} else if len(query.Filters) > 1 {
-		// VS Code always seems to use one filter.
+	} else if len(query.Filters) > api.MaxFilters {
 		httpapi.Write(rw, http.StatusBadRequest, httpapi.ErrorResponse{
 			Message:   "Too many filters",
-			Detail:    "Check that you only have one filter",
+			Detail:    "Check that you have at most " + strconv.Itoa(api.MaxFilters) + " filters",
 			RequestID: httpmw.RequestID(r),
 		})
+		return
 	}
+	maxPageSize := api.Settings().MaxPageSize
 	for _, filter := range query.Filters {
-		if filter.PageSize < 0 || filter.PageSize > api.MaxPageSize {
+		if filter.PageSize < 0 || filter.PageSize > maxPageSize {
 			httpapi.Write(rw, http.StatusBadRequest, httpapi.ErrorResponse{
-				Message:   "The page size must be between 0 and " + strconv.Itoa(api.MaxPageSize),
+				Message:   "The page size must be between 0 and " + strconv.Itoa(maxPageSize),
 				Detail:    "Contact an administrator to increase the page size",
 				RequestID: httpmw.RequestID(r),
 			})
+			return
 		}
 	}
 
 	baseURL := httpapi.RequestBaseURL(r, "/")
 
-	// Each filter gets its own entry in the results.
-	results := []QueryResult{}
-	for _, filter := range query.Filters {
-		extensions, count, err := api.Database.GetExtensions(ctx, filter, query.Flags, baseURL)
-		if err != nil {
-			api.Logger.Error(ctx, "Unable to execute query", slog.Error(err))
-			httpapi.Write(rw, http.StatusInternalServerError, httpapi.ErrorResponse{
-				Message:   "Internal server error while executing query",
-				Detail:    "Contact an administrator with the request ID",
-				RequestID: httpmw.RequestID(r),
-			})
-			return
-		}
-
-		api.Logger.Debug(ctx, "got extensions for filter",
-			slog.F("filter", filter),
-			slog.F("count", count))
-
-		results = append(results, QueryResult{
-			Extensions: extensions,
-			Metadata: []ResultMetadata{{
-				Type: "ResultCount",
-				Items: []ResultMetadataItem{{
-					Count: count,
-					Name:  "TotalCount",
-				}},
-			}},
+	// Each filter gets its own entry in the results, in the same order as the
+	// filters.  Filters are independent so they can run concurrently.
+	results := make([]QueryResult, len(query.Filters))
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.SetLimit(filterConcurrency)
+	for i, filter := range query.Filters {
+		eg.Go(func() error {
+			extensions, totals, err := api.Database.GetExtensions(egCtx, filter, query.Flags, baseURL)
+			if err != nil {
+				return err
+			}
+
+			api.Logger.Debug(ctx, "got extensions for filter",
+				slog.F("filter", filter),
+				slog.F("count", totals.Count))
+
+			results[i] = QueryResult{
+				Extensions: extensions,
+				Metadata:   convertTotalsToMetadata(totals),
+			}
+			return nil
+		})
+	}
+	err := eg.Wait()
+	if err != nil {
+		api.Logger.Error(ctx, "Unable to execute query", slog.Error(err))
+		httpapi.Write(rw, http.StatusInternalServerError, httpapi.ErrorResponse{
+			Message:   "Internal server error while executing query",
+			Detail:    "Contact an administrator with the request ID",
+			RequestID: httpmw.RequestID(r),
 		})
+		return
 	}
 
-	httpapi.Write(rw, http.StatusOK, QueryResponse{Results: results})
+	httpapi.WriteCacheable(rw, r, QueryResponse{Results: results})
 }
 
 func (api *API) assetRedirect(rw http.ResponseWriter, r *http.Request) {
@@ -235,7 +504,7 @@ func (api *API) assetRedirect(rw http.ResponseWriter, r *http.Request) {
 	if version.TargetPlatform == "" {
 		version.TargetPlatform = storage.Platform(r.URL.Query().Get("targetPlatform"))
 	}
-	url, err := api.Database.GetExtensionAssetPath(r.Context(), &database.Asset{
+	location, err := api.Database.GetExtensionAssetPath(r.Context(), &database.Asset{
 		Extension: chi.URLParam(r, "extension"),
 		Publisher: chi.URLParam(r, "publisher"),
 		Type:      assetType,
@@ -257,7 +526,41 @@ func (api *API) assetRedirect(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	http.Redirect(rw, r, url, http.StatusMovedPermanently)
+	// Give the redirect the ETag of the file it points to so clients that
+	// already have that file can skip following it.  Which file an asset
+	// resolves to can change as builds are added, so clients must revalidate.
+	if u, err := url.Parse(location); err == nil {
+		etag, err := storage.FileETag(r.Context(), api.Storage, strings.TrimPrefix(u.Path, "/files"))
+		if err != nil {
+			api.Logger.Warn(r.Context(), "Unable to read checksums", slog.Error(err))
+		} else if etag != "" {
+			rw.Header().Set("ETag", etag)
+			rw.Header().Set("Cache-Control", httpcache.RevalidateCacheControl)
+			// The location is built from the request's base URL.
+			rw.Header().Set("Vary", httpapi.BaseURLVary)
+			if httpcache.ETagMatches(r, etag) {
+				rw.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+	}
+
+	http.Redirect(rw, r, location, http.StatusMovedPermanently)
+}
+
+func (api *API) extensionsControl(rw http.ResponseWriter, r *http.Request) {
+	manifest, err := storage.ReadControlManifest(r.Context(), api.Storage)
+	if err != nil {
+		api.Logger.Error(r.Context(), "Unable to read control manifest", slog.Error(err))
+		httpapi.Write(rw, http.StatusInternalServerError, httpapi.ErrorResponse{
+			Message:   "Unable to read extensions control manifest",
+			Detail:    "Contact an administrator with the request ID",
+			RequestID: httpmw.RequestID(r),
+		})
+		return
+	}
+
+	httpapi.WriteCacheable(rw, r, manifest)
 }
 
 func (api *API) latestExtension(rw http.ResponseWriter, r *http.Request) {
@@ -302,5 +605,5 @@ func (api *API) latestExtension(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	httpapi.Write(rw, http.StatusOK, extensions[0])
+	httpapi.WriteCacheable(rw, r, extensions[0])
 }
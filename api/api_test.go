@@ -2,11 +2,13 @@ package api_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"strings"
 	"testing"
 
@@ -16,7 +18,10 @@ import (
 	"cdr.dev/slog/sloggers/slogtest"
 	"github.com/coder/code-marketplace/api"
 	"github.com/coder/code-marketplace/api/httpapi"
+	"github.com/coder/code-marketplace/api/httpmw"
 	"github.com/coder/code-marketplace/database"
+	"github.com/coder/code-marketplace/httpcache"
+	"github.com/coder/code-marketplace/storage"
 	"github.com/coder/code-marketplace/testutil"
 )
 
@@ -26,10 +31,29 @@ func TestAPI(t *testing.T) {
 	exts := []*database.Extension{}
 	for i := range 10 {
 		exts = append(exts, &database.Extension{
-			ID: fmt.Sprintf("extension-%d", i),
+			ID:         fmt.Sprintf("extension-%d", i),
+			Categories: []string{[]string{"Themes", "Other"}[i%2]},
 		})
 	}
 
+	// The metadata for a query that returns every extension.
+	allMetadata := []api.ResultMetadata{{
+		Type: "ResultCount",
+		Items: []api.ResultMetadataItem{{
+			Count: len(exts),
+			Name:  "TotalCount",
+		}},
+	}, {
+		Type: "Categories",
+		Items: []api.ResultMetadataItem{{
+			Count: 5,
+			Name:  "Other",
+		}, {
+			Count: 5,
+			Name:  "Themes",
+		}},
+	}}
+
 	cases := []struct {
 		Name     string
 		Path     string
@@ -101,13 +125,57 @@ func TestAPI(t *testing.T) {
 		{
 			Name:   "ManyQueries",
 			Path:   "/api/extensionquery",
+			Status: http.StatusOK,
+			Request: &api.QueryRequest{
+				Filters: []database.Filter{{
+					Criteria: []database.Criteria{{
+						Type:  database.Target,
+						Value: "Microsoft.VisualStudio.Code",
+					}},
+				}, {
+					Criteria: []database.Criteria{{
+						Type:  database.Target,
+						Value: "Microsoft.VisualStudio.Code",
+					}, {
+						Type:  database.ExtensionName,
+						Value: "foo",
+					}},
+				}, {}},
+			},
+			Response: &api.QueryResponse{
+				Results: []api.QueryResult{{
+					Extensions: exts,
+					Metadata:   allMetadata,
+				}, {
+					Extensions: exts[:1],
+					Metadata: []api.ResultMetadata{{
+						Type: "ResultCount",
+						Items: []api.ResultMetadataItem{{
+							Count: 1,
+							Name:  "TotalCount",
+						}},
+					}},
+				}, {
+					Metadata: []api.ResultMetadata{{
+						Type: "ResultCount",
+						Items: []api.ResultMetadataItem{{
+							Count: 0,
+							Name:  "TotalCount",
+						}},
+					}},
+				}},
+			},
+		},
+		{
+			Name:   "TooManyQueries",
+			Path:   "/api/extensionquery",
 			Status: http.StatusBadRequest,
 			Request: &api.QueryRequest{
-				Filters: make([]database.Filter, 2),
+				Filters: make([]database.Filter, api.MaxFiltersDefault+1),
 			},
 			Response: &httpapi.ErrorResponse{
 				Message: "Too many filters",
-				Detail:  "Check that you only have one filter",
+				Detail:  "Check that you have at most 10 filters",
 			},
 		},
 		{
@@ -124,6 +192,22 @@ func TestAPI(t *testing.T) {
 				Detail:  "Contact an administrator to increase the page size",
 			},
 		},
+		{
+			Name:   "HugePagesSecondFilter",
+			Path:   "/api/extensionquery",
+			Status: http.StatusBadRequest,
+			Request: &api.QueryRequest{
+				Filters: []database.Filter{{
+					PageSize: 50,
+				}, {
+					PageSize: 500,
+				}},
+			},
+			Response: &httpapi.ErrorResponse{
+				Message: "The page size must be between 0 and 200",
+				Detail:  "Contact an administrator to increase the page size",
+			},
+		},
 		{
 			Name:   "DBError",
 			Path:   "/api/extensionquery",
@@ -154,13 +238,7 @@ func TestAPI(t *testing.T) {
 			Response: &api.QueryResponse{
 				Results: []api.QueryResult{{
 					Extensions: exts,
-					Metadata: []api.ResultMetadata{{
-						Type: "ResultCount",
-						Items: []api.ResultMetadataItem{{
-							Count: len(exts),
-							Name:  "TotalCount",
-						}},
-					}},
+					Metadata:   allMetadata,
 				}},
 			},
 		},
@@ -251,6 +329,12 @@ func TestAPI(t *testing.T) {
 			Response: "/files/publisher/extension/version/extension.vsix",
 			Method:   http.MethodGet,
 		},
+		{
+			Name:     "ExtensionsControl",
+			Path:     "/extensions/control",
+			Status:   http.StatusOK,
+			Response: &storage.ControlManifest{Malicious: []string{}},
+		},
 		{
 			Name:   "Item",
 			Path:   "/item",
@@ -354,6 +438,11 @@ func TestAPI(t *testing.T) {
 					b, err := io.ReadAll(resp.Body)
 					require.NoError(t, err)
 					require.Equal(t, a, string(b))
+				} else if _, aok := c.Response.(*storage.ControlManifest); aok {
+					var body storage.ControlManifest
+					err := json.NewDecoder(resp.Body).Decode(&body)
+					require.NoError(t, err)
+					require.Equal(t, c.Response, &body)
 				} else if _, aok := c.Response.(*database.Extension); aok {
 					var body database.Extension
 					err := json.NewDecoder(resp.Body).Decode(&body)
@@ -369,3 +458,291 @@ func TestAPI(t *testing.T) {
 		})
 	}
 }
+
+func TestCaching(t *testing.T) {
+	t.Parallel()
+
+	logger := slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}).Leveled(slog.LevelDebug)
+	store, err := storage.NewLocalStorage(&storage.LocalOptions{ExtDir: t.TempDir()}, logger)
+	require.NoError(t, err)
+	ext := testutil.Extensions[0]
+	version := storage.Version{Version: "1.0.0"}
+	manifest := testutil.ConvertExtensionToManifest(ext, version)
+	vsix := testutil.CreateVSIXFromManifest(t, manifest)
+	_, err = store.AddExtension(context.Background(), manifest, vsix)
+	require.NoError(t, err)
+
+	apiServer := api.New(&api.Options{
+		Database: &database.NoDB{Storage: store, Logger: logger},
+		Storage:  store,
+		Logger:   logger,
+	})
+	server := httptest.NewServer(apiServer.Handler)
+	t.Cleanup(server.Close)
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	do := func(method, path, ifNoneMatch string, body []byte) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, bytes.NewReader(body))
+		require.NoError(t, err)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = resp.Body.Close()
+		})
+		return resp
+	}
+
+	t.Run("Query", func(t *testing.T) {
+		t.Parallel()
+
+		query, err := json.Marshal(&api.QueryRequest{
+			Filters: []database.Filter{{
+				Criteria: []database.Criteria{{Type: database.Target, Value: "Microsoft.VisualStudio.Code"}},
+				PageSize: 10,
+			}},
+		})
+		require.NoError(t, err)
+
+		resp := do(http.MethodPost, "/api/extensionquery", "", query)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		etag := resp.Header.Get("ETag")
+		require.NotEmpty(t, etag)
+		require.Equal(t, httpcache.RevalidateCacheControl, resp.Header.Get("Cache-Control"))
+		require.Equal(t, httpapi.BaseURLVary, resp.Header.Get("Vary"))
+
+		// The same query should produce the same ETag.
+		resp = do(http.MethodPost, "/api/extensionquery", "", query)
+		require.Equal(t, etag, resp.Header.Get("ETag"))
+
+		// Queries are POSTs, which are never answered with a 304.
+		resp = do(http.MethodPost, "/api/extensionquery", etag, query)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NotEmpty(t, b)
+	})
+
+	t.Run("Assets", func(t *testing.T) {
+		t.Parallel()
+
+		vsixPath := fmt.Sprintf("/files/%s/%s/%s/%s.vsix", ext.Publisher, ext.Name, version, storage.ExtensionVSIXNameFromManifest(manifest))
+		resp := do(http.MethodGet, vsixPath, "", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		etag := resp.Header.Get("ETag")
+		require.Equal(t, httpcache.ContentETag(vsix), etag)
+		require.Equal(t, httpcache.RevalidateCacheControl, resp.Header.Get("Cache-Control"))
+
+		resp = do(http.MethodGet, vsixPath, etag, nil)
+		require.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+		assetPath := fmt.Sprintf("/assets/%s/%s/%s/vspackage", ext.Publisher, ext.Name, version)
+		resp = do(http.MethodGet, assetPath, "", nil)
+		require.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+		require.Equal(t, etag, resp.Header.Get("ETag"))
+		require.Equal(t, httpcache.RevalidateCacheControl, resp.Header.Get("Cache-Control"))
+		require.Equal(t, httpapi.BaseURLVary, resp.Header.Get("Vary"))
+
+		resp = do(http.MethodGet, assetPath, etag, nil)
+		require.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+		resp = do(http.MethodGet, assetPath, `"other"`, nil)
+		require.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+	})
+}
+
+func TestUpdateSettings(t *testing.T) {
+	t.Parallel()
+
+	logger := slogtest.Make(t, &slogtest.Options{IgnoreErrors: true})
+	apiServer := api.New(&api.Options{
+		Database:       testutil.NewMockDB(nil),
+		Storage:        testutil.NewMockStorage(),
+		Logger:         logger,
+		MaxPageSize:    10,
+		QueryRateLimit: 2,
+	})
+	server := httptest.NewServer(apiServer.Handler)
+	t.Cleanup(server.Close)
+
+	query := func(pageSize int) int {
+		body, err := json.Marshal(&database.Filter{PageSize: pageSize})
+		require.NoError(t, err)
+		body = []byte(`{"filters":[` + string(body) + `]}`)
+		resp, err := http.Post(server.URL+"/api/extensionquery", "application/json", bytes.NewReader(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	get := func(origin string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/healthz", nil)
+		require.NoError(t, err)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	require.Equal(t, http.StatusBadRequest, query(20))
+	require.Equal(t, http.StatusOK, query(10))
+
+	// Raising the page size applies to the next query without disturbing the
+	// rate limit counts.
+	apiServer.UpdateSettings(api.Settings{MaxPageSize: 20, QueryRateLimit: 2})
+	require.Equal(t, 20, apiServer.Settings().MaxPageSize)
+	require.Equal(t, http.StatusTooManyRequests, query(20))
+
+	// Raising the rate limit keeps the counts.
+	apiServer.UpdateSettings(api.Settings{MaxPageSize: 20, QueryRateLimit: 4})
+	require.Equal(t, http.StatusOK, query(20))
+	require.Equal(t, http.StatusTooManyRequests, query(20))
+
+	apiServer.UpdateSettings(api.Settings{MaxPageSize: 20, QueryRateLimit: -1})
+	for i := 0; i < 5; i++ {
+		require.Equal(t, http.StatusOK, query(20))
+	}
+
+	require.Equal(t, "*", get("https://code.example.com").Header.Get("Access-Control-Allow-Origin"))
+	apiServer.UpdateSettings(api.Settings{
+		GalleryCors: &httpmw.CorsOptions{AllowedOrigins: []string{"https://other.example.com"}},
+		RateLimit:   -1,
+	})
+	require.Empty(t, get("https://code.example.com").Header.Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "https://other.example.com", get("https://other.example.com").Header.Get("Access-Control-Allow-Origin"))
+
+	// Zero values get the defaults.
+	require.Equal(t, api.MaxPageSizeDefault, apiServer.Settings().MaxPageSize)
+}
+
+func TestCorsGroups(t *testing.T) {
+	t.Parallel()
+
+	logger := slogtest.Make(t, &slogtest.Options{IgnoreErrors: true})
+	apiServer := api.New(&api.Options{
+		AdminTokens: map[string]string{"token": "admin"},
+		Database:    testutil.NewMockDB(nil),
+		Storage:     testutil.NewMockStorage(),
+		Logger:      logger,
+		RateLimit:   -1,
+	})
+	server := httptest.NewServer(apiServer.Handler)
+	t.Cleanup(server.Close)
+
+	do := func(method, path, origin string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, nil)
+		require.NoError(t, err)
+		req.Header.Set(httpmw.OriginHeader, origin)
+		if method == http.MethodOptions {
+			req.Header.Set(httpmw.AccessControlRequestMethodHeader, http.MethodPost)
+			req.Header.Set(httpmw.AccessControlRequestHeadersHeader, "Authorization")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	// By default the gallery allows every origin and the admin API none.
+	resp := do(http.MethodGet, "/healthz", "https://code.example.com")
+	require.Equal(t, "*", resp.Header.Get(httpmw.AccessControlAllowOriginHeader))
+	require.Equal(t, "true", resp.Header.Get(httpmw.AccessControlAllowCredentialsHeader))
+	resp = do(http.MethodOptions, "/api/admin/extensions/foo.bar/unpublish", "https://code.example.com")
+	require.Empty(t, resp.Header.Get(httpmw.AccessControlAllowOriginHeader))
+
+	settings := api.Settings{
+		AdminCors: &httpmw.CorsOptions{
+			AllowedOrigins: []string{"https://*.admin.example.com"},
+			AllowedMethods: []string{http.MethodPost},
+			AllowedHeaders: []string{"Authorization"},
+		},
+		GalleryCors: &httpmw.CorsOptions{AllowedOrigins: []string{"https://code.example.com"}},
+		RateLimit:   -1,
+	}
+	apiServer.UpdateSettings(settings)
+
+	resp = do(http.MethodOptions, "/api/admin/extensions/foo.bar/unpublish", "https://ui.admin.example.com")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "https://ui.admin.example.com", resp.Header.Get(httpmw.AccessControlAllowOriginHeader))
+	require.Equal(t, http.MethodPost, resp.Header.Get(httpmw.AccessControlAllowMethodsHeader))
+	require.Empty(t, resp.Header.Get(httpmw.AccessControlAllowCredentialsHeader))
+	resp = do(http.MethodOptions, "/api/admin/extensions/foo.bar/unpublish", "https://code.example.com")
+	require.Empty(t, resp.Header.Get(httpmw.AccessControlAllowOriginHeader))
+
+	// Gallery origins do not apply to the admin API and the other way around.
+	resp = do(http.MethodGet, "/", "https://ui.admin.example.com")
+	require.Empty(t, resp.Header.Get(httpmw.AccessControlAllowOriginHeader))
+	resp = do(http.MethodGet, "/healthz", "https://code.example.com")
+	require.Equal(t, "https://code.example.com", resp.Header.Get(httpmw.AccessControlAllowOriginHeader))
+
+	// Rate limited responses still have CORS headers so browsers can read them.
+	settings.RateLimit = 1
+	apiServer.UpdateSettings(settings)
+	resp = do(http.MethodGet, "/healthz", "https://code.example.com")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = do(http.MethodGet, "/healthz", "https://code.example.com")
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	require.Equal(t, "https://code.example.com", resp.Header.Get(httpmw.AccessControlAllowOriginHeader))
+}
+
+func TestRateLimitBudgets(t *testing.T) {
+	t.Parallel()
+
+	logger := slogtest.Make(t, &slogtest.Options{IgnoreErrors: true})
+	apiServer := api.New(&api.Options{
+		AdminTokens:       map[string]string{"token": "admin"},
+		Database:          testutil.NewMockDB(nil),
+		Storage:           testutil.NewMockStorage(),
+		Logger:            logger,
+		RateLimit:         1,
+		QueryRateLimit:    1,
+		DownloadRateLimit: 2,
+		TrustedProxies:    []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")},
+	})
+	server := httptest.NewServer(apiServer.Handler)
+	t.Cleanup(server.Close)
+
+	// Redirects would count as another request.
+	httpClient := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	do := func(method, path, client, token string) int {
+		req, err := http.NewRequest(method, server.URL+path, nil)
+		require.NoError(t, err)
+		req.Header.Set(httpapi.XForwardedForHeader, client)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := httpClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Each budget is separate and shared by every route in it.
+	client := "192.0.2.1"
+	require.Equal(t, http.StatusOK, do(http.MethodPost, "/api/extensionquery", client, ""))
+	require.Equal(t, http.StatusTooManyRequests, do(http.MethodGet, "/api/vscode/foo/bar/latest", client, ""))
+	require.NotEqual(t, http.StatusTooManyRequests, do(http.MethodGet, "/files/foo/bar/1.0.0/icon.png", client, ""))
+	require.NotEqual(t, http.StatusTooManyRequests, do(http.MethodGet, "/assets/foo/bar/1.0.0/vspackage", client, ""))
+	require.Equal(t, http.StatusTooManyRequests, do(http.MethodGet, "/api/publishers/foo/vsextensions/bar/1.0.0/vspackage", client, ""))
+	require.Equal(t, http.StatusOK, do(http.MethodGet, "/healthz", client, ""))
+	require.Equal(t, http.StatusTooManyRequests, do(http.MethodGet, "/", client, ""))
+
+	// Other clients behind the trusted proxy have their own counts.
+	require.Equal(t, http.StatusOK, do(http.MethodGet, "/healthz", "192.0.2.2", ""))
+
+	// Admin requests count against their token instead of their IP.
+	require.Equal(t, http.StatusOK, do(http.MethodGet, "/api/admin/pending", client, "token"))
+	require.Equal(t, http.StatusTooManyRequests, do(http.MethodGet, "/api/admin/pending", "192.0.2.3", "token"))
+}
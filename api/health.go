@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"cdr.dev/slog"
+	"github.com/coder/code-marketplace/api/httpapi"
+	"github.com/coder/code-marketplace/api/httpmw"
+	"github.com/coder/code-marketplace/storage"
+)
+
+// Health statuses.
+const (
+	HealthOK          = "ok"
+	HealthUnavailable = "unavailable"
+)
+
+// healthTimeout bounds how long each component has to report its health.
+const healthTimeout = 5 * time.Second
+
+// Health checks are public, and their errors can include internal details like
+// storage URLs and paths, so responses only carry these generic reasons.  The
+// full errors are logged.
+const (
+	healthReasonTimeout     = "the health check timed out"
+	healthReasonUnavailable = "the component is not ready, see the server logs for details"
+	seedReasonFailed        = "the extensions could not be listed, see the server logs for details"
+)
+
+// HealthResponse is the response to liveness and readiness checks.
+type HealthResponse struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentHealth `json:"components,omitempty"`
+}
+
+// ComponentHealth is the health of a single component.  Error is a generic
+// reason an unavailable component is not ready.
+type ComponentHealth struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// livez reports that the server is running.  It does not check any components
+// since restarting the server will not fix them.
+func livez(rw http.ResponseWriter, r *http.Request) {
+	writeHealth(rw, HealthResponse{Status: HealthOK})
+}
+
+// readyz reports whether the storage and database are ready to serve requests.
+func (api *API) readyz(rw http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+
+	checks := map[string]func(context.Context) error{
+		"storage":  api.Storage.Health,
+		"database": api.Database.Health,
+	}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	components := map[string]ComponentHealth{}
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			health := ComponentHealth{Status: HealthOK}
+			if err := check(ctx); err != nil {
+				api.Logger.Warn(ctx, "Component is not ready", slog.F("component", name), slog.Error(err))
+				reason := healthReasonUnavailable
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					reason = healthReasonTimeout
+				}
+				health = ComponentHealth{Status: HealthUnavailable, Error: reason}
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			components[name] = health
+		}()
+	}
+	wg.Wait()
+
+	writeHealth(rw, HealthResponse{Status: overallHealth(components), Components: components})
+}
+
+// seedStatus reports the progress of seeding the storage's manifest cache.
+func (api *API) seedStatus(rw http.ResponseWriter, r *http.Request) {
+	status := storage.SeedProgress(api.Storage)
+	if status == nil {
+		httpapi.Write(rw, http.StatusNotFound, httpapi.ErrorResponse{
+			Message:   "Storage does not have a cache to seed",
+			Detail:    "Manifests are read directly from storage",
+			RequestID: httpmw.RequestID(r),
+		})
+		return
+	}
+	// The server logs the full error each time seeding fails.
+	response := *status
+	if response.Error != "" {
+		response.Error = seedReasonFailed
+	}
+	rw.Header().Set("Cache-Control", "no-store")
+	httpapi.Write(rw, http.StatusOK, response)
+}
+
+// overallHealth is ok when every component is ok.
+func overallHealth(components map[string]ComponentHealth) string {
+	for _, component := range components {
+		if component.Status != HealthOK {
+			return HealthUnavailable
+		}
+	}
+	return HealthOK
+}
+
+// writeHealth writes the health response with a 503 status when it is not ok.
+// Health responses are never cached.
+func writeHealth(rw http.ResponseWriter, response HealthResponse) {
+	status := http.StatusOK
+	if response.Status != HealthOK {
+		status = http.StatusServiceUnavailable
+	}
+	rw.Header().Set("Cache-Control", "no-store")
+	httpapi.Write(rw, status, response)
+}
+
+// Starting returns a handler to serve while the server is starting up, before
+// the API has been created.  It is live but not ready, and every other route
+// is unavailable.
+func Starting() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/livez":
+			livez(rw, r)
+		case "/healthz":
+			httpapi.WriteBytes(rw, http.StatusOK, []byte("API server running"))
+		case "/readyz":
+			writeHealth(rw, HealthResponse{
+				Status: HealthUnavailable,
+				Components: map[string]ComponentHealth{
+					"server": {Status: HealthUnavailable, Error: "the server is starting"},
+				},
+			})
+		default:
+			rw.Header().Set("Retry-After", "5")
+			httpapi.Write(rw, http.StatusServiceUnavailable, httpapi.ErrorResponse{
+				Message: "The marketplace is starting",
+				Detail:  "Please try again shortly",
+			})
+		}
+	})
+}
@@ -0,0 +1,204 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog/sloggers/slogtest"
+	"github.com/coder/code-marketplace/api"
+	"github.com/coder/code-marketplace/storage"
+	"github.com/coder/code-marketplace/testutil"
+)
+
+func TestHealth(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		path        string
+		storageErr  error
+		databaseErr error
+		status      int
+		response    api.HealthResponse
+	}{
+		{
+			name:     "Livez",
+			path:     "/livez",
+			status:   http.StatusOK,
+			response: api.HealthResponse{Status: api.HealthOK},
+		},
+		{
+			name:        "LivezUnready",
+			path:        "/livez",
+			storageErr:  xerrors.New("storage is down"),
+			databaseErr: xerrors.New("index is building"),
+			status:      http.StatusOK,
+			response:    api.HealthResponse{Status: api.HealthOK},
+		},
+		{
+			name:   "Readyz",
+			path:   "/readyz",
+			status: http.StatusOK,
+			response: api.HealthResponse{
+				Status: api.HealthOK,
+				Components: map[string]api.ComponentHealth{
+					"storage":  {Status: api.HealthOK},
+					"database": {Status: api.HealthOK},
+				},
+			},
+		},
+		{
+			name:       "StorageUnavailable",
+			path:       "/readyz",
+			storageErr: xerrors.New("storage is down"),
+			status:     http.StatusServiceUnavailable,
+			response: api.HealthResponse{
+				Status: api.HealthUnavailable,
+				Components: map[string]api.ComponentHealth{
+					"storage":  {Status: api.HealthUnavailable, Error: "the component is not ready, see the server logs for details"},
+					"database": {Status: api.HealthOK},
+				},
+			},
+		},
+		{
+			name:        "DatabaseUnavailable",
+			path:        "/readyz",
+			databaseErr: xerrors.New("index is building"),
+			status:      http.StatusServiceUnavailable,
+			response: api.HealthResponse{
+				Status: api.HealthUnavailable,
+				Components: map[string]api.ComponentHealth{
+					"storage":  {Status: api.HealthOK},
+					"database": {Status: api.HealthUnavailable, Error: "the component is not ready, see the server logs for details"},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := testutil.NewMockStorage()
+			store.HealthError = test.storageErr
+			db := testutil.NewMockDB(nil)
+			db.HealthError = test.databaseErr
+			apiServer := api.New(&api.Options{
+				Database: db,
+				Storage:  store,
+				Logger:   slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}),
+				// Probes are never rate limited.
+				RateLimit: 1,
+			})
+
+			for i := 0; i < 3; i++ {
+				rec := httptest.NewRecorder()
+				apiServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.path, nil))
+				resp := rec.Result()
+				defer resp.Body.Close()
+
+				require.Equal(t, test.status, resp.StatusCode)
+				require.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+				var health api.HealthResponse
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&health))
+				require.Equal(t, test.response, health)
+			}
+		})
+	}
+
+	t.Run("Leak", func(t *testing.T) {
+		t.Parallel()
+
+		// Internal details in errors stay out of the public response.
+		store := testutil.NewMockStorage()
+		store.HealthError = xerrors.New("GET https://artifactory.internal/api/repo: 401")
+		apiServer := api.New(&api.Options{
+			Database: testutil.NewMockDB(nil),
+			Storage:  store,
+			Logger:   slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}),
+		})
+		rec := httptest.NewRecorder()
+		apiServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		require.NotContains(t, rec.Body.String(), "artifactory.internal")
+	})
+}
+
+func TestStarting(t *testing.T) {
+	t.Parallel()
+
+	handler := api.Starting()
+	do := func(path string) *http.Response {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Result()
+	}
+
+	resp := do("/livez")
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = do("/healthz")
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = do("/readyz")
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	var health api.HealthResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&health))
+	require.Equal(t, api.HealthUnavailable, health.Status)
+	require.Equal(t, api.HealthUnavailable, health.Components["server"].Status)
+
+	resp = do("/api/extensionquery")
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.NotEmpty(t, resp.Header.Get("Retry-After"))
+}
+
+func TestSeedStatus(t *testing.T) {
+	t.Parallel()
+
+	store := testutil.NewMockStorage()
+	apiServer := api.New(&api.Options{
+		Database: testutil.NewMockDB(nil),
+		Storage:  store,
+		Logger:   slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}),
+	})
+	do := func() *http.Response {
+		rec := httptest.NewRecorder()
+		apiServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status/seed", nil))
+		return rec.Result()
+	}
+
+	// Storage without a cache has nothing to report.
+	resp := do()
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	store.Seeding = &storage.SeedStatus{State: storage.Seeding, Total: 10, Seeded: 4, Errors: 1}
+	resp = do()
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+	var status storage.SeedStatus
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+	require.Equal(t, *store.Seeding, status)
+
+	// Failures report a generic reason instead of the error.
+	store.Seeding = &storage.SeedStatus{State: storage.SeedFailed, Errors: 1, Error: "GET https://artifactory.internal/api/repo: 401"}
+	resp = do()
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	status = storage.SeedStatus{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+	require.Equal(t, storage.SeedFailed, status.State)
+	require.NotEmpty(t, status.Error)
+	require.NotContains(t, status.Error, "artifactory.internal")
+}
@@ -0,0 +1,40 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/coder/code-marketplace/httpcache"
+)
+
+// BaseURLVary lists the request headers RequestBaseURL reads.  Responses that
+// include URLs built from the request's base URL must vary on them so shared
+// caches do not serve URLs meant for one host to another.
+var BaseURLVary = strings.Join([]string{ForwardedHeader, XForwardedProtoHeader, XForwardedHostHeader}, ", ")
+
+// WriteCacheable writes a successful JSON response with an ETag of its
+// content, or responds with 304 Not Modified if the request already has it.
+// Identical responses always get identical ETags.  Responses can include URLs
+// built from the request's base URL, so they vary on BaseURLVary.
+func WriteCacheable(rw http.ResponseWriter, r *http.Request, response interface{}) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(true)
+	err := enc.Encode(response)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	etag := httpcache.ContentETag(buf.Bytes())
+	rw.Header().Set("ETag", etag)
+	rw.Header().Set("Cache-Control", httpcache.RevalidateCacheControl)
+	rw.Header().Set("Vary", BaseURLVary)
+	if httpcache.ETagMatches(r, etag) {
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	WriteBytes(rw, http.StatusOK, buf.Bytes())
+}
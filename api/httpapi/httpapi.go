@@ -3,7 +3,9 @@ package httpapi
 import (
 	"bytes"
 	"encoding/json"
+	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"strings"
 
@@ -42,6 +44,7 @@ func Write(rw http.ResponseWriter, status int, response interface{}) {
 
 const (
 	ForwardedHeader       = "Forwarded"
+	XForwardedForHeader   = "X-Forwarded-For"
 	XForwardedHostHeader  = "X-Forwarded-Host"
 	XForwardedProtoHeader = "X-Forwarded-Proto"
 )
@@ -84,3 +87,66 @@ func RequestBaseURL(r *http.Request, basePath string) url.URL {
 		Path:   strings.TrimRight(basePath, "/"),
 	}
 }
+
+// ClientIP returns the IP of the client that made the request.  When the
+// request comes from one of the trusted proxies the Forwarded header, or
+// X-Forwarded-For if there is no Forwarded header, is used to find the client:
+// it is the last address in the chain that is not a trusted proxy.  Unknown or
+// obfuscated addresses end the chain.  The zero address is returned if the
+// remote address cannot be parsed.
+func ClientIP(r *http.Request, trustedProxies []netip.Prefix) netip.Addr {
+	trusted := func(addr netip.Addr) bool {
+		for _, prefix := range trustedProxies {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	client, ok := parseNode(r.RemoteAddr)
+	if !ok || !trusted(client) {
+		return client
+	}
+
+	var chain []string
+	if forwarded := r.Header.Values(ForwardedHeader); len(forwarded) > 0 {
+		// for=<identifier>;proto=<http|https>, for=<identifier>
+		for _, element := range strings.Split(strings.Join(forwarded, ","), ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, _ := strings.Cut(pair, "=")
+				if strings.EqualFold(strings.TrimSpace(key), "for") {
+					chain = append(chain, value)
+				}
+			}
+		}
+	} else {
+		chain = strings.Split(strings.Join(r.Header.Values(XForwardedForHeader), ","), ",")
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, ok := parseNode(chain[i])
+		if !ok {
+			break
+		}
+		client = addr
+		if !trusted(addr) {
+			break
+		}
+	}
+	return client
+}
+
+// parseNode parses an address that may have a port and may be quoted or in
+// brackets, as in the Forwarded header.
+func parseNode(node string) (netip.Addr, bool) {
+	node = strings.Trim(strings.TrimSpace(node), `"`)
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		node = host
+	}
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(node, "["), "]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"net/url"
 	"testing"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/coder/code-marketplace/api/httpapi"
+	"github.com/coder/code-marketplace/httpcache"
 )
 
 type TestResponse struct {
@@ -87,3 +89,136 @@ func TestBaseURL(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, *url, httpapi.RequestBaseURL(r, "/quirk/bling"))
 }
+
+func TestClientIP(t *testing.T) {
+	t.Parallel()
+
+	proxies := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("fd00::/8"),
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		xff        []string
+		expected   string
+	}{
+		{
+			name:       "Direct",
+			remoteAddr: "192.0.2.1:1234",
+			expected:   "192.0.2.1",
+		},
+		{
+			name:       "UntrustedProxy",
+			remoteAddr: "192.0.2.1:1234",
+			xff:        []string{"198.51.100.1"},
+			expected:   "192.0.2.1",
+		},
+		{
+			name:       "TrustedProxyWithoutHeaders",
+			remoteAddr: "10.0.0.1:1234",
+			expected:   "10.0.0.1",
+		},
+		{
+			name:       "XForwardedFor",
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"198.51.100.1, 10.0.0.2"},
+			expected:   "198.51.100.1",
+		},
+		{
+			// Clients can send their own X-Forwarded-For so only the addresses
+			// added by trusted proxies can be believed.
+			name:       "SpoofedXForwardedFor",
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"203.0.113.1", "198.51.100.1, 10.0.0.2"},
+			expected:   "198.51.100.1",
+		},
+		{
+			name:       "AllTrusted",
+			remoteAddr: "10.0.0.1:1234",
+			xff:        []string{"10.0.0.3, 10.0.0.2"},
+			expected:   "10.0.0.3",
+		},
+		{
+			name:       "Forwarded",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  `for="[2001:db8::1]:4711";proto=https, for=10.0.0.2`,
+			xff:        []string{"198.51.100.1"},
+			expected:   "2001:db8::1",
+		},
+		{
+			name:       "ForwardedObfuscated",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  "for=_hidden, for=10.0.0.2",
+			expected:   "10.0.0.2",
+		},
+		{
+			name:       "IPv6Proxy",
+			remoteAddr: "[fd00::1]:1234",
+			xff:        []string{"::ffff:198.51.100.1"},
+			expected:   "198.51.100.1",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = test.remoteAddr
+			if test.forwarded != "" {
+				r.Header.Set(httpapi.ForwardedHeader, test.forwarded)
+			}
+			for _, xff := range test.xff {
+				r.Header.Add(httpapi.XForwardedForHeader, xff)
+			}
+			require.Equal(t, test.expected, httpapi.ClientIP(r, proxies).String())
+		})
+	}
+}
+
+func TestWriteCacheable(t *testing.T) {
+	t.Parallel()
+
+	write := func(message string, ifNoneMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rw := httptest.NewRecorder()
+		httpapi.WriteCacheable(rw, r, TestResponse{Message: message})
+		return rw
+	}
+
+	rw := write("foo", "")
+	require.Equal(t, http.StatusOK, rw.Code)
+	etag := rw.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	require.Equal(t, httpcache.ContentETag(rw.Body.Bytes()), etag)
+	require.Equal(t, httpcache.RevalidateCacheControl, rw.Header().Get("Cache-Control"))
+	require.Equal(t, "Forwarded, X-Forwarded-Proto, X-Forwarded-Host", rw.Header().Get("Vary"))
+
+	// The same content should always get the same ETag.
+	require.Equal(t, etag, write("foo", "").Header().Get("ETag"))
+	require.NotEqual(t, etag, write("bar", "").Header().Get("ETag"))
+
+	rw = write("foo", etag)
+	require.Equal(t, http.StatusNotModified, rw.Code)
+	require.Empty(t, rw.Body.Bytes())
+	require.Equal(t, etag, rw.Header().Get("ETag"))
+
+	require.Equal(t, "Forwarded, X-Forwarded-Proto, X-Forwarded-Host", rw.Header().Get("Vary"))
+
+	rw = write("bar", etag)
+	require.Equal(t, http.StatusOK, rw.Code)
+
+	// Only GET and HEAD can be answered with a 304.
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("If-None-Match", etag)
+	rw = httptest.NewRecorder()
+	httpapi.WriteCacheable(rw, r, TestResponse{Message: "foo"})
+	require.Equal(t, http.StatusOK, rw.Code)
+	require.NotEmpty(t, rw.Body.Bytes())
+}
@@ -0,0 +1,53 @@
+package httpmw
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/coder/code-marketplace/api/httpapi"
+)
+
+type actorContextKey struct{}
+
+// Actor returns the name of whoever authenticated the request.  It is blank if
+// the request was not authenticated.
+func Actor(r *http.Request) string {
+	actor, _ := r.Context().Value(actorContextKey{}).(string)
+	return actor
+}
+
+// Authorize requires that requests carry a bearer token matching one of the
+// provided tokens, which map to the name of the actor they authenticate.
+func Authorize(tokens map[string]string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if actor, ok := tokenActor(r, tokens); ok {
+				ctx := context.WithValue(r.Context(), actorContextKey{}, actor)
+				next.ServeHTTP(rw, r.WithContext(ctx))
+				return
+			}
+			httpapi.Write(rw, http.StatusUnauthorized, httpapi.ErrorResponse{
+				Message:   "Unauthorized",
+				Detail:    "Provide a valid admin token in the Authorization header",
+				RequestID: RequestID(r),
+			})
+		})
+	}
+}
+
+// tokenActor returns the actor for the bearer token of the request, if it has
+// one of the tokens.
+func tokenActor(r *http.Request, tokens map[string]string) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return "", false
+	}
+	for candidate, actor := range tokens {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(token)) == 1 {
+			return actor, true
+		}
+	}
+	return "", false
+}
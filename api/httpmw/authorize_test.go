@@ -0,0 +1,79 @@
+package httpmw_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/code-marketplace/api/httpmw"
+)
+
+func TestAuthorize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		header string
+		actor  string
+		status int
+	}{
+		{
+			name:   "OK",
+			header: "Bearer secret",
+			actor:  "alice",
+			status: http.StatusOK,
+		},
+		{
+			name:   "OtherToken",
+			header: "Bearer other",
+			actor:  "bob",
+			status: http.StatusOK,
+		},
+		{
+			name:   "WrongToken",
+			header: "Bearer nope",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "NotBearer",
+			header: "Basic secret",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "NoHeader",
+			status: http.StatusUnauthorized,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			rtr := chi.NewRouter()
+			rtr.Use(httpmw.AttachRequestID, httpmw.Authorize(map[string]string{
+				"secret": "alice",
+				"other":  "bob",
+			}))
+			rtr.Get("/", func(rw http.ResponseWriter, r *http.Request) {
+				rw.WriteHeader(http.StatusOK)
+				_, _ = rw.Write([]byte(httpmw.Actor(r)))
+			})
+
+			r := httptest.NewRequest("GET", "/", nil)
+			if test.header != "" {
+				r.Header.Set("Authorization", test.header)
+			}
+			rw := httptest.NewRecorder()
+			rtr.ServeHTTP(rw, r)
+
+			require.Equal(t, test.status, rw.Code)
+			if test.status == http.StatusOK {
+				require.Equal(t, test.actor, rw.Body.String())
+			}
+		})
+	}
+}
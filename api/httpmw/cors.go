@@ -2,6 +2,8 @@ package httpmw
 
 import (
 	"net/http"
+	"slices"
+	"time"
 
 	"github.com/go-chi/cors"
 )
@@ -12,6 +14,7 @@ const (
 	AccessControlAllowCredentialsHeader = "Access-Control-Allow-Credentials"
 	AccessControlAllowMethodsHeader     = "Access-Control-Allow-Methods"
 	AccessControlAllowHeadersHeader     = "Access-Control-Allow-Headers"
+	AccessControlMaxAgeHeader           = "Access-Control-Max-Age"
 	VaryHeader                          = "Vary"
 
 	// Client headers.
@@ -20,8 +23,37 @@ const (
 	AccessControlRequestHeadersHeader = "Access-Control-Request-Headers"
 )
 
-func Cors() func(next http.Handler) http.Handler {
-	return cors.Handler(cors.Options{
+// CorsOptions is the CORS policy for a group of routes.
+type CorsOptions struct {
+	// AllowedOrigins are the origins that can make cross-origin requests.  An
+	// origin may contain one * wildcard, like https://*.example.com, and * alone
+	// allows every origin.  Cross-origin requests are not allowed when empty.
+	AllowedOrigins []string
+	// AllowedMethods are the methods cross-origin requests can use.
+	AllowedMethods []string
+	// AllowedHeaders are the headers cross-origin requests can send.  * allows
+	// every header.
+	AllowedHeaders []string
+	// AllowCredentials lets cross-origin requests include cookies and
+	// authorization headers.
+	AllowCredentials bool
+	// MaxAge is how long browsers can cache the result of a preflight request.
+	// Zero leaves it up to the browser.
+	MaxAge time.Duration
+}
+
+// Clone returns a deep copy of the options.
+func (o CorsOptions) Clone() CorsOptions {
+	o.AllowedOrigins = slices.Clone(o.AllowedOrigins)
+	o.AllowedMethods = slices.Clone(o.AllowedMethods)
+	o.AllowedHeaders = slices.Clone(o.AllowedHeaders)
+	return o
+}
+
+// GalleryCors returns the default policy for the gallery routes, which allows
+// every origin since VS Code and code-server make requests from the browser.
+func GalleryCors() CorsOptions {
+	return CorsOptions{
 		AllowedOrigins: []string{"*"},
 		AllowedMethods: []string{
 			http.MethodHead,
@@ -33,6 +65,39 @@ func Cors() func(next http.Handler) http.Handler {
 		},
 		AllowedHeaders:   []string{"*"},
 		AllowCredentials: true,
-		MaxAge:           300,
+		MaxAge:           5 * time.Minute,
+	}
+}
+
+// AdminCors returns the default policy for the admin routes, which allows no
+// origins.  When origins are allowed the methods and headers are the ones the
+// admin API uses.
+func AdminCors() CorsOptions {
+	return CorsOptions{
+		AllowedMethods: []string{
+			http.MethodGet,
+			http.MethodPost,
+			http.MethodDelete,
+		},
+		AllowedHeaders: []string{"Authorization", "Content-Type"},
+		MaxAge:         5 * time.Minute,
+	}
+}
+
+// Cors handles cross-origin requests according to the policy.  If the policy
+// allows no origins requests pass through without any CORS headers, which
+// makes browsers reject cross-origin responses.
+func Cors(options CorsOptions) func(next http.Handler) http.Handler {
+	if len(options.AllowedOrigins) == 0 {
+		return func(next http.Handler) http.Handler {
+			return next
+		}
+	}
+	return cors.Handler(cors.Options{
+		AllowedOrigins:   options.AllowedOrigins,
+		AllowedMethods:   options.AllowedMethods,
+		AllowedHeaders:   options.AllowedHeaders,
+		AllowCredentials: options.AllowCredentials,
+		MaxAge:           int(options.MaxAge / time.Second),
 	})
 }
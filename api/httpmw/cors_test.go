@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -96,7 +97,7 @@ func TestCors(t *testing.T) {
 					}
 
 					rw := httptest.NewRecorder()
-					handler := httpmw.Cors()(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+					handler := httpmw.Cors(httpmw.GalleryCors())(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 						rw.WriteHeader(http.StatusNoContent)
 					}))
 					handler.ServeHTTP(rw, r)
@@ -121,3 +122,86 @@ func TestCors(t *testing.T) {
 		})
 	}
 }
+
+func TestCorsPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		options httpmw.CorsOptions
+		origin  string
+		method  string
+		// allowedOrigin is the expected Access-Control-Allow-Origin header.
+		allowedOrigin string
+		// preflight is whether a preflight request is answered by the middleware.
+		preflight bool
+		maxAge    string
+	}{
+		{
+			name:          "WildcardSubdomain",
+			options:       httpmw.CorsOptions{AllowedOrigins: []string{"https://*.example.com"}},
+			origin:        "https://code.example.com",
+			allowedOrigin: "https://code.example.com",
+		},
+		{
+			name:    "WildcardSubdomainMismatch",
+			options: httpmw.CorsOptions{AllowedOrigins: []string{"https://*.example.com"}},
+			origin:  "https://example.org",
+		},
+		{
+			name:          "MaxAge",
+			options:       httpmw.CorsOptions{AllowedOrigins: []string{"*"}, MaxAge: time.Hour},
+			origin:        "https://code.example.com",
+			method:        http.MethodOptions,
+			allowedOrigin: "*",
+			preflight:     true,
+			maxAge:        "3600",
+		},
+		{
+			name: "MethodNotAllowed",
+			options: httpmw.CorsOptions{
+				AllowedOrigins: []string{"*"},
+				AllowedMethods: []string{http.MethodPost},
+			},
+			origin:    "https://code.example.com",
+			method:    http.MethodOptions,
+			preflight: true,
+		},
+		{
+			name:    "Disabled",
+			options: httpmw.AdminCors(),
+			origin:  "https://code.example.com",
+			method:  http.MethodOptions,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			method := test.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, "http://dev.coder.com", nil)
+			r.Header.Set(httpmw.OriginHeader, test.origin)
+			if method == http.MethodOptions {
+				r.Header.Set(httpmw.AccessControlRequestMethodHeader, http.MethodGet)
+			}
+			rw := httptest.NewRecorder()
+			handler := httpmw.Cors(test.options)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				rw.WriteHeader(http.StatusNoContent)
+			}))
+			handler.ServeHTTP(rw, r)
+
+			require.Equal(t, test.allowedOrigin, rw.Header().Get(httpmw.AccessControlAllowOriginHeader))
+			require.Equal(t, test.maxAge, rw.Header().Get(httpmw.AccessControlMaxAgeHeader))
+			if test.preflight {
+				require.NotEqual(t, http.StatusNoContent, rw.Code)
+			} else {
+				require.Equal(t, http.StatusNoContent, rw.Code)
+			}
+		})
+	}
+}
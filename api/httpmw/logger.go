@@ -25,8 +25,11 @@ func Logger(log slog.Logger) func(next http.Handler) http.Handler {
 			next.ServeHTTP(sw, r)
 
 			// Do not log successful health check requests.
-			if r.URL.Path == "/healthz" && sw.Status == 200 {
-				return
+			switch r.URL.Path {
+			case "/healthz", "/livez", "/readyz":
+				if sw.Status == 200 {
+					return
+				}
 			}
 
 			httplog = httplog.With(
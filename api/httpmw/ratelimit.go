@@ -1,34 +1,127 @@
 package httpmw
 
 import (
+	"fmt"
+	"math"
 	"net/http"
+	"net/netip"
+	"sync"
 	"time"
 
-	"github.com/go-chi/httprate"
-
+	"cdr.dev/slog"
 	"github.com/coder/code-marketplace/api/httpapi"
+	"github.com/coder/code-marketplace/ratelimit"
+)
+
+const (
+	RateLimitLimitHeader     = "RateLimit-Limit"
+	RateLimitRemainingHeader = "RateLimit-Remaining"
+	RateLimitResetHeader     = "RateLimit-Reset"
+	RateLimitPolicyHeader    = "RateLimit-Policy"
+	RetryAfterHeader         = "Retry-After"
 )
 
-// RateLimitPerMinute returns a handler that limits requests per-minute based
-// on IP and endpoint.
-func RateLimitPerMinute(count int) func(http.Handler) http.Handler {
-	// -1 is no rate limit
-	if count <= 0 {
-		return func(handler http.Handler) http.Handler {
-			return handler
+// counterErrorLogInterval is how often counter errors are logged.  While the
+// counter is down every request fails to count, so the rest are only tallied.
+const counterErrorLogInterval = time.Minute
+
+// RateLimitOptions configures RateLimit.
+type RateLimitOptions struct {
+	// Limits are the number of requests per minute a client can make against
+	// each budget.  Budgets without a positive limit are not limited.
+	Limits map[string]int
+	// Budget returns the budget a request counts against.
+	Budget func(r *http.Request) string
+	// Tokens map bearer tokens to the actor they authenticate.  Requests with
+	// one of the tokens are limited per actor instead of per IP.
+	Tokens map[string]string
+	// TrustedProxies are the networks of proxies whose forwarding headers are
+	// trusted to identify the client.  See httpapi.ClientIP.
+	TrustedProxies []netip.Prefix
+	// Counter stores the request counts.  Defaults to counting in memory.
+	Counter ratelimit.Counter
+	// Logger logs counter errors, in which case requests are let through.  At
+	// most one error is logged a minute.
+	Logger slog.Logger
+}
+
+// RateLimit limits the requests per minute each client makes against each
+// budget.  Responses carry the RateLimit-* headers from the IETF draft and
+// rejected requests a Retry-After header.  Rejected requests count towards the
+// limit as well.
+func RateLimit(options RateLimitOptions) func(http.Handler) http.Handler {
+	counter := options.Counter
+	if counter == nil {
+		counter = ratelimit.NewMemory()
+	}
+	var (
+		mutex      sync.Mutex
+		lastLogged time.Time
+		suppressed int
+	)
+	// logError logs the error unless another was logged recently.
+	logError := func(r *http.Request, budget string, err error) {
+		mutex.Lock()
+		if time.Since(lastLogged) < counterErrorLogInterval {
+			suppressed++
+			mutex.Unlock()
+			return
 		}
+		lastLogged = time.Now()
+		count := suppressed
+		suppressed = 0
+		mutex.Unlock()
+		options.Logger.Warn(r.Context(), "Unable to count request for rate limiting",
+			slog.F("budget", budget),
+			slog.F("suppressed", count),
+			slog.Error(err))
 	}
-	return httprate.Limit(
-		count,
-		1*time.Minute,
-		httprate.WithKeyFuncs(func(r *http.Request) (string, error) {
-			return httprate.KeyByIP(r)
-		}, httprate.KeyByEndpoint),
-		httprate.WithLimitHandler(func(w http.ResponseWriter, r *http.Request) {
-			httpapi.Write(w, http.StatusTooManyRequests, httpapi.ErrorResponse{
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			budget := options.Budget(r)
+			limit := options.Limits[budget]
+			if limit <= 0 {
+				next.ServeHTTP(rw, r)
+				return
+			}
+
+			client := "ip:" + httpapi.ClientIP(r, options.TrustedProxies).String()
+			if actor, ok := tokenActor(r, options.Tokens); ok {
+				client = "actor:" + actor
+			}
+
+			now := time.Now()
+			window := now.Truncate(ratelimit.Window)
+			elapsed := now.Sub(window)
+			current, previous, err := counter.Increment(r.Context(), budget+":"+client, window)
+			if err != nil {
+				logError(r, budget, err)
+				next.ServeHTTP(rw, r)
+				return
+			}
+
+			estimate := ratelimit.Estimate(current, previous, elapsed)
+			remaining := max(0, limit-int(math.Ceil(estimate)))
+			rw.Header().Set(RateLimitPolicyHeader, fmt.Sprintf("%d;w=%d", limit, int(ratelimit.Window.Seconds())))
+			rw.Header().Set(RateLimitLimitHeader, fmt.Sprint(limit))
+			rw.Header().Set(RateLimitRemainingHeader, fmt.Sprint(remaining))
+			rw.Header().Set(RateLimitResetHeader, fmt.Sprint(seconds(ratelimit.Window-elapsed)))
+			if estimate <= float64(limit) {
+				next.ServeHTTP(rw, r)
+				return
+			}
+
+			retryAfter := ratelimit.RetryAfter(limit, current, previous, elapsed)
+			rw.Header().Set(RetryAfterHeader, fmt.Sprint(max(1, seconds(retryAfter))))
+			httpapi.Write(rw, http.StatusTooManyRequests, httpapi.ErrorResponse{
 				Message: "You have been rate limited!",
-				Detail:  "Please wait a minute then try again.",
+				Detail:  "Please wait for the number of seconds in the Retry-After header then try again.",
 			})
-		}),
-	)
+		})
+	}
+}
+
+// seconds rounds the duration up to whole seconds.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
 }
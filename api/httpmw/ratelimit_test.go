@@ -1,23 +1,68 @@
 package httpmw_test
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
 
+	"cdr.dev/slog"
+	"cdr.dev/slog/sloggers/slogtest"
 	"github.com/coder/code-marketplace/api/httpmw"
 )
 
+// countingSink counts the entries logged to it.
+type countingSink struct {
+	mutex   sync.Mutex
+	entries []slog.SinkEntry
+}
+
+func (s *countingSink) LogEntry(_ context.Context, e slog.SinkEntry) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.entries = append(s.entries, e)
+}
+
+func (s *countingSink) Sync() {}
+
+// fakeCounter counts every request in the same window so results do not
+// depend on when the test runs.
+type fakeCounter struct {
+	mutex  sync.Mutex
+	counts map[string]int
+	err    error
+}
+
+func (c *fakeCounter) Increment(_ context.Context, key string, _ time.Time) (int, int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.err != nil {
+		return 0, 0, c.err
+	}
+	if c.counts == nil {
+		c.counts = map[string]int{}
+	}
+	c.counts[key]++
+	return c.counts[key], 0, nil
+}
+
 func TestRateLimit(t *testing.T) {
 	t.Parallel()
 	t.Run("NoUser", func(t *testing.T) {
 		t.Parallel()
 		rtr := chi.NewRouter()
-		rtr.Use(httpmw.RateLimitPerMinute(5))
+		rtr.Use(httpmw.RateLimit(httpmw.RateLimitOptions{
+			Limits: map[string]int{"default": 5},
+			Budget: func(r *http.Request) string { return "default" },
+		}))
 		rtr.Get("/", func(rw http.ResponseWriter, r *http.Request) {
 			rw.WriteHeader(http.StatusOK)
 		})
@@ -31,4 +76,203 @@ func TestRateLimit(t *testing.T) {
 			return resp.StatusCode == http.StatusTooManyRequests
 		}, 5*time.Second, 25*time.Millisecond)
 	})
+
+	// newHandler returns a handler limiting the query budget to two requests
+	// and the download budget to four, with every other request unlimited.
+	newHandler := func(t *testing.T, counter *fakeCounter) http.Handler {
+		t.Helper()
+		return httpmw.RateLimit(httpmw.RateLimitOptions{
+			Limits: map[string]int{"query": 2, "download": 4},
+			Budget: func(r *http.Request) string {
+				return r.URL.Path[1:]
+			},
+			Tokens:         map[string]string{"token": "alice"},
+			TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+			Counter:        counter,
+			Logger:         slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}),
+		})(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rw.WriteHeader(http.StatusOK)
+		}))
+	}
+	do := func(handler http.Handler, path, remoteAddr string, header http.Header) *http.Response {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Result()
+	}
+
+	t.Run("Headers", func(t *testing.T) {
+		t.Parallel()
+		handler := newHandler(t, &fakeCounter{})
+
+		resp := do(handler, "/query", "192.0.2.1:1234", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "2", resp.Header.Get(httpmw.RateLimitLimitHeader))
+		require.Equal(t, "1", resp.Header.Get(httpmw.RateLimitRemainingHeader))
+		require.Equal(t, "2;w=60", resp.Header.Get(httpmw.RateLimitPolicyHeader))
+		reset, err := strconv.Atoi(resp.Header.Get(httpmw.RateLimitResetHeader))
+		require.NoError(t, err)
+		require.True(t, reset > 0 && reset <= 60, reset)
+		require.Empty(t, resp.Header.Get(httpmw.RetryAfterHeader))
+
+		resp = do(handler, "/query", "192.0.2.1:1234", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "0", resp.Header.Get(httpmw.RateLimitRemainingHeader))
+
+		resp = do(handler, "/query", "192.0.2.1:1234", nil)
+		require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		require.Equal(t, "0", resp.Header.Get(httpmw.RateLimitRemainingHeader))
+		retryAfter, err := strconv.Atoi(resp.Header.Get(httpmw.RetryAfterHeader))
+		require.NoError(t, err)
+		require.True(t, retryAfter >= 1 && retryAfter <= 120, retryAfter)
+
+		// Budgets without a limit have no headers.
+		resp = do(handler, "/other", "192.0.2.1:1234", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Empty(t, resp.Header.Get(httpmw.RateLimitLimitHeader))
+	})
+
+	t.Run("Budgets", func(t *testing.T) {
+		t.Parallel()
+		handler := newHandler(t, &fakeCounter{})
+
+		for i := 0; i < 2; i++ {
+			require.Equal(t, http.StatusOK, do(handler, "/query", "192.0.2.1:1234", nil).StatusCode)
+		}
+		require.Equal(t, http.StatusTooManyRequests, do(handler, "/query", "192.0.2.1:1234", nil).StatusCode)
+
+		// Running out of queries leaves downloads alone.
+		for i := 0; i < 4; i++ {
+			require.Equal(t, http.StatusOK, do(handler, "/download", "192.0.2.1:1234", nil).StatusCode)
+		}
+		require.Equal(t, http.StatusTooManyRequests, do(handler, "/download", "192.0.2.1:1234", nil).StatusCode)
+	})
+
+	t.Run("Clients", func(t *testing.T) {
+		t.Parallel()
+
+		tests := []struct {
+			name string
+			// first and second are the remote address and headers of two
+			// requests.
+			first        string
+			firstHeader  http.Header
+			second       string
+			secondHeader http.Header
+			// shared is whether the requests share a count.
+			shared bool
+		}{
+			{
+				name:   "SameIP",
+				first:  "192.0.2.1:1234",
+				second: "192.0.2.1:5678",
+				shared: true,
+			},
+			{
+				name:   "DifferentIP",
+				first:  "192.0.2.1:1234",
+				second: "192.0.2.2:1234",
+			},
+			{
+				name:         "TrustedProxy",
+				first:        "10.0.0.1:1234",
+				firstHeader:  http.Header{"X-Forwarded-For": {"192.0.2.1"}},
+				second:       "10.0.0.1:1234",
+				secondHeader: http.Header{"X-Forwarded-For": {"192.0.2.2"}},
+			},
+			{
+				name:         "TrustedProxySameClient",
+				first:        "10.0.0.1:1234",
+				firstHeader:  http.Header{"X-Forwarded-For": {"192.0.2.1"}},
+				second:       "10.0.0.2:1234",
+				secondHeader: http.Header{"Forwarded": {"for=192.0.2.1"}},
+				shared:       true,
+			},
+			{
+				name:         "UntrustedProxy",
+				first:        "192.0.2.1:1234",
+				firstHeader:  http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+				second:       "192.0.2.1:1234",
+				secondHeader: http.Header{"X-Forwarded-For": {"198.51.100.2"}},
+				shared:       true,
+			},
+			{
+				name:         "Token",
+				first:        "192.0.2.1:1234",
+				firstHeader:  http.Header{"Authorization": {"Bearer token"}},
+				second:       "192.0.2.2:1234",
+				secondHeader: http.Header{"Authorization": {"Bearer token"}},
+				shared:       true,
+			},
+			{
+				name:         "TokenAndIP",
+				first:        "192.0.2.1:1234",
+				firstHeader:  http.Header{"Authorization": {"Bearer token"}},
+				second:       "192.0.2.1:1234",
+				secondHeader: http.Header{"Authorization": {"Bearer invalid"}},
+			},
+		}
+
+		for _, test := range tests {
+			test := test
+			t.Run(test.name, func(t *testing.T) {
+				t.Parallel()
+				handler := newHandler(t, &fakeCounter{})
+				for i := 0; i < 2; i++ {
+					require.Equal(t, http.StatusOK, do(handler, "/query", test.first, test.firstHeader).StatusCode)
+				}
+				expected := http.StatusOK
+				if test.shared {
+					expected = http.StatusTooManyRequests
+				}
+				require.Equal(t, expected, do(handler, "/query", test.second, test.secondHeader).StatusCode)
+			})
+		}
+	})
+
+	t.Run("SharedCounter", func(t *testing.T) {
+		t.Parallel()
+		// Replicas sharing a counter share limits.
+		counter := &fakeCounter{}
+		replicas := []http.Handler{newHandler(t, counter), newHandler(t, counter)}
+		require.Equal(t, http.StatusOK, do(replicas[0], "/query", "192.0.2.1:1234", nil).StatusCode)
+		require.Equal(t, http.StatusOK, do(replicas[1], "/query", "192.0.2.1:1234", nil).StatusCode)
+		require.Equal(t, http.StatusTooManyRequests, do(replicas[0], "/query", "192.0.2.1:1234", nil).StatusCode)
+	})
+
+	t.Run("CounterError", func(t *testing.T) {
+		t.Parallel()
+		// Requests are let through if they cannot be counted.
+		handler := newHandler(t, &fakeCounter{err: xerrors.New("unavailable")})
+		for i := 0; i < 5; i++ {
+			resp := do(handler, "/query", "192.0.2.1:1234", nil)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Empty(t, resp.Header.Get(httpmw.RateLimitLimitHeader))
+		}
+	})
+
+	t.Run("CounterErrorLogs", func(t *testing.T) {
+		t.Parallel()
+		// Failing to count every request logs once instead of on every request.
+		sink := &countingSink{}
+		handler := httpmw.RateLimit(httpmw.RateLimitOptions{
+			Limits:  map[string]int{"query": 2},
+			Budget:  func(r *http.Request) string { return r.URL.Path[1:] },
+			Counter: &fakeCounter{err: xerrors.New("unavailable")},
+			Logger:  slog.Make(sink),
+		})(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rw.WriteHeader(http.StatusOK)
+		}))
+		for i := 0; i < 5; i++ {
+			require.Equal(t, http.StatusOK, do(handler, "/query", "192.0.2.1:1234", nil).StatusCode)
+		}
+		sink.mutex.Lock()
+		defer sink.mutex.Unlock()
+		require.Len(t, sink.entries, 1)
+		require.Equal(t, slog.LevelWarn, sink.entries[0].Level)
+	})
 }
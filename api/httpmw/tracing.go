@@ -0,0 +1,63 @@
+package httpmw
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"cdr.dev/slog"
+	"github.com/coder/code-marketplace/api/httpapi"
+	"github.com/coder/code-marketplace/tracing"
+)
+
+// Trace starts a span for each request, continuing any trace from the
+// request's W3C trace context headers.  The trace ID is added to the logger
+// context so logs can be correlated with the trace.
+func Trace(provider trace.TracerProvider) func(next http.Handler) http.Handler {
+	tracer := tracing.Tracer(provider)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			ctx := tracing.Propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tracer.Start(ctx, r.Method,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(r.Method),
+					semconv.URLPath(r.URL.Path),
+					semconv.UserAgentOriginal(r.UserAgent()),
+				))
+			defer span.End()
+
+			if rid, ok := ctx.Value(requestIDContextKey{}).(uuid.UUID); ok {
+				span.SetAttributes(attribute.String("request_id", rid.String()))
+			}
+			if sc := span.SpanContext(); sc.IsValid() {
+				ctx = slog.With(ctx, slog.F("trace_id", sc.TraceID().String()))
+			}
+
+			sw := &httpapi.StatusWriter{ResponseWriter: rw}
+			next.ServeHTTP(sw, r.WithContext(ctx))
+
+			// The route is only known once the router has matched the request.
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				if route := rctx.RoutePattern(); route != "" {
+					span.SetName(r.Method + " " + route)
+					span.SetAttributes(semconv.HTTPRoute(route))
+				}
+			}
+			status := sw.Status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+		})
+	}
+}
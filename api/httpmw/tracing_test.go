@@ -0,0 +1,109 @@
+package httpmw_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/coder/code-marketplace/api/httpmw"
+)
+
+func TestTrace(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		path   string
+		parent string
+		span   string
+		status int
+		error  bool
+	}{
+		{
+			name:   "OK",
+			path:   "/items/foo",
+			span:   "GET /items/{id}",
+			status: http.StatusOK,
+		},
+		{
+			name:   "Parent",
+			path:   "/items/foo",
+			parent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			span:   "GET /items/{id}",
+			status: http.StatusOK,
+		},
+		{
+			name:   "Error",
+			path:   "/error",
+			span:   "GET /error",
+			status: http.StatusInternalServerError,
+			error:  true,
+		},
+		{
+			name:   "NotFound",
+			path:   "/missing",
+			span:   "GET",
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			exporter := tracetest.NewInMemoryExporter()
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+			var handlerSpan trace.SpanContext
+			rtr := chi.NewRouter()
+			rtr.Use(httpmw.AttachRequestID, httpmw.Trace(provider))
+			rtr.Get("/items/{id}", func(rw http.ResponseWriter, r *http.Request) {
+				handlerSpan = trace.SpanContextFromContext(r.Context())
+				rw.WriteHeader(http.StatusOK)
+			})
+			rtr.Get("/error", func(rw http.ResponseWriter, r *http.Request) {
+				rw.WriteHeader(http.StatusInternalServerError)
+			})
+
+			r := httptest.NewRequest("GET", test.path, nil)
+			if test.parent != "" {
+				r.Header.Set("traceparent", test.parent)
+			}
+			rw := httptest.NewRecorder()
+			rtr.ServeHTTP(rw, r)
+			require.Equal(t, test.status, rw.Code)
+
+			spans := exporter.GetSpans()
+			require.Len(t, spans, 1)
+			span := spans[0]
+			require.Equal(t, test.span, span.Name)
+			require.Equal(t, trace.SpanKindServer, span.SpanKind)
+			require.Contains(t, span.Attributes, attribute.Int("http.response.status_code", test.status))
+			if test.error {
+				require.Equal(t, codes.Error, span.Status.Code)
+			} else {
+				require.Equal(t, codes.Unset, span.Status.Code)
+			}
+			if test.parent != "" {
+				require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID().String())
+				require.Equal(t, "00f067aa0ba902b7", span.Parent.SpanID().String())
+				require.True(t, span.Parent.IsRemote())
+			} else {
+				require.False(t, span.Parent.IsValid())
+			}
+			if handlerSpan.IsValid() {
+				// Handlers should see the request span in their context.
+				require.Equal(t, span.SpanContext.SpanID(), handlerSpan.SpanID())
+			}
+		})
+	}
+}
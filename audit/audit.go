@@ -0,0 +1,152 @@
+// Package audit records changes made to the marketplace.
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/coder/code-marketplace/storage"
+)
+
+// Action is a kind of change.
+type Action string
+
+const (
+	ActionAdd       Action = "add"
+	ActionRemove    Action = "remove"
+	ActionUnpublish Action = "unpublish"
+	ActionRepublish Action = "republish"
+	ActionFeature   Action = "feature"
+	ActionUnfeature Action = "unfeature"
+	// ActionDeprecate, ActionBlock, and ActionClear change an extension's entry
+	// in the extensions control manifest.
+	ActionDeprecate Action = "deprecate"
+	ActionBlock     Action = "block"
+	ActionClear     Action = "clear"
+	// ActionSubmit is adding an extension that is pending approval.
+	ActionSubmit  Action = "submit"
+	ActionApprove Action = "approve"
+	ActionReject  Action = "reject"
+)
+
+// Outcome is whether a change succeeded.
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeFailure Outcome = "failure"
+)
+
+// Event describes a single change.  Fields that are not known (for example the
+// extension ID when a VSIX could not be read) are left blank.
+type Event struct {
+	Time   time.Time `json:"time"`
+	Actor  string    `json:"actor"`
+	Action Action    `json:"action"`
+	// Source is the URL or file the extension was added from.
+	Source string `json:"source,omitempty"`
+	// SHA256 is the hex-encoded hash of the added VSIX.
+	SHA256 string `json:"sha256,omitempty"`
+	// Extension is the extension ID (publisher.name).
+	Extension      string           `json:"extension,omitempty"`
+	Version        string           `json:"version,omitempty"`
+	TargetPlatform storage.Platform `json:"targetPlatform,omitempty"`
+	Outcome        Outcome          `json:"outcome"`
+	// Error is the reason a change failed.
+	Error string `json:"error,omitempty"`
+}
+
+// Finish sets the time, if not already set, along with the outcome based on
+// the error.
+func (e Event) Finish(err error) Event {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	e.Outcome = OutcomeSuccess
+	if err != nil {
+		e.Outcome = OutcomeFailure
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// Sink records events.  Implementations must be safe for concurrent use.
+type Sink interface {
+	Record(ctx context.Context, event Event) error
+}
+
+// Nop discards events.
+type Nop struct{}
+
+func (Nop) Record(context.Context, Event) error {
+	return nil
+}
+
+// Filter selects events.  Blank fields match every event.
+type Filter struct {
+	// Extension matches the extension ID case-insensitively.
+	Extension string
+	Action    Action
+	// Since and Until bound the event time (inclusive).
+	Since time.Time
+	Until time.Time
+}
+
+// Matches returns true if the event satisfies the filter.
+func (f Filter) Matches(event Event) bool {
+	switch {
+	case f.Extension != "" && !strings.EqualFold(f.Extension, event.Extension):
+		return false
+	case f.Action != "" && f.Action != event.Action:
+		return false
+	case !f.Since.IsZero() && event.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && event.Time.After(f.Until):
+		return false
+	}
+	return true
+}
+
+// Read decodes JSON lines of events from the reader and returns the ones that
+// match the filter, in the order they were written.
+func Read(r io.Reader, filter Filter) ([]Event, error) {
+	events := []Event{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var event Event
+		err := json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil {
+			return nil, xerrors.Errorf("parse line %d: %w", line, err)
+		}
+		if filter.Matches(event) {
+			events = append(events, event)
+		}
+	}
+	return events, scanner.Err()
+}
+
+// DefaultActor returns the name of the user running the process, for changes
+// made outside of the API.
+func DefaultActor() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return "unknown"
+}
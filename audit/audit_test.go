@@ -0,0 +1,146 @@
+package audit_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/code-marketplace/audit"
+	"github.com/coder/code-marketplace/storage"
+)
+
+func TestFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "nested", "audit.jsonl")
+	sink := audit.NewFile(path)
+
+	// Reading before anything is written should not error.
+	events, err := sink.Read(audit.Filter{})
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	written := []audit.Event{
+		audit.Event{
+			Time:           start,
+			Actor:          "alice",
+			Action:         audit.ActionAdd,
+			Source:         "https://domain.tld/foo.bar.vsix",
+			SHA256:         "abc123",
+			Extension:      "foo.bar",
+			Version:        "1.0.0",
+			TargetPlatform: storage.PlatformLinuxX64,
+		}.Finish(nil),
+		audit.Event{
+			Time:      start.Add(time.Hour),
+			Actor:     "bob",
+			Action:    audit.ActionRemove,
+			Extension: "foo.bar",
+			Version:   "1.0.0",
+		}.Finish(errors.New("permission denied")),
+		audit.Event{
+			Time:      start.Add(2 * time.Hour),
+			Actor:     "alice",
+			Action:    audit.ActionAdd,
+			Extension: "foo.baz",
+			Version:   "2.0.0",
+		}.Finish(nil),
+	}
+	for _, event := range written {
+		require.NoError(t, sink.Record(context.Background(), event))
+	}
+
+	// Events should be written as one line each.
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, len(written), strings.Count(string(content), "\n"))
+
+	require.Equal(t, audit.OutcomeSuccess, written[0].Outcome)
+	require.Equal(t, audit.OutcomeFailure, written[1].Outcome)
+	require.Equal(t, "permission denied", written[1].Error)
+
+	tests := []struct {
+		name     string
+		filter   audit.Filter
+		expected []audit.Event
+	}{
+		{
+			name:     "All",
+			expected: written,
+		},
+		{
+			name:     "Extension",
+			filter:   audit.Filter{Extension: "FOO.BAR"},
+			expected: written[:2],
+		},
+		{
+			name:     "Action",
+			filter:   audit.Filter{Action: audit.ActionAdd},
+			expected: []audit.Event{written[0], written[2]},
+		},
+		{
+			name:     "Since",
+			filter:   audit.Filter{Since: start.Add(time.Hour)},
+			expected: written[1:],
+		},
+		{
+			name:     "Until",
+			filter:   audit.Filter{Until: start.Add(time.Hour)},
+			expected: written[:2],
+		},
+		{
+			name:     "NoMatch",
+			filter:   audit.Filter{Extension: "foo.bar", Since: start.Add(2 * time.Hour)},
+			expected: []audit.Event{},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			events, err := sink.Read(test.filter)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, events)
+		})
+	}
+}
+
+func TestFileConcurrent(t *testing.T) {
+	t.Parallel()
+
+	sink := audit.NewFile(filepath.Join(t.TempDir(), "audit.jsonl"))
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := sink.Record(context.Background(), audit.Event{Action: audit.ActionAdd}.Finish(nil))
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	events, err := sink.Read(audit.Filter{})
+	require.NoError(t, err)
+	require.Len(t, events, 20)
+}
+
+func TestRead(t *testing.T) {
+	t.Parallel()
+
+	events, err := audit.Read(strings.NewReader("\n{\"action\":\"add\"}\n\n"), audit.Filter{})
+	require.NoError(t, err)
+	require.Equal(t, []audit.Event{{Action: audit.ActionAdd}}, events)
+
+	_, err = audit.Read(strings.NewReader("{\"action\":\"add\"}\nnope\n"), audit.Filter{})
+	require.ErrorContains(t, err, "line 2")
+}
@@ -0,0 +1,63 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+var _ Sink = (*File)(nil)
+
+// File appends events as JSON lines to a file on disk.  Each event is written
+// with a single append so the file can be shared by several processes, for
+// example the server and the add and remove commands.
+type File struct {
+	mutex sync.Mutex
+	path  string
+}
+
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+func (f *File) Record(ctx context.Context, event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	err = os.MkdirAll(filepath.Dir(f.path), 0o755)
+	if err != nil {
+		return xerrors.Errorf("create audit log directory: %w", err)
+	}
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return xerrors.Errorf("open audit log: %w", err)
+	}
+	_, err = file.Write(line)
+	if err != nil {
+		_ = file.Close()
+		return xerrors.Errorf("write audit log: %w", err)
+	}
+	return file.Close()
+}
+
+// Read returns the events in the file that match the filter.  A file that does
+// not exist yet has no events.
+func (f *File) Read(filter Filter) ([]Event, error) {
+	file, err := os.Open(f.path)
+	if err != nil && os.IsNotExist(err) {
+		return []Event{}, nil
+	} else if err != nil {
+		return nil, xerrors.Errorf("open audit log: %w", err)
+	}
+	defer file.Close()
+	return Read(file, filter)
+}
@@ -2,6 +2,8 @@ package cli
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -10,12 +12,19 @@ import (
 	"github.com/spf13/cobra"
 	"golang.org/x/xerrors"
 
+	"github.com/coder/code-marketplace/audit"
 	"github.com/coder/code-marketplace/storage"
+	"github.com/coder/code-marketplace/storage/easyzip"
 	"github.com/coder/code-marketplace/util"
 )
 
 func add() *cobra.Command {
+	var strict bool
 	addFlags, opts := serverFlags()
+	addLimitFlags := zipLimitFlags(opts)
+	addAuditFlags, auditOpts := auditFlags()
+	addScanFlags, scanOpts := scanFlags()
+	addWebhookFlags, webhookOpts := webhookFlags()
 	cmd := &cobra.Command{
 		Use:   "add <source>",
 		Short: "Add an extension to the marketplace",
@@ -23,6 +32,8 @@ func add() *cobra.Command {
 			"  marketplace add https://domain.tld/extension.vsix --extensions-dir ./extensions",
 			"  marketplace add extension.vsix --artifactory http://artifactory.server/artifactory --repo extensions",
 			"  marketplace add extension-vsixs/ --extensions-dir ./extensions",
+			"  marketplace add extension.vsix --extensions-dir ./extensions --strict",
+			"  marketplace add extension.vsix --extensions-dir ./extensions --scan-rules native-binary --clamd /var/run/clamav/clamd.ctl",
 		}, "\n"),
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -33,6 +44,16 @@ func add() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			// Scan before sending webhooks so rejected extensions are not announced.
+			store, err = scanOpts.wrap(store, opts.Logger)
+			if err != nil {
+				return err
+			}
+			store, dispatcher, err := webhookOpts.wrap(store, opts.Logger)
+			if err != nil {
+				return err
+			}
+			defer flushWebhooks(ctx, cmd, dispatcher)
 
 			// The source might be a local directory with extensions.
 			isDir := false
@@ -44,6 +65,10 @@ func add() *cobra.Command {
 				isDir = stat.IsDir()
 			}
 
+			record := func(event audit.Event, err error) {
+				auditOpts.record(cmd, event, err)
+			}
+
 			var failed []string
 			if isDir {
 				files, err := os.ReadDir(args[0])
@@ -51,7 +76,7 @@ func add() *cobra.Command {
 					return err
 				}
 				for _, file := range files {
-					s, err := doAdd(ctx, filepath.Join(args[0], file.Name()), store)
+					s, err := doAdd(ctx, filepath.Join(args[0], file.Name()), store, strict, opts.ZipLimits, record)
 					if err != nil {
 						_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Failed to unpack %s: %s\n", file.Name(), err.Error())
 						failed = append(failed, file.Name())
@@ -60,7 +85,7 @@ func add() *cobra.Command {
 					}
 				}
 			} else {
-				s, err := doAdd(ctx, args[0], store)
+				s, err := doAdd(ctx, args[0], store, strict, opts.ZipLimits, record)
 				if err != nil {
 					return err
 				}
@@ -76,17 +101,37 @@ func add() *cobra.Command {
 			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&strict, "strict", false, "Reject extensions that fail the checks done by the validate command.")
 	addFlags(cmd)
+	addLimitFlags(cmd)
+	addAuditFlags(cmd)
+	addScanFlags(cmd)
+	addWebhookFlags(cmd)
 
 	return cmd
 }
 
-func doAdd(ctx context.Context, source string, store storage.Storage) ([]string, error) {
+// doAdd adds the extension at the source and records the attempt with the
+// provided function, whether it succeeds or not.  In strict mode the extension
+// must also pass validation, which checks the archive against the limits.
+func doAdd(ctx context.Context, source string, store storage.Storage, strict bool, limits *easyzip.Limits, record func(audit.Event, error)) (_ []string, err error) {
+	event := audit.Event{Action: audit.ActionAdd, Source: source}
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		if abs, err := filepath.Abs(source); err == nil {
+			event.Source = abs
+		}
+	}
+	defer func() {
+		record(event, err)
+	}()
+
 	// Read in the extension.  In the future we might support stdin as well.
 	vsix, err := storage.ReadVSIX(ctx, source)
 	if err != nil {
 		return nil, err
 	}
+	sum := sha256.Sum256(vsix)
+	event.SHA256 = hex.EncodeToString(sum[:])
 
 	// The manifest is required to know where to place the extension since it
 	// is unsafe to rely on the file name or URI.
@@ -94,6 +139,16 @@ func doAdd(ctx context.Context, source string, store storage.Storage) ([]string,
 	if err != nil {
 		return nil, err
 	}
+	identity := manifest.Metadata.Identity
+	event.Extension = storage.ExtensionIDWithoutVersion(identity.Publisher, identity.ID)
+	event.Version = identity.Version
+	event.TargetPlatform = identity.TargetPlatform
+
+	if strict {
+		if err := storage.ValidateVSIX(vsix, limits).Err(); err != nil {
+			return nil, err
+		}
+	}
 
 	location, err := store.AddExtension(ctx, manifest, vsix)
 	if err != nil {
@@ -179,3 +179,63 @@ func TestAdd(t *testing.T) {
 		})
 	}
 }
+
+func TestAddLimits(t *testing.T) {
+	t.Parallel()
+
+	ext := testutil.Extensions[0]
+	vsix := testutil.CreateVSIXFromExtension(t, ext, storage.Version{Version: ext.LatestVersion})
+
+	tests := []struct {
+		name  string
+		args  []string
+		error string
+	}{
+		{
+			name: "Defaults",
+		},
+		{
+			name: "Unlimited",
+			args: []string{"--max-extension-files", "0", "--max-extension-size", "0"},
+		},
+		{
+			name:  "TooManyFiles",
+			args:  []string{"--max-extension-files", "1"},
+			error: "too many entries",
+		},
+		{
+			name:  "TooLarge",
+			args:  []string{"--max-extension-size", "1"},
+			error: "too large",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			extdir := t.TempDir()
+			source := filepath.Join(t.TempDir(), "ext.vsix")
+			require.NoError(t, os.WriteFile(source, vsix, 0o644))
+
+			cmd := cli.Root()
+			cmd.SetArgs(append([]string{"add", source, "--extensions-dir", extdir}, test.args...))
+			buf := new(bytes.Buffer)
+			cmd.SetOut(buf)
+			cmd.SetErr(buf)
+
+			err := cmd.Execute()
+			dest := filepath.Join(extdir, ext.Publisher, ext.Name, ext.LatestVersion)
+			if test.error != "" {
+				require.ErrorContains(t, err, test.error)
+				_, err := os.Stat(dest)
+				require.True(t, os.IsNotExist(err))
+				return
+			}
+			require.NoError(t, err)
+			_, err = os.Stat(dest)
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/code-marketplace/audit"
+)
+
+// auditOptions configures where changes made by a command are recorded.
+type auditOptions struct {
+	actor  string
+	path   string
+	cached audit.Sink
+}
+
+// auditFlags adds flags for recording changes to an audit log.  Commands other
+// than the server also get an --actor flag since there is no token to identify
+// who is making the change.
+func auditFlags() (addFlags func(cmd *cobra.Command), opts *auditOptions) {
+	opts = &auditOptions{}
+	return func(cmd *cobra.Command) {
+		cmd.Flags().StringVar(&opts.path, "audit-log", "", "Append a JSON line describing each change to this file.")
+		configurable(cmd, "audit-log")
+		if cmd.Use != "server" {
+			cmd.Flags().StringVar(&opts.actor, "actor", audit.DefaultActor(), "Who to record as making the change in the audit log.")
+			configurable(cmd, "actor")
+		}
+	}, opts
+}
+
+// sink returns the configured audit sink, which discards events when there is
+// no audit log.
+func (o *auditOptions) sink() audit.Sink {
+	if o.cached == nil {
+		if o.path == "" {
+			o.cached = audit.Nop{}
+		} else {
+			o.cached = audit.NewFile(o.path)
+		}
+	}
+	return o.cached
+}
+
+// record records a change attempted by the command.  Failing to record it only
+// warns since by then the change has already been made.
+func (o *auditOptions) record(cmd *cobra.Command, event audit.Event, err error) {
+	event.Actor = o.actor
+	err = o.sink().Record(cmd.Context(), event.Finish(err))
+	if err != nil {
+		_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "Failed to record audit event: %s\n", err)
+	}
+}
+
+// parseAuditTime parses either an RFC 3339 time or a duration, which is taken
+// to be that long before now.
+func parseAuditTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, xerrors.Errorf("%q is not an RFC 3339 time or a duration", value)
+}
+
+func auditLog() *cobra.Command {
+	var (
+		action    string
+		extension string
+		jsonOut   bool
+		path      string
+		since     string
+		until     string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Query the audit log of changes to the marketplace",
+		Example: strings.Join([]string{
+			"  marketplace audit --audit-log ./audit.jsonl --extension ms-python.python",
+			"  marketplace audit --audit-log ./audit.jsonl --since 24h --action remove",
+			"  marketplace audit --audit-log ./audit.jsonl --since 2026-01-01T00:00:00Z --until 2026-02-01T00:00:00Z --json",
+		}, "\n"),
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if path == "" {
+				return xerrors.New("--audit-log is required")
+			}
+			filter := audit.Filter{
+				Action:    audit.Action(action),
+				Extension: extension,
+			}
+			var err error
+			filter.Since, err = parseAuditTime(since)
+			if err != nil {
+				return xerrors.Errorf("--since: %w", err)
+			}
+			filter.Until, err = parseAuditTime(until)
+			if err != nil {
+				return xerrors.Errorf("--until: %w", err)
+			}
+
+			events, err := audit.NewFile(path).Read(filter)
+			if err != nil {
+				return err
+			}
+
+			if jsonOut {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				for _, event := range events {
+					if err := encoder.Encode(event); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			_, _ = fmt.Fprintln(w, "TIME\tACTOR\tACTION\tEXTENSION\tVERSION\tOUTCOME")
+			for _, event := range events {
+				version := event.Version
+				if event.TargetPlatform != "" {
+					version += "@" + string(event.TargetPlatform)
+				}
+				outcome := string(event.Outcome)
+				if event.Error != "" {
+					outcome += ": " + event.Error
+				}
+				_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+					event.Time.Format(time.RFC3339), event.Actor, event.Action, event.Extension, version, outcome)
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().StringVar(&path, "audit-log", "", "The audit log to query.")
+	configurable(cmd, "audit-log")
+	cmd.Flags().StringVar(&extension, "extension", "", "Only show changes to this extension (publisher.name).")
+	cmd.Flags().StringVar(&action, "action", "", "Only show this kind of change (add, remove, unpublish, republish, feature, unfeature, deprecate, block, clear, submit, approve, or reject).")
+	cmd.Flags().StringVar(&since, "since", "", "Only show changes at or after this RFC 3339 time or this long ago (for example 24h).")
+	cmd.Flags().StringVar(&until, "until", "", "Only show changes at or before this RFC 3339 time or this long ago.")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Output the matching events as JSON lines.")
+
+	return cmd
+}
@@ -0,0 +1,229 @@
+package cli_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/code-marketplace/audit"
+	"github.com/coder/code-marketplace/cli"
+	"github.com/coder/code-marketplace/storage"
+	"github.com/coder/code-marketplace/testutil"
+)
+
+func TestAuditHelp(t *testing.T) {
+	t.Parallel()
+
+	cmd := cli.Root()
+	cmd.SetArgs([]string{"audit", "--help"})
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+
+	err := cmd.Execute()
+	require.NoError(t, err)
+
+	output := buf.String()
+	require.Contains(t, output, "Query the audit log", "has help")
+}
+
+func TestAudit(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	extdir := filepath.Join(dir, "extensions")
+	log := filepath.Join(dir, "audit.jsonl")
+
+	ext := testutil.Extensions[0]
+	version := storage.Version{Version: ext.LatestVersion, TargetPlatform: storage.PlatformLinuxX64}
+	vsix := testutil.CreateVSIXFromExtension(t, ext, version)
+	source := filepath.Join(dir, "ext.vsix")
+	require.NoError(t, os.WriteFile(source, vsix, 0o644))
+	invalid := filepath.Join(dir, "invalid.vsix")
+	require.NoError(t, os.WriteFile(invalid, []byte("foo"), 0o644))
+
+	run := func(args ...string) (string, error) {
+		cmd := cli.Root()
+		cmd.SetArgs(args)
+		buf := new(bytes.Buffer)
+		cmd.SetOut(buf)
+		cmd.SetErr(buf)
+		err := cmd.Execute()
+		return buf.String(), err
+	}
+
+	id := storage.ExtensionIDWithoutVersion(ext.Publisher, ext.Name)
+	_, err := run("add", source, "--extensions-dir", extdir, "--audit-log", log, "--actor", "alice")
+	require.NoError(t, err)
+	_, err = run("add", invalid, "--extensions-dir", extdir, "--audit-log", log, "--actor", "alice")
+	require.Error(t, err)
+	_, err = run("remove", id+"@"+version.Version, "--extensions-dir", extdir, "--audit-log", log, "--actor", "bob")
+	require.NoError(t, err)
+	// Without --audit-log nothing should be recorded.
+	_, err = run("add", source, "--extensions-dir", extdir)
+	require.NoError(t, err)
+
+	events, err := audit.NewFile(log).Read(audit.Filter{})
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	sum := sha256.Sum256(vsix)
+	require.Equal(t, "alice", events[0].Actor)
+	require.Equal(t, audit.ActionAdd, events[0].Action)
+	require.Equal(t, source, events[0].Source)
+	require.Equal(t, hex.EncodeToString(sum[:]), events[0].SHA256)
+	require.Equal(t, id, events[0].Extension)
+	require.Equal(t, version.Version, events[0].Version)
+	require.Equal(t, version.TargetPlatform, events[0].TargetPlatform)
+	require.Equal(t, audit.OutcomeSuccess, events[0].Outcome)
+
+	require.Equal(t, invalid, events[1].Source)
+	require.Empty(t, events[1].Extension)
+	require.Equal(t, audit.OutcomeFailure, events[1].Outcome)
+	require.NotEmpty(t, events[1].Error)
+
+	require.Equal(t, "bob", events[2].Actor)
+	require.Equal(t, audit.ActionRemove, events[2].Action)
+	require.Equal(t, id, events[2].Extension)
+	require.Equal(t, version.TargetPlatform, events[2].TargetPlatform)
+	require.Equal(t, audit.OutcomeSuccess, events[2].Outcome)
+
+	tests := []struct {
+		name  string
+		args  []string
+		error string
+		lines int
+	}{
+		{
+			name:  "All",
+			lines: 3,
+		},
+		{
+			name:  "Extension",
+			args:  []string{"--extension", id},
+			lines: 2,
+		},
+		{
+			name:  "Action",
+			args:  []string{"--action", "remove"},
+			lines: 1,
+		},
+		{
+			name:  "Since",
+			args:  []string{"--since", "1h"},
+			lines: 3,
+		},
+		{
+			name:  "Until",
+			args:  []string{"--until", "2000-01-01T00:00:00Z"},
+			lines: 0,
+		},
+		{
+			name:  "InvalidSince",
+			args:  []string{"--since", "yesterday"},
+			error: "not an RFC 3339 time or a duration",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			output, err := run(append([]string{"audit", "--audit-log", log, "--json"}, test.args...)...)
+			if test.error != "" {
+				require.ErrorContains(t, err, test.error)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.lines, strings.Count(output, "\n"))
+		})
+	}
+
+	t.Run("Table", func(t *testing.T) {
+		t.Parallel()
+
+		output, err := run("audit", "--audit-log", log, "--action", "remove")
+		require.NoError(t, err)
+		require.Contains(t, output, "ACTOR")
+		require.Contains(t, output, "bob")
+		require.Contains(t, output, version.Version+"@linux-x64")
+	})
+
+	t.Run("MissingLog", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := run("audit")
+		require.ErrorContains(t, err, "--audit-log is required")
+	})
+}
+
+func TestAuditCommands(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	extdir := filepath.Join(dir, "extensions")
+	log := filepath.Join(dir, "audit.jsonl")
+
+	ext := testutil.Extensions[0]
+	version := storage.Version{Version: ext.LatestVersion}
+	source := filepath.Join(dir, "ext.vsix")
+	require.NoError(t, os.WriteFile(source, testutil.CreateVSIXFromExtension(t, ext, version), 0o644))
+
+	run := func(args ...string) error {
+		cmd := cli.Root()
+		cmd.SetArgs(args)
+		buf := new(bytes.Buffer)
+		cmd.SetOut(buf)
+		cmd.SetErr(buf)
+		return cmd.Execute()
+	}
+	require.NoError(t, run("add", source, "--extensions-dir", extdir))
+
+	id := storage.ExtensionIDWithoutVersion(ext.Publisher, ext.Name)
+	tests := []struct {
+		args    []string
+		action  audit.Action
+		version string
+		failed  bool
+	}{
+		{args: []string{"unpublish", id + "@" + version.Version}, action: audit.ActionUnpublish, version: version.Version},
+		{args: []string{"republish", id + "@" + version.Version}, action: audit.ActionRepublish, version: version.Version},
+		{args: []string{"feature", "add", id}, action: audit.ActionFeature},
+		{args: []string{"feature", "remove", id}, action: audit.ActionUnfeature},
+		{args: []string{"control", "deprecate", id}, action: audit.ActionDeprecate},
+		{args: []string{"control", "block", id}, action: audit.ActionBlock},
+		// Failures are recorded too.
+		{args: []string{"control", "block", id}, action: audit.ActionBlock, failed: true},
+		{args: []string{"control", "clear", id}, action: audit.ActionClear},
+	}
+	for _, test := range tests {
+		err := run(append(test.args, "--extensions-dir", extdir, "--audit-log", log, "--actor", "alice")...)
+		if test.failed {
+			require.Error(t, err, test.args)
+		} else {
+			require.NoError(t, err, test.args)
+		}
+	}
+
+	events, err := audit.NewFile(log).Read(audit.Filter{})
+	require.NoError(t, err)
+	require.Len(t, events, len(tests))
+	for i, test := range tests {
+		event := events[i]
+		require.Equal(t, "alice", event.Actor, test.args)
+		require.Equal(t, test.action, event.Action, test.args)
+		require.Equal(t, id, event.Extension, test.args)
+		require.Equal(t, test.version, event.Version, test.args)
+		if test.failed {
+			require.Equal(t, audit.OutcomeFailure, event.Outcome, test.args)
+			require.NotEmpty(t, event.Error, test.args)
+		} else {
+			require.Equal(t, audit.OutcomeSuccess, event.Outcome, test.args)
+		}
+	}
+}
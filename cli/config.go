@@ -0,0 +1,283 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// configEnvKey can be used instead of --config.
+	configEnvKey = "MARKETPLACE_CONFIG"
+	// envPrefix prefixes the environment variable for each setting.
+	envPrefix = "MARKETPLACE_"
+
+	// configurableAnnotation marks flags that can be set in the config file and
+	// the environment.  Flags for a single invocation, like --all when removing
+	// an extension, are left out so they cannot be set by accident.
+	configurableAnnotation = "marketplace_configurable"
+	// secretAnnotation marks configurable flags whose values are redacted when
+	// printed.
+	secretAnnotation = "marketplace_secret"
+
+	redacted = "REDACTED"
+)
+
+// configurable marks the named flags as settings that can come from the config
+// file or environment.
+func configurable(cmd *cobra.Command, names ...string) {
+	for _, name := range names {
+		annotate(cmd, name, configurableAnnotation)
+	}
+}
+
+// secret marks the named flags as configurable settings whose values should not
+// be shown.
+func secret(cmd *cobra.Command, names ...string) {
+	for _, name := range names {
+		annotate(cmd, name, configurableAnnotation)
+		annotate(cmd, name, secretAnnotation)
+	}
+}
+
+func annotate(cmd *cobra.Command, name, annotation string) {
+	flag := cmd.Flags().Lookup(name)
+	if flag == nil {
+		panic(fmt.Sprintf("flag %q is not defined on %q", name, cmd.Name()))
+	}
+	if flag.Annotations == nil {
+		flag.Annotations = map[string][]string{}
+	}
+	flag.Annotations[annotation] = []string{"true"}
+}
+
+func hasAnnotation(flag *pflag.Flag, annotation string) bool {
+	_, ok := flag.Annotations[annotation]
+	return ok
+}
+
+// envKey returns the environment variable for a setting, for example
+// MARKETPLACE_EXTENSIONS_DIR for extensions-dir.
+func envKey(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// readConfig reads the config file from --config or MARKETPLACE_CONFIG.  The
+// file is YAML (which includes JSON) mapping flag names to values.  Keys must be
+// settings on at least one command.  If there is no config file the result is
+// empty.
+func readConfig(cmd *cobra.Command) (map[string]any, error) {
+	name, err := cmd.Flags().GetString("config")
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = os.Getenv(configEnvKey)
+	}
+	if name == "" {
+		return map[string]any{}, nil
+	}
+	content, err := os.ReadFile(name)
+	if err != nil {
+		return nil, xerrors.Errorf("read config: %w", err)
+	}
+	config := map[string]any{}
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return nil, xerrors.Errorf("parse config %q: %w", name, err)
+	}
+	if config == nil {
+		// The file was empty.
+		config = map[string]any{}
+	}
+	known := map[string]bool{}
+	for _, flag := range settings(cmd.Root()) {
+		known[flag.Name] = true
+	}
+	for key := range config {
+		if !known[key] {
+			return nil, xerrors.Errorf("parse config %q: unknown setting %q", name, key)
+		}
+	}
+	return config, nil
+}
+
+// applyConfig sets the configurable flags of a command that were not set on
+// the command line from the environment or else the config file, giving the
+// precedence flags, environment, config file, then defaults.
+func applyConfig(cmd *cobra.Command) error {
+	config, err := readConfig(cmd)
+	if err != nil {
+		return err
+	}
+	var flags []*pflag.Flag
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		flags = append(flags, flag)
+	})
+	return applySettings(flags, config)
+}
+
+// applySettings sets each configurable flag that was not set on the command
+// line from the environment or else the config.
+func applySettings(flags []*pflag.Flag, config map[string]any) error {
+	for _, flag := range flags {
+		if flag.Changed || !hasAnnotation(flag, configurableAnnotation) {
+			continue
+		}
+		if value, ok := os.LookupEnv(envKey(flag.Name)); ok {
+			if err := setFlag(flag, value); err != nil {
+				return xerrors.Errorf("%s: %w", envKey(flag.Name), err)
+			}
+		} else if value, ok := config[flag.Name]; ok {
+			if err := setFlag(flag, value); err != nil {
+				return xerrors.Errorf("config setting %q: %w", flag.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// setFlag sets a flag from an environment variable or config value.  Lists
+// replace the default of list flags.  In the environment they are
+// comma-separated.
+func setFlag(flag *pflag.Flag, value any) error {
+	slice, isSlice := flag.Value.(pflag.SliceValue)
+	switch value := value.(type) {
+	case []any:
+		if !isSlice {
+			return xerrors.New("must be a single value, not a list")
+		}
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			values = append(values, fmt.Sprint(v))
+		}
+		return slice.Replace(values)
+	case string:
+		if isSlice {
+			if value == "" {
+				return slice.Replace([]string{})
+			}
+			return slice.Replace(strings.Split(value, ","))
+		}
+		return flag.Value.Set(value)
+	case nil:
+		// An empty value in the config file leaves the default in place.
+		return nil
+	case map[string]any:
+		return xerrors.New("must be a single value or a list")
+	default:
+		if isSlice {
+			return slice.Replace([]string{fmt.Sprint(value)})
+		}
+		return flag.Value.Set(fmt.Sprint(value))
+	}
+}
+
+// settings returns every configurable flag on the command and its descendants,
+// sorted by name.  Commands sharing a setting use the same definition so only
+// the first one found is kept.
+func settings(cmd *cobra.Command) []*pflag.Flag {
+	seen := map[string]*pflag.Flag{}
+	var walk func(cmd *cobra.Command)
+	walk = func(cmd *cobra.Command) {
+		cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+			if _, ok := seen[flag.Name]; !ok && hasAnnotation(flag, configurableAnnotation) {
+				seen[flag.Name] = flag
+			}
+		})
+		for _, child := range cmd.Commands() {
+			walk(child)
+		}
+	}
+	walk(cmd)
+	flags := make([]*pflag.Flag, 0, len(seen))
+	for _, flag := range seen {
+		flags = append(flags, flag)
+	}
+	sort.Slice(flags, func(i, j int) bool {
+		return flags[i].Name < flags[j].Name
+	})
+	return flags
+}
+
+// configValue returns the value of a flag as a config file value.
+func configValue(flag *pflag.Flag) any {
+	if slice, ok := flag.Value.(pflag.SliceValue); ok {
+		values := append([]string{}, slice.GetSlice()...)
+		if hasAnnotation(flag, secretAnnotation) {
+			for i := range values {
+				values[i] = redacted
+			}
+		}
+		return values
+	}
+	value := flag.Value.String()
+	if hasAnnotation(flag, secretAnnotation) && value != "" {
+		return redacted
+	}
+	switch flag.Value.Type() {
+	case "bool":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	case "int", "int64":
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i
+		}
+	case "float64":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return value
+}
+
+func config() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the configuration",
+		Long: strings.Join([]string{
+			"Settings can be passed as flags, set in the environment, or set in a YAML config file passed with --config or " + configEnvKey + ".",
+			"Config file keys are flag names and environment variables are the flag name in upper case with " + envPrefix + " prepended and dashes replaced by underscores.",
+			"Flags take precedence over the environment, which takes precedence over the config file.",
+		}, "\n"),
+	}
+	cmd.AddCommand(configPrint())
+	return cmd
+}
+
+func configPrint() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "print",
+		Short: "Print the effective configuration with secrets redacted",
+		Long:  "Print the settings for every command as they would be after applying the environment and config file on top of the defaults.  The output can be used as a config file, apart from redacted secrets.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := readConfig(cmd)
+			if err != nil {
+				return err
+			}
+			flags := settings(cmd.Root())
+			if err := applySettings(flags, config); err != nil {
+				return err
+			}
+			effective := map[string]any{}
+			for _, flag := range flags {
+				effective[flag.Name] = configValue(flag)
+			}
+			encoder := yaml.NewEncoder(cmd.OutOrStdout())
+			encoder.SetIndent(2)
+			if err := encoder.Encode(effective); err != nil {
+				return err
+			}
+			return encoder.Close()
+		},
+	}
+	return cmd
+}
@@ -0,0 +1,190 @@
+package cli_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/coder/code-marketplace/cli"
+	"github.com/coder/code-marketplace/storage"
+	"github.com/coder/code-marketplace/testutil"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(name, []byte(content), 0o600))
+	return name
+}
+
+func printConfig(t *testing.T, args ...string) (map[string]any, error) {
+	t.Helper()
+	cmd := cli.Root()
+	cmd.SetArgs(append([]string{"config", "print"}, args...))
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	if err := cmd.Execute(); err != nil {
+		return nil, err
+	}
+	config := map[string]any{}
+	require.NoError(t, yaml.Unmarshal(buf.Bytes(), &config))
+	return config, nil
+}
+
+func TestConfigPrint(t *testing.T) {
+	t.Parallel()
+
+	name := writeConfig(t, `
+extensions-dir: /extensions
+max-page-size: 50
+list-cache-duration: 5m
+sign: true
+platform: [linux-x64, darwin-arm64]
+admin-token: [alice:secret, other]
+webhook-secret: secret
+artifactory-token: secret
+rate-limit-redis: redis://:secret@localhost
+trusted-proxies: [10.0.0.0/8]
+`)
+	config, err := printConfig(t, "--config", name)
+	require.NoError(t, err)
+	require.Equal(t, "/extensions", config["extensions-dir"])
+	require.Equal(t, 50, config["max-page-size"])
+	require.Equal(t, "5m0s", config["list-cache-duration"])
+	require.Equal(t, true, config["sign"])
+	require.Equal(t, []any{"linux-x64", "darwin-arm64"}, config["platform"])
+	// Secrets are redacted.
+	require.Equal(t, []any{"REDACTED", "REDACTED"}, config["admin-token"])
+	require.Equal(t, "REDACTED", config["webhook-secret"])
+	require.Equal(t, "REDACTED", config["artifactory-token"])
+	require.Equal(t, "REDACTED", config["rate-limit-redis"])
+	require.Equal(t, []any{"10.0.0.0/8"}, config["trusted-proxies"])
+	// Unset settings have their defaults.
+	require.Equal(t, "127.0.0.1:3001", config["address"])
+	require.Equal(t, 512, config["rate-limit"])
+	require.Equal(t, 512, config["rate-limit-query"])
+	require.Equal(t, 2048, config["rate-limit-download"])
+	require.Equal(t, []any{"*"}, config["cors-allowed-origins"])
+	require.Equal(t, []any{}, config["admin-cors-allowed-origins"])
+	require.Equal(t, false, config["admin-cors-allow-credentials"])
+	require.Equal(t, "5m0s", config["admin-cors-max-age"])
+	// Flags for a single invocation are not settings.
+	require.NotContains(t, config, "all")
+	require.NotContains(t, config, "json")
+
+	// The output can be used as a config file, apart from redacted secrets.
+	delete(config, "admin-token")
+	delete(config, "webhook-secret")
+	delete(config, "artifactory-token")
+	delete(config, "rate-limit-redis")
+	out, err := yaml.Marshal(config)
+	require.NoError(t, err)
+	again, err := printConfig(t, "--config", writeConfig(t, string(out)))
+	require.NoError(t, err)
+	require.Equal(t, config["platform"], again["platform"])
+	require.Equal(t, config["max-page-size"], again["max-page-size"])
+}
+
+func TestConfigInvalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		config string
+		error  string
+	}{
+		{
+			name:   "UnknownSetting",
+			config: "extension-dir: /extensions",
+			error:  `unknown setting "extension-dir"`,
+		},
+		{
+			name:   "NotASetting",
+			config: "all: true",
+			error:  `unknown setting "all"`,
+		},
+		{
+			name:   "InvalidValue",
+			config: "max-page-size: lots",
+			error:  `config setting "max-page-size"`,
+		},
+		{
+			name:   "ListForSingleValue",
+			config: "address: [a, b]",
+			error:  "must be a single value, not a list",
+		},
+		{
+			name:   "InvalidYAML",
+			config: "address: [",
+			error:  "parse config",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := printConfig(t, "--config", writeConfig(t, test.config))
+			require.ErrorContains(t, err, test.error)
+		})
+	}
+
+	_, err := printConfig(t, "--config", filepath.Join(t.TempDir(), "missing.yaml"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+// TestConfigEnv cannot run in parallel since it modifies the environment.
+func TestConfigEnv(t *testing.T) {
+	name := writeConfig(t, `
+max-page-size: 50
+max-filters: 5
+`)
+	t.Setenv("MARKETPLACE_CONFIG", name)
+	t.Setenv("MARKETPLACE_MAX_PAGE_SIZE", "75")
+	t.Setenv("MARKETPLACE_PLATFORM", "linux-x64,web")
+	t.Setenv("MARKETPLACE_ADMIN_TOKEN", "secret")
+
+	config, err := printConfig(t)
+	require.NoError(t, err)
+	// The environment takes precedence over the config file.
+	require.Equal(t, 75, config["max-page-size"])
+	require.Equal(t, 5, config["max-filters"])
+	require.Equal(t, []any{"linux-x64", "web"}, config["platform"])
+	require.Equal(t, []any{"REDACTED"}, config["admin-token"])
+
+	t.Setenv("MARKETPLACE_MAX_PAGE_SIZE", "lots")
+	_, err = printConfig(t)
+	require.ErrorContains(t, err, "MARKETPLACE_MAX_PAGE_SIZE")
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	t.Parallel()
+
+	ext := testutil.Extensions[0]
+	source := filepath.Join(t.TempDir(), "ext.vsix")
+	vsix := testutil.CreateVSIXFromExtension(t, ext, storage.Version{Version: ext.LatestVersion})
+	require.NoError(t, os.WriteFile(source, vsix, 0o644))
+
+	configDir, flagDir := t.TempDir(), t.TempDir()
+	name := writeConfig(t, "extensions-dir: "+configDir)
+	add := func(args ...string) {
+		cmd := cli.Root()
+		cmd.SetArgs(append([]string{"add", source, "--config", name}, args...))
+		cmd.SetOut(new(bytes.Buffer))
+		require.NoError(t, cmd.Execute())
+	}
+
+	// Settings come from the config file.
+	add()
+	_, err := os.Stat(filepath.Join(configDir, ext.Publisher, ext.Name, ext.LatestVersion))
+	require.NoError(t, err)
+
+	// Flags take precedence.
+	add("--extensions-dir", flagDir)
+	_, err = os.Stat(filepath.Join(flagDir, ext.Publisher, ext.Name, ext.LatestVersion))
+	require.NoError(t, err)
+}
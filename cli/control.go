@@ -0,0 +1,236 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/code-marketplace/audit"
+	"github.com/coder/code-marketplace/storage"
+)
+
+func control() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "control",
+		Short: "Manage deprecated and malicious extensions",
+		Long: "Manage the extensions control manifest, which VS Code uses to show " +
+			"deprecation notices, suggest replacement extensions, and block " +
+			"malicious extensions.",
+	}
+	cmd.AddCommand(controlDeprecate(), controlBlock(), controlClear(), controlShow())
+	return cmd
+}
+
+func controlDeprecate() *cobra.Command {
+	var (
+		disallowInstall bool
+		info            string
+		replacement     string
+		replacementName string
+		settings        []string
+	)
+	addFlags, opts := serverFlags()
+	addAuditFlags, auditOpts := auditFlags()
+
+	cmd := &cobra.Command{
+		Use:   "deprecate <id>",
+		Short: "Mark an extension as deprecated",
+		Example: strings.Join([]string{
+			"  marketplace control deprecate publisher.extension --extensions-dir ./extensions",
+			"  marketplace control deprecate publisher.extension --replacement publisher.other --extensions-dir ./extensions",
+		}, "\n"),
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(cmd.Context())
+			defer cancel()
+
+			id, err := parseExtensionIDWithoutVersion(args[0])
+			if err != nil {
+				return err
+			}
+
+			deprecation := &storage.Deprecation{
+				AdditionalInfo:  info,
+				DisallowInstall: disallowInstall,
+				Settings:        settings,
+			}
+			if replacement != "" {
+				replacement, err = parseExtensionIDWithoutVersion(replacement)
+				if err != nil {
+					return err
+				}
+				if replacementName == "" {
+					replacementName = replacement
+				}
+				deprecation.Extension = &storage.DeprecationExtension{
+					ID:          replacement,
+					DisplayName: replacementName,
+				}
+			}
+
+			err = updateControlManifest(ctx, opts, func(manifest *storage.ControlManifest) error {
+				manifest.Deprecate(id, deprecation)
+				return nil
+			})
+			auditOpts.record(cmd, audit.Event{Action: audit.ActionDeprecate, Extension: id}, err)
+			if err != nil {
+				return err
+			}
+
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Deprecated %s\n", id)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&replacement, "replacement", "", "The ID of an extension that replaces the deprecated extension.")
+	cmd.Flags().StringVar(&replacementName, "replacement-name", "", "The display name of the replacement extension.  Defaults to its ID.")
+	cmd.Flags().StringArrayVar(&settings, "setting", nil, "A setting that replaces the deprecated extension.  Can be repeated.")
+	cmd.Flags().StringVar(&info, "info", "", "Additional information to show with the deprecation notice.")
+	cmd.Flags().BoolVar(&disallowInstall, "disallow-install", false, "Whether to prevent new installs of the deprecated extension.")
+	addFlags(cmd)
+	addAuditFlags(cmd)
+
+	return cmd
+}
+
+func controlBlock() *cobra.Command {
+	addFlags, opts := serverFlags()
+	addAuditFlags, auditOpts := auditFlags()
+
+	cmd := &cobra.Command{
+		Use:     "block <id>",
+		Aliases: []string{"malicious"},
+		Short:   "Block an extension as malicious",
+		Long: "Block an extension as malicious.  Blocked extensions are excluded " +
+			"from queries and downloads and VS Code will uninstall them.",
+		Example: strings.Join([]string{
+			"  marketplace control block publisher.extension --extensions-dir ./extensions",
+		}, "\n"),
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(cmd.Context())
+			defer cancel()
+
+			id, err := parseExtensionIDWithoutVersion(args[0])
+			if err != nil {
+				return err
+			}
+
+			err = updateControlManifest(ctx, opts, func(manifest *storage.ControlManifest) error {
+				if manifest.IsMalicious(id) {
+					return xerrors.Errorf("%s is already blocked", id)
+				}
+				manifest.SetMalicious(id)
+				return nil
+			})
+			auditOpts.record(cmd, audit.Event{Action: audit.ActionBlock, Extension: id}, err)
+			if err != nil {
+				return err
+			}
+
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Blocked %s\n", id)
+			return nil
+		},
+	}
+	addFlags(cmd)
+	addAuditFlags(cmd)
+
+	return cmd
+}
+
+func controlClear() *cobra.Command {
+	addFlags, opts := serverFlags()
+	addAuditFlags, auditOpts := auditFlags()
+
+	cmd := &cobra.Command{
+		Use:   "clear <id>",
+		Short: "Remove an extension's deprecation and block",
+		Example: strings.Join([]string{
+			"  marketplace control clear publisher.extension --extensions-dir ./extensions",
+		}, "\n"),
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(cmd.Context())
+			defer cancel()
+
+			id, err := parseExtensionIDWithoutVersion(args[0])
+			if err != nil {
+				return err
+			}
+
+			err = updateControlManifest(ctx, opts, func(manifest *storage.ControlManifest) error {
+				if !manifest.Clear(id, true) {
+					return xerrors.Errorf("%s is neither deprecated nor blocked", id)
+				}
+				return nil
+			})
+			auditOpts.record(cmd, audit.Event{Action: audit.ActionClear, Extension: id}, err)
+			if err != nil {
+				return err
+			}
+
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Cleared %s\n", id)
+			return nil
+		},
+	}
+	addFlags(cmd)
+	addAuditFlags(cmd)
+
+	return cmd
+}
+
+func controlShow() *cobra.Command {
+	addFlags, opts := serverFlags()
+
+	cmd := &cobra.Command{
+		Use:   "show",
+		Short: "Print the extensions control manifest",
+		Example: strings.Join([]string{
+			"  marketplace control show --extensions-dir ./extensions",
+		}, "\n"),
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(cmd.Context())
+			defer cancel()
+
+			store, err := storage.NewStorage(ctx, opts)
+			if err != nil {
+				return err
+			}
+
+			manifest, err := storage.ReadControlManifest(ctx, store)
+			if err != nil {
+				return err
+			}
+
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			return enc.Encode(manifest)
+		},
+	}
+	addFlags(cmd)
+
+	return cmd
+}
+
+func updateControlManifest(ctx context.Context, opts *storage.Options, fn func(manifest *storage.ControlManifest) error) error {
+	store, err := storage.NewStorage(ctx, opts)
+	if err != nil {
+		return err
+	}
+	return storage.UpdateControlManifest(ctx, store, fn)
+}
+
+// parseExtensionIDWithoutVersion parses an extension ID and errors if it
+// includes a version.  The ID is returned as publisher.name.
+func parseExtensionIDWithoutVersion(id string) (string, error) {
+	publisher, name, err := storage.ParseExtensionIDWithoutVersion(id)
+	if err != nil {
+		return "", err
+	}
+	return storage.ExtensionIDWithoutVersion(publisher, name), nil
+}
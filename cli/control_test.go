@@ -0,0 +1,143 @@
+package cli_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/code-marketplace/cli"
+	"github.com/coder/code-marketplace/storage"
+)
+
+func TestControlHelp(t *testing.T) {
+	t.Parallel()
+
+	cmd := cli.Root()
+	cmd.SetArgs([]string{"control", "--help"})
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+
+	err := cmd.Execute()
+	require.NoError(t, err)
+
+	output := buf.String()
+	require.Contains(t, output, "Manage the extensions control manifest", "has help")
+}
+
+func TestControl(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		// commands are run in order.
+		commands [][]string
+		// error is the expected error of the last command, if any.
+		error string
+		// expected is the expected manifest afterward.
+		expected *storage.ControlManifest
+		// name is the name of the test.
+		name string
+	}{
+		{
+			name:     "Deprecate",
+			commands: [][]string{{"deprecate", "foo.old"}},
+			expected: &storage.ControlManifest{
+				Malicious:  []string{},
+				Deprecated: map[string]*storage.Deprecation{"foo.old": {}},
+			},
+		},
+		{
+			name: "DeprecateWithReplacement",
+			commands: [][]string{{
+				"deprecate", "foo.old",
+				"--replacement", "foo.new",
+				"--setting", "foo.enable",
+				"--info", "Use foo.new instead",
+				"--disallow-install",
+			}},
+			expected: &storage.ControlManifest{
+				Malicious: []string{},
+				Deprecated: map[string]*storage.Deprecation{"foo.old": {
+					AdditionalInfo:  "Use foo.new instead",
+					DisallowInstall: true,
+					Extension:       &storage.DeprecationExtension{ID: "foo.new", DisplayName: "foo.new"},
+					Settings:        []string{"foo.enable"},
+				}},
+			},
+		},
+		{
+			name:     "Block",
+			commands: [][]string{{"block", "foo.bad"}},
+			expected: &storage.ControlManifest{
+				Malicious:  []string{"foo.bad"},
+				Deprecated: map[string]*storage.Deprecation{},
+			},
+		},
+		{
+			name:     "BlockTwice",
+			commands: [][]string{{"block", "foo.bad"}, {"malicious", "foo.bad"}},
+			error:    "already blocked",
+		},
+		{
+			name: "Clear",
+			commands: [][]string{
+				{"block", "foo.bad"},
+				{"deprecate", "foo.bad"},
+				{"clear", "foo.bad"},
+			},
+			expected: &storage.ControlManifest{
+				Malicious:  []string{},
+				Deprecated: map[string]*storage.Deprecation{},
+			},
+		},
+		{
+			name:     "ClearNothing",
+			commands: [][]string{{"clear", "foo.bad"}},
+			error:    "neither deprecated nor blocked",
+		},
+		{
+			name:     "Version",
+			commands: [][]string{{"block", "foo.bad@1.0.0"}},
+			error:    "must not include a version",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			extdir := t.TempDir()
+			var err error
+			for _, command := range test.commands {
+				cmd := cli.Root()
+				cmd.SetArgs(append(append([]string{"control"}, command...), "--extensions-dir", extdir))
+				cmd.SetOut(new(bytes.Buffer))
+				err = cmd.Execute()
+			}
+
+			if test.error != "" {
+				require.Error(t, err)
+				require.Regexp(t, test.error, err.Error())
+				return
+			}
+			require.NoError(t, err)
+
+			cmd := cli.Root()
+			cmd.SetArgs([]string{"control", "show", "--extensions-dir", extdir})
+			buf := new(bytes.Buffer)
+			cmd.SetOut(buf)
+			err = cmd.Execute()
+			require.NoError(t, err)
+
+			var manifest storage.ControlManifest
+			err = json.Unmarshal(buf.Bytes(), &manifest)
+			require.NoError(t, err)
+			if manifest.Deprecated == nil {
+				manifest.Deprecated = map[string]*storage.Deprecation{}
+			}
+			require.Equal(t, test.expected, &manifest)
+		})
+	}
+}
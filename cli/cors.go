@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/coder/code-marketplace/api/httpmw"
+)
+
+// corsGroup is a group of routes with its own CORS policy.  Its flags are the
+// CORS flags prefixed with the group's prefix.
+type corsGroup struct {
+	prefix   string
+	name     string
+	defaults httpmw.CorsOptions
+}
+
+var corsGroups = []corsGroup{
+	{prefix: "", name: "gallery", defaults: httpmw.GalleryCors()},
+	{prefix: "admin-", name: "admin API", defaults: httpmw.AdminCors()},
+}
+
+// flag returns the name of one of the group's flags, for example
+// admin-cors-max-age for "max-age".
+func (g corsGroup) flag(name string) string {
+	return g.prefix + "cors-" + name
+}
+
+// names returns the names of the group's flags.
+func (g corsGroup) names() []string {
+	return []string{
+		g.flag("allowed-origins"),
+		g.flag("allowed-methods"),
+		g.flag("allowed-headers"),
+		g.flag("allow-credentials"),
+		g.flag("max-age"),
+	}
+}
+
+// corsFlags adds flags for the CORS policy of each group of routes.
+func corsFlags(cmd *cobra.Command) {
+	for _, g := range corsGroups {
+		cmd.Flags().StringSlice(g.flag("allowed-origins"), g.defaults.AllowedOrigins, "Origins allowed to make cross-origin requests to the "+g.name+", which may contain a * wildcard like https://*.example.com. * alone allows every origin and none disables cross-origin requests. Can be repeated or comma-separated.")
+		cmd.Flags().StringSlice(g.flag("allowed-methods"), g.defaults.AllowedMethods, "Methods cross-origin requests to the "+g.name+" can use. Can be repeated or comma-separated.")
+		cmd.Flags().StringSlice(g.flag("allowed-headers"), g.defaults.AllowedHeaders, "Headers cross-origin requests to the "+g.name+" can send. * allows every header. Can be repeated or comma-separated.")
+		cmd.Flags().Bool(g.flag("allow-credentials"), g.defaults.AllowCredentials, "Whether cross-origin requests to the "+g.name+" can include credentials like cookies.")
+		cmd.Flags().Duration(g.flag("max-age"), g.defaults.MaxAge, "How long browsers can cache preflight responses from the "+g.name+".")
+		configurable(cmd, g.names()...)
+	}
+}
+
+// corsFromFlags returns the gallery and admin API CORS policies from the flags
+// added by corsFlags.
+func corsFromFlags(flags *pflag.FlagSet) (gallery, admin *httpmw.CorsOptions, err error) {
+	policies := make([]*httpmw.CorsOptions, 0, len(corsGroups))
+	for _, g := range corsGroups {
+		policy := &httpmw.CorsOptions{}
+		if policy.AllowedOrigins, err = flags.GetStringSlice(g.flag("allowed-origins")); err != nil {
+			return nil, nil, err
+		}
+		if policy.AllowedMethods, err = flags.GetStringSlice(g.flag("allowed-methods")); err != nil {
+			return nil, nil, err
+		}
+		if policy.AllowedHeaders, err = flags.GetStringSlice(g.flag("allowed-headers")); err != nil {
+			return nil, nil, err
+		}
+		if policy.AllowCredentials, err = flags.GetBool(g.flag("allow-credentials")); err != nil {
+			return nil, nil, err
+		}
+		if policy.MaxAge, err = flags.GetDuration(g.flag("max-age")); err != nil {
+			return nil, nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies[0], policies[1], nil
+}
@@ -0,0 +1,156 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/code-marketplace/audit"
+	"github.com/coder/code-marketplace/storage"
+)
+
+func feature() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "feature",
+		Short: "Manage featured extensions",
+		Long: "Manage the ordered list of featured extensions, which VS Code shows " +
+			"in its featured and recommended views.",
+	}
+	cmd.AddCommand(featureAdd(), featureRemove(), featureList())
+	return cmd
+}
+
+func featureAdd() *cobra.Command {
+	var position int
+	addFlags, opts := serverFlags()
+	addAuditFlags, auditOpts := auditFlags()
+
+	cmd := &cobra.Command{
+		Use:   "add <id>",
+		Short: "Feature an extension",
+		Example: strings.Join([]string{
+			"  marketplace feature add publisher.extension --extensions-dir ./extensions",
+			"  marketplace feature add publisher.extension --position 1 --extensions-dir ./extensions",
+		}, "\n"),
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(cmd.Context())
+			defer cancel()
+
+			if position < 0 {
+				return xerrors.Errorf("position cannot be negative")
+			}
+
+			publisher, name, err := storage.ParseExtensionIDWithoutVersion(args[0])
+			if err != nil {
+				return err
+			}
+
+			store, err := storage.NewStorage(ctx, opts)
+			if err != nil {
+				return err
+			}
+
+			// The flag is one-based with zero meaning the end of the list.
+			err = storage.Feature(ctx, store, publisher, name, position-1)
+			auditOpts.record(cmd, audit.Event{
+				Action:    audit.ActionFeature,
+				Extension: storage.ExtensionIDWithoutVersion(publisher, name),
+			}, err)
+			if err != nil {
+				return err
+			}
+
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Featured %s\n", args[0])
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&position, "position", 0, "Position in the featured list, starting at 1.  Moves the extension if it is already featured.  Defaults to the end of the list.")
+	addFlags(cmd)
+	addAuditFlags(cmd)
+
+	return cmd
+}
+
+func featureRemove() *cobra.Command {
+	addFlags, opts := serverFlags()
+	addAuditFlags, auditOpts := auditFlags()
+
+	cmd := &cobra.Command{
+		Use:   "remove <id>",
+		Short: "Stop featuring an extension",
+		Example: strings.Join([]string{
+			"  marketplace feature remove publisher.extension --extensions-dir ./extensions",
+		}, "\n"),
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(cmd.Context())
+			defer cancel()
+
+			publisher, name, err := storage.ParseExtensionIDWithoutVersion(args[0])
+			if err != nil {
+				return err
+			}
+
+			store, err := storage.NewStorage(ctx, opts)
+			if err != nil {
+				return err
+			}
+
+			err = storage.Unfeature(ctx, store, publisher, name)
+			auditOpts.record(cmd, audit.Event{
+				Action:    audit.ActionUnfeature,
+				Extension: storage.ExtensionIDWithoutVersion(publisher, name),
+			}, err)
+			if err != nil {
+				return err
+			}
+
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Unfeatured %s\n", args[0])
+			return nil
+		},
+	}
+	addFlags(cmd)
+	addAuditFlags(cmd)
+
+	return cmd
+}
+
+func featureList() *cobra.Command {
+	addFlags, opts := serverFlags()
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List featured extensions in order",
+		Example: strings.Join([]string{
+			"  marketplace feature list --extensions-dir ./extensions",
+		}, "\n"),
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(cmd.Context())
+			defer cancel()
+
+			store, err := storage.NewStorage(ctx, opts)
+			if err != nil {
+				return err
+			}
+
+			featured, err := storage.ReadFeatured(ctx, store)
+			if err != nil {
+				return err
+			}
+
+			for _, id := range featured {
+				_, _ = fmt.Fprintln(cmd.OutOrStdout(), id)
+			}
+			return nil
+		},
+	}
+	addFlags(cmd)
+
+	return cmd
+}
@@ -0,0 +1,126 @@
+package cli_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/code-marketplace/cli"
+	"github.com/coder/code-marketplace/testutil"
+)
+
+func TestFeatureHelp(t *testing.T) {
+	t.Parallel()
+
+	cmd := cli.Root()
+	cmd.SetArgs([]string{"feature", "--help"})
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+
+	err := cmd.Execute()
+	require.NoError(t, err)
+
+	output := buf.String()
+	require.Contains(t, output, "Manage the ordered list of featured extensions", "has help")
+}
+
+func TestFeature(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		// commands are run in order.
+		commands [][]string
+		// error is the expected error of the last command, if any.
+		error string
+		// expected is the expected featured list afterward.
+		expected []string
+		// name is the name of the test.
+		name string
+	}{
+		{
+			name:     "Add",
+			commands: [][]string{{"add", "foo.zany"}, {"add", "foo.buz"}},
+			expected: []string{"foo.zany", "foo.buz"},
+		},
+		{
+			name:     "Position",
+			commands: [][]string{{"add", "foo.zany"}, {"add", "foo.buz", "--position", "1"}},
+			expected: []string{"foo.buz", "foo.zany"},
+		},
+		{
+			name:     "NegativePosition",
+			commands: [][]string{{"add", "foo.zany", "--position", "-1"}},
+			error:    "cannot be negative",
+		},
+		{
+			name:     "Remove",
+			commands: [][]string{{"add", "foo.zany"}, {"add", "foo.buz"}, {"remove", "foo.zany"}},
+			expected: []string{"foo.buz"},
+		},
+		{
+			name:     "AlreadyFeatured",
+			commands: [][]string{{"add", "foo.zany"}, {"add", "foo.zany"}},
+			error:    "already featured",
+		},
+		{
+			name:     "NotFeatured",
+			commands: [][]string{{"remove", "foo.zany"}},
+			error:    "not featured",
+		},
+		{
+			name:     "NotExist",
+			commands: [][]string{{"add", "foo.does-not-exist"}},
+			error:    "does not exist",
+		},
+		{
+			name:     "Version",
+			commands: [][]string{{"add", "foo.zany@1.0.0"}},
+			error:    "must not include a version",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			extdir := t.TempDir()
+			for _, ext := range testutil.Extensions {
+				for _, version := range ext.Versions {
+					manifestPath := filepath.Join(extdir, ext.Publisher, ext.Name, version.String(), "extension.vsixmanifest")
+					err := os.MkdirAll(filepath.Dir(manifestPath), 0o755)
+					require.NoError(t, err)
+					err = os.WriteFile(manifestPath, testutil.ConvertExtensionToManifestBytes(t, ext, version), 0o644)
+					require.NoError(t, err)
+				}
+			}
+
+			var err error
+			for _, command := range test.commands {
+				cmd := cli.Root()
+				cmd.SetArgs(append(append([]string{"feature"}, command...), "--extensions-dir", extdir))
+				cmd.SetOut(new(bytes.Buffer))
+				err = cmd.Execute()
+			}
+
+			if test.error != "" {
+				require.Error(t, err)
+				require.Regexp(t, test.error, err.Error())
+				return
+			}
+			require.NoError(t, err)
+
+			cmd := cli.Root()
+			cmd.SetArgs([]string{"feature", "list", "--extensions-dir", extdir})
+			buf := new(bytes.Buffer)
+			cmd.SetOut(buf)
+			err = cmd.Execute()
+			require.NoError(t, err)
+			require.Equal(t, test.expected, strings.Fields(buf.String()))
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/coder/code-marketplace/storage"
+	"github.com/coder/code-marketplace/storage/easyzip"
+)
+
+// zipLimitFlags adds flags for bounding the archives that can be added to the
+// storage configured by the provided options.
+func zipLimitFlags(opts *storage.Options) func(cmd *cobra.Command) {
+	limits := easyzip.DefaultLimits
+	opts.ZipLimits = &limits
+	return func(cmd *cobra.Command) {
+		cmd.Flags().IntVar(&limits.MaxEntries, "max-extension-files", limits.MaxEntries, "The maximum number of files in an extension. Zero means no limit.")
+		cmd.Flags().Int64Var(&limits.MaxFileSize, "max-extension-file-size", limits.MaxFileSize, "The maximum uncompressed size in bytes of a single file in an extension. Zero means no limit.")
+		cmd.Flags().Int64Var(&limits.MaxTotalSize, "max-extension-size", limits.MaxTotalSize, "The maximum uncompressed size in bytes of all the files in an extension. Zero means no limit.")
+		cmd.Flags().Int64Var(&limits.MaxCompressionRatio, "max-compression-ratio", limits.MaxCompressionRatio, "The maximum compression ratio of files in an extension that are at least 1 MiB uncompressed. Zero means no limit.")
+		configurable(cmd, "max-extension-files", "max-extension-file-size", "max-extension-size", "max-compression-ratio")
+	}
+}
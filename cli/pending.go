@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/code-marketplace/api"
+	"github.com/coder/code-marketplace/audit"
+	"github.com/coder/code-marketplace/storage"
+)
+
+func pending() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pending",
+		Short: "Review extensions awaiting approval",
+		Long: "Review extensions submitted through the admin API, which are not available " +
+			"until someone other than the person who submitted them approves them there.  " +
+			"Approving takes an admin token so it is not possible from the command line.",
+	}
+	cmd.AddCommand(pendingList(), pendingApprove(), pendingReject())
+	return cmd
+}
+
+func pendingList() *cobra.Command {
+	var jsonOut bool
+	addFlags, opts := serverFlags()
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List extensions awaiting approval",
+		Example: strings.Join([]string{
+			"  marketplace pending list --extensions-dir ./extensions",
+		}, "\n"),
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(cmd.Context())
+			defer cancel()
+
+			store, err := storage.NewStorage(ctx, opts)
+			if err != nil {
+				return err
+			}
+
+			pending, err := storage.ReadPending(ctx, store)
+			if err != nil {
+				return err
+			}
+			sorted := pending.Sorted()
+
+			if jsonOut {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(sorted)
+			}
+			if len(sorted) == 0 {
+				_, _ = fmt.Fprintln(cmd.OutOrStdout(), "No extensions are pending approval")
+				return nil
+			}
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			_, _ = fmt.Fprintln(tw, "ID\tSUBMITTED BY\tSUBMITTED AT\tSHA256")
+			for _, ext := range sorted {
+				_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", ext.ID(), ext.SubmittedBy, ext.SubmittedAt.Format(time.RFC3339), ext.SHA256)
+			}
+			return tw.Flush()
+		},
+	}
+
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Output JSON instead of a table.")
+	addFlags(cmd)
+
+	return cmd
+}
+
+// pendingApprove refuses to approve since the name of whoever runs it cannot be
+// verified, which is what keeps submitters from approving their own extensions.
+func pendingApprove() *cobra.Command {
+	return &cobra.Command{
+		Use:    "approve <id>",
+		Short:  "Approve a pending extension through the admin API instead",
+		Hidden: true,
+		// Accept the flags this used to take so the error below is what shows.
+		DisableFlagParsing: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return xerrors.Errorf("approving needs a verified second reviewer, use POST %s/pending/{id}/approve with an admin token", api.AdminPath)
+		},
+	}
+}
+
+func pendingReject() *cobra.Command {
+	var reason string
+	addFlags, opts := serverFlags()
+	addAuditFlags, auditOpts := auditFlags()
+
+	cmd := &cobra.Command{
+		Use:   "reject <id>",
+		Short: "Reject a pending extension, discarding it",
+		Example: strings.Join([]string{
+			"  marketplace pending reject publisher.extension@1.0.0 --reason \"bundles a miner\" --extensions-dir ./extensions",
+		}, "\n"),
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(cmd.Context())
+			defer cancel()
+
+			store, err := storage.NewStorage(ctx, opts)
+			if err != nil {
+				return err
+			}
+
+			err = storage.RejectPending(ctx, store, args[0], auditOpts.actor, reason)
+			auditOpts.record(cmd, pendingEvent(audit.ActionReject, args[0]), err)
+			if err != nil {
+				return err
+			}
+
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Rejected %s\n", args[0])
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&reason, "reason", "", "Why the extension was rejected, which is kept with the review.")
+	addFlags(cmd)
+	addAuditFlags(cmd)
+
+	return cmd
+}
+
+// pendingEvent returns an audit event for reviewing the pending extension with
+// the ID.  The ID is recorded as-is if it cannot be parsed.
+func pendingEvent(action audit.Action, id string) audit.Event {
+	event := audit.Event{Action: action, Extension: id}
+	publisher, name, version, err := storage.ParseExtensionIDWithPlatform(id)
+	if err == nil {
+		event.Extension = storage.ExtensionIDWithoutVersion(publisher, name)
+		event.Version = version.Version
+		event.TargetPlatform = version.TargetPlatform
+	}
+	return event
+}
@@ -0,0 +1,101 @@
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"cdr.dev/slog"
+	"github.com/coder/code-marketplace/audit"
+	"github.com/coder/code-marketplace/cli"
+	"github.com/coder/code-marketplace/storage"
+	"github.com/coder/code-marketplace/testutil"
+)
+
+func TestPendingHelp(t *testing.T) {
+	t.Parallel()
+
+	cmd := cli.Root()
+	cmd.SetArgs([]string{"pending", "--help"})
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+
+	err := cmd.Execute()
+	require.NoError(t, err)
+
+	output := buf.String()
+	require.Contains(t, output, "Review extensions", "has help")
+}
+
+func TestPending(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	extdir := filepath.Join(dir, "extensions")
+	log := filepath.Join(dir, "audit.jsonl")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "1.0.0.vsix"), testutil.CreateVSIXFromExtension(t, testutil.Extensions[0], storage.Version{Version: "1.0.0"}), 0o644))
+
+	ext := testutil.Extensions[0]
+	store, err := storage.NewLocalStorage(&storage.LocalOptions{ExtDir: extdir}, slog.Make())
+	require.NoError(t, err)
+
+	run := func(args ...string) (string, error) {
+		cmd := cli.Root()
+		cmd.SetArgs(append(args, "--extensions-dir", extdir))
+		buf := new(bytes.Buffer)
+		cmd.SetOut(buf)
+		cmd.SetErr(buf)
+		err := cmd.Execute()
+		return buf.String(), err
+	}
+
+	output, err := run("pending", "list")
+	require.NoError(t, err)
+	require.Contains(t, output, "No extensions are pending approval")
+
+	// Submissions come through the admin API so the submitter is known.
+	for _, version := range []string{"1.0.0", "2.0.0"} {
+		manifest := testutil.ConvertExtensionToManifest(ext, storage.Version{Version: version})
+		_, err = storage.AddPending(context.Background(), store, "alice", manifest, testutil.CreateVSIXFromManifest(t, manifest))
+		require.NoError(t, err)
+	}
+
+	output, err = run("pending", "list")
+	require.NoError(t, err)
+	require.Contains(t, output, "foo.zany@1.0.0")
+	require.Contains(t, output, "foo.zany@2.0.0")
+	require.Contains(t, output, "alice")
+
+	// Names on the command line are not verified so neither submitting nor
+	// approving is possible from it.
+	_, err = run("add", filepath.Join(dir, "1.0.0.vsix"), "--pending", "--actor", "alice")
+	require.ErrorContains(t, err, "unknown flag")
+	_, err = run("pending", "approve", "foo.zany@1.0.0", "--actor", "bob")
+	require.ErrorContains(t, err, "/api/admin/pending/{id}/approve")
+	_, err = os.Stat(filepath.Join(extdir, ext.Publisher, ext.Name, "1.0.0"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	output, err = run("pending", "reject", "foo.zany@2.0.0", "--actor", "bob", "--reason", "nope", "--audit-log", log)
+	require.NoError(t, err)
+	require.Contains(t, output, "Rejected foo.zany@2.0.0")
+
+	_, err = run("pending", "reject", "foo.zany@2.0.0", "--actor", "bob")
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	output, err = run("pending", "list")
+	require.NoError(t, err)
+	require.Contains(t, output, "foo.zany@1.0.0")
+	require.NotContains(t, output, "foo.zany@2.0.0")
+
+	events, err := audit.NewFile(log).Read(audit.Filter{})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, audit.ActionReject, events[0].Action)
+	require.Equal(t, "bob", events[0].Actor)
+	require.Equal(t, "foo.zany", events[0].Extension)
+	require.Equal(t, "2.0.0", events[0].Version)
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/code-marketplace/api"
+	"github.com/coder/code-marketplace/ratelimit"
+)
+
+// rateLimitOptions configures how clients are identified and counted for rate
+// limiting.  The limits themselves can be reloaded so they are read from the
+// flags instead; see apiSettings.
+type rateLimitOptions struct {
+	trustedProxies []string
+	redisURL       string
+}
+
+// rateLimitFlags adds flags for rate limiting.
+func rateLimitFlags() (addFlags func(cmd *cobra.Command), opts *rateLimitOptions) {
+	opts = &rateLimitOptions{}
+	return func(cmd *cobra.Command) {
+		cmd.Flags().Int("rate-limit", api.RateLimitDefault, "The maximum number of requests per minute from a single client to routes other than queries and downloads. Clients are identified by their admin token or IP. Negative values disable rate limiting.")
+		cmd.Flags().Int("rate-limit-query", api.QueryRateLimitDefault, "The maximum number of extension queries per minute from a single client. Negative values disable rate limiting.")
+		cmd.Flags().Int("rate-limit-download", api.DownloadRateLimitDefault, "The maximum number of file and asset requests per minute from a single client. Negative values disable rate limiting.")
+		cmd.Flags().StringSliceVar(&opts.trustedProxies, "trusted-proxies", nil, "IPs or CIDR ranges of reverse proxies whose X-Forwarded-For and Forwarded headers identify clients for rate limiting. Can be repeated or comma-separated.")
+		cmd.Flags().StringVar(&opts.redisURL, "rate-limit-redis", "", "A Redis URL, like redis://:password@host:6379/0, to share rate limit counts between replicas. Counts are kept in memory by default.")
+		configurable(cmd, "rate-limit", "rate-limit-query", "rate-limit-download", "trusted-proxies")
+		secret(cmd, "rate-limit-redis")
+	}, opts
+}
+
+// proxies parses the trusted proxies.  Single IPs are treated as a range of
+// one.
+func (o *rateLimitOptions) proxies() ([]netip.Prefix, error) {
+	prefixes := []netip.Prefix{}
+	for _, value := range o.trustedProxies {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(value)
+			if addrErr != nil {
+				return nil, xerrors.Errorf("%q is not a valid IP or CIDR range", value)
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// counter returns the rate limit counter along with a function to close it.
+// Without Redis the counter is nil and the API counts in memory.
+func (o *rateLimitOptions) counter(ctx context.Context) (ratelimit.Counter, func(), error) {
+	if o.redisURL == "" {
+		return nil, func() {}, nil
+	}
+	redis, err := ratelimit.NewRedis(ctx, o.redisURL)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("rate limit redis: %w", err)
+	}
+	return redis, func() { _ = redis.Close() }, nil
+}
@@ -0,0 +1,160 @@
+package cli
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+	"github.com/coder/code-marketplace/api"
+	"github.com/coder/code-marketplace/database"
+	"github.com/coder/code-marketplace/storage"
+)
+
+// reloadableSettings take effect when the server reloads its configuration.
+// Changes to any other setting are only picked up by restarting.
+func reloadableSettings() []string {
+	settings := []string{
+		"list-cache-duration",
+		"max-page-size",
+		"rate-limit",
+		"rate-limit-query",
+		"rate-limit-download",
+	}
+	for _, g := range corsGroups {
+		settings = append(settings, g.names()...)
+	}
+	return settings
+}
+
+// resolveSettings returns the flags of the command as they would be if it were
+// run again now.  Flags from the command line keep their values while the rest
+// are read again from the environment and config file.
+func resolveSettings(cmd *cobra.Command) (*pflag.FlagSet, error) {
+	path := strings.Fields(cmd.CommandPath())[1:]
+	fresh, _, err := Root().Find(path)
+	if err != nil {
+		return nil, err
+	}
+	// Parsing merges in the persistent flags, like --config.
+	if err := fresh.ParseFlags(nil); err != nil {
+		return nil, err
+	}
+	var copyErr error
+	cmd.Flags().Visit(func(flag *pflag.Flag) {
+		if copyErr != nil {
+			return
+		}
+		target := fresh.Flags().Lookup(flag.Name)
+		if target == nil {
+			copyErr = xerrors.Errorf("flag %q is missing", flag.Name)
+			return
+		}
+		copyErr = copyFlag(target, flag)
+		target.Changed = true
+	})
+	if copyErr != nil {
+		return nil, copyErr
+	}
+	if err := applyConfig(fresh); err != nil {
+		return nil, err
+	}
+	return fresh.Flags(), nil
+}
+
+// copyFlag sets the value of one flag to the value of another of the same type.
+func copyFlag(dst, src *pflag.Flag) error {
+	if slice, ok := src.Value.(pflag.SliceValue); ok {
+		return dst.Value.(pflag.SliceValue).Replace(slice.GetSlice())
+	}
+	return dst.Value.Set(src.Value.String())
+}
+
+// apiSettings returns the API settings from the server's flags.
+func apiSettings(flags *pflag.FlagSet) (api.Settings, error) {
+	var (
+		settings api.Settings
+		err      error
+	)
+	if settings.MaxPageSize, err = flags.GetInt("max-page-size"); err != nil {
+		return api.Settings{}, err
+	}
+	if settings.RateLimit, err = flags.GetInt("rate-limit"); err != nil {
+		return api.Settings{}, err
+	}
+	if settings.QueryRateLimit, err = flags.GetInt("rate-limit-query"); err != nil {
+		return api.Settings{}, err
+	}
+	if settings.DownloadRateLimit, err = flags.GetInt("rate-limit-download"); err != nil {
+		return api.Settings{}, err
+	}
+	if settings.GalleryCors, settings.AdminCors, err = corsFromFlags(flags); err != nil {
+		return api.Settings{}, err
+	}
+	return settings, nil
+}
+
+// reloadServer reads the configuration again and applies the settings that can
+// change while the server is running.  Each changed setting is logged along
+// with whether it needs a restart.
+func reloadServer(ctx context.Context, cmd *cobra.Command, logger slog.Logger, mapi *api.API, store storage.Storage, db *database.NoDB) error {
+	fresh, err := resolveSettings(cmd)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	reloadable := reloadableSettings()
+	var reloaded []*pflag.Flag
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if !hasAnnotation(flag, configurableAnnotation) {
+			return
+		}
+		next := fresh.Lookup(flag.Name)
+		if next == nil || next.Value.String() == flag.Value.String() {
+			return
+		}
+		changed = true
+		fields := []any{
+			slog.F("setting", flag.Name),
+			slog.F("old", configValue(flag)),
+			slog.F("new", configValue(next)),
+		}
+		if slices.Contains(reloadable, flag.Name) {
+			logger.Info(ctx, "Setting changed", fields...)
+			reloaded = append(reloaded, flag)
+		} else {
+			logger.Warn(ctx, "Setting changed but needs a restart to take effect", fields...)
+		}
+	})
+	if !changed {
+		logger.Info(ctx, "Reloaded configuration without changes")
+		return nil
+	}
+
+	settings, err := apiSettings(fresh)
+	if err != nil {
+		return err
+	}
+	listCacheDuration, err := fresh.GetDuration("list-cache-duration")
+	if err != nil {
+		return err
+	}
+	mapi.UpdateSettings(settings)
+	storage.SetListCacheDuration(store, listCacheDuration)
+	db.SetIndexRefreshInterval(listCacheDuration)
+
+	// Remember what was applied so the next reload only reports new changes.
+	// Settings that need a restart keep their old values since those are still
+	// the ones in effect.
+	for _, flag := range reloaded {
+		if err := copyFlag(flag, fresh.Lookup(flag.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
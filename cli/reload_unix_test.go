@@ -0,0 +1,108 @@
+//go:build !windows
+
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"regexp"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/code-marketplace/api"
+	"github.com/coder/code-marketplace/cli"
+)
+
+// syncBuffer is a buffer that can be written to by the server while the test
+// reads it.
+type syncBuffer struct {
+	buf   bytes.Buffer
+	mutex sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+func TestServerReload(t *testing.T) {
+	t.Parallel()
+
+	name := writeConfig(t, "max-page-size: 10\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := cli.Root()
+	cmd.SetArgs([]string{"server", "--extensions-dir", t.TempDir(), "--address", "127.0.0.1:0", "--config", name})
+	out := &syncBuffer{}
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.ExecuteContext(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		require.NoError(t, <-done)
+	})
+
+	addressRe := regexp.MustCompile(`Started API server.*address=(\S+)`)
+	var address string
+	require.Eventually(t, func() bool {
+		match := addressRe.FindStringSubmatch(out.String())
+		if match != nil {
+			address = match[1]
+		}
+		return match != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The server listens before it is ready.
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://" + address + "/readyz")
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		var health api.HealthResponse
+		if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+			return false
+		}
+		return resp.StatusCode == http.StatusOK &&
+			health.Components["storage"].Status == api.HealthOK &&
+			health.Components["database"].Status == api.HealthOK
+	}, 5*time.Second, 10*time.Millisecond)
+
+	query := func(pageSize string) int {
+		body := `{"filters":[{"pageSize":` + pageSize + `}]}`
+		resp, err := http.Post("http://"+address+"/api/extensionquery", "application/json", bytes.NewReader([]byte(body)))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	require.Equal(t, http.StatusBadRequest, query("20"))
+
+	require.NoError(t, os.WriteFile(name, []byte("max-page-size: 50\nmax-filters: 20\n"), 0o600))
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	require.Eventually(t, func() bool {
+		return query("20") == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+
+	output := out.String()
+	require.Regexp(t, `Setting changed.*setting=max-page-size.*old=10.*new=50`, output)
+	require.Regexp(t, `needs a restart.*setting=max-filters`, output)
+	// The server is still running after reloading.
+	require.Equal(t, http.StatusOK, query("20"))
+}
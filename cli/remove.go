@@ -10,21 +10,26 @@ import (
 	"github.com/spf13/cobra"
 	"golang.org/x/xerrors"
 
+	"github.com/coder/code-marketplace/audit"
 	"github.com/coder/code-marketplace/storage"
 	"github.com/coder/code-marketplace/util"
 )
 
 func remove() *cobra.Command {
 	var (
-		all bool
+		all      bool
+		platform string
 	)
 	addFlags, opts := serverFlags()
+	addAuditFlags, auditOpts := auditFlags()
+	addWebhookFlags, webhookOpts := webhookFlags()
 
 	cmd := &cobra.Command{
 		Use:   "remove <id>",
 		Short: "Remove an extension from the marketplace",
 		Example: strings.Join([]string{
 			"  marketplace remove publisher.extension@1.0.0 --extensions-dir ./extensions",
+			"  marketplace remove publisher.extension@1.0.0@linux-x64 --extensions-dir ./extensions",
 			"  marketplace remove publisher.extension --all --artifactory http://artifactory.server/artifactory --repo extensions",
 		}, "\n"),
 		Args: cobra.ExactArgs(1),
@@ -36,16 +41,30 @@ func remove() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			store, dispatcher, err := webhookOpts.wrap(store, opts.Logger)
+			if err != nil {
+				return err
+			}
+			defer flushWebhooks(ctx, cmd, dispatcher)
 
 			targetId := args[0]
-			publisher, name, versionStr, err := storage.ParseExtensionID(targetId)
+			publisher, name, version, err := storage.ParseExtensionIDWithPlatform(targetId)
 			if err != nil {
 				return err
 			}
 
-			version := storage.Version{Version: versionStr}
+			if platform != "" {
+				if version.TargetPlatform != "" {
+					return xerrors.Errorf("cannot specify both --platform and platform %s", version.TargetPlatform)
+				}
+				version.TargetPlatform = storage.Platform(platform)
+				if err := storage.ValidatePlatform(version.TargetPlatform); err != nil {
+					return err
+				}
+			}
+
 			if version.Version != "" && all {
-				return xerrors.Errorf("cannot specify both --all and version %s", version)
+				return xerrors.Errorf("cannot specify both --all and version %s", version.Version)
 			}
 
 			allVersions, err := store.Versions(ctx, publisher, name)
@@ -63,17 +82,9 @@ func remove() *cobra.Command {
 				)
 			}
 
-			// TODO: Allow deleting by platform as well?
-			var toDelete []storage.Version
-			if all {
-				toDelete = allVersions
-			} else {
-				for _, sv := range allVersions {
-					if version.Version == sv.Version {
-						toDelete = append(toDelete, sv)
-					}
-				}
-			}
+			// With --all the version is blank so this matches every version, or
+			// every version of the platform if there is one.
+			toDelete := storage.MatchVersions(allVersions, version)
 			if len(toDelete) == 0 {
 				return xerrors.Errorf("%s does not exist", targetId)
 			}
@@ -81,7 +92,19 @@ func remove() *cobra.Command {
 			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Removing %s...\n", util.Plural(len(toDelete), "version", ""))
 			var failed []string
 			for _, delete := range toDelete {
-				err = store.RemoveExtension(ctx, publisher, name, delete)
+				// A blank platform would remove every platform of the version so be
+				// explicit about only removing the universal build.
+				target := delete
+				if target.IsUniversal() {
+					target.TargetPlatform = storage.PlatformUniversal
+				}
+				err = store.RemoveExtension(ctx, publisher, name, target)
+				auditOpts.record(cmd, audit.Event{
+					Action:         audit.ActionRemove,
+					Extension:      storage.ExtensionIDWithoutVersion(publisher, name),
+					Version:        delete.Version,
+					TargetPlatform: target.TargetPlatform,
+				}, err)
 				if err != nil {
 					_, _ = fmt.Fprintf(cmd.OutOrStdout(), "  - %s (%s)\n", delete, err)
 					failed = append(failed, delete.String())
@@ -101,7 +124,10 @@ func remove() *cobra.Command {
 	}
 
 	cmd.Flags().BoolVar(&all, "all", false, "Whether to delete all versions of the extension.")
+	cmd.Flags().StringVar(&platform, "platform", "", "Only delete versions for this platform.  Can be combined with --all to delete every version for the platform.")
 	addFlags(cmd)
+	addAuditFlags(cmd)
+	addWebhookFlags(cmd)
 
 	return cmd
 }
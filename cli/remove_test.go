@@ -42,8 +42,12 @@ func TestRemove(t *testing.T) {
 		// extension is the extension to remove.  Every version of
 		// testutil.Extensions[0] will be added before each test.
 		extension testutil.Extension
+		// kept contains versions that should not have been deleted, if any.
+		kept []storage.Version
 		// name is the name of the test.
 		name string
+		// platform is the value for --platform, if any.
+		platform string
 		// version is the version to remove.
 		version string
 	}{
@@ -122,13 +126,79 @@ func TestRemove(t *testing.T) {
 			all:       true,
 		},
 		{
-			// Cannot target specific platforms at the moment.  If we wanted this
-			// we would likely need to use a `--platform` flag since we already use @
-			// to delineate the version.
-			name:      "NoPlatformTarget",
-			error:     "does not exist",
+			name:      "RemovePlatform",
 			extension: testutil.Extensions[0],
 			version:   "1.0.0@win32-x64",
+			expected: []storage.Version{
+				{Version: "1.0.0", TargetPlatform: storage.PlatformWin32X64},
+			},
+			kept: []storage.Version{
+				{Version: "1.0.0"},
+			},
+		},
+		{
+			name:      "RemoveUniversal",
+			extension: testutil.Extensions[0],
+			version:   "3.0.0@universal",
+			expected: []storage.Version{
+				{Version: "3.0.0"},
+			},
+			kept: []storage.Version{
+				{Version: "3.0.0", TargetPlatform: storage.PlatformLinuxX64},
+			},
+		},
+		{
+			name:      "PlatformFlag",
+			extension: testutil.Extensions[0],
+			version:   "3.0.0",
+			platform:  "linux-x64",
+			expected: []storage.Version{
+				{Version: "3.0.0", TargetPlatform: storage.PlatformLinuxX64},
+			},
+			kept: []storage.Version{
+				{Version: "3.0.0"},
+				{Version: "3.0.0", TargetPlatform: storage.PlatformLinuxArm64},
+			},
+		},
+		{
+			name:      "AllWithPlatform",
+			extension: testutil.Extensions[0],
+			all:       true,
+			platform:  "win32-x64",
+			expected: []storage.Version{
+				{Version: "1.0.0", TargetPlatform: storage.PlatformWin32X64},
+				{Version: "3.0.0", TargetPlatform: storage.PlatformWin32X64},
+			},
+			kept: []storage.Version{
+				{Version: "1.0.0"},
+				{Version: "3.0.0"},
+			},
+		},
+		{
+			name:      "PlatformWithoutVersion",
+			error:     "target a specific version or pass --all",
+			extension: testutil.Extensions[0],
+			platform:  "win32-x64",
+		},
+		{
+			name:      "PlatformTwice",
+			error:     "cannot specify both",
+			extension: testutil.Extensions[0],
+			version:   "3.0.0@linux-x64",
+			platform:  "win32-x64",
+		},
+		{
+			name:      "InvalidPlatform",
+			error:     "not a valid platform",
+			extension: testutil.Extensions[0],
+			version:   "3.0.0",
+			platform:  "linux-x86",
+		},
+		{
+			name:      "NoPlatform",
+			error:     "does not exist",
+			extension: testutil.Extensions[0],
+			version:   "2.0.0@linux-x64",
 		},
 	}
 
@@ -157,6 +227,9 @@ func TestRemove(t *testing.T) {
 			if test.all {
 				args = append(args, "--all")
 			}
+			if test.platform != "" {
+				args = append(args, "--platform", test.platform)
+			}
 			cmd.SetArgs(args)
 			buf := new(bytes.Buffer)
 			cmd.SetOut(buf)
@@ -183,6 +256,11 @@ func TestRemove(t *testing.T) {
 					require.Contains(t, output, fmt.Sprintf("  - %s\n", version))
 				}
 			}
+			for _, version := range test.kept {
+				dest := filepath.Join(extdir, test.extension.Publisher, test.extension.Name, version.String())
+				_, err := os.Stat(dest)
+				require.NoError(t, err)
+			}
 		})
 	}
 }
@@ -17,9 +17,16 @@ func Root() *cobra.Command {
 		}, "\n"),
 	}
 
-	cmd.AddCommand(add(), remove(), server(), version(), signature())
+	cmd.AddCommand(add(), validate(), remove(), unpublish(), republish(), control(), feature(), pending(), auditLog(), server(), config(), version(), signature())
 
 	cmd.PersistentFlags().BoolP("verbose", "v", false, "Enable verbose output")
+	cmd.PersistentFlags().String("config", "", "A YAML config file with settings keyed by flag name. Can also be set with "+configEnvKey+".")
+	_ = cmd.PersistentFlags().SetAnnotation("verbose", configurableAnnotation, []string{"true"})
+
+	// Settings not passed as flags come from the environment or config file.
+	cmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		return applyConfig(cmd)
+	}
 
 	return cmd
 }
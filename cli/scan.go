@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"cdr.dev/slog"
+	"github.com/coder/code-marketplace/scan"
+	"github.com/coder/code-marketplace/storage"
+)
+
+// scanOptions configures scanning extensions before they are added.
+type scanOptions struct {
+	clamd         string
+	command       string
+	quarantineDir string
+	rules         []string
+}
+
+// scanFlags adds flags for scanning extensions before they are added.
+func scanFlags() (addFlags func(cmd *cobra.Command), opts *scanOptions) {
+	opts = &scanOptions{}
+	return func(cmd *cobra.Command) {
+		cmd.Flags().StringVar(&opts.command, "scan-command", "", "A command to run on each VSIX, which is passed as the last argument. Exiting with 1 rejects the extension and any other non-zero exit fails the add.")
+		cmd.Flags().StringVar(&opts.clamd, "clamd", "", "The address of a ClamAV daemon to scan each VSIX with, either a socket path, unix:///path, host:port, or tcp://host:port.")
+		cmd.Flags().StringSliceVar(&opts.rules, "scan-rules", nil, "Built-in rules that reject extensions containing suspicious files ("+strings.Join(scan.RuleNames(), ", ")+"). Can be repeated or comma-separated.")
+		cmd.Flags().StringVar(&opts.quarantineDir, "scan-quarantine-dir", "", "Keep rejected extensions and their findings in this directory.")
+		configurable(cmd, "scan-command", "clamd", "scan-rules", "scan-quarantine-dir")
+	}, opts
+}
+
+// wrap returns storage that scans extensions with the configured scanners
+// before adding them.  If no scanners are configured the storage is returned
+// as-is.
+func (o *scanOptions) wrap(store storage.Storage, logger slog.Logger) (storage.Storage, error) {
+	scanners := scan.Multi{}
+	if len(o.rules) > 0 {
+		rules, err := scan.NewRules(o.rules)
+		if err != nil {
+			return nil, err
+		}
+		scanners = append(scanners, rules)
+	}
+	if o.command != "" {
+		command, err := scan.NewCommand(o.command)
+		if err != nil {
+			return nil, err
+		}
+		scanners = append(scanners, command)
+	}
+	if o.clamd != "" {
+		clamd, err := scan.NewClamd(o.clamd)
+		if err != nil {
+			return nil, err
+		}
+		scanners = append(scanners, clamd)
+	}
+	if len(scanners) == 0 {
+		return store, nil
+	}
+	return scan.NewStorage(store, scanners, o.quarantineDir, logger), nil
+}
@@ -0,0 +1,101 @@
+package cli_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/code-marketplace/cli"
+	"github.com/coder/code-marketplace/storage"
+	"github.com/coder/code-marketplace/testutil"
+)
+
+func TestScan(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	ext := testutil.Extensions[0]
+	version := storage.Version{Version: ext.LatestVersion}
+	source := filepath.Join(dir, "ext.vsix")
+	require.NoError(t, os.WriteFile(source, testutil.CreateVSIXFromExtension(t, ext, version), 0o644))
+
+	clean := filepath.Join(dir, "clean.sh")
+	require.NoError(t, os.WriteFile(clean, []byte("#!/bin/sh\nexit 0\n"), 0o755))
+	infected := filepath.Join(dir, "infected.sh")
+	require.NoError(t, os.WriteFile(infected, []byte("#!/bin/sh\necho Evil.Signature FOUND\nexit 1\n"), 0o755))
+
+	tests := []struct {
+		name  string
+		args  []string
+		error string
+		added bool
+		// quarantine means to pass --scan-quarantine-dir.
+		quarantine bool
+	}{
+		{
+			name:  "Clean",
+			args:  []string{"--scan-command", clean, "--scan-rules", "native-binary,obfuscated-js"},
+			added: true,
+		},
+		{
+			name:  "Rejected",
+			args:  []string{"--scan-command", infected},
+			error: "rejected by scanning: command: Evil.Signature FOUND",
+		},
+		{
+			name:       "Quarantined",
+			args:       []string{"--scan-command", infected},
+			quarantine: true,
+			error:      "quarantined to",
+		},
+		{
+			name:  "InvalidRule",
+			args:  []string{"--scan-rules", "foo"},
+			error: `"foo" is not a scan rule`,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			extdir := t.TempDir()
+			quarantine := filepath.Join(t.TempDir(), "quarantine")
+			args := append([]string{"add", source, "--extensions-dir", extdir}, test.args...)
+			if test.quarantine {
+				args = append(args, "--scan-quarantine-dir", quarantine)
+			}
+
+			cmd := cli.Root()
+			cmd.SetArgs(args)
+			buf := new(bytes.Buffer)
+			cmd.SetOut(buf)
+			cmd.SetErr(buf)
+			err := cmd.Execute()
+			if test.error != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), test.error)
+			} else {
+				require.NoError(t, err)
+			}
+
+			_, err = os.Stat(filepath.Join(extdir, ext.Publisher, ext.Name, version.String()))
+			if test.added {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+
+			_, err = os.Stat(filepath.Join(quarantine, storage.ExtensionVSIXName(ext.Publisher, ext.Name, version)+".vsix"))
+			if test.quarantine {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
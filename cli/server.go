@@ -5,8 +5,11 @@ import (
 	"errors"
 	"net"
 	"net/http"
+	"os"
 	"os/signal"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -18,6 +21,7 @@ import (
 	"github.com/coder/code-marketplace/api"
 	"github.com/coder/code-marketplace/database"
 	"github.com/coder/code-marketplace/storage"
+	"github.com/coder/code-marketplace/tlsconfig"
 )
 
 func serverFlags() (addFlags func(cmd *cobra.Command), opts *storage.Options) {
@@ -26,11 +30,16 @@ func serverFlags() (addFlags func(cmd *cobra.Command), opts *storage.Options) {
 		cmd.Flags().StringVar(&opts.ExtDir, "extensions-dir", "", "The path to extensions.")
 		cmd.Flags().StringVar(&opts.Artifactory, "artifactory", "", "Artifactory server URL.")
 		cmd.Flags().StringVar(&opts.Repo, "repo", "", "Artifactory repository.")
+		cmd.Flags().StringVar(&opts.ArtifactoryToken, "artifactory-token", "", "Artifactory token. Prefer setting it in the config file or environment over passing it as a flag. Defaults to "+storage.ArtifactoryTokenEnvKey+".")
+		configurable(cmd, "extensions-dir", "artifactory", "repo")
+		secret(cmd, "artifactory-token")
 
 		if cmd.Use == "server" {
 			// Server only flags
 			cmd.Flags().BoolVar(&opts.IncludeEmptySignatures, "sign", false, "Includes an empty signature for all extensions.")
 			cmd.Flags().DurationVar(&opts.ListCacheDuration, "list-cache-duration", time.Minute, "The duration of the extension cache.")
+			cmd.Flags().IntVar(&opts.ManifestConcurrency, "manifest-concurrency", storage.ManifestConcurrencyDefault, "The maximum number of manifests to fetch from Artifactory at the same time.")
+			configurable(cmd, "sign", "list-cache-duration", "manifest-concurrency")
 		}
 
 		var before func(cmd *cobra.Command, args []string) error
@@ -64,12 +73,51 @@ func cmdLogger(cmd *cobra.Command) slog.Logger {
 	return logger
 }
 
+// parseAdminTokens turns a list of `token` or `name:token` values into a map of
+// tokens to names.  Tokens without a name are given the name "admin".
+func parseAdminTokens(values []string) (map[string]string, error) {
+	tokens := map[string]string{}
+	for _, value := range values {
+		name, token, ok := strings.Cut(value, ":")
+		if !ok {
+			name, token = "admin", value
+		}
+		if token == "" || name == "" {
+			return nil, xerrors.Errorf("admin token %q must not have an empty name or token", value)
+		}
+		tokens[token] = name
+	}
+	return tokens, nil
+}
+
+// parsePlatforms validates a list of platforms.
+func parsePlatforms(values []string) ([]storage.Platform, error) {
+	platforms := []storage.Platform{}
+	for _, value := range values {
+		platform := storage.Platform(strings.ToLower(strings.TrimSpace(value)))
+		if !slices.Contains(storage.Platforms, platform) {
+			return nil, xerrors.Errorf("%q is not a valid platform", value)
+		}
+		platforms = append(platforms, platform)
+	}
+	return platforms, nil
+}
+
 func server() *cobra.Command {
 	var (
 		address     string
-		maxpagesize int
+		adminTokens []string
+		maxfilters  int
+		platforms   []string
 	)
 	addFlags, opts := serverFlags()
+	addLimitFlags := zipLimitFlags(opts)
+	addAuditFlags, auditOpts := auditFlags()
+	addScanFlags, scanOpts := scanFlags()
+	addWebhookFlags, webhookOpts := webhookFlags()
+	addTracingFlags, tracingOpts := tracingFlags()
+	addTLSFlags, tlsOpts := tlsFlags()
+	addRateLimitFlags, rateLimitOpts := rateLimitFlags()
 
 	cmd := &cobra.Command{
 		Use:   "server",
@@ -83,13 +131,51 @@ func server() *cobra.Command {
 			defer cancel()
 			logger := opts.Logger
 
+			tokens, err := parseAdminTokens(adminTokens)
+			if err != nil {
+				return err
+			}
+
+			allowedPlatforms, err := parsePlatforms(platforms)
+			if err != nil {
+				return err
+			}
+
+			settings, err := apiSettings(cmd.Flags())
+			if err != nil {
+				return err
+			}
+
+			trustedProxies, err := rateLimitOpts.proxies()
+			if err != nil {
+				return err
+			}
+
+			tlsConfig, certReloader, err := tlsOpts.config(logger)
+			if err != nil {
+				return err
+			}
+
 			notifyCtx, notifyStop := signal.NotifyContext(ctx, interruptSignals...)
 			defer notifyStop()
+			reloadCh := make(chan os.Signal, 1)
+			if len(reloadSignals) > 0 {
+				signal.Notify(reloadCh, reloadSignals...)
+				defer signal.Stop(reloadCh)
+			}
 
-			store, err := storage.NewStorage(ctx, opts)
+			tracerProvider, flushTraces, err := tracingOpts.provider(ctx, logger)
 			if err != nil {
 				return err
 			}
+			defer flushTraces()
+			opts.TracerProvider = tracerProvider
+
+			rateLimitCounter, closeCounter, err := rateLimitOpts.counter(ctx)
+			if err != nil {
+				return err
+			}
+			defer closeCounter()
 
 			// A separate listener is required to get the resulting address (as
 			// opposed to using http.ListenAndServe()).
@@ -102,31 +188,146 @@ func server() *cobra.Command {
 			if !valid {
 				return xerrors.New("must be listening on tcp")
 			}
-			logger.Info(ctx, "Started API server", slog.F("address", tcpAddr))
 
-			// Always no database for now.
-			database := &database.NoDB{
-				Storage: store,
-				Logger:  logger,
+			if certReloader != nil {
+				go certReloader.Watch(ctx, tlsconfig.WatchIntervalDefault)
 			}
 
-			// Start the API server.
-			mapi := api.New(&api.Options{
-				Database:    database,
-				Storage:     store,
-				Logger:      logger,
-				MaxPageSize: maxpagesize,
-			})
+			// Serve as soon as possible so probes can tell the server is alive
+			// while storage is set up.  Until then it reports as not ready.
+			var handler atomic.Pointer[http.Handler]
+			starting := api.Starting()
+			handler.Store(&starting)
+			protocols := &http.Protocols{}
+			protocols.SetHTTP1(true)
+			protocols.SetHTTP2(true)
 			server := &http.Server{
-				Handler: mapi.Handler,
+				Handler: http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+					(*handler.Load()).ServeHTTP(rw, r)
+				}),
 				BaseContext: func(_ net.Listener) context.Context {
 					return ctx
 				},
+				Protocols: protocols,
+				TLSConfig: tlsConfig,
 			}
+			// Close is a no-op after a graceful shutdown but stops the server if
+			// starting up fails.
+			defer server.Close()
 			eg := errgroup.Group{}
 			eg.Go(func() error {
+				if tlsConfig != nil {
+					// The certificate comes from the TLS config.
+					return server.ServeTLS(listener, "", "")
+				}
 				return server.Serve(listener)
 			})
+			logger.Info(ctx, "Started API server", slog.F("address", tcpAddr), slog.F("tls", tlsConfig != nil))
+
+			store, err := storage.NewStorage(ctx, opts)
+			if err != nil {
+				return err
+			}
+			store, dispatcher, err := webhookOpts.wrap(store, opts.Logger)
+			if err != nil {
+				return err
+			}
+			if dispatcher != nil {
+				go dispatcher.Run(ctx)
+			}
+			// Pending extensions are scanned when they are approved.
+			store, err = scanOpts.wrap(store, opts.Logger)
+			if err != nil {
+				return err
+			}
+
+			// Seed the manifest cache in the background.  Queries are answered
+			// from what has been cached so far and readiness waits for it, so
+			// keep trying if it fails.
+			go func() {
+				for {
+					err := storage.Seed(ctx, store)
+					if err == nil || ctx.Err() != nil {
+						return
+					}
+					logger.Error(ctx, "Unable to seed manifest cache, retrying...", slog.Error(err))
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(10 * time.Second):
+					}
+				}
+			}()
+
+			// Always no database for now.
+			database := &database.NoDB{
+				Storage:        store,
+				Logger:         logger,
+				Platforms:      allowedPlatforms,
+				TracerProvider: tracerProvider,
+			}
+			database.SetIndexRefreshInterval(opts.ListCacheDuration)
+
+			// Start the API server.
+			mapi := api.New(&api.Options{
+				AdminCors:         settings.AdminCors,
+				AdminTokens:       tokens,
+				Audit:             auditOpts.sink(),
+				GalleryCors:       settings.GalleryCors,
+				RateLimit:         settings.RateLimit,
+				QueryRateLimit:    settings.QueryRateLimit,
+				DownloadRateLimit: settings.DownloadRateLimit,
+				RateLimitCounter:  rateLimitCounter,
+				TrustedProxies:    trustedProxies,
+				Database:          database,
+				Storage:           store,
+				Logger:            logger,
+				MaxFilters:        maxfilters,
+				MaxPageSize:       settings.MaxPageSize,
+				TracerProvider:    tracerProvider,
+			})
+			// Reload the certificate and configuration on SIGHUP.
+			go func() {
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-reloadCh:
+					}
+					logger.Info(ctx, "Reloading...")
+					if certReloader != nil {
+						if err := certReloader.Reload(); err != nil {
+							logger.Error(ctx, "Unable to reload certificate", slog.Error(err))
+						} else {
+							logger.Info(ctx, "Reloaded certificate")
+						}
+					}
+					if err := reloadServer(ctx, cmd, logger, mapi, store, database); err != nil {
+						logger.Error(ctx, "Unable to reload configuration", slog.Error(err))
+					}
+				}
+			}()
+
+			handler.Store(&mapi.Handler)
+			logger.Info(ctx, "API server is ready to handle requests")
+
+			// Build the search index up front so the first search does not have
+			// to wait for it.  Readiness waits for it as well, so keep trying.
+			go func() {
+				for {
+					err := database.BuildIndex(ctx)
+					if err == nil || ctx.Err() != nil {
+						return
+					}
+					logger.Error(ctx, "Unable to build search index, retrying...", slog.Error(err))
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(10 * time.Second):
+					}
+				}
+			}()
+
 			errCh := make(chan error, 1)
 			go func() {
 				select {
@@ -163,9 +364,22 @@ func server() *cobra.Command {
 		},
 	}
 
-	cmd.Flags().IntVar(&maxpagesize, "max-page-size", api.MaxPageSizeDefault, "The maximum number of pages to request")
+	cmd.Flags().Int("max-page-size", api.MaxPageSizeDefault, "The maximum number of pages to request")
+	cmd.Flags().IntVar(&maxfilters, "max-filters", api.MaxFiltersDefault, "The maximum number of filters in a single extension query")
 	cmd.Flags().StringVar(&address, "address", "127.0.0.1:3001", "The address on which to serve the marketplace API.")
+	cmd.Flags().StringSliceVar(&platforms, "platform", nil, "Only return versions in query results that can be installed on these platforms, falling back to compatible and universal builds. Can be repeated or comma-separated. Defaults to all platforms.")
+	cmd.Flags().StringArrayVar(&adminTokens, "admin-token", nil, "A bearer token that enables the admin API, optionally prefixed with a name that identifies its user (name:token). Can be repeated.")
+	configurable(cmd, "max-page-size", "max-filters", "address", "platform")
+	secret(cmd, "admin-token")
+	corsFlags(cmd)
 	addFlags(cmd)
+	addLimitFlags(cmd)
+	addAuditFlags(cmd)
+	addScanFlags(cmd)
+	addWebhookFlags(cmd)
+	addTracingFlags(cmd)
+	addTLSFlags(cmd)
+	addRateLimitFlags(cmd)
 
 	return cmd
 }
@@ -23,3 +23,106 @@ func TestServer(t *testing.T) {
 	output := buf.String()
 	require.Contains(t, output, "Start the Code", "has help")
 }
+
+func TestServerTraceSampleRatio(t *testing.T) {
+	t.Parallel()
+
+	cmd := cli.Root()
+	cmd.SetArgs([]string{"server", "--extensions-dir", t.TempDir(), "--otlp-endpoint", "http://localhost:4318", "--trace-sample-ratio", "2"})
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+	cmd.SetErr(buf)
+
+	err := cmd.Execute()
+	require.ErrorContains(t, err, "--trace-sample-ratio must be between 0 and 1")
+}
+
+func TestServerTLSFlags(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		args  []string
+		error string
+	}{
+		{
+			name:  "CertWithoutKey",
+			args:  []string{"--tls-cert", "cert.pem"},
+			error: "--tls-cert and --tls-key must be used together",
+		},
+		{
+			name:  "KeyWithoutCert",
+			args:  []string{"--tls-key", "key.pem"},
+			error: "--tls-cert and --tls-key must be used together",
+		},
+		{
+			name:  "ClientCAWithoutCert",
+			args:  []string{"--tls-client-ca", "ca.pem"},
+			error: "--tls-client-ca requires --tls-cert and --tls-key",
+		},
+		{
+			name:  "MissingCert",
+			args:  []string{"--tls-cert", "does-not-exist.pem", "--tls-key", "does-not-exist.pem"},
+			error: "no such file or directory",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			cmd := cli.Root()
+			cmd.SetArgs(append([]string{"server", "--extensions-dir", t.TempDir()}, test.args...))
+			buf := new(bytes.Buffer)
+			cmd.SetOut(buf)
+			cmd.SetErr(buf)
+
+			err := cmd.Execute()
+			require.ErrorContains(t, err, test.error)
+		})
+	}
+}
+
+func TestServerRateLimitFlags(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		args  []string
+		error string
+	}{
+		{
+			name:  "InvalidProxy",
+			args:  []string{"--trusted-proxies", "10.0.0.0/8,proxy.example.com"},
+			error: `"proxy.example.com" is not a valid IP or CIDR range`,
+		},
+		{
+			name:  "InvalidRedis",
+			args:  []string{"--rate-limit-redis", "http://:secret@localhost"},
+			error: "must start with redis://",
+		},
+		{
+			name:  "UnreachableRedis",
+			args:  []string{"--rate-limit-redis", "redis://127.0.0.1:1"},
+			error: "connect to redis",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			cmd := cli.Root()
+			cmd.SetArgs(append([]string{"server", "--extensions-dir", t.TempDir()}, test.args...))
+			buf := new(bytes.Buffer)
+			cmd.SetOut(buf)
+			cmd.SetErr(buf)
+
+			err := cmd.Execute()
+			require.ErrorContains(t, err, test.error)
+			require.NotContains(t, err.Error(), "secret")
+		})
+	}
+}
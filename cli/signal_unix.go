@@ -10,5 +10,7 @@ import (
 var interruptSignals = []os.Signal{
 	os.Interrupt,
 	syscall.SIGTERM,
-	syscall.SIGHUP,
 }
+
+// reloadSignals make the server reload its certificate and configuration.
+var reloadSignals = []os.Signal{syscall.SIGHUP}
@@ -7,3 +7,8 @@ import (
 )
 
 var interruptSignals = []os.Signal{os.Interrupt}
+
+// reloadSignals make the server reload its certificate and configuration.
+// Windows has no SIGHUP so certificates are only reloaded when their files
+// change and configuration changes need a restart.
+var reloadSignals = []os.Signal{}
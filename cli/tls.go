@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"crypto/tls"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+	"github.com/coder/code-marketplace/tlsconfig"
+)
+
+// tlsOptions configures serving over TLS.
+type tlsOptions struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+}
+
+// tlsFlags adds flags for serving over TLS.
+func tlsFlags() (addFlags func(cmd *cobra.Command), opts *tlsOptions) {
+	opts = &tlsOptions{}
+	return func(cmd *cobra.Command) {
+		cmd.Flags().StringVar(&opts.certFile, "tls-cert", "", "The path to a PEM certificate (with any intermediates) to serve HTTPS with. Reloaded when the file changes or on SIGHUP.")
+		cmd.Flags().StringVar(&opts.keyFile, "tls-key", "", "The path to the PEM private key for --tls-cert.")
+		cmd.Flags().StringVar(&opts.clientCAFile, "tls-client-ca", "", "The path to a PEM bundle of certificate authorities. When set, clients must present a certificate signed by one of them.")
+		configurable(cmd, "tls-cert", "tls-key", "tls-client-ca")
+	}, opts
+}
+
+// config returns the TLS config for the configured certificate along with the
+// reloader for that certificate.  Without a certificate both are nil and the
+// server should use plain HTTP.
+func (o *tlsOptions) config(logger slog.Logger) (*tls.Config, *tlsconfig.Reloader, error) {
+	if o.certFile == "" && o.keyFile == "" {
+		if o.clientCAFile != "" {
+			return nil, nil, xerrors.New("--tls-client-ca requires --tls-cert and --tls-key")
+		}
+		return nil, nil, nil
+	}
+	if o.certFile == "" || o.keyFile == "" {
+		return nil, nil, xerrors.New("--tls-cert and --tls-key must be used together")
+	}
+	reloader, err := tlsconfig.NewReloader(o.certFile, o.keyFile, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	config, err := tlsconfig.New(reloader, o.clientCAFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return config, reloader, nil
+}
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+	"github.com/coder/code-marketplace/buildinfo"
+	"github.com/coder/code-marketplace/tracing"
+)
+
+// tracingOptions configures exporting traces.
+type tracingOptions struct {
+	endpoint    string
+	sampleRatio float64
+}
+
+// tracingFlags adds flags for exporting traces over OTLP.
+func tracingFlags() (addFlags func(cmd *cobra.Command), opts *tracingOptions) {
+	opts = &tracingOptions{}
+	return func(cmd *cobra.Command) {
+		cmd.Flags().StringVar(&opts.endpoint, "otlp-endpoint", "", "The URL of an OTLP/HTTP collector to export traces to, for example http://localhost:4318. Tracing is disabled when unset.")
+		cmd.Flags().Float64Var(&opts.sampleRatio, "trace-sample-ratio", 1, "The fraction of requests to trace, from 0 to 1. Whether a client marked its trace as sampled is ignored.")
+		configurable(cmd, "otlp-endpoint", "trace-sample-ratio")
+	}, opts
+}
+
+// provider returns a tracer provider for the configured endpoint along with a
+// function that flushes remaining spans.  Without an endpoint the provider is
+// nil, which discards spans.
+func (o *tracingOptions) provider(ctx context.Context, logger slog.Logger) (trace.TracerProvider, func(), error) {
+	if o.endpoint == "" {
+		return nil, func() {}, nil
+	}
+	if o.sampleRatio < 0 || o.sampleRatio > 1 {
+		return nil, nil, xerrors.Errorf("--trace-sample-ratio must be between 0 and 1")
+	}
+	provider, err := tracing.NewProvider(ctx, tracing.Options{
+		Endpoint:       o.endpoint,
+		SampleRatio:    o.sampleRatio,
+		ServiceVersion: buildinfo.Version(),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	logger.Info(ctx, "Exporting traces", slog.F("endpoint", o.endpoint))
+	return provider, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			logger.Error(ctx, "Unable to flush traces", slog.Error(err))
+		}
+	}, nil
+}
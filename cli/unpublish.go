@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coder/code-marketplace/audit"
+	"github.com/coder/code-marketplace/storage"
+)
+
+func unpublish() *cobra.Command {
+	addFlags, opts := serverFlags()
+	addAuditFlags, auditOpts := auditFlags()
+
+	cmd := &cobra.Command{
+		Use:   "unpublish <id>",
+		Short: "Hide an extension from the marketplace without removing its files",
+		Example: strings.Join([]string{
+			"  marketplace unpublish publisher.extension@1.0.0 --extensions-dir ./extensions",
+			"  marketplace unpublish publisher.extension --artifactory http://artifactory.server/artifactory --repo extensions",
+		}, "\n"),
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(cmd.Context())
+			defer cancel()
+
+			store, err := storage.NewStorage(ctx, opts)
+			if err != nil {
+				return err
+			}
+
+			publisher, name, version, err := storage.ParseExtensionID(args[0])
+			if err != nil {
+				return err
+			}
+
+			err = storage.Unpublish(ctx, store, publisher, name, version)
+			auditOpts.record(cmd, audit.Event{
+				Action:    audit.ActionUnpublish,
+				Extension: storage.ExtensionIDWithoutVersion(publisher, name),
+				Version:   version,
+			}, err)
+			if err != nil {
+				return err
+			}
+
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Unpublished %s\n", args[0])
+			return nil
+		},
+	}
+	addFlags(cmd)
+	addAuditFlags(cmd)
+
+	return cmd
+}
+
+func republish() *cobra.Command {
+	addFlags, opts := serverFlags()
+	addAuditFlags, auditOpts := auditFlags()
+
+	cmd := &cobra.Command{
+		Use:   "republish <id>",
+		Short: "Make an unpublished extension visible again",
+		Example: strings.Join([]string{
+			"  marketplace republish publisher.extension@1.0.0 --extensions-dir ./extensions",
+			"  marketplace republish publisher.extension --artifactory http://artifactory.server/artifactory --repo extensions",
+		}, "\n"),
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithCancel(cmd.Context())
+			defer cancel()
+
+			store, err := storage.NewStorage(ctx, opts)
+			if err != nil {
+				return err
+			}
+
+			publisher, name, version, err := storage.ParseExtensionID(args[0])
+			if err != nil {
+				return err
+			}
+
+			err = storage.Republish(ctx, store, publisher, name, version)
+			auditOpts.record(cmd, audit.Event{
+				Action:    audit.ActionRepublish,
+				Extension: storage.ExtensionIDWithoutVersion(publisher, name),
+				Version:   version,
+			}, err)
+			if err != nil {
+				return err
+			}
+
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Republished %s\n", args[0])
+			return nil
+		},
+	}
+	addFlags(cmd)
+	addAuditFlags(cmd)
+
+	return cmd
+}
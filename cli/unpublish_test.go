@@ -0,0 +1,140 @@
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"cdr.dev/slog/sloggers/slogtest"
+	"github.com/coder/code-marketplace/cli"
+	"github.com/coder/code-marketplace/storage"
+	"github.com/coder/code-marketplace/testutil"
+)
+
+func TestUnpublishHelp(t *testing.T) {
+	t.Parallel()
+
+	for _, command := range []string{"unpublish", "republish"} {
+		cmd := cli.Root()
+		cmd.SetArgs([]string{command, "--help"})
+		buf := new(bytes.Buffer)
+		cmd.SetOut(buf)
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+
+		output := buf.String()
+		require.Contains(t, output, "unpublish", "has help")
+	}
+}
+
+func TestUnpublish(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		// commands are run in order, each with its ID.
+		commands [][]string
+		// error is the expected error of the last command, if any.
+		error string
+		// name is the name of the test.
+		name string
+		// unpublished are the versions that should be unpublished afterward.
+		unpublished []string
+		// published are the versions that should be published afterward.
+		published []string
+	}{
+		{
+			name:        "Version",
+			commands:    [][]string{{"unpublish", "foo.zany@2.0.0"}},
+			unpublished: []string{"2.0.0"},
+			published:   []string{"1.0.0", "3.0.0"},
+		},
+		{
+			name:        "Extension",
+			commands:    [][]string{{"unpublish", "foo.zany"}},
+			unpublished: []string{"1.0.0", "2.0.0", "3.0.0"},
+		},
+		{
+			name: "Republish",
+			commands: [][]string{
+				{"unpublish", "foo.zany@2.0.0"},
+				{"republish", "foo.zany@2.0.0"},
+			},
+			published: []string{"1.0.0", "2.0.0", "3.0.0"},
+		},
+		{
+			name:     "NoVersion",
+			commands: [][]string{{"unpublish", "foo.zany@does-not-exist"}},
+			error:    "does not exist",
+		},
+		{
+			name: "AlreadyUnpublished",
+			commands: [][]string{
+				{"unpublish", "foo.zany"},
+				{"unpublish", "foo.zany"},
+			},
+			error: "already unpublished",
+		},
+		{
+			name:     "NotUnpublished",
+			commands: [][]string{{"republish", "foo.zany"}},
+			error:    "not unpublished",
+		},
+		{
+			name:     "InvalidID",
+			commands: [][]string{{"unpublish", "foo"}},
+			error:    "does not match",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			extdir := t.TempDir()
+			ext := testutil.Extensions[0]
+			for _, version := range ext.Versions {
+				manifestPath := filepath.Join(extdir, ext.Publisher, ext.Name, version.String(), "extension.vsixmanifest")
+				err := os.MkdirAll(filepath.Dir(manifestPath), 0o755)
+				require.NoError(t, err)
+				err = os.WriteFile(manifestPath, testutil.ConvertExtensionToManifestBytes(t, ext, version), 0o644)
+				require.NoError(t, err)
+			}
+
+			var err error
+			for _, command := range test.commands {
+				cmd := cli.Root()
+				cmd.SetArgs(append(command, "--extensions-dir", extdir))
+				buf := new(bytes.Buffer)
+				cmd.SetOut(buf)
+				err = cmd.Execute()
+				if err == nil {
+					require.Contains(t, buf.String(), command[1])
+				}
+			}
+
+			if test.error != "" {
+				require.Error(t, err)
+				require.Regexp(t, test.error, err.Error())
+				return
+			}
+			require.NoError(t, err)
+
+			s, err := storage.NewLocalStorage(&storage.LocalOptions{ExtDir: extdir}, slogtest.Make(t, nil))
+			require.NoError(t, err)
+			unpublished, err := storage.ReadUnpublished(context.Background(), s)
+			require.NoError(t, err)
+			for _, version := range test.unpublished {
+				require.True(t, unpublished.IsUnpublished(ext.Publisher, ext.Name, storage.Version{Version: version}))
+			}
+			for _, version := range test.published {
+				require.False(t, unpublished.IsUnpublished(ext.Publisher, ext.Name, storage.Version{Version: version}))
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/code-marketplace/storage"
+	"github.com/coder/code-marketplace/util"
+)
+
+func validate() *cobra.Command {
+	var jsonOut bool
+	// Only the limits are used; they are shared with add so that validate
+	// passes the same extensions add would accept.
+	opts := &storage.Options{}
+	addLimitFlags := zipLimitFlags(opts)
+
+	cmd := &cobra.Command{
+		Use:   "validate <source>...",
+		Short: "Check extensions for problems without adding them",
+		Example: strings.Join([]string{
+			"  marketplace validate extension.vsix",
+			"  marketplace validate https://domain.tld/extension.vsix other.vsix --json",
+		}, "\n"),
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			encoder := json.NewEncoder(cmd.OutOrStdout())
+			var failed []string
+			for _, source := range args {
+				var report *storage.ValidationReport
+				vsix, err := storage.ReadVSIX(cmd.Context(), source)
+				if err != nil {
+					report = &storage.ValidationReport{Issues: []storage.ValidationIssue{{
+						Check:   storage.CheckArchive,
+						Message: err.Error(),
+					}}}
+				} else {
+					report = storage.ValidateVSIX(vsix, opts.ZipLimits)
+				}
+				report.Source = source
+				if !report.Valid {
+					failed = append(failed, source)
+				}
+
+				if jsonOut {
+					if err := encoder.Encode(report); err != nil {
+						return err
+					}
+					continue
+				}
+
+				name := source
+				if report.Extension != "" {
+					name = fmt.Sprintf("%s (%s@%s)", source, report.Extension, report.Version)
+				}
+				if report.Valid {
+					_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s is valid\n", name)
+					continue
+				}
+				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s has %s\n", name, util.Plural(len(report.Issues), "issue", ""))
+				for _, issue := range report.Issues {
+					_, _ = fmt.Fprintf(cmd.OutOrStdout(), "  - %s: %s\n", issue.Check, issue.Message)
+				}
+			}
+
+			if len(failed) > 0 {
+				return xerrors.Errorf(
+					"%s failed validation: %s",
+					util.Plural(len(failed), "extension", ""),
+					strings.Join(failed, ", "))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Output a report for each extension as JSON lines.")
+	addLimitFlags(cmd)
+
+	return cmd
+}
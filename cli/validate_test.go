@@ -0,0 +1,140 @@
+package cli_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/code-marketplace/cli"
+	"github.com/coder/code-marketplace/storage"
+	"github.com/coder/code-marketplace/testutil"
+)
+
+func TestValidateHelp(t *testing.T) {
+	t.Parallel()
+
+	cmd := cli.Root()
+	cmd.SetArgs([]string{"validate", "--help"})
+	buf := new(bytes.Buffer)
+	cmd.SetOut(buf)
+
+	err := cmd.Execute()
+	require.NoError(t, err)
+
+	output := buf.String()
+	require.Contains(t, output, "Check extensions for problems", "has help")
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	// The test extensions do not use semantic versions so make a valid one.
+	manifest := testutil.ConvertExtensionToManifest(testutil.Extensions[0], storage.Version{Version: "1.0.0"})
+	manifest.Metadata.Icon = "icon.png"
+	manifest.Assets.Asset = []storage.VSIXAsset{{Type: storage.ManifestAssetType, Path: "extension/package.json", Addressable: "true"}}
+	manifestBytes, err := xml.Marshal(manifest)
+	require.NoError(t, err)
+	packageJSON, err := json.Marshal(storage.VSIXPackageJSON{
+		Name:      manifest.Metadata.Identity.ID,
+		Publisher: manifest.Metadata.Identity.Publisher,
+		Version:   manifest.Metadata.Identity.Version,
+	})
+	require.NoError(t, err)
+	valid := filepath.Join(dir, "valid.vsix")
+	require.NoError(t, os.WriteFile(valid, testutil.CreateVSIX(t, manifestBytes, packageJSON), 0o644))
+
+	ext := testutil.Extensions[0]
+	invalid := filepath.Join(dir, "invalid.vsix")
+	require.NoError(t, os.WriteFile(invalid, testutil.CreateVSIXFromExtension(t, ext, storage.Version{Version: ext.LatestVersion}), 0o644))
+
+	run := func(args ...string) (string, error) {
+		cmd := cli.Root()
+		cmd.SetArgs(args)
+		buf := new(bytes.Buffer)
+		cmd.SetOut(buf)
+		cmd.SetErr(buf)
+		err := cmd.Execute()
+		return buf.String(), err
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		t.Parallel()
+
+		output, err := run("validate", valid)
+		require.NoError(t, err)
+		require.Contains(t, output, "is valid")
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		t.Parallel()
+
+		output, err := run("validate", valid, invalid)
+		require.ErrorContains(t, err, "1 extension failed validation: "+invalid)
+		require.Contains(t, output, "has 1 issue")
+		require.Contains(t, output, "packageJSON: manifest does not list a package.json")
+	})
+
+	t.Run("Limits", func(t *testing.T) {
+		t.Parallel()
+
+		output, err := run("validate", valid, "--max-extension-files", "1")
+		require.Error(t, err)
+		require.Contains(t, output, "archive: ")
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		t.Parallel()
+
+		output, err := run("validate", filepath.Join(dir, "missing.vsix"))
+		require.Error(t, err)
+		require.Contains(t, output, "archive: ")
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		t.Parallel()
+
+		output, err := run("validate", valid, invalid, "--json")
+		require.Error(t, err)
+		lines := strings.Split(strings.TrimSpace(output), "\n")
+		require.Len(t, lines, 2)
+
+		var report storage.ValidationReport
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &report))
+		require.True(t, report.Valid)
+		require.Equal(t, valid, report.Source)
+		require.Equal(t, storage.ExtensionIDWithoutVersion(ext.Publisher, ext.Name), report.Extension)
+		require.Empty(t, report.Issues)
+
+		require.NoError(t, json.Unmarshal([]byte(lines[1]), &report))
+		require.False(t, report.Valid)
+		require.Equal(t, invalid, report.Source)
+		require.NotEmpty(t, report.Issues)
+	})
+
+	t.Run("AddStrict", func(t *testing.T) {
+		t.Parallel()
+
+		extdir := t.TempDir()
+		_, err := run("add", invalid, "--extensions-dir", extdir, "--strict")
+		require.ErrorContains(t, err, "extension failed validation")
+		_, err = os.Stat(filepath.Join(extdir, ext.Publisher))
+		require.True(t, os.IsNotExist(err))
+
+		_, err = run("add", valid, "--extensions-dir", extdir, "--strict")
+		require.NoError(t, err)
+		_, err = os.Stat(filepath.Join(extdir, ext.Publisher, ext.Name, "1.0.0"))
+		require.NoError(t, err)
+
+		// Without --strict the invalid extension is still accepted.
+		_, err = run("add", invalid, "--extensions-dir", extdir)
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+	"github.com/coder/code-marketplace/storage"
+	"github.com/coder/code-marketplace/webhook"
+)
+
+// webhookOptions configures webhooks sent when extensions are added or
+// removed.
+type webhookOptions struct {
+	publicURL string
+	queueDir  string
+	secret    string
+	urls      []string
+}
+
+// webhookFlags adds flags for sending webhooks.  The add and remove commands
+// share the queue with the server so deliveries they are unable to make before
+// exiting are retried by the server.
+func webhookFlags() (addFlags func(cmd *cobra.Command), opts *webhookOptions) {
+	opts = &webhookOptions{}
+	return func(cmd *cobra.Command) {
+		cmd.Flags().StringArrayVar(&opts.urls, "webhook", nil, "A URL to POST to when an extension is added or removed. Can be repeated.")
+		cmd.Flags().StringVar(&opts.secret, "webhook-secret", "", "A secret used to sign webhooks with HMAC-SHA256.")
+		cmd.Flags().StringVar(&opts.queueDir, "webhook-queue-dir", "", "A directory in which to keep webhooks until they are delivered. Required with --webhook.")
+		cmd.Flags().StringVar(&opts.publicURL, "public-url", "", "The URL at which the marketplace is reachable, used for download URLs in webhooks.")
+		configurable(cmd, "webhook", "webhook-queue-dir", "public-url")
+		secret(cmd, "webhook-secret")
+	}, opts
+}
+
+// wrap returns storage that queues webhooks for the configured URLs along with
+// the dispatcher that delivers them.  If there are no URLs the storage is
+// returned as-is with a nil dispatcher.
+func (o *webhookOptions) wrap(store storage.Storage, logger slog.Logger) (storage.Storage, *webhook.Dispatcher, error) {
+	if len(o.urls) == 0 {
+		return store, nil, nil
+	}
+	if o.queueDir == "" {
+		return nil, nil, xerrors.New("--webhook-queue-dir is required when using --webhook")
+	}
+	dispatcher, err := webhook.NewDispatcher(&webhook.Options{
+		URLs:     o.urls,
+		Secret:   o.secret,
+		QueueDir: o.queueDir,
+		Logger:   logger,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return webhook.NewStorage(store, dispatcher, o.publicURL, logger), dispatcher, nil
+}
+
+// flushWebhooks makes one attempt at delivering queued webhooks before a
+// command exits.  Anything left over stays queued for the server.
+func flushWebhooks(ctx context.Context, cmd *cobra.Command, dispatcher *webhook.Dispatcher) {
+	if dispatcher == nil {
+		return
+	}
+	pending, err := dispatcher.Flush(ctx)
+	if err != nil {
+		_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "Failed to deliver webhooks: %s\n", err)
+	} else if pending > 0 {
+		_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "%d webhook deliveries are queued for retry\n", pending)
+	}
+}
@@ -0,0 +1,83 @@
+package cli_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/code-marketplace/cli"
+	"github.com/coder/code-marketplace/storage"
+	"github.com/coder/code-marketplace/testutil"
+	"github.com/coder/code-marketplace/webhook"
+)
+
+func TestWebhook(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mutex    sync.Mutex
+		payloads []webhook.Payload
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.True(t, webhook.Verify("secret", body, r.Header.Get(webhook.SignatureHeader)))
+		var payload webhook.Payload
+		require.NoError(t, json.Unmarshal(body, &payload))
+		mutex.Lock()
+		payloads = append(payloads, payload)
+		mutex.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	extdir := filepath.Join(dir, "extensions")
+	queue := filepath.Join(dir, "queue")
+
+	ext := testutil.Extensions[0]
+	version := storage.Version{Version: ext.LatestVersion}
+	source := filepath.Join(dir, "ext.vsix")
+	require.NoError(t, os.WriteFile(source, testutil.CreateVSIXFromExtension(t, ext, version), 0o644))
+
+	run := func(args ...string) error {
+		cmd := cli.Root()
+		cmd.SetArgs(args)
+		buf := new(bytes.Buffer)
+		cmd.SetOut(buf)
+		cmd.SetErr(buf)
+		return cmd.Execute()
+	}
+	flags := []string{"--extensions-dir", extdir, "--webhook", srv.URL, "--webhook-secret", "secret", "--webhook-queue-dir", queue}
+
+	err := run(append([]string{"add", source, "--public-url", "http://localhost:3001"}, flags...)...)
+	require.NoError(t, err)
+	err = run(append([]string{"remove", "foo.zany@" + version.Version}, flags...)...)
+	require.NoError(t, err)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.Len(t, payloads, 2)
+	require.Equal(t, webhook.EventAdded, payloads[0].Event)
+	require.Equal(t, "foo.zany", payloads[0].ID)
+	require.Equal(t, "http://localhost:3001/assets/foo/zany/3.0.0/Microsoft.VisualStudio.Services.VSIXPackage", payloads[0].DownloadURL)
+	require.Equal(t, webhook.EventRemoved, payloads[1].Event)
+	require.Equal(t, version.Version, payloads[1].Version)
+
+	// Everything was delivered so nothing should be left in the queue.
+	entries, err := os.ReadDir(queue)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	// The queue directory is required.
+	err = run("add", source, "--extensions-dir", extdir, "--webhook", srv.URL)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "--webhook-queue-dir is required")
+}
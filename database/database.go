@@ -159,10 +159,24 @@ type Asset struct {
 	Version   storage.Version
 }
 
+// Totals holds counts computed over every extension that matched a filter
+// rather than only the returned page.
+type Totals struct {
+	// Count is the total number of matched extensions.
+	Count int
+	// Categories maps each category to the number of matched extensions in it.
+	Categories map[string]int
+	// TargetPlatforms maps each platform to the number of matched extensions
+	// with at least one version for it.
+	TargetPlatforms map[storage.Platform]int
+}
+
 type Database interface {
 	// GetExtensionAssetPath returns the path of an asset by the asset type.
 	GetExtensionAssetPath(ctx context.Context, asset *Asset, baseURL url.URL) (string, error)
 	// GetExtensions returns paged extensions from the database that match the
-	// filter along the total number of matched extensions.
-	GetExtensions(ctx context.Context, filter Filter, flags Flag, baseURL url.URL) ([]*Extension, int, error)
+	// filter along with totals computed over all the matched extensions.
+	GetExtensions(ctx context.Context, filter Filter, flags Flag, baseURL url.URL) ([]*Extension, *Totals, error)
+	// Health returns an error if the database is not ready to answer queries.
+	Health(ctx context.Context) error
 }
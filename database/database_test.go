@@ -4,9 +4,16 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"os"
+	"strconv"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
 	"cdr.dev/slog"
 	"cdr.dev/slog/sloggers/slogtest"
@@ -110,6 +117,93 @@ func TestGetExtensionAssetPath(t *testing.T) {
 			require.Equal(t, fmt.Sprintf("%s/files/foo/zany/1.0.0/icon.png", base), path)
 		}
 	})
+
+	t.Run("GetAssetWithFallback", func(t *testing.T) {
+		t.Parallel()
+
+		tests := []struct {
+			version  storage.Version
+			expected string
+		}{
+			// Exact builds are preferred.
+			{storage.Version{Version: "3.0.0", TargetPlatform: storage.PlatformAlpineX64}, "3.0.0@alpine-x64"},
+			// Then builds for a compatible platform.
+			{storage.Version{Version: "3.0.0", TargetPlatform: storage.PlatformAlpineArm64}, "3.0.0@linux-arm64"},
+			{storage.Version{Version: "3.0.0", TargetPlatform: storage.PlatformDarwinArm64}, "3.0.0@darwin-x64"},
+			{storage.Version{Version: "1.0.0", TargetPlatform: storage.PlatformWin32Arm64}, "1.0.0@win32-x64"},
+			// Then universal builds.
+			{storage.Version{Version: "3.0.0", TargetPlatform: storage.PlatformWeb}, "3.0.0"},
+			{storage.Version{Version: "2.0.0", TargetPlatform: storage.PlatformLinuxX64}, "2.0.0"},
+		}
+		for _, test := range tests {
+			path, err := db.GetExtensionAssetPath(context.Background(), &database.Asset{
+				Publisher: "foo",
+				Extension: "zany",
+				Type:      "Microsoft.VisualStudio.Services.Icons.Default",
+				Version:   test.version,
+			}, *baseURL)
+			require.NoError(t, err)
+			require.Equal(t, fmt.Sprintf("%s/files/foo/zany/%s/icon.png", base, test.expected), path)
+		}
+	})
+}
+
+// countingStorage counts the calls that list extensions or their versions.
+type countingStorage struct {
+	storage.Storage
+	versions atomic.Int32
+	walks    atomic.Int32
+}
+
+func (s *countingStorage) WalkExtensions(ctx context.Context, fn func(manifest *storage.VSIXManifest, versions []storage.Version) error) error {
+	s.walks.Add(1)
+	return s.Storage.WalkExtensions(ctx, fn)
+}
+
+func (s *countingStorage) Versions(ctx context.Context, publisher, name string) ([]storage.Version, error) {
+	s.versions.Add(1)
+	return s.Storage.Versions(ctx, publisher, name)
+}
+
+func TestGetExtensionAssetPathCache(t *testing.T) {
+	t.Parallel()
+
+	baseURL, err := url.Parse("test://cdr.dev/base")
+	require.NoError(t, err)
+	store := &countingStorage{Storage: testutil.NewMockStorage()}
+	db := database.NoDB{
+		Storage: store,
+		Logger:  slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}),
+	}
+	get := func(version storage.Version) (string, error) {
+		return db.GetExtensionAssetPath(context.Background(), &database.Asset{
+			Publisher: "foo",
+			Extension: "zany",
+			Type:      "Microsoft.VisualStudio.Services.Icons.Default",
+			Version:   version,
+		}, *baseURL)
+	}
+
+	// Before any walk the versions come from storage.
+	_, err = get(storage.Version{Version: "1.0.0"})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), store.versions.Load())
+
+	// After a query walks storage assets are resolved without asking it.
+	_, _, err = db.GetExtensions(context.Background(), database.Filter{}, database.None, *baseURL)
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		path, err := get(storage.Version{Version: "3.0.0", TargetPlatform: storage.PlatformAlpineArm64})
+		require.NoError(t, err)
+		require.Equal(t, "test://cdr.dev/base/files/foo/zany/3.0.0@linux-arm64/icon.png", path)
+	}
+	require.Equal(t, int32(1), store.versions.Load())
+
+	// Versions the walk did not see might have been added since, so storage is
+	// asked about them.
+	_, err = get(storage.Version{Version: "9.9.9"})
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.Equal(t, int32(2), store.versions.Load())
 }
 
 type checkFunc func(t *testing.T, ext *database.Extension)
@@ -122,6 +216,7 @@ func TestGetExtensions(t *testing.T) {
 		Name       string
 		WalkError  bool
 		ExtDir     string
+		Featured   []string
 		Filter     database.Filter
 		Flags      database.Flag
 		Extensions []string
@@ -306,8 +401,7 @@ func TestGetExtensions(t *testing.T) {
 			Count:      1,
 		},
 		{
-			// Not implemented.
-			Name: "ByFeatured",
+			Name: "ByFeaturedNone",
 			Filter: database.Filter{
 				Criteria: []database.Criteria{{
 					Type: database.Featured,
@@ -316,16 +410,28 @@ func TestGetExtensions(t *testing.T) {
 			Extensions: []string{},
 			Count:      0,
 		},
+		{
+			Name:     "ByFeatured",
+			Featured: []string{"fred.thud", "foo.zany", "bar.squigly"},
+			Filter: database.Filter{
+				Criteria: []database.Criteria{{
+					Type: database.Featured,
+				}},
+			},
+			// Featured extensions are returned in their curated order.
+			Extensions: []string{"fred.thud", "foo.zany", "bar.squigly"},
+			Count:      3,
+		},
 		{
 			Name: "BySearchTextRelevance",
 			Filter: database.Filter{
 				Criteria: []database.Criteria{{
 					Type:  database.SearchText,
-					Value: "qux",
+					Value: "quix",
 				}},
 			},
-			// foo.buz matches earlier but foo.zany matches more precisely.
-			Extensions: []string{"foo.zany", "foo.buz"},
+			// foo.buz matches exactly but foo.zany only matches with a typo.
+			Extensions: []string{"foo.buz", "foo.zany"},
 			Count:      2,
 		},
 		{
@@ -336,9 +442,77 @@ func TestGetExtensions(t *testing.T) {
 					Value: "foo",
 				}},
 			},
-			// These all match foo at least once but with different accuracies.
-			Extensions: []string{"foo.zany", "foo.buz", "fred.thud", "bar.squigly"},
-			Count:      4,
+			// The publisher is weighted more heavily than the description, and
+			// foo.zany has foo in both.
+			Extensions: []string{"foo.zany", "foo.buz", "bar.squigly"},
+			Count:      3,
+		},
+		{
+			Name: "BySearchTextReadme",
+			Filter: database.Filter{
+				Criteria: []database.Criteria{{
+					Type:  database.SearchText,
+					Value: "grue",
+				}},
+			},
+			Extensions: []string{"fred.thud"},
+			Count:      1,
+		},
+		{
+			Name: "BySearchTextStemming",
+			Filter: database.Filter{
+				Criteria: []database.Criteria{{
+					Type:  database.SearchText,
+					Value: "tested",
+				}},
+			},
+			Extensions: []string{"fred.thud"},
+			Count:      1,
+		},
+		{
+			Name: "BySearchTextPrefix",
+			Filter: database.Filter{
+				Criteria: []database.Criteria{{
+					Type:  database.SearchText,
+					Value: "frobnoz",
+				}},
+			},
+			Extensions: []string{"fred.thud"},
+			Count:      1,
+		},
+		{
+			Name: "BySearchTextTag",
+			Filter: database.Filter{
+				Criteria: []database.Criteria{{
+					Type:  database.SearchText,
+					Value: "tag2",
+				}},
+			},
+			// foo.buz has fewer tags so the match counts for more.
+			Extensions: []string{"foo.buz", "bar.squigly"},
+			Count:      2,
+		},
+		{
+			Name: "BySearchTextPhrase",
+			Filter: database.Filter{
+				Criteria: []database.Criteria{{
+					Type:  database.SearchText,
+					Value: "\"running quick tests\"",
+				}},
+			},
+			Extensions: []string{"fred.thud"},
+			Count:      1,
+		},
+		{
+			Name: "BySearchTextPhraseOrder",
+			Filter: database.Filter{
+				Criteria: []database.Criteria{{
+					Type:  database.SearchText,
+					Value: "\"tests quick\"",
+				}},
+			},
+			Extensions: []string{},
+			Count:      0,
 		},
 		{
 			Name: "BySearchTextMany",
@@ -374,6 +548,163 @@ func TestGetExtensions(t *testing.T) {
 			Extensions: []string{"bar.squigly"},
 			Count:      1,
 		},
+		{
+			Name: "ByQualifierTag",
+			Filter: database.Filter{
+				Criteria: []database.Criteria{{
+					Type:  database.SearchText,
+					Value: "tag:tag1",
+				}},
+			},
+			Extensions: []string{"bar.squigly", "foo.zany"},
+			Count:      2,
+		},
+		{
+			Name: "ByQualifierAt",
+			Filter: database.Filter{
+				Criteria: []database.Criteria{{
+					Type:  database.SearchText,
+					Value: "@tag:tag1",
+				}},
+			},
+			Extensions: []string{"bar.squigly", "foo.zany"},
+			Count:      2,
+		},
+		{
+			Name: "ByQualifierNegated",
+			Filter: database.Filter{
+				Criteria: []database.Criteria{{
+					Type:  database.SearchText,
+					Value: "-tag:tag1",
+				}},
+			},
+			Extensions: []string{"foo.buz", "qqqqqqqqqqq.qqqqq", "fred.thud"},
+			Count:      3,
+		},
+		{
+			// Qualifiers with the same key are alternatives.
+			Name: "ByQualifierSameKey",
+			Filter: database.Filter{
+				Criteria: []database.Criteria{{
+					Type:  database.SearchText,
+					Value: "tag:tag1 tag:tag2",
+				}},
+			},
+			Extensions: []string{"foo.buz", "bar.squigly", "foo.zany"},
+			Count:      3,
+		},
+		{
+			// Qualifiers with different keys must all match.
+			Name: "ByQualifierDifferentKeys",
+			Filter: database.Filter{
+				Criteria: []database.Criteria{{
+					Type:  database.SearchText,
+					Value: "tag:tag2 -category:category1",
+				}},
+			},
+			Extensions: []string{"foo.buz"},
+			Count:      1,
+		},
+		{
+			Name: "ByQualifierQuoted",
+			Filter: database.Filter{
+				Criteria: []database.Criteria{{
+					Type:  database.SearchText,
+					Value: "category:\"category2\"",
+				}},
+			},
+			Extensions: []string{"foo.buz", "bar.squigly"},
+			Count:      2,
+		},
+		{
+			Name: "ByQualifierExt",
+			Filter: database.Filter{
+				Criteria: []database.Criteria{{
+					Type:  database.SearchText,
+					Value: "ext:.qq",
+				}},
+			},
+			Extensions: []string{"qqqqqqqqqqq.qqqqq"},
+			Count:      1,
+		},
+		{
+			Name: "ByQualifierPlatform",
+			Filter: database.Filter{
+				Criteria: []database.Criteria{{
+					Type:  database.SearchText,
+					Value: "platform:linux-x64",
+				}},
+			},
+			Extensions: []string{"foo.zany"},
+			Count:      1,
+		},
+		{
+			Name: "ByQualifierNegatedPlatform",
+			Filter: database.Filter{
+				Criteria: []database.Criteria{{
+					Type:  database.SearchText,
+					Value: "tag:tag1 -platform:linux-x64",
+				}},
+			},
+			Extensions: []string{"bar.squigly"},
+			Count:      1,
+		},
+		{
+			Name: "ByQualifierUniversal",
+			Filter: database.Filter{
+				Criteria: []database.Criteria{{
+					Type:  database.SearchText,
+					Value: "platform:universal",
+				}},
+			},
+			Extensions: []string{"foo.buz", "qqqqqqqqqqq.qqqqq", "bar.squigly", "fred.thud", "foo.zany"},
+			Count:      5,
+		},
+		{
+			Name: "ByQualifierID",
+			Filter: database.Filter{
+				Criteria: []database.Criteria{{
+					Type:  database.SearchText,
+					Value: "id:FOO.ZANY",
+				}},
+			},
+			Extensions: []string{"foo.zany"},
+			Count:      1,
+		},
+		{
+			Name: "ByQualifierAndText",
+			Filter: database.Filter{
+				Criteria: []database.Criteria{{
+					Type:  database.SearchText,
+					Value: "publisher:fred frobbles",
+				}},
+			},
+			Extensions: []string{"fred.thud"},
+			Count:      1,
+		},
+		{
+			Name: "ByQualifierAndTextNoMatch",
+			Filter: database.Filter{
+				Criteria: []database.Criteria{{
+					Type:  database.SearchText,
+					Value: "publisher:foo frobbles",
+				}},
+			},
+			Extensions: []string{},
+			Count:      0,
+		},
+		{
+			// Unknown qualifiers are searched as text.
+			Name: "ByQualifierUnknown",
+			Filter: database.Filter{
+				Criteria: []database.Criteria{{
+					Type:  database.SearchText,
+					Value: "fred:frobbles",
+				}},
+			},
+			Extensions: []string{"fred.thud"},
+			Count:      1,
+		},
 		{
 			Name: "ByPublisher",
 			Filter: database.Filter{
@@ -562,15 +893,22 @@ func TestGetExtensions(t *testing.T) {
 		c := c
 		t.Run(c.Name, func(t *testing.T) {
 			t.Parallel()
+			store := testutil.NewMockStorage()
+			for _, id := range c.Featured {
+				publisher, name, err := storage.ParseExtensionIDWithoutVersion(id)
+				require.NoError(t, err)
+				err = storage.Feature(context.Background(), store, publisher, name, -1)
+				require.NoError(t, err)
+			}
 			db := database.NoDB{
-				Storage: testutil.NewMockStorage(),
+				Storage: store,
 				Logger:  slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}).Leveled(slog.LevelDebug),
 			}
 			baseURL, err := url.Parse(base)
 			require.NoError(t, err)
-			exts, count, err := db.GetExtensions(context.Background(), c.Filter, c.Flags, *baseURL)
+			exts, totals, err := db.GetExtensions(context.Background(), c.Filter, c.Flags, *baseURL)
 			require.NoError(t, err)
-			require.Equal(t, c.Count, count)
+			require.Equal(t, c.Count, totals.Count)
 
 			if len(c.Extensions) > 0 {
 				extids := []string{}
@@ -589,3 +927,370 @@ func TestGetExtensions(t *testing.T) {
 		})
 	}
 }
+
+func TestGetExtensionsUnpublished(t *testing.T) {
+	t.Parallel()
+
+	base := "test://cdr.dev/base"
+	baseURL, err := url.Parse(base)
+	require.NoError(t, err)
+
+	excludeUnpublished := database.Criteria{
+		Type:  database.ExcludeWithFlags,
+		Value: strconv.Itoa(int(database.Unpublished)),
+	}
+
+	cases := []struct {
+		Name string
+		// Unpublish is a list of IDs to unpublish before querying.
+		Unpublish []string
+		Criteria  []database.Criteria
+		Flags     database.Flag
+		// Extensions are the expected extension IDs.
+		Extensions []string
+		// Versions are the expected versions of foo.zany, if returned.
+		Versions []string
+		// Flags are the expected gallery flags of foo.zany, if returned.
+		ExtFlags string
+	}{
+		{
+			Name:       "Version",
+			Unpublish:  []string{"foo.zany@3.0.0"},
+			Extensions: []string{"foo.zany"},
+			Versions:   []string{"2.2.2", "2.0.0", "1.5.2", "1.0.0", "1.0.0@win32-x64"},
+		},
+		{
+			Name:      "Extension",
+			Unpublish: []string{"foo.zany"},
+		},
+		{
+			Name:      "AllVersions",
+			Unpublish: []string{"foo.zany@1.0.0", "foo.zany@1.5.2", "foo.zany@2.0.0", "foo.zany@2.2.2", "foo.zany@3.0.0"},
+		},
+		{
+			Name:       "IncludeUnpublished",
+			Unpublish:  []string{"foo.zany"},
+			Flags:      database.Unpublished,
+			Extensions: []string{"foo.zany"},
+			Versions:   []string{"3.0.0", "3.0.0@alpine-x64", "3.0.0@darwin-x64", "3.0.0@linux-arm64", "3.0.0@linux-x64", "3.0.0@win32-x64", "2.2.2", "2.0.0", "1.5.2", "1.0.0", "1.0.0@win32-x64"},
+			ExtFlags:   "unpublished",
+		},
+		{
+			Name:      "ExcludeUnpublished",
+			Unpublish: []string{"foo.zany"},
+			Criteria:  []database.Criteria{excludeUnpublished},
+			Flags:     database.Unpublished,
+		},
+		{
+			Name:       "ExcludeUnpublishedVersion",
+			Unpublish:  []string{"foo.zany@1.0.0"},
+			Criteria:   []database.Criteria{excludeUnpublished},
+			Flags:      database.Unpublished,
+			Extensions: []string{"foo.zany"},
+			Versions:   []string{"3.0.0", "3.0.0@alpine-x64", "3.0.0@darwin-x64", "3.0.0@linux-arm64", "3.0.0@linux-x64", "3.0.0@win32-x64", "2.2.2", "2.0.0", "1.5.2"},
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			t.Parallel()
+
+			store := testutil.NewMockStorage()
+			for _, id := range c.Unpublish {
+				publisher, name, version, err := storage.ParseExtensionID(id)
+				require.NoError(t, err)
+				err = storage.Unpublish(context.Background(), store, publisher, name, version)
+				require.NoError(t, err)
+			}
+
+			db := database.NoDB{
+				Storage: store,
+				Logger:  slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}).Leveled(slog.LevelDebug),
+			}
+			filter := database.Filter{
+				Criteria: append([]database.Criteria{{
+					Type:  database.ExtensionID,
+					Value: "foo.zany",
+				}}, c.Criteria...),
+			}
+			exts, totals, err := db.GetExtensions(context.Background(), filter, c.Flags|database.IncludeVersions, *baseURL)
+			require.NoError(t, err)
+			require.Equal(t, len(c.Extensions), totals.Count)
+
+			extids := []string{}
+			for _, ext := range exts {
+				extids = append(extids, ext.ID)
+				versions := []string{}
+				for _, version := range ext.Versions {
+					versions = append(versions, version.String())
+				}
+				require.Equal(t, c.Versions, versions)
+				require.Equal(t, c.ExtFlags, ext.Flags)
+			}
+			require.ElementsMatch(t, c.Extensions, extids)
+		})
+	}
+}
+
+func TestMaliciousExtensions(t *testing.T) {
+	t.Parallel()
+
+	base := "test://cdr.dev/base"
+	baseURL, err := url.Parse(base)
+	require.NoError(t, err)
+
+	store := testutil.NewMockStorage()
+	err = storage.UpdateControlManifest(context.Background(), store, func(manifest *storage.ControlManifest) error {
+		manifest.SetMalicious("foo.zany")
+		return nil
+	})
+	require.NoError(t, err)
+
+	db := database.NoDB{
+		Storage: store,
+		Logger:  slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}).Leveled(slog.LevelDebug),
+	}
+
+	exts, totals, err := db.GetExtensions(context.Background(), database.Filter{
+		Criteria: []database.Criteria{{
+			Type:  database.Target,
+			Value: "Microsoft.VisualStudio.Code",
+		}},
+	}, database.None, *baseURL)
+	require.NoError(t, err)
+	require.Equal(t, len(testutil.Extensions)-1, totals.Count)
+	for _, ext := range exts {
+		require.NotEqual(t, "foo.zany", ext.Publisher.PublisherName+"."+ext.Name)
+	}
+
+	_, err = db.GetExtensionAssetPath(context.Background(), &database.Asset{
+		Publisher: "foo",
+		Extension: "zany",
+		Type:      storage.VSIXAssetType,
+		Version:   storage.Version{Version: "1.0.0"},
+	}, *baseURL)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestGetExtensionsTotals(t *testing.T) {
+	t.Parallel()
+
+	base := "test://cdr.dev/base"
+	baseURL, err := url.Parse(base)
+	require.NoError(t, err)
+
+	db := database.NoDB{
+		Storage: testutil.NewMockStorage(),
+		Logger:  slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}).Leveled(slog.LevelDebug),
+	}
+
+	// Totals should cover every match, not just the page.
+	exts, totals, err := db.GetExtensions(context.Background(), database.Filter{
+		Criteria: []database.Criteria{{
+			Type:  database.Target,
+			Value: "Microsoft.VisualStudio.Code",
+		}},
+		PageSize: 1,
+	}, database.None, *baseURL)
+	require.NoError(t, err)
+	require.Len(t, exts, 1)
+	require.Equal(t, &database.Totals{
+		Count: 5,
+		Categories: map[string]int{
+			"category1": 3,
+			"category2": 2,
+			"q":         1,
+		},
+		TargetPlatforms: map[storage.Platform]int{
+			storage.PlatformUniversal:  5,
+			storage.PlatformWin32X64:   1,
+			storage.PlatformLinuxX64:   1,
+			storage.PlatformLinuxArm64: 1,
+			storage.PlatformAlpineX64:  1,
+			storage.PlatformDarwinX64:  1,
+		},
+	}, totals)
+
+	// Totals should only cover matches.
+	_, totals, err = db.GetExtensions(context.Background(), database.Filter{
+		Criteria: []database.Criteria{{
+			Type:  database.Category,
+			Value: "category2",
+		}},
+	}, database.None, *baseURL)
+	require.NoError(t, err)
+	require.Equal(t, &database.Totals{
+		Count: 2,
+		Categories: map[string]int{
+			"category1": 1,
+			"category2": 2,
+		},
+		TargetPlatforms: map[storage.Platform]int{
+			storage.PlatformUniversal: 2,
+		},
+	}, totals)
+}
+
+func TestGetExtensionsPlatforms(t *testing.T) {
+	t.Parallel()
+
+	base := "test://cdr.dev/base"
+	baseURL, err := url.Parse(base)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		platforms []storage.Platform
+		expected  []string
+	}{
+		{
+			name:     "All",
+			expected: []string{"3.0.0", "3.0.0@alpine-x64", "3.0.0@darwin-x64", "3.0.0@linux-arm64", "3.0.0@linux-x64", "3.0.0@win32-x64", "2.2.2", "2.0.0", "1.5.2", "1.0.0", "1.0.0@win32-x64"},
+		},
+		{
+			name:      "Exact",
+			platforms: []storage.Platform{storage.PlatformAlpineX64},
+			expected:  []string{"3.0.0@alpine-x64", "2.2.2", "2.0.0", "1.5.2", "1.0.0"},
+		},
+		{
+			name:      "Fallback",
+			platforms: []storage.Platform{storage.PlatformDarwinArm64, storage.PlatformWin32Arm64},
+			expected:  []string{"3.0.0@darwin-x64", "3.0.0@win32-x64", "2.2.2", "2.0.0", "1.5.2", "1.0.0", "1.0.0@win32-x64"},
+		},
+		{
+			name:      "Universal",
+			platforms: []storage.Platform{storage.PlatformWeb},
+			expected:  []string{"3.0.0", "2.2.2", "2.0.0", "1.5.2", "1.0.0"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			db := database.NoDB{
+				Storage:   testutil.NewMockStorage(),
+				Logger:    slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}).Leveled(slog.LevelDebug),
+				Platforms: test.platforms,
+			}
+
+			exts, _, err := db.GetExtensions(context.Background(), database.Filter{
+				Criteria: []database.Criteria{{
+					Type:  database.ExtensionName,
+					Value: "foo.zany",
+				}},
+			}, database.IncludeVersions, *baseURL)
+			require.NoError(t, err)
+			require.Len(t, exts, 1)
+			versions := []string{}
+			for _, version := range exts[0].Versions {
+				versions = append(versions, version.String())
+			}
+			require.Equal(t, test.expected, versions)
+		})
+	}
+}
+
+func TestGetExtensionsTracing(t *testing.T) {
+	t.Parallel()
+
+	base := "test://cdr.dev/base"
+	baseURL, err := url.Parse(base)
+	require.NoError(t, err)
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	db := database.NoDB{
+		Storage:        testutil.NewMockStorage(),
+		Logger:         slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}).Leveled(slog.LevelDebug),
+		TracerProvider: provider,
+	}
+
+	exts, _, err := db.GetExtensions(context.Background(), database.Filter{
+		Criteria: []database.Criteria{{
+			Type:  database.Target,
+			Value: "Microsoft.VisualStudio.Code",
+		}},
+		PageSize: 2,
+	}, database.IncludeVersions, *baseURL)
+	require.NoError(t, err)
+	require.Len(t, exts, 2)
+
+	spans := exporter.GetSpans()
+	byName := map[string]tracetest.SpanStub{}
+	names := []string{}
+	for _, span := range spans {
+		byName[span.Name] = span
+		names = append(names, span.Name)
+	}
+	require.Equal(t, []string{"walk", "sort", "paginate", "handleFlags", "GetExtensions"}, names)
+
+	root := byName["GetExtensions"]
+	require.False(t, root.Parent.IsValid())
+	require.Contains(t, root.Attributes, attribute.Int("filter.page_size", 2))
+	for _, name := range names[:4] {
+		require.Equal(t, root.SpanContext.SpanID(), byName[name].Parent.SpanID(), name)
+		require.Equal(t, root.SpanContext.TraceID(), byName[name].SpanContext.TraceID(), name)
+	}
+	require.Contains(t, byName["walk"].Attributes, attribute.Int("count", 5))
+	require.Contains(t, byName["paginate"].Attributes, attribute.Int("count", 2))
+}
+
+func TestIndexRefresh(t *testing.T) {
+	t.Parallel()
+
+	baseURL, err := url.Parse("test://cdr.dev/base")
+	require.NoError(t, err)
+	search := func(db *database.NoDB) {
+		exts, _, err := db.GetExtensions(context.Background(), database.Filter{
+			Criteria: []database.Criteria{{Type: database.SearchText, Value: "zany"}},
+		}, database.None, *baseURL)
+		require.NoError(t, err)
+		require.NotEmpty(t, exts)
+	}
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		// walks is the number of walks over storage for three searches, each of
+		// which walks once to match extensions.
+		walks int32
+	}{
+		{name: "EverySearch", walks: 6},
+		{name: "Interval", interval: time.Hour, walks: 4},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := &countingStorage{Storage: testutil.NewMockStorage()}
+			db := &database.NoDB{
+				Storage: store,
+				Logger:  slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}),
+			}
+			db.SetIndexRefreshInterval(test.interval)
+			for i := 0; i < 3; i++ {
+				search(db)
+			}
+			require.Equal(t, test.walks, store.walks.Load())
+		})
+	}
+}
+
+func TestHealth(t *testing.T) {
+	t.Parallel()
+
+	db := &database.NoDB{
+		Storage: testutil.NewMockStorage(),
+		Logger:  slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}),
+	}
+
+	// Not ready until the search index has been built.
+	require.ErrorContains(t, db.Health(context.Background()), "still being built")
+	require.NoError(t, db.BuildIndex(context.Background()))
+	require.NoError(t, db.Health(context.Background()))
+}
@@ -0,0 +1,144 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+
+	"github.com/coder/code-marketplace/database/search"
+	"github.com/coder/code-marketplace/storage"
+)
+
+// maxReadmeSize limits how much of a README is indexed.
+const maxReadmeSize = 256 * 1024
+
+// scoreToDistance converts a relevance score, where higher is better, into a
+// distance, where lower is better, so it can be sorted alongside other matches.
+func scoreToDistance(score float64) int {
+	return -int(math.Round(score * 1000))
+}
+
+// SetIndexRefreshInterval changes how long the search index is used before a
+// search brings it up to date with storage.  Zero, the default, refreshes it on
+// every search.  Storage only sees changes as often as its list cache expires,
+// so the list cache duration is a good interval.
+func (db *NoDB) SetIndexRefreshInterval(interval time.Duration) {
+	db.indexInterval.Store(int64(interval))
+}
+
+// searchIndex returns the full-text search index, first bringing it up to date
+// with storage if it is older than the refresh interval.  Only extensions that
+// were added or that changed since the last refresh are read and indexed, and
+// extensions that no longer exist are removed, so after the first search this
+// is mostly a walk over the cached extension list.
+func (db *NoDB) searchIndex(ctx context.Context) (*search.Index, error) {
+	db.indexMutex.Lock()
+	defer db.indexMutex.Unlock()
+	if db.index == nil {
+		db.index = search.NewIndex()
+	} else if time.Since(db.indexRefreshed) < time.Duration(db.indexInterval.Load()) {
+		return db.index, nil
+	}
+
+	start := time.Now()
+	seen := map[string]struct{}{}
+	added := 0
+	err := db.Storage.WalkExtensions(ctx, func(manifest *storage.VSIXManifest, versions []storage.Version) error {
+		identity := manifest.Metadata.Identity
+		id := storage.ExtensionIDWithoutVersion(identity.Publisher, identity.ID)
+		seen[id] = struct{}{}
+		if db.index.Has(id, versions[0].String()) {
+			return nil
+		}
+		readme, err := db.readReadme(ctx, manifest, versions[0])
+		if err != nil && errors.Is(err, context.Canceled) {
+			return err
+		} else if err != nil {
+			db.Logger.Warn(ctx, "Unable to read extension README; it will not be searchable", slog.Error(err),
+				slog.F("id", storage.ExtensionIDWithVersion(identity.Publisher, identity.ID, versions[0].Version)),
+				slog.F("targetPlatform", versions[0].TargetPlatform))
+		}
+		db.index.Add(search.Document{
+			ID:      id,
+			Version: versions[0].String(),
+			Fields: map[search.Field]string{
+				search.FieldName:        strings.Join([]string{manifest.Metadata.DisplayName, identity.ID, identity.Publisher}, " "),
+				search.FieldTags:        manifest.Metadata.Tags,
+				search.FieldCategories:  manifest.Metadata.Categories,
+				search.FieldDescription: manifest.Metadata.Description,
+				search.FieldReadme:      readme,
+			},
+		})
+		added++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	removed := 0
+	for _, id := range db.index.IDs() {
+		if _, ok := seen[id]; !ok {
+			db.index.Remove(id)
+			removed++
+		}
+	}
+
+	db.Logger.Debug(ctx, "refresh search index",
+		slog.F("took", time.Since(start)),
+		slog.F("added", added),
+		slog.F("removed", removed))
+
+	db.indexRefreshed = time.Now()
+	db.indexed.Store(true)
+	return db.index, nil
+}
+
+// BuildIndex builds the search index ahead of the first search, which would
+// otherwise have to wait for it.  Until the index has been built, either here
+// or by a search, Health reports the database as not ready.
+func (db *NoDB) BuildIndex(ctx context.Context) error {
+	start := time.Now()
+	_, err := db.searchIndex(ctx)
+	if err != nil {
+		return err
+	}
+	db.Logger.Info(ctx, "Built search index", slog.F("took", time.Since(start)))
+	return nil
+}
+
+func (db *NoDB) Health(ctx context.Context) error {
+	if !db.indexed.Load() {
+		return xerrors.New("the search index is still being built")
+	}
+	return nil
+}
+
+// readReadme returns the README listed in the manifest or a blank string if
+// there is not one.
+func (db *NoDB) readReadme(ctx context.Context, manifest *storage.VSIXManifest, version storage.Version) (string, error) {
+	for _, asset := range manifest.Assets.Asset {
+		if asset.Type != storage.DetailsAssetType {
+			continue
+		}
+		identity := manifest.Metadata.Identity
+		reader, err := db.Storage.Open(ctx, identity.Publisher, identity.ID, version, asset.Path)
+		if err != nil {
+			return "", err
+		}
+		defer reader.Close()
+		readme, err := io.ReadAll(io.LimitReader(reader, maxReadmeSize))
+		if err != nil {
+			return "", err
+		}
+		return string(readme), nil
+	}
+	return "", nil
+}
@@ -6,16 +6,23 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/lithammer/fuzzysearch/fuzzy"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 
 	"cdr.dev/slog"
 
+	"github.com/coder/code-marketplace/database/search"
 	"github.com/coder/code-marketplace/storage"
+	"github.com/coder/code-marketplace/tracing"
 )
 
 // NoDB implements Database.  It reads extensions directly off storage then
@@ -24,10 +31,45 @@ import (
 type NoDB struct {
 	Storage storage.Storage
 	Logger  slog.Logger
+	// Platforms limits query results to versions that can be installed on at
+	// least one of these platforms.  If empty, every version is returned.
+	Platforms []storage.Platform
+	// TracerProvider receives spans for each phase of a query.  Defaults to
+	// discarding them.
+	TracerProvider trace.TracerProvider
+
+	// index is created on the first search and refreshed on searches after once
+	// it is older than the refresh interval.  indexMutex guards it along with
+	// indexRefreshed, and keeps concurrent searches from refreshing it at once.
+	index          *search.Index
+	indexMutex     sync.Mutex
+	indexRefreshed time.Time
+	indexInterval  atomic.Int64
+	// indexed is set once the index has been built.
+	indexed atomic.Bool
+	// versions holds the versions of each extension, keyed by ID, from the last
+	// complete walk over storage.  Asset requests resolve their version from it
+	// so they do not have to ask storage, which for Artifactory means listing.
+	versions atomic.Pointer[map[string][]storage.Version]
 }
 
 func (db *NoDB) GetExtensionAssetPath(ctx context.Context, asset *Asset, baseURL url.URL) (string, error) {
-	manifest, err := db.Storage.Manifest(ctx, asset.Publisher, asset.Extension, asset.Version)
+	control, err := storage.ReadControlManifest(ctx, db.Storage)
+	if err != nil {
+		return "", err
+	}
+	// Blocked extensions should not be installable.
+	if control.IsMalicious(storage.ExtensionIDWithoutVersion(asset.Publisher, asset.Extension)) {
+		return "", os.ErrNotExist
+	}
+
+	// Versions added since the last walk are not known yet and versions removed
+	// since are gone, so try again with the versions in storage when the cached
+	// ones do not resolve.
+	version, manifest, err := db.resolveAsset(ctx, asset, true)
+	if err != nil && errors.Is(err, os.ErrNotExist) {
+		version, manifest, err = db.resolveAsset(ctx, asset, false)
+	}
 	if err != nil {
 		return "", err
 	}
@@ -40,7 +82,7 @@ func (db *NoDB) GetExtensionAssetPath(ctx context.Context, asset *Asset, baseURL
 			"files",
 			asset.Publisher,
 			asset.Extension,
-			asset.Version.String()),
+			version.String()),
 	}).String()
 
 	for _, a := range manifest.Assets.Asset {
@@ -52,39 +94,159 @@ func (db *NoDB) GetExtensionAssetPath(ctx context.Context, asset *Asset, baseURL
 	return "", os.ErrNotExist
 }
 
-func (db *NoDB) GetExtensions(ctx context.Context, filter Filter, flags Flag, baseURL url.URL) ([]*Extension, int, error) {
+// resolveAsset negotiates the best build for the asset and returns it with the
+// build's manifest.  Clients ask for their own platform which might not have a build,
+// so an exact match is not required.  The versions come from the last walk if
+// cached is true and from storage otherwise.
+func (db *NoDB) resolveAsset(ctx context.Context, asset *Asset, cached bool) (storage.Version, *storage.VSIXManifest, error) {
+	var versions []storage.Version
+	if cached {
+		if all := db.versions.Load(); all != nil {
+			versions = (*all)[storage.ExtensionIDWithoutVersion(asset.Publisher, asset.Extension)]
+		}
+	} else {
+		var err error
+		versions, err = db.Storage.Versions(ctx, asset.Publisher, asset.Extension)
+		if err != nil {
+			return storage.Version{}, nil, err
+		}
+	}
+	version, ok := storage.ResolveVersion(versions, asset.Version.Version, asset.Version.TargetPlatform)
+	if !ok {
+		return storage.Version{}, nil, os.ErrNotExist
+	}
+	manifest, err := db.Storage.Manifest(ctx, asset.Publisher, asset.Extension, version)
+	if err != nil {
+		return storage.Version{}, nil, err
+	}
+	return version, manifest, nil
+}
+
+func (db *NoDB) GetExtensions(ctx context.Context, filter Filter, flags Flag, baseURL url.URL) (_ []*Extension, _ *Totals, err error) {
+	tracer := tracing.Tracer(db.TracerProvider)
+	ctx, span := tracer.Start(ctx, "GetExtensions", trace.WithAttributes(
+		attribute.Int("filter.criteria", len(filter.Criteria)),
+		attribute.Int("filter.page_number", filter.PageNumber),
+		attribute.Int("filter.page_size", filter.PageSize),
+		attribute.Int("flags", int(flags))))
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	vscodeExts := []*noDBExtension{}
 
+	unpublished, err := storage.ReadUnpublished(ctx, db.Storage)
+	if err != nil {
+		return nil, nil, err
+	}
+	control, err := storage.ReadControlManifest(ctx, db.Storage)
+	if err != nil {
+		return nil, nil, err
+	}
+	featured, err := storage.ReadFeatured(ctx, db.Storage)
+	if err != nil {
+		return nil, nil, err
+	}
+	mctx := &matchContext{
+		featured: featured,
+		searches: map[string]searchText{},
+	}
+	for _, c := range filter.Criteria {
+		if c.Type != SearchText {
+			continue
+		}
+		parsed, text := parseSearchText(c.Value)
+		// Searches that only use qualifiers do not need the index.
+		if text != "" {
+			index, err := db.searchIndex(ctx)
+			if err != nil {
+				return nil, nil, err
+			}
+			parsed.scores = index.Search(text)
+		}
+		mctx.searches[c.Value] = parsed
+	}
+	// Unpublished versions are only returned when explicitly requested, and even
+	// then ExcludeWithFlags takes precedence.
+	includeUnpublished := flags&Unpublished != 0 && !excludesFlag(filter, Unpublished)
+
 	start := time.Now()
-	err := db.Storage.WalkExtensions(ctx, func(manifest *storage.VSIXManifest, versions []storage.Version) error {
+	walkCtx, walkSpan := tracer.Start(ctx, "walk")
+	walked := map[string][]storage.Version{}
+	err = db.Storage.WalkExtensions(walkCtx, func(manifest *storage.VSIXManifest, versions []storage.Version) error {
+		identity := manifest.Metadata.Identity
+		walked[storage.ExtensionIDWithoutVersion(identity.Publisher, identity.ID)] = versions
+		if control.IsMalicious(storage.ExtensionIDWithoutVersion(identity.Publisher, identity.ID)) {
+			return nil
+		}
+		isUnpublished := func(version storage.Version) bool {
+			return unpublished.IsUnpublished(identity.Publisher, identity.ID, version)
+		}
+		latest := versions[0]
+		if !includeUnpublished && slices.ContainsFunc(versions, isUnpublished) {
+			versions = slices.DeleteFunc(slices.Clone(versions), isUnpublished)
+		}
+		versions = db.compatibleVersions(versions)
+		if len(versions) == 0 {
+			return nil
+		}
+		// The manifest from the latest version is used for filtering so if that
+		// one was unpublished or is not for a served platform swap to the latest
+		// remaining version.
+		if versions[0] != latest {
+			var err error
+			manifest, err = db.Storage.Manifest(walkCtx, identity.Publisher, identity.ID, versions[0])
+			if err != nil && errors.Is(err, context.Canceled) {
+				return err
+			} else if err != nil {
+				db.Logger.Error(walkCtx, "Unable to read extension manifest; extension will be ignored", slog.Error(err),
+					slog.F("id", storage.ExtensionIDWithVersion(identity.Publisher, identity.ID, versions[0].Version)),
+					slog.F("targetPlatform", versions[0].TargetPlatform))
+				return nil
+			}
+		}
 		vscodeExt := convertManifestToExtension(manifest)
+		vscodeExt.versions = versions
+		if includeUnpublished && isUnpublished(versions[0]) {
+			vscodeExt.Flags = appendFlag(vscodeExt.Flags, "unpublished")
+		}
 		// TODO: Could return early if ExtensionID or ExtensionName match.
-		if matched, distances := getMatches(vscodeExt, filter); matched {
-			vscodeExt.versions = versions
+		if matched, distances := getMatches(vscodeExt, filter, mctx); matched {
 			vscodeExt.distances = distances
 			vscodeExts = append(vscodeExts, vscodeExt)
 		}
 		return nil
 	})
 	if err != nil {
-		return nil, 0, err
+		tracing.End(walkSpan, err)
+		return nil, nil, err
 	}
+	db.versions.Store(&walked)
 
-	total := len(vscodeExts)
-	db.Logger.Debug(ctx, "walk extensions", slog.F("took", time.Since(start)), slog.F("count", total))
+	totals := countExtensions(vscodeExts)
+	walkSpan.SetAttributes(attribute.Int("count", totals.Count))
+	walkSpan.End()
+	db.Logger.Debug(ctx, "walk extensions", slog.F("took", time.Since(start)), slog.F("count", totals.Count))
 
 	start = time.Now()
+	_, sortSpan := tracer.Start(ctx, "sort")
 	sortExtensions(vscodeExts, filter)
+	sortSpan.End()
 	db.Logger.Debug(ctx, "sort extensions", slog.F("took", time.Since(start)))
 
 	start = time.Now()
+	_, paginateSpan := tracer.Start(ctx, "paginate")
 	vscodeExts = paginateExtensions(vscodeExts, filter)
+	paginateSpan.SetAttributes(attribute.Int("count", len(vscodeExts)))
+	paginateSpan.End()
 	db.Logger.Debug(ctx, "paginate extensions", slog.F("took", time.Since(start)))
 
 	start = time.Now()
-	err = db.handleFlags(ctx, vscodeExts, flags, baseURL)
+	flagsCtx, flagsSpan := tracer.Start(ctx, "handleFlags")
+	err = db.handleFlags(flagsCtx, vscodeExts, flags, baseURL)
+	tracing.End(flagsSpan, err)
 	if err != nil {
-		return nil, 0, err
+		return nil, nil, err
 	}
 	db.Logger.Debug(ctx, "handle flags", slog.F("took", time.Since(start)))
 
@@ -106,14 +268,85 @@ func (db *NoDB) GetExtensions(ctx context.Context, filter Filter, flags Flag, ba
 			Flags:            ext.Flags,
 		})
 	}
-	return convertedExts, total, nil
+	return convertedExts, totals, nil
 }
 
-func getMatches(extension *noDBExtension, filter Filter) (bool, []int) {
-	// Normally we would want to handle ExcludeWithFlags but the only flag that
-	// seems usable with it (and the only flag VS Code seems to send) is
-	// Unpublished and currently there is no concept of unpublished extensions so
-	// there is nothing to do.
+// compatibleVersions returns the versions that are the best build of their
+// version for at least one of the configured platforms.  For example with only
+// alpine-x64 configured a version with linux-x64 and universal builds will only
+// have its linux-x64 build returned.  The order of the versions is preserved.
+func (db *NoDB) compatibleVersions(versions []storage.Version) []storage.Version {
+	if len(db.Platforms) == 0 {
+		return versions
+	}
+	keep := map[storage.Version]struct{}{}
+	for _, version := range versions {
+		for _, platform := range db.Platforms {
+			if resolved, ok := storage.ResolveVersion(versions, version.Version, platform); ok {
+				keep[resolved] = struct{}{}
+			}
+		}
+	}
+	return slices.DeleteFunc(slices.Clone(versions), func(version storage.Version) bool {
+		_, ok := keep[version]
+		return !ok
+	})
+}
+
+// countExtensions computes totals over every matched extension.  Facets count
+// extensions rather than versions, so an extension with several versions for
+// the same platform only counts once toward that platform.
+func countExtensions(exts []*noDBExtension) *Totals {
+	totals := &Totals{
+		Count:           len(exts),
+		Categories:      map[string]int{},
+		TargetPlatforms: map[storage.Platform]int{},
+	}
+	for _, ext := range exts {
+		for _, category := range ext.Categories {
+			totals.Categories[category]++
+		}
+		platforms := map[storage.Platform]struct{}{}
+		for _, version := range ext.versions {
+			platform := version.TargetPlatform
+			if platform == "" {
+				platform = storage.PlatformUniversal
+			}
+			platforms[platform] = struct{}{}
+		}
+		for platform := range platforms {
+			totals.TargetPlatforms[platform]++
+		}
+	}
+	return totals
+}
+
+// excludesFlag returns true if the filter has an ExcludeWithFlags criteria
+// that includes the provided flag.
+func excludesFlag(filter Filter, flag Flag) bool {
+	for _, c := range filter.Criteria {
+		if c.Type != ExcludeWithFlags {
+			continue
+		}
+		value, err := strconv.Atoi(c.Value)
+		if err == nil && Flag(value)&flag != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// matchContext holds data needed for matching that is read once per query.
+type matchContext struct {
+	featured storage.Featured
+	// searches maps the value of each SearchText criteria to its results.
+	searches map[string]searchText
+}
+
+func getMatches(extension *noDBExtension, filter Filter, mctx *matchContext) (bool, []int) {
+	// ExcludeWithFlags is not handled here since the only flag that seems usable
+	// with it (and the only flag VS Code seems to send) is Unpublished, which
+	// applies to versions and is handled while walking.
 	var (
 		triedFilter = false
 		hasTarget   = false
@@ -148,39 +381,17 @@ func getMatches(extension *noDBExtension, filter Filter) (bool, []int) {
 			// them all since not all criteria are for matching (ExcludeWithFlags).
 			hasTarget = true
 		case Featured:
-			// Currently unsupported; this would require a database.
-			match(false)
-		case SearchText:
+			// Use the position in the featured list as the distance so featured
+			// extensions are returned in their curated order.
 			triedFilter = true
-			// REVIEW: Does this even make any sense?
-			// REVIEW: Should include categories and tags?
-			// Search each token of the input individually.
-			tokens := strings.FieldsFunc(c.Value, func(r rune) bool {
-				return r == ' ' || r == ',' || r == '.'
-			})
-			// Publisher is implement as SearchText via `publisher:"name"`.
-			searchTokens := []string{}
-			for _, token := range tokens {
-				parts := strings.SplitN(token, ":", 2)
-				if len(parts) == 2 && parts[0] == "publisher" {
-					match(strings.EqualFold(extension.Publisher.PublisherName, strings.Trim(parts[1], "\"")))
-				} else if token != "" {
-					searchTokens = append(searchTokens, token)
-				}
-			}
-			candidates := []string{extension.Name, extension.Publisher.PublisherName, extension.ShortDescription}
-			allMatches := fuzzy.Ranks{}
-			for _, token := range searchTokens {
-				matches := fuzzy.RankFindFold(token, candidates)
-				if len(matches) == 0 {
-					// If even one token does not match all the matches are invalid.
-					allMatches = fuzzy.Ranks{}
-					break
-				}
-				allMatches = append(allMatches, matches...)
+			name := storage.ExtensionIDWithoutVersion(extension.Publisher.PublisherName, extension.Name)
+			if index := mctx.featured.Index(name); index != -1 {
+				distances = append(distances, index)
 			}
-			for _, match := range allMatches {
-				distances = append(distances, match.Distance)
+		case SearchText:
+			triedFilter = true
+			if matched, distance := mctx.searches[c.Value].match(extension); matched {
+				distances = append(distances, distance)
 			}
 		}
 	}
@@ -307,7 +518,6 @@ func (db *NoDB) handleFlags(ctx context.Context, exts []*noDBExtension, flags Fl
 		// if flags&IncludeSharedAccounts != 0 {}
 		// if flags&ExcludeNonValidated != 0 {}
 		// if flags&IncludeStatistics != 0 {}
-		// if flags&Unpublished != 0 {}
 	}
 	return eg.Wait()
 }
@@ -438,6 +648,14 @@ func convertManifestToExtension(manifest *storage.VSIXManifest) *noDBExtension {
 	}
 }
 
+// appendFlag adds a flag to a comma-separated gallery flags string.
+func appendFlag(flags, flag string) string {
+	if flags == "" {
+		return flag
+	}
+	return flags + ", " + flag
+}
+
 func containsFold(a []string, b string) bool {
 	for _, astr := range a {
 		if strings.EqualFold(astr, b) {
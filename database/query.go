@@ -0,0 +1,117 @@
+package database
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/coder/code-marketplace/storage"
+)
+
+// qualifierPattern matches qualifiers like `tag:foo`, `@category:"Data
+// Science"`, or `-tag:foo` (which excludes extensions with the tag).  A leading
+// @ is accepted since that is how they are typed in VS Code.
+var qualifierPattern = regexp.MustCompile(`(?:^|\s)(-?)@?(publisher|category|tag|ext|platform|id):(?:"([^"]*)"|(\S+))`)
+
+// qualifier filters search results on something other than the search text.
+type qualifier struct {
+	key    string
+	value  string
+	negate bool
+}
+
+// matches returns true if the extension has the qualifier's value.
+func (q qualifier) matches(ext *noDBExtension) bool {
+	switch q.key {
+	case "publisher":
+		return strings.EqualFold(ext.Publisher.PublisherName, q.value)
+	case "category":
+		return containsFold(ext.Categories, q.value)
+	case "tag":
+		return containsFold(ext.Tags, q.value)
+	case "ext":
+		// vscode-vsce adds a tag for each file extension the extension contributes
+		// a language for.
+		return containsFold(ext.Tags, "__ext_"+strings.TrimPrefix(q.value, "."))
+	case "platform":
+		// Only versions built for the platform match, except for `universal` which
+		// matches versions that are not built for any specific platform.
+		platform := storage.Platform(strings.ToLower(q.value))
+		return slices.ContainsFunc(ext.versions, func(version storage.Version) bool {
+			if platform == storage.PlatformUniversal {
+				return version.IsUniversal()
+			}
+			return version.TargetPlatform == platform
+		})
+	case "id":
+		name := storage.ExtensionIDWithoutVersion(ext.Publisher.PublisherName, ext.Name)
+		return strings.EqualFold(name, q.value)
+	}
+	return false
+}
+
+// searchText is a parsed SearchText criteria.
+type searchText struct {
+	qualifiers []qualifier
+	// scores maps matching extension IDs (publisher.name) to their relevance,
+	// or is nil if there was no text to search for.
+	scores map[string]float64
+}
+
+// parseSearchText extracts qualifiers from the search text and returns them
+// along with the remaining text.  Results from searching the remaining text
+// should be set on the returned searchText.
+func parseSearchText(value string) (searchText, string) {
+	parsed := searchText{}
+	text := qualifierPattern.ReplaceAllStringFunc(value, func(match string) string {
+		groups := qualifierPattern.FindStringSubmatch(match)
+		parsed.qualifiers = append(parsed.qualifiers, qualifier{
+			negate: groups[1] == "-",
+			key:    groups[2],
+			value:  groups[3] + groups[4],
+		})
+		return " "
+	})
+	return parsed, strings.TrimSpace(text)
+}
+
+// matchesQualifiers returns true if the extension satisfies the qualifiers.
+// Qualifiers with different keys must all match but qualifiers with the same
+// key are alternatives, so `tag:a tag:b category:c` matches extensions in
+// category c with either tag a or b.  An extension that matches any negated
+// qualifier is excluded.
+func (s searchText) matchesQualifiers(ext *noDBExtension) bool {
+	matched := map[string]bool{}
+	for _, q := range s.qualifiers {
+		matches := q.matches(ext)
+		if q.negate {
+			if matches {
+				return false
+			}
+			continue
+		}
+		matched[q.key] = matched[q.key] || matches
+	}
+	for _, matches := range matched {
+		if !matches {
+			return false
+		}
+	}
+	return true
+}
+
+// match returns whether the extension matches and, if so, its distance.
+// Extensions must match the qualifiers and, if there is any text, the text.
+func (s searchText) match(ext *noDBExtension) (bool, int) {
+	if len(s.qualifiers) == 0 && s.scores == nil {
+		return false, 0
+	}
+	if !s.matchesQualifiers(ext) {
+		return false, 0
+	}
+	if s.scores == nil {
+		return true, 0
+	}
+	score, ok := s.scores[storage.ExtensionIDWithoutVersion(ext.Publisher.PublisherName, ext.Name)]
+	return ok, scoreToDistance(score)
+}
@@ -0,0 +1,301 @@
+// Package search implements an in-memory full-text index over extensions with
+// BM25F ranking.
+package search
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Field is a searchable part of an extension.
+type Field int
+
+const (
+	// FieldName holds the display name, name, and publisher.
+	FieldName Field = iota
+	FieldTags
+	FieldCategories
+	FieldDescription
+	FieldReadme
+	fieldCount
+)
+
+// boosts weights term frequencies by the field they occur in so, for example, a
+// match in the name outranks a match buried in the README.
+var boosts = [fieldCount]float64{
+	FieldName:        5,
+	FieldTags:        3,
+	FieldCategories:  2,
+	FieldDescription: 1.5,
+	FieldReadme:      1,
+}
+
+const (
+	// k1 and b are the usual BM25 saturation and length normalization
+	// parameters.
+	k1 = 1.2
+	b  = 0.75
+	// Terms that only match as a prefix or with typos are discounted so exact
+	// matches rank first.  Typo matches are further discounted by the number of
+	// edits.
+	prefixWeight    = 0.8
+	minPrefixLength = 3
+)
+
+// Document is an extension to index.
+type Document struct {
+	// ID identifies the document, for example publisher.name.
+	ID string
+	// Version identifies the content of the document so callers can tell
+	// whether it needs to be indexed again.
+	Version string
+	Fields  map[Field]string
+}
+
+// posting holds the positions of a term in each field of a document.
+type posting [fieldCount][]int
+
+type document struct {
+	version string
+	lengths [fieldCount]int
+	terms   []string
+}
+
+// Index is an inverted index from terms to the documents containing them.  It
+// is safe for concurrent use.  Documents can be added and removed individually
+// so the index can be kept up to date without rebuilding it.
+type Index struct {
+	mutex    sync.RWMutex
+	docs     map[string]*document
+	postings map[string]map[string]*posting
+	// lengths holds the total length of each field across all documents, for
+	// computing average field lengths.
+	lengths [fieldCount]int
+}
+
+func NewIndex() *Index {
+	return &Index{
+		docs:     map[string]*document{},
+		postings: map[string]map[string]*posting{},
+	}
+}
+
+// Add indexes a document, replacing any existing document with the same ID.
+func (i *Index) Add(doc Document) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.remove(doc.ID)
+
+	d := &document{version: doc.Version}
+	for field, text := range doc.Fields {
+		if field < 0 || field >= fieldCount {
+			continue
+		}
+		tokens := tokenize(text)
+		d.lengths[field] = len(tokens)
+		i.lengths[field] += len(tokens)
+		for _, token := range tokens {
+			docs, ok := i.postings[token.term]
+			if !ok {
+				docs = map[string]*posting{}
+				i.postings[token.term] = docs
+			}
+			p, ok := docs[doc.ID]
+			if !ok {
+				p = &posting{}
+				docs[doc.ID] = p
+				d.terms = append(d.terms, token.term)
+			}
+			p[field] = append(p[field], token.position)
+		}
+	}
+	i.docs[doc.ID] = d
+}
+
+// Remove removes a document from the index.  It is a no-op if the document is
+// not indexed.
+func (i *Index) Remove(id string) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.remove(id)
+}
+
+func (i *Index) remove(id string) {
+	d, ok := i.docs[id]
+	if !ok {
+		return
+	}
+	for _, term := range d.terms {
+		delete(i.postings[term], id)
+		if len(i.postings[term]) == 0 {
+			delete(i.postings, term)
+		}
+	}
+	for field, length := range d.lengths {
+		i.lengths[field] -= length
+	}
+	delete(i.docs, id)
+}
+
+// Has returns true if the document is indexed with the provided version.
+func (i *Index) Has(id, version string) bool {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	d, ok := i.docs[id]
+	return ok && d.version == version
+}
+
+// IDs returns the IDs of every indexed document.
+func (i *Index) IDs() []string {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	ids := make([]string, 0, len(i.docs))
+	for id := range i.docs {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// Len returns the number of indexed documents.
+func (i *Index) Len() int {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	return len(i.docs)
+}
+
+// Search returns the score of every document that matches the query, keyed by
+// document ID.  Higher scores are more relevant.  Text in double quotes is
+// matched as a phrase and every other term is matched individually, tolerating
+// prefixes and typos.  Documents must match every term and phrase.
+func (i *Index) Search(text string) map[string]float64 {
+	q := parseQuery(text)
+
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	var scores map[string]float64
+	intersect := func(clause map[string]float64) {
+		if scores == nil {
+			scores = clause
+			return
+		}
+		for id := range scores {
+			if score, ok := clause[id]; ok {
+				scores[id] += score
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+	for _, term := range q.terms {
+		intersect(i.termScores(term))
+	}
+	for _, phrase := range q.phrases {
+		intersect(i.phraseScores(phrase))
+	}
+	if scores == nil {
+		return map[string]float64{}
+	}
+	return scores
+}
+
+// termScores scores every document that contains the term or something close
+// to it, using the best scoring variant for each document.
+func (i *Index) termScores(term string) map[string]float64 {
+	scores := map[string]float64{}
+	for variant, weight := range i.expand(term) {
+		for id, p := range i.postings[variant] {
+			scores[id] = max(scores[id], weight*i.bm25(variant, id, p))
+		}
+	}
+	return scores
+}
+
+// expand returns the indexed terms that match a query term along with how much
+// to discount each one.
+func (i *Index) expand(term string) map[string]float64 {
+	variants := map[string]float64{}
+	if _, ok := i.postings[term]; ok {
+		variants[term] = 1
+	}
+	edits := maxEdits(term)
+	prefix := len([]rune(term)) >= minPrefixLength
+	for indexed := range i.postings {
+		if indexed == term {
+			continue
+		}
+		weight := 0.0
+		if prefix && strings.HasPrefix(indexed, term) {
+			weight = prefixWeight
+		}
+		if edits > 0 {
+			if d := distance(term, indexed, edits); d <= edits {
+				weight = max(weight, 1/float64(1+d))
+			}
+		}
+		if weight > 0 {
+			variants[indexed] = weight
+		}
+	}
+	return variants
+}
+
+// phraseScores scores every document that contains the phrase in a single
+// field.  Phrases must match exactly (after stemming).
+func (i *Index) phraseScores(phrase []token) map[string]float64 {
+	scores := map[string]float64{}
+	first := phrase[0]
+	for id, p := range i.postings[first.term] {
+		if !i.containsPhrase(id, p, phrase) {
+			continue
+		}
+		score := 0.0
+		for _, token := range phrase {
+			score += i.bm25(token.term, id, i.postings[token.term][id])
+		}
+		scores[id] = score
+	}
+	return scores
+}
+
+func (i *Index) containsPhrase(id string, first *posting, phrase []token) bool {
+	for field, positions := range first {
+	outer:
+		for _, start := range positions {
+			for _, token := range phrase[1:] {
+				p, ok := i.postings[token.term][id]
+				want := start + token.position - phrase[0].position
+				if !ok || !slices.Contains(p[field], want) {
+					continue outer
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// bm25 scores a term in a document using BM25F: term frequencies are
+// normalized by field length and boosted per field before being combined and
+// saturated.
+func (i *Index) bm25(term, id string, p *posting) float64 {
+	n := float64(len(i.docs))
+	df := float64(len(i.postings[term]))
+	idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+	d := i.docs[id]
+	tf := 0.0
+	for field, positions := range p {
+		if len(positions) == 0 {
+			continue
+		}
+		avg := float64(i.lengths[field]) / n
+		norm := 1 - b + b*float64(d.lengths[field])/avg
+		tf += boosts[field] * float64(len(positions)) / norm
+	}
+	return idf * tf * (k1 + 1) / (tf + k1)
+}
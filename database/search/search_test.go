@@ -0,0 +1,206 @@
+package search_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/code-marketplace/database/search"
+)
+
+func newIndex() *search.Index {
+	index := search.NewIndex()
+	index.Add(search.Document{
+		ID:      "ms-python.python",
+		Version: "1.0.0",
+		Fields: map[search.Field]string{
+			search.FieldName:        "Python python ms-python",
+			search.FieldTags:        "python,linters,debuggers",
+			search.FieldCategories:  "Programming Languages,Debuggers",
+			search.FieldDescription: "Python language support with extension access points for IntelliSense, debugging, and more.",
+			search.FieldReadme:      "# Python\n\nRun tests and lint your code while debugging in the editor.",
+		},
+	})
+	index.Add(search.Document{
+		ID:      "golang.go",
+		Version: "1.0.0",
+		Fields: map[search.Field]string{
+			search.FieldName:        "Go go golang",
+			search.FieldTags:        "go,debuggers,snippet",
+			search.FieldCategories:  "Programming Languages,Debuggers",
+			search.FieldDescription: "Rich Go language support.",
+			search.FieldReadme:      "Works great alongside Python tooling.",
+		},
+	})
+	index.Add(search.Document{
+		ID:      "vscodevim.vim",
+		Version: "1.0.0",
+		Fields: map[search.Field]string{
+			search.FieldName:        "Vim vim vscodevim",
+			search.FieldTags:        "keybindings,vim",
+			search.FieldCategories:  "Keymaps",
+			search.FieldDescription: "Vim emulation for Visual Studio Code",
+		},
+	})
+	return index
+}
+
+// ranked returns the IDs from the search results in order of relevance.
+func ranked(scores map[string]float64) []string {
+	ids := []string{}
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return scores[ids[i]] > scores[ids[j]]
+	})
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	t.Parallel()
+
+	index := newIndex()
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{
+			name:     "Empty",
+			query:    "",
+			expected: []string{},
+		},
+		{
+			name:     "StopWords",
+			query:    "the and of",
+			expected: []string{},
+		},
+		{
+			name:     "NoMatch",
+			query:    "kitten",
+			expected: []string{},
+		},
+		{
+			name:     "Name",
+			query:    "vim",
+			expected: []string{"vscodevim.vim"},
+		},
+		{
+			// golang.go only mentions Python in its README.
+			name:     "FieldBoost",
+			query:    "python",
+			expected: []string{"ms-python.python", "golang.go"},
+		},
+		{
+			name:     "CaseInsensitive",
+			query:    "PYTHON",
+			expected: []string{"ms-python.python", "golang.go"},
+		},
+		{
+			name:     "Category",
+			query:    "keymaps",
+			expected: []string{"vscodevim.vim"},
+		},
+		{
+			name:     "Tag",
+			query:    "snippet",
+			expected: []string{"golang.go"},
+		},
+		{
+			name:     "AllTermsRequired",
+			query:    "language vim",
+			expected: []string{},
+		},
+		{
+			name:     "Stemming",
+			query:    "tested linting",
+			expected: []string{"ms-python.python"},
+		},
+		{
+			name:     "Typo",
+			query:    "pyhton",
+			expected: []string{"ms-python.python", "golang.go"},
+		},
+		{
+			name:     "TwoTypos",
+			query:    "intellisnese",
+			expected: []string{"ms-python.python"},
+		},
+		{
+			name:     "ShortTermsNoTypos",
+			query:    "vin",
+			expected: []string{},
+		},
+		{
+			name:     "Prefix",
+			query:    "emul",
+			expected: []string{"vscodevim.vim"},
+		},
+		{
+			name:     "Phrase",
+			query:    `"language support"`,
+			expected: []string{"golang.go", "ms-python.python"},
+		},
+		{
+			name:     "PhraseWithStopWords",
+			query:    `"emulation for visual studio"`,
+			expected: []string{"vscodevim.vim"},
+		},
+		{
+			name:     "PhraseOrder",
+			query:    `"support language"`,
+			expected: []string{},
+		},
+		{
+			name:     "PhraseAndTerm",
+			query:    `"language support" intellisense`,
+			expected: []string{"ms-python.python"},
+		},
+		{
+			name:     "UnterminatedPhrase",
+			query:    `"visual studio`,
+			expected: []string{"vscodevim.vim"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, test.expected, ranked(index.Search(test.query)))
+		})
+	}
+}
+
+func TestIndex(t *testing.T) {
+	t.Parallel()
+
+	index := newIndex()
+	require.Equal(t, 3, index.Len())
+	require.Equal(t, []string{"golang.go", "ms-python.python", "vscodevim.vim"}, index.IDs())
+	require.True(t, index.Has("vscodevim.vim", "1.0.0"))
+	require.False(t, index.Has("vscodevim.vim", "2.0.0"))
+	require.False(t, index.Has("foo.bar", "1.0.0"))
+
+	// Replacing a document should drop its old terms.
+	index.Add(search.Document{
+		ID:      "vscodevim.vim",
+		Version: "2.0.0",
+		Fields: map[search.Field]string{
+			search.FieldName: "Neovim",
+		},
+	})
+	require.Equal(t, 3, index.Len())
+	require.True(t, index.Has("vscodevim.vim", "2.0.0"))
+	require.Empty(t, index.Search("emulation"))
+	require.Equal(t, []string{"vscodevim.vim"}, ranked(index.Search("neovim")))
+
+	// Removing a document should drop it from results.
+	index.Remove("golang.go")
+	index.Remove("does-not.exist")
+	require.Equal(t, 2, index.Len())
+	require.Equal(t, []string{"ms-python.python"}, ranked(index.Search("python")))
+}
@@ -0,0 +1,149 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// token is a normalized term and its position in the text it came from.
+// Positions count stop words so phrases with stop words in them still line up.
+type token struct {
+	term     string
+	position int
+}
+
+var stopWords = map[string]struct{}{
+	"a": {}, "an": {}, "and": {}, "are": {}, "as": {}, "at": {}, "be": {},
+	"by": {}, "for": {}, "from": {}, "in": {}, "is": {}, "it": {}, "of": {},
+	"on": {}, "or": {}, "that": {}, "the": {}, "this": {}, "to": {}, "with": {},
+}
+
+// tokenize splits text on anything that is not a letter or number, lowercases
+// and stems the words, and drops stop words.
+func tokenize(text string) []token {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	tokens := []token{}
+	for i, word := range words {
+		if _, ok := stopWords[word]; ok {
+			continue
+		}
+		tokens = append(tokens, token{term: stem(word), position: i})
+	}
+	return tokens
+}
+
+// stem strips common English suffixes so that different forms of a word (for
+// example "test", "tests", "tested", and "testing") produce the same term.  It
+// is a much simplified take on the Porter stemmer; it only needs to be
+// consistent, not linguistically correct, since queries are stemmed the same
+// way.
+func stem(word string) string {
+	if len(word) <= 3 {
+		return word
+	}
+	switch {
+	case strings.HasSuffix(word, "sses"):
+		word = word[:len(word)-2]
+	case strings.HasSuffix(word, "ies"):
+		word = word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "ss"), strings.HasSuffix(word, "us"), strings.HasSuffix(word, "is"):
+	case strings.HasSuffix(word, "s"):
+		word = word[:len(word)-1]
+	}
+	for _, suffix := range []string{"ing", "ed"} {
+		base := strings.TrimSuffix(word, suffix)
+		if base == word || len(base) < 3 || !strings.ContainsAny(base, "aeiouy") {
+			continue
+		}
+		word = base
+		// Undo doubled consonants, for example "running" to "run".
+		if n := len(word); word[n-1] == word[n-2] && !strings.ContainsRune("aeiouylsz", rune(word[n-1])) {
+			word = word[:n-1]
+		}
+		break
+	}
+	// Drop a trailing e so "code" and "coded" (now "cod") match.
+	if len(word) > 3 && strings.HasSuffix(word, "e") {
+		word = word[:len(word)-1]
+	}
+	return word
+}
+
+// query is a parsed search query.  Every term and phrase must match.
+type query struct {
+	terms   []string
+	phrases [][]token
+}
+
+// parseQuery splits text into phrases (anything in double quotes) and terms
+// (everything else).  An unterminated quote runs to the end of the text.
+func parseQuery(text string) query {
+	q := query{}
+	for i, part := range strings.Split(text, `"`) {
+		tokens := tokenize(part)
+		// Odd parts are inside quotes.
+		if i%2 == 1 && len(tokens) > 1 {
+			q.phrases = append(q.phrases, tokens)
+			continue
+		}
+		for _, token := range tokens {
+			q.terms = append(q.terms, token.term)
+		}
+	}
+	return q
+}
+
+// maxEdits returns the number of typos tolerated for a term.  Short terms must
+// match exactly since almost every short word is a typo away from another, as
+// do terms with numbers since "python2" is not a typo of "python3".
+func maxEdits(term string) int {
+	switch n := len([]rune(term)); {
+	case strings.ContainsFunc(term, unicode.IsNumber):
+		return 0
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// distance returns the optimal string alignment distance between a and b (the
+// Levenshtein distance but with adjacent transpositions counting as a single
+// edit) or limit+1 if it exceeds limit.
+func distance(a, b string, limit int) int {
+	ar, br := []rune(a), []rune(b)
+	if d := len(ar) - len(br); d > limit || -d > limit {
+		return limit + 1
+	}
+	// Only the last three rows are needed for transpositions.
+	prev2 := make([]int, len(br)+1)
+	prev := make([]int, len(br)+1)
+	curr := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ar[i-1] == br[j-2] && ar[i-2] == br[j-1] {
+				curr[j] = min(curr[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+	return min(prev[len(br)], limit+1)
+}
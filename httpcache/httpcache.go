@@ -0,0 +1,44 @@
+// Package httpcache holds the HTTP caching helpers shared by the API and the
+// storage file servers.
+package httpcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// RevalidateCacheControl lets clients and shared caches store a response as
+// long as they revalidate it with the ETag before each use.
+const RevalidateCacheControl = "public, no-cache"
+
+// ETagMatches returns true if the request's If-None-Match header matches the
+// ETag, meaning the client already has the current representation.  Matching
+// uses weak comparison as required for If-None-Match.  Only GET and HEAD
+// requests can match since other methods cannot be answered with a 304.
+func ETagMatches(r *http.Request, etag string) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	header := r.Header.Get("If-None-Match")
+	if header == "" || etag == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ContentETag returns a strong ETag for the content.
+func ContentETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
@@ -0,0 +1,60 @@
+package httpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/code-marketplace/httpcache"
+)
+
+func TestETagMatches(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		method string
+		header string
+		etag   string
+		match  bool
+	}{
+		{name: "NoHeader", etag: `"a"`},
+		{name: "NoETag", header: `"a"`},
+		{name: "Match", header: `"a"`, etag: `"a"`, match: true},
+		{name: "Mismatch", header: `"b"`, etag: `"a"`},
+		{name: "List", header: `"b", "a"`, etag: `"a"`, match: true},
+		{name: "Weak", header: `W/"a"`, etag: `"a"`, match: true},
+		{name: "Any", header: `*`, etag: `"a"`, match: true},
+		{name: "Unquoted", header: `a`, etag: `"a"`},
+		{name: "Head", method: http.MethodHead, header: `"a"`, etag: `"a"`, match: true},
+		{name: "Post", method: http.MethodPost, header: `"a"`, etag: `"a"`},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			method := test.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, "/", nil)
+			if test.header != "" {
+				r.Header.Set("If-None-Match", test.header)
+			}
+			require.Equal(t, test.match, httpcache.ETagMatches(r, test.etag))
+		})
+	}
+}
+
+func TestContentETag(t *testing.T) {
+	t.Parallel()
+
+	etag := httpcache.ContentETag([]byte("foo"))
+	require.Equal(t, `"2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"`, etag)
+	require.Equal(t, etag, httpcache.ContentETag([]byte("foo")))
+	require.NotEqual(t, etag, httpcache.ContentETag([]byte("bar")))
+}
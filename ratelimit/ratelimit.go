@@ -0,0 +1,91 @@
+// Package ratelimit counts requests for rate limiting with a sliding window.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Window is the length of the windows requests are counted in.  Limits are
+// per window.
+const Window = time.Minute
+
+// Counter counts requests in fixed windows.  The number of requests in the last
+// minute is estimated from the counts of the current and previous windows; see
+// Estimate.
+type Counter interface {
+	// Increment counts a request for the key in the window starting at the
+	// given time and returns the counts for the key in that window, including
+	// this request, and the window before it.
+	Increment(ctx context.Context, key string, window time.Time) (current, previous int, err error)
+}
+
+// Memory counts requests in memory, so each replica has its own counts.
+type Memory struct {
+	mutex    sync.Mutex
+	window   time.Time
+	current  map[string]int
+	previous map[string]int
+}
+
+var _ Counter = (*Memory)(nil)
+
+func NewMemory() *Memory {
+	return &Memory{
+		current:  map[string]int{},
+		previous: map[string]int{},
+	}
+}
+
+func (m *Memory) Increment(_ context.Context, key string, window time.Time) (int, int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	switch {
+	case window.Equal(m.window):
+	case window.Equal(m.window.Add(Window)):
+		// Reuse the maps instead of allocating new ones every window.
+		clear(m.previous)
+		m.current, m.previous = m.previous, m.current
+		m.window = window
+	case window.After(m.window):
+		clear(m.previous)
+		clear(m.current)
+		m.window = window
+	default:
+		// A request that started before the window moved on counts towards the
+		// new window, which is close enough.
+	}
+
+	m.current[key]++
+	return m.current[key], m.previous[key], nil
+}
+
+// Estimate returns the number of requests in the last minute, assuming requests
+// in the previous window were spread evenly.  elapsed is how far into the
+// current window we are.
+func Estimate(current, previous int, elapsed time.Duration) float64 {
+	remaining := float64(Window-elapsed) / float64(Window)
+	return float64(previous)*remaining + float64(current)
+}
+
+// RetryAfter returns how long until one more request would stay within the
+// limit, assuming no other requests are made in the meantime.
+func RetryAfter(limit, current, previous int, elapsed time.Duration) time.Duration {
+	// into is how far into a window the estimate with one more request drops
+	// to the limit, given the count for the window before it and the requests
+	// already made in this one.
+	into := func(before, made int) time.Duration {
+		if before == 0 {
+			return 0
+		}
+		return max(0, Window-Window*time.Duration(limit-made-1)/time.Duration(before))
+	}
+	if current+1 <= limit {
+		return max(0, into(previous, current)-elapsed)
+	}
+	// Nothing can be done in this window so wait for the next one, where the
+	// requests from this window count towards the estimate.
+	return Window - elapsed + into(current, 0)
+}
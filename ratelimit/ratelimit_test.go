@@ -0,0 +1,112 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/code-marketplace/ratelimit"
+)
+
+func TestMemory(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	counter := ratelimit.NewMemory()
+	window := time.Now().Truncate(ratelimit.Window)
+
+	increment := func(key string, window time.Time) [2]int {
+		current, previous, err := counter.Increment(ctx, key, window)
+		require.NoError(t, err)
+		return [2]int{current, previous}
+	}
+
+	require.Equal(t, [2]int{1, 0}, increment("a", window))
+	require.Equal(t, [2]int{2, 0}, increment("a", window))
+	require.Equal(t, [2]int{1, 0}, increment("b", window))
+
+	// The counts move to the previous window.
+	window = window.Add(ratelimit.Window)
+	require.Equal(t, [2]int{1, 2}, increment("a", window))
+	require.Equal(t, [2]int{1, 1}, increment("b", window))
+
+	// Requests from a window that has passed count towards the latest one.
+	require.Equal(t, [2]int{2, 2}, increment("a", window.Add(-ratelimit.Window)))
+
+	// Skipping a window clears both.
+	window = window.Add(2 * ratelimit.Window)
+	require.Equal(t, [2]int{1, 0}, increment("a", window))
+}
+
+func TestEstimate(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, 15.0, ratelimit.Estimate(5, 10, 0))
+	require.Equal(t, 10.0, ratelimit.Estimate(5, 10, 30*time.Second))
+	require.Equal(t, 5.0, ratelimit.Estimate(5, 10, ratelimit.Window))
+}
+
+func TestRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		limit    int
+		current  int
+		previous int
+		elapsed  time.Duration
+		expected time.Duration
+	}{
+		{
+			name:     "UnderLimit",
+			limit:    10,
+			current:  1,
+			previous: 5,
+			elapsed:  30 * time.Second,
+			expected: 0,
+		},
+		{
+			// 10 previous requests have to decay to 4 to fit 5 current requests
+			// plus one more, which happens 36 seconds into the window.
+			name:     "PreviousWindow",
+			limit:    10,
+			current:  5,
+			previous: 10,
+			elapsed:  6 * time.Second,
+			expected: 30 * time.Second,
+		},
+		{
+			// At the limit in this window there is no room until the next one,
+			// where 10 requests decay to 9 after 6 seconds.
+			name:     "CurrentWindow",
+			limit:    10,
+			current:  10,
+			previous: 0,
+			elapsed:  50 * time.Second,
+			expected: 16 * time.Second,
+		},
+		{
+			name:     "OverLimit",
+			limit:    10,
+			current:  20,
+			previous: 20,
+			elapsed:  30 * time.Second,
+			expected: 30*time.Second + 33*time.Second,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			retryAfter := ratelimit.RetryAfter(test.limit, test.current, test.previous, test.elapsed)
+			require.Equal(t, test.expected, retryAfter)
+			if retryAfter > 0 && retryAfter < ratelimit.Window-test.elapsed {
+				// Right at the retry time one more request fits.
+				require.InDelta(t, float64(test.limit), ratelimit.Estimate(test.current+1, test.previous, test.elapsed+retryAfter), 0.001)
+			}
+		})
+	}
+}
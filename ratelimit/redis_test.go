@@ -0,0 +1,137 @@
+package ratelimit_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/code-marketplace/ratelimit"
+)
+
+func TestRedis(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	window := time.Now().Truncate(ratelimit.Window)
+
+	// Counts are shared between replicas.
+	replicas := make([]*ratelimit.Redis, 2)
+	for i := range replicas {
+		counter, err := ratelimit.NewRedis(ctx, "redis://"+server.Addr())
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = counter.Close() })
+		replicas[i] = counter
+	}
+	for i := 1; i <= 4; i++ {
+		current, previous, err := replicas[i%2].Increment(ctx, "ip:127.0.0.1", window)
+		require.NoError(t, err)
+		require.Equal(t, i, current)
+		require.Equal(t, 0, previous)
+	}
+
+	current, previous, err := replicas[0].Increment(ctx, "ip:127.0.0.1", window.Add(ratelimit.Window))
+	require.NoError(t, err)
+	require.Equal(t, 1, current)
+	require.Equal(t, 4, previous)
+
+	current, previous, err = replicas[1].Increment(ctx, "ip:127.0.0.2", window)
+	require.NoError(t, err)
+	require.Equal(t, 1, current)
+	require.Equal(t, 0, previous)
+
+	key := fmt.Sprintf("%sip:127.0.0.1:%d", ratelimit.RedisKeyPrefix, window.Unix())
+	value, err := server.Get(key)
+	require.NoError(t, err)
+	require.Equal(t, "4", value)
+	require.Equal(t, 2*ratelimit.Window, server.TTL(key))
+
+	// Errors are returned once Redis goes away.
+	server.Close()
+	_, _, err = replicas[0].Increment(ctx, "ip:127.0.0.1", window)
+	require.Error(t, err)
+}
+
+func TestRedisAuth(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	server.RequireAuth("secret")
+	server.RequireUserAuth("user", "secret")
+	url := func(userinfo string) string {
+		if userinfo != "" {
+			userinfo += "@"
+		}
+		return "redis://" + userinfo + server.Addr()
+	}
+
+	_, err := ratelimit.NewRedis(ctx, url(""))
+	require.ErrorContains(t, err, "NOAUTH")
+	_, err = ratelimit.NewRedis(ctx, url(":wrong"))
+	require.ErrorContains(t, err, "WRONGPASS")
+
+	for _, userinfo := range []string{":secret", "user:secret"} {
+		counter, err := ratelimit.NewRedis(ctx, url(userinfo)+"/2")
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = counter.Close() })
+		_, _, err = counter.Increment(ctx, "ip:127.0.0.1", time.Now().Truncate(ratelimit.Window))
+		require.NoError(t, err)
+	}
+
+	// Both counters used the selected database.
+	require.Empty(t, server.DB(0).Keys())
+	keys := server.DB(2).Keys()
+	require.Len(t, keys, 1)
+	require.True(t, strings.HasPrefix(keys[0], ratelimit.RedisKeyPrefix), keys[0])
+	value, err := server.DB(2).Get(keys[0])
+	require.NoError(t, err)
+	require.Equal(t, "2", value)
+}
+
+func TestNewRedis(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		url   string
+		error string
+	}{
+		{
+			name:  "Scheme",
+			url:   "http://localhost:6379",
+			error: "must start with redis://",
+		},
+		{
+			name:  "NoHost",
+			url:   "redis:///0",
+			error: "has no host",
+		},
+		{
+			name:  "Database",
+			url:   "redis://:secret@localhost/db",
+			error: `invalid database "db"`,
+		},
+		{
+			name:  "Unreachable",
+			url:   "redis://:secret@127.0.0.1:1",
+			error: "connect to redis",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := ratelimit.NewRedis(context.Background(), test.url)
+			require.ErrorContains(t, err, test.error)
+			// Passwords never end up in errors.
+			require.NotContains(t, err.Error(), "secret")
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/coder/code-marketplace/storage"
+)
+
+// clamdChunkSize is how much of the VSIX is sent in each INSTREAM chunk.
+const clamdChunkSize = 64 * 1024
+
+// Clamd streams the VSIX to a ClamAV daemon with the INSTREAM command.
+type Clamd struct {
+	// Network is "unix" or "tcp".
+	Network string
+	Address string
+	// Timeout limits each scan.  Zero means no limit beyond the context.
+	Timeout time.Duration
+}
+
+var _ Scanner = (*Clamd)(nil)
+
+// NewClamd parses an address of either unix:///path/to/clamd.sock,
+// tcp://host:port, a path to a socket, or a host:port.
+func NewClamd(address string) (*Clamd, error) {
+	switch {
+	case strings.HasPrefix(address, "unix://"):
+		return &Clamd{Network: "unix", Address: strings.TrimPrefix(address, "unix://")}, nil
+	case strings.HasPrefix(address, "tcp://"):
+		return &Clamd{Network: "tcp", Address: strings.TrimPrefix(address, "tcp://")}, nil
+	case strings.HasPrefix(address, "/"):
+		return &Clamd{Network: "unix", Address: address}, nil
+	case address != "":
+		return &Clamd{Network: "tcp", Address: address}, nil
+	}
+	return nil, xerrors.New("clamd address is empty")
+}
+
+func (c *Clamd) Name() string {
+	return "clamd"
+}
+
+func (c *Clamd) Scan(ctx context.Context, _ *storage.VSIXManifest, vsix []byte) ([]Finding, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.Network, c.Address)
+	if err != nil {
+		return nil, xerrors.Errorf("connect to clamd: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	// Unblock reads and writes if the context is canceled without a deadline.
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	// The z prefix means the command and response are null-terminated.
+	_, err = conn.Write([]byte("zINSTREAM\x00"))
+	if err != nil {
+		return nil, xerrors.Errorf("write to clamd: %w", err)
+	}
+	for offset := 0; offset < len(vsix); offset += clamdChunkSize {
+		chunk := vsix[offset:min(offset+clamdChunkSize, len(vsix))]
+		err = binary.Write(conn, binary.BigEndian, uint32(len(chunk)))
+		if err == nil {
+			_, err = conn.Write(chunk)
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("write to clamd: %w", err)
+		}
+	}
+	err = binary.Write(conn, binary.BigEndian, uint32(0))
+	if err != nil {
+		return nil, xerrors.Errorf("write to clamd: %w", err)
+	}
+
+	response, err := io.ReadAll(conn)
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	} else if err != nil {
+		return nil, xerrors.Errorf("read from clamd: %w", err)
+	}
+	return c.parse(string(bytes.TrimRight(response, "\x00\n")))
+}
+
+// parse interprets responses like "stream: OK", "stream: Eicar-Signature FOUND",
+// or "INSTREAM size limit exceeded. ERROR".
+func (c *Clamd) parse(response string) ([]Finding, error) {
+	result := strings.TrimPrefix(response, "stream: ")
+	switch {
+	case result == "OK":
+		return nil, nil
+	case strings.HasSuffix(result, " FOUND"):
+		return []Finding{{Scanner: c.Name(), Message: strings.TrimSuffix(result, " FOUND")}}, nil
+	default:
+		return nil, xerrors.Errorf("clamd: %s", response)
+	}
+}
@@ -0,0 +1,76 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/coder/code-marketplace/storage"
+)
+
+// Command runs an external program on the VSIX, passing the path to a
+// temporary copy of it as the last argument.  Following the convention of
+// ClamAV's clamscan, exiting with zero means the VSIX is clean and exiting with
+// one means something was found, in which case the output becomes the finding.
+// Any other exit code is treated as the scan failing.
+type Command struct {
+	Path string
+	Args []string
+}
+
+var _ Scanner = (*Command)(nil)
+
+// NewCommand splits a command line on spaces into a Command.
+func NewCommand(command string) (*Command, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil, xerrors.New("scan command is empty")
+	}
+	return &Command{Path: fields[0], Args: fields[1:]}, nil
+}
+
+func (c *Command) Name() string {
+	return "command"
+}
+
+func (c *Command) Scan(ctx context.Context, _ *storage.VSIXManifest, vsix []byte) ([]Finding, error) {
+	file, err := os.CreateTemp("", "marketplace-scan-*.vsix")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(vsix)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.Path, append(append([]string{}, c.Args...), file.Name())...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err = cmd.Run()
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return nil, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		// Scanners usually print the path, which is meaningless to anyone
+		// reading the finding.
+		message := strings.TrimSpace(strings.ReplaceAll(output.String(), file.Name(), "<vsix>"))
+		if message == "" {
+			message = "command reported a problem"
+		}
+		return []Finding{{Scanner: c.Name(), Message: message}}, nil
+	default:
+		return nil, xerrors.Errorf("run %s: %w: %s", c.Path, err, strings.TrimSpace(output.String()))
+	}
+}
@@ -0,0 +1,166 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/coder/code-marketplace/storage"
+	"github.com/coder/code-marketplace/storage/easyzip"
+)
+
+// maxRuleFileSize is how much of each file the rules look at.
+const maxRuleFileSize = 16 * 1024 * 1024
+
+// Rule checks a single file in the VSIX and returns a message if the file
+// should cause the extension to be rejected.
+type Rule struct {
+	Name        string
+	Description string
+	Check       func(name string, content []byte) string
+}
+
+// DefaultRules are the built-in rules.
+var DefaultRules = []Rule{
+	{
+		Name:        "native-binary",
+		Description: "Executables, shared libraries, and Node addons.",
+		Check:       checkNativeBinary,
+	},
+	{
+		Name:        "obfuscated-js",
+		Description: "JavaScript that looks machine-obfuscated rather than minified.",
+		Check:       checkObfuscatedJS,
+	},
+}
+
+// RuleNames returns the names of the built-in rules.
+func RuleNames() []string {
+	names := make([]string, len(DefaultRules))
+	for i, rule := range DefaultRules {
+		names[i] = rule.Name
+	}
+	return names
+}
+
+// Rules applies rules to every file in the VSIX.
+type Rules struct {
+	Rules []Rule
+}
+
+var _ Scanner = (*Rules)(nil)
+
+// NewRules returns a scanner with the named built-in rules.
+func NewRules(names []string) (*Rules, error) {
+	rules := &Rules{}
+	for _, name := range names {
+		i := slices.IndexFunc(DefaultRules, func(r Rule) bool { return r.Name == name })
+		if i == -1 {
+			return nil, xerrors.Errorf("%q is not a scan rule (valid rules are %s)", name, strings.Join(RuleNames(), ", "))
+		}
+		rules.Rules = append(rules.Rules, DefaultRules[i])
+	}
+	return rules, nil
+}
+
+func (r *Rules) Name() string {
+	return "rules"
+}
+
+func (r *Rules) Scan(ctx context.Context, _ *storage.VSIXManifest, vsix []byte) ([]Finding, error) {
+	findings := []Finding{}
+	err := easyzip.ExtractZip(vsix, func(name string, reader io.Reader) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		content, err := io.ReadAll(io.LimitReader(reader, maxRuleFileSize))
+		if err != nil {
+			return err
+		}
+		for _, rule := range r.Rules {
+			if message := rule.Check(name, content); message != "" {
+				findings = append(findings, Finding{
+					Scanner: fmt.Sprintf("%s/%s", r.Name(), rule.Name),
+					Path:    name,
+					Message: message,
+				})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return findings, nil
+}
+
+var nativeExtensions = []string{".exe", ".dll", ".so", ".dylib", ".node"}
+
+// nativeMagic are the leading bytes of ELF, PE, and Mach-O files.
+var nativeMagic = []struct {
+	format string
+	magic  []byte
+}{
+	{"ELF", []byte("\x7fELF")},
+	{"PE", []byte("MZ")},
+	{"Mach-O", []byte{0xfe, 0xed, 0xfa, 0xce}},
+	{"Mach-O", []byte{0xfe, 0xed, 0xfa, 0xcf}},
+	{"Mach-O", []byte{0xce, 0xfa, 0xed, 0xfe}},
+	{"Mach-O", []byte{0xcf, 0xfa, 0xed, 0xfe}},
+}
+
+func checkNativeBinary(name string, content []byte) string {
+	for _, m := range nativeMagic {
+		// A text file could easily start with MZ so also require the PE
+		// signature offset to fit.
+		if bytes.HasPrefix(content, m.magic) && (m.format != "PE" || len(content) >= 0x40) {
+			return fmt.Sprintf("%s binary", m.format)
+		}
+	}
+	ext := strings.ToLower(path.Ext(name))
+	if slices.Contains(nativeExtensions, ext) {
+		return fmt.Sprintf("native binary extension %s", ext)
+	}
+	return ""
+}
+
+var (
+	// obfuscatorIdentifier matches the identifiers javascript-obfuscator and
+	// similar tools generate.
+	obfuscatorIdentifier = regexp.MustCompile(`\b_0x[0-9a-f]{4,}\b`)
+	hexEscape            = regexp.MustCompile(`\\x[0-9a-fA-F]{2}`)
+	// dynamicEval matches evaluating decoded strings.
+	dynamicEval = regexp.MustCompile(`\b(eval|Function)\s*\(\s*(atob|unescape|decodeURIComponent|Buffer\.from)\s*\(`)
+)
+
+// checkObfuscatedJS flags JavaScript using techniques obfuscators use to hide
+// code.  Minified code on its own is not flagged since most extensions are
+// bundled and minified.
+func checkObfuscatedJS(name string, content []byte) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".js", ".mjs", ".cjs":
+	default:
+		return ""
+	}
+	if dynamicEval.Match(content) {
+		return "evaluates decoded strings"
+	}
+	if count := len(obfuscatorIdentifier.FindAllIndex(content, 100)); count >= 100 {
+		return "contains many obfuscator-generated identifiers"
+	}
+	// Escaping most of a file's strings as hex only serves to hide them.
+	if len(content) >= 1024 {
+		escaped := len(hexEscape.FindAllIndex(content, -1)) * 4
+		if escaped*5 >= len(content) {
+			return "mostly hex-escaped"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+// Package scan checks extensions for malware and suspicious content before they
+// are added to the marketplace.
+package scan
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/coder/code-marketplace/storage"
+)
+
+// Finding is a problem a scanner found in an extension.
+type Finding struct {
+	// Scanner is the name of the scanner that reported the finding.
+	Scanner string `json:"scanner"`
+	// Path is the file in the VSIX the finding is about, if known.
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+func (f Finding) String() string {
+	if f.Path != "" {
+		return fmt.Sprintf("%s: %s: %s", f.Scanner, f.Path, f.Message)
+	}
+	return fmt.Sprintf("%s: %s", f.Scanner, f.Message)
+}
+
+// Scanner inspects a VSIX.  It returns findings if the extension should be
+// rejected and an error only if the scan itself could not be completed.
+type Scanner interface {
+	Name() string
+	Scan(ctx context.Context, manifest *storage.VSIXManifest, vsix []byte) ([]Finding, error)
+}
+
+// Multi runs each scanner in order and returns every finding.  It stops at the
+// first scanner that errors.
+type Multi []Scanner
+
+var _ Scanner = Multi(nil)
+
+func (m Multi) Name() string {
+	names := make([]string, len(m))
+	for i, s := range m {
+		names[i] = s.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (m Multi) Scan(ctx context.Context, manifest *storage.VSIXManifest, vsix []byte) ([]Finding, error) {
+	findings := []Finding{}
+	for _, s := range m {
+		found, err := s.Scan(ctx, manifest, vsix)
+		if err != nil {
+			return nil, xerrors.Errorf("%s: %w", s.Name(), err)
+		}
+		findings = append(findings, found...)
+	}
+	return findings, nil
+}
+
+// RejectedError is returned when adding an extension that has findings.
+type RejectedError struct {
+	// ID is the extension ID with its version and platform.
+	ID       string
+	Findings []Finding
+	// Quarantined is where the VSIX was moved to, if anywhere.
+	Quarantined string
+}
+
+func (e *RejectedError) Error() string {
+	findings := make([]string, len(e.Findings))
+	for i, f := range e.Findings {
+		findings[i] = f.String()
+	}
+	msg := fmt.Sprintf("%s was rejected by scanning: %s", e.ID, strings.Join(findings, "; "))
+	if e.Quarantined != "" {
+		msg += fmt.Sprintf(" (quarantined to %s)", e.Quarantined)
+	}
+	return msg
+}
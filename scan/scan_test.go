@@ -0,0 +1,416 @@
+package scan_test
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"cdr.dev/slog/sloggers/slogtest"
+	"github.com/coder/code-marketplace/scan"
+	"github.com/coder/code-marketplace/storage"
+	"github.com/coder/code-marketplace/testutil"
+)
+
+// createVSIX creates a VSIX for testutil.Extensions[0] with extra files.
+func createVSIX(t *testing.T, files map[string]string) (*storage.VSIXManifest, []byte) {
+	manifest := testutil.ConvertExtensionToManifest(testutil.Extensions[0], storage.Version{Version: "1.0.0"})
+	manifestBytes := testutil.ConvertExtensionToManifestBytes(t, testutil.Extensions[0], storage.Version{Version: "1.0.0"})
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	fw, err := zw.Create("extension.vsixmanifest")
+	require.NoError(t, err)
+	_, err = fw.Write(manifestBytes)
+	require.NoError(t, err)
+	for name, content := range files {
+		fw, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return manifest, buf.Bytes()
+}
+
+func TestRules(t *testing.T) {
+	t.Parallel()
+
+	rules, err := scan.NewRules(scan.RuleNames())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected []scan.Finding
+	}{
+		{
+			name: "Clean",
+			files: map[string]string{
+				"extension/out/extension.js": "function activate(){console.log(\"hello\")}exports.activate=activate;",
+				"extension/README.md":        "MZ is the start of this readme.",
+			},
+		},
+		{
+			name: "ELF",
+			files: map[string]string{
+				"extension/bin/helper": "\x7fELF\x02\x01\x01",
+			},
+			expected: []scan.Finding{{Scanner: "rules/native-binary", Path: "extension/bin/helper", Message: "ELF binary"}},
+		},
+		{
+			name: "PE",
+			files: map[string]string{
+				"extension/bin/helper": "MZ" + strings.Repeat("\x00", 0x40),
+			},
+			expected: []scan.Finding{{Scanner: "rules/native-binary", Path: "extension/bin/helper", Message: "PE binary"}},
+		},
+		{
+			name: "MachO",
+			files: map[string]string{
+				"extension/bin/helper": "\xcf\xfa\xed\xfe\x07",
+			},
+			expected: []scan.Finding{{Scanner: "rules/native-binary", Path: "extension/bin/helper", Message: "Mach-O binary"}},
+		},
+		{
+			name: "NodeAddon",
+			files: map[string]string{
+				"extension/build/addon.NODE": "not really",
+			},
+			expected: []scan.Finding{{Scanner: "rules/native-binary", Path: "extension/build/addon.NODE", Message: "native binary extension .node"}},
+		},
+		{
+			name: "Eval",
+			files: map[string]string{
+				"extension/out/extension.js": "eval(atob('Y29uc29sZS5sb2coMSk='))",
+			},
+			expected: []scan.Finding{{Scanner: "rules/obfuscated-js", Path: "extension/out/extension.js", Message: "evaluates decoded strings"}},
+		},
+		{
+			name: "ObfuscatorIdentifiers",
+			files: map[string]string{
+				"extension/out/extension.js": strings.Repeat("var _0x1a2b=_0x3c4d;", 60),
+			},
+			expected: []scan.Finding{{Scanner: "rules/obfuscated-js", Path: "extension/out/extension.js", Message: "contains many obfuscator-generated identifiers"}},
+		},
+		{
+			name: "HexEscaped",
+			files: map[string]string{
+				"extension/out/extension.mjs": "var s=\"" + strings.Repeat("\\x68\\x65\\x6c\\x6c\\x6f", 100) + "\";",
+			},
+			expected: []scan.Finding{{Scanner: "rules/obfuscated-js", Path: "extension/out/extension.mjs", Message: "mostly hex-escaped"}},
+		},
+		{
+			// The JS rules only apply to JavaScript files.
+			name: "EvalNotJS",
+			files: map[string]string{
+				"extension/README.md": "Never write eval(atob(x)) in your code.",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			manifest, vsix := createVSIX(t, test.files)
+			findings, err := rules.Scan(context.Background(), manifest, vsix)
+			require.NoError(t, err)
+			if len(test.expected) == 0 {
+				require.Empty(t, findings)
+			} else {
+				require.Equal(t, test.expected, findings)
+			}
+		})
+	}
+
+	_, err = scan.NewRules([]string{"native-binary", "nope"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `"nope" is not a scan rule`)
+}
+
+// script writes a shell script that runs the provided body.
+func script(t *testing.T, body string) string {
+	path := filepath.Join(t.TempDir(), "scan.sh")
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o755))
+	return path
+}
+
+func TestCommand(t *testing.T) {
+	t.Parallel()
+
+	manifest, vsix := createVSIX(t, nil)
+
+	tests := []struct {
+		name     string
+		body     string
+		error    string
+		expected []scan.Finding
+	}{
+		{
+			name: "Clean",
+			// Make sure the VSIX is really passed.
+			body: `unzip -l "$2" >/dev/null 2>&1 || test "$(head -c 2 "$2")" = "PK"`,
+		},
+		{
+			name:     "Found",
+			body:     `echo "$2: Evil.Signature FOUND"; exit 1`,
+			expected: []scan.Finding{{Scanner: "command", Message: "<vsix>: Evil.Signature FOUND"}},
+		},
+		{
+			name:     "FoundNoOutput",
+			body:     `exit 1`,
+			expected: []scan.Finding{{Scanner: "command", Message: "command reported a problem"}},
+		},
+		{
+			name:  "Error",
+			body:  `echo "database missing" >&2; exit 2`,
+			error: "database missing",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			// Include an argument to make sure they are passed before the path.
+			command, err := scan.NewCommand(script(t, test.body) + " --flag")
+			require.NoError(t, err)
+			findings, err := command.Scan(context.Background(), manifest, vsix)
+			if test.error != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), test.error)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, findings)
+		})
+	}
+
+	_, err := scan.NewCommand("  ")
+	require.Error(t, err)
+}
+
+// fakeClamd implements enough of clamd's INSTREAM command to reply with the
+// result of the provided function.
+func fakeClamd(t *testing.T, respond func(content []byte) string) string {
+	dir, err := os.MkdirTemp("", "clamd")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	path := filepath.Join(dir, "clamd.sock")
+	listener, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				command, err := reader.ReadString(0)
+				if err != nil || command != "zINSTREAM\x00" {
+					_, _ = conn.Write([]byte("UNKNOWN COMMAND\x00"))
+					return
+				}
+				content := new(bytes.Buffer)
+				for {
+					var size uint32
+					if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					if _, err := io.CopyN(content, reader, int64(size)); err != nil {
+						return
+					}
+				}
+				_, _ = conn.Write([]byte(respond(content.Bytes()) + "\x00"))
+			}()
+		}
+	}()
+	return path
+}
+
+func TestClamd(t *testing.T) {
+	t.Parallel()
+
+	// Make the VSIX bigger than a chunk so several chunks are sent.
+	manifest, vsix := createVSIX(t, map[string]string{
+		"extension/data.bin": strings.Repeat("0123456789", 20*1024),
+	})
+	received := make(chan []byte, 1)
+	path := fakeClamd(t, func(content []byte) string {
+		received <- content
+		if bytes.Contains(content, []byte("EICAR")) {
+			return "stream: Eicar-Signature FOUND"
+		}
+		if bytes.Contains(content, []byte("ERROR")) {
+			return "INSTREAM size limit exceeded. ERROR"
+		}
+		return "stream: OK"
+	})
+
+	for _, address := range []string{path, "unix://" + path} {
+		clamd, err := scan.NewClamd(address)
+		require.NoError(t, err)
+		findings, err := clamd.Scan(context.Background(), manifest, vsix)
+		require.NoError(t, err)
+		require.Empty(t, findings)
+		require.Equal(t, vsix, <-received)
+	}
+
+	clamd, err := scan.NewClamd(path)
+	require.NoError(t, err)
+
+	// The VSIX is compressed so the marker has to be stored rather than deflated.
+	infected := storedVSIX(t, "EICAR")
+	findings, err := clamd.Scan(context.Background(), manifest, infected)
+	require.NoError(t, err)
+	<-received
+	require.Equal(t, []scan.Finding{{Scanner: "clamd", Message: "Eicar-Signature"}}, findings)
+
+	_, err = clamd.Scan(context.Background(), manifest, storedVSIX(t, "ERROR"))
+	<-received
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "size limit exceeded")
+
+	// Unreachable daemons fail the scan.
+	clamd, err = scan.NewClamd(filepath.Join(t.TempDir(), "missing.sock"))
+	require.NoError(t, err)
+	_, err = clamd.Scan(context.Background(), manifest, vsix)
+	require.Error(t, err)
+
+	tcp, err := scan.NewClamd("tcp://localhost:3310")
+	require.NoError(t, err)
+	require.Equal(t, &scan.Clamd{Network: "tcp", Address: "localhost:3310"}, tcp)
+	tcp, err = scan.NewClamd("localhost:3310")
+	require.NoError(t, err)
+	require.Equal(t, &scan.Clamd{Network: "tcp", Address: "localhost:3310"}, tcp)
+	_, err = scan.NewClamd("")
+	require.Error(t, err)
+}
+
+// storedVSIX creates a zip with a single uncompressed file.
+func storedVSIX(t *testing.T, content string) []byte {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: "file.txt", Method: zip.Store})
+	require.NoError(t, err)
+	_, err = fw.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+type fakeScanner struct {
+	name     string
+	findings []scan.Finding
+	err      error
+}
+
+func (s *fakeScanner) Name() string {
+	return s.name
+}
+
+func (s *fakeScanner) Scan(context.Context, *storage.VSIXManifest, []byte) ([]scan.Finding, error) {
+	return s.findings, s.err
+}
+
+func TestStorage(t *testing.T) {
+	t.Parallel()
+
+	finding := scan.Finding{Scanner: "fake", Path: "extension/evil.js", Message: "evil"}
+	tests := []struct {
+		name       string
+		scanner    scan.Scanner
+		quarantine bool
+		error      string
+		added      bool
+	}{
+		{
+			name:    "Clean",
+			scanner: scan.Multi{&fakeScanner{name: "a"}, &fakeScanner{name: "b"}},
+			added:   true,
+		},
+		{
+			name:    "Rejected",
+			scanner: scan.Multi{&fakeScanner{name: "a"}, &fakeScanner{name: "b", findings: []scan.Finding{finding}}},
+			error:   "foo.zany-1.0.0 was rejected by scanning: fake: extension/evil.js: evil",
+		},
+		{
+			name:       "Quarantined",
+			scanner:    &fakeScanner{name: "fake", findings: []scan.Finding{finding}},
+			quarantine: true,
+			error:      "quarantined to",
+		},
+		{
+			name:    "Error",
+			scanner: scan.Multi{&fakeScanner{name: "a", err: errors.New("no database")}, &fakeScanner{name: "b"}},
+			error:   "scan foo.zany-1.0.0: a: no database",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			logger := slogtest.Make(t, &slogtest.Options{IgnoreErrors: true})
+			extdir := t.TempDir()
+			local, err := storage.NewLocalStorage(&storage.LocalOptions{ExtDir: extdir}, logger)
+			require.NoError(t, err)
+			quarantineDir := ""
+			if test.quarantine {
+				quarantineDir = filepath.Join(t.TempDir(), "quarantine")
+			}
+			store := scan.NewStorage(local, test.scanner, quarantineDir, logger)
+
+			manifest, vsix := createVSIX(t, nil)
+			_, addErr := store.AddExtension(context.Background(), manifest, vsix)
+			if test.error != "" {
+				require.Error(t, addErr)
+				require.Contains(t, addErr.Error(), test.error)
+			} else {
+				require.NoError(t, addErr)
+			}
+
+			_, err = local.Manifest(context.Background(), "foo", "zany", storage.Version{Version: "1.0.0"})
+			if test.added {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+
+			if test.quarantine {
+				var rejected *scan.RejectedError
+				require.ErrorAs(t, addErr, &rejected)
+				require.Equal(t, []scan.Finding{finding}, rejected.Findings)
+				require.Equal(t, filepath.Join(quarantineDir, "foo.zany-1.0.0.vsix"), rejected.Quarantined)
+				content, err := os.ReadFile(filepath.Join(quarantineDir, "foo.zany-1.0.0.vsix"))
+				require.NoError(t, err)
+				require.Equal(t, vsix, content)
+				content, err = os.ReadFile(filepath.Join(quarantineDir, "foo.zany-1.0.0.findings.json"))
+				require.NoError(t, err)
+				var findings []scan.Finding
+				require.NoError(t, json.Unmarshal(content, &findings))
+				require.Equal(t, []scan.Finding{finding}, findings)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package scan
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+	"github.com/coder/code-marketplace/storage"
+)
+
+var (
+	_ storage.Storage   = (*Storage)(nil)
+	_ storage.Unwrapper = (*Storage)(nil)
+)
+
+// Storage is a storage wrapper that scans extensions before adding them.
+// Extensions with findings are not added and a *RejectedError is returned.
+type Storage struct {
+	Logger slog.Logger
+	// QuarantineDir, if set, is where rejected VSIXs are kept along with a JSON
+	// file listing their findings so they can be inspected later.
+	QuarantineDir string
+	Scanner       Scanner
+	storage.Storage
+}
+
+func NewStorage(s storage.Storage, scanner Scanner, quarantineDir string, logger slog.Logger) *Storage {
+	return &Storage{
+		Logger:        logger,
+		QuarantineDir: quarantineDir,
+		Scanner:       scanner,
+		Storage:       s,
+	}
+}
+
+func (s *Storage) AddExtension(ctx context.Context, manifest *storage.VSIXManifest, vsix []byte, extra ...storage.File) (string, error) {
+	id := storage.ExtensionVSIXNameFromManifest(manifest)
+	findings, err := s.Scanner.Scan(ctx, manifest, vsix)
+	if err != nil {
+		// Fail closed; an extension that could not be scanned is not trusted.
+		return "", xerrors.Errorf("scan %s: %w", id, err)
+	}
+	if len(findings) == 0 {
+		return s.Storage.AddExtension(ctx, manifest, vsix, extra...)
+	}
+
+	rejected := &RejectedError{ID: id, Findings: findings}
+	s.Logger.Warn(ctx, "Rejected extension", slog.F("id", id), slog.F("findings", findings))
+	if s.QuarantineDir != "" {
+		location, err := s.quarantine(id, vsix, findings)
+		if err != nil {
+			s.Logger.Error(ctx, "Unable to quarantine extension", slog.F("id", id), slog.Error(err))
+		} else {
+			rejected.Quarantined = location
+		}
+	}
+	return "", rejected
+}
+
+// quarantine writes the VSIX and its findings to the quarantine directory.
+func (s *Storage) quarantine(id string, vsix []byte, findings []Finding) (string, error) {
+	err := os.MkdirAll(s.QuarantineDir, 0o700)
+	if err != nil {
+		return "", err
+	}
+	// os.Root keeps a malicious publisher or name from escaping the directory.
+	root, err := os.OpenRoot(s.QuarantineDir)
+	if err != nil {
+		return "", err
+	}
+	defer root.Close()
+
+	report, err := json.MarshalIndent(findings, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	err = root.WriteFile(id+".findings.json", report, 0o600)
+	if err != nil {
+		return "", err
+	}
+	err = root.WriteFile(id+".vsix", vsix, 0o600)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.QuarantineDir, id+".vsix"), nil
+}
+
+// Unwrap returns the wrapped storage.
+func (s *Storage) Unwrap() storage.Storage {
+	return s.Storage
+}
@@ -13,13 +13,20 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/xerrors"
 
 	"cdr.dev/slog"
+	"github.com/coder/code-marketplace/httpcache"
 	"github.com/coder/code-marketplace/storage/easyzip"
+	"github.com/coder/code-marketplace/tracing"
 
 	"github.com/coder/code-marketplace/util"
 )
@@ -49,16 +56,57 @@ var _ Storage = (*Artifactory)(nil)
 // structure in the form of publisher/extension/version to easily serve
 // individual assets via HTTP.
 type Artifactory struct {
+	concurrency     int
 	listCache       *[]ArtifactoryFile
-	listDuration    time.Duration
+	listDuration    atomic.Int64
+	listErr         error
 	listExpiration  time.Time
 	listMutex       sync.Mutex
 	logger          slog.Logger
 	manifests       sync.Map
 	manifestMutexes sync.Map
 	repo            string
+	seed            *seedProgress
+	stateCache      sync.Map
 	token           string
+	tracer          trace.Tracer
 	uri             string
+	zipLimits       easyzip.Limits
+}
+
+// extensionVersion identifies a single version of an extension.
+type extensionVersion struct {
+	publisher string
+	name      string
+	version   Version
+}
+
+// artifactoryState is a cached state file.  Files that do not exist are cached
+// too, with the error from reading them.
+type artifactoryState struct {
+	content    []byte
+	err        error
+	expiration time.Time
+}
+
+// cacheableState returns true if the named state file should be cached.
+// Pending extensions are only read when reviewed and can be large so they are
+// left out.
+func cacheableState(name string) bool {
+	return !strings.HasPrefix(name, pendingDir+"/")
+}
+
+// cacheState caches the content of a state file or the error reading it.
+func (s *Artifactory) cacheState(name string, content []byte, err error) {
+	if !cacheableState(name) {
+		s.stateCache.Delete(name)
+		return
+	}
+	s.stateCache.Store(name, &artifactoryState{
+		content:    content,
+		err:        err,
+		expiration: time.Now().Add(time.Duration(s.listDuration.Load())),
+	})
 }
 
 type ArtifactoryOptions struct {
@@ -69,6 +117,15 @@ type ArtifactoryOptions struct {
 	Repo              string
 	Token             string
 	URI               string
+	// ZipLimits bound the archives that can be added.  Defaults to
+	// easyzip.DefaultLimits.
+	ZipLimits *easyzip.Limits
+	// TracerProvider receives spans for manifest reads and each request to
+	// Artifactory.  Defaults to discarding them.
+	TracerProvider trace.TracerProvider
+	// ManifestConcurrency limits how many manifests are fetched at the same
+	// time.  Defaults to ManifestConcurrencyDefault.
+	ManifestConcurrency int
 }
 
 func NewArtifactoryStorage(ctx context.Context, options *ArtifactoryOptions) (*Artifactory, error) {
@@ -77,53 +134,24 @@ func NewArtifactoryStorage(ctx context.Context, options *ArtifactoryOptions) (*A
 		uri = uri + "/"
 	}
 
+	concurrency := options.ManifestConcurrency
+	if concurrency <= 0 {
+		concurrency = ManifestConcurrencyDefault
+	}
+
 	s := &Artifactory{
 		// TODO: Eject the cache when adding/removing extensions and/or add a
 		// command to eject the cache?
-		listDuration: options.ListCacheDuration,
-		logger:       options.Logger,
-		repo:         path.Clean(options.Repo),
-		token:        options.Token,
-		uri:          uri,
-	}
-
-	s.logger.Info(ctx, "Seeding manifest cache...")
-
-	start := time.Now()
-	count := 0
-	var eg errgroup.Group
-	err := s.WalkExtensions(ctx, func(manifest *VSIXManifest, versions []Version) error {
-		for _, ver := range versions {
-			count++
-			ver := ver
-			eg.Go(func() error {
-				identity := manifest.Metadata.Identity
-				_, err := s.Manifest(ctx, identity.Publisher, identity.ID, ver)
-				if err != nil && !errors.Is(err, context.Canceled) {
-					return err
-				} else if err != nil {
-					id := ExtensionIDWithVersion(identity.Publisher, identity.ID, ver.Version)
-					s.logger.Error(ctx, "Unable to read extension manifest", slog.Error(err),
-						slog.F("id", id),
-						slog.F("targetPlatform", ver.TargetPlatform))
-				}
-				return nil
-			})
-		}
-		return nil
-	})
-	if err != nil {
-		return nil, err
+		concurrency: concurrency,
+		logger:      options.Logger,
+		repo:        path.Clean(options.Repo),
+		seed:        newSeedProgress(),
+		token:       options.Token,
+		tracer:      tracing.Tracer(options.TracerProvider),
+		uri:         uri,
+		zipLimits:   zipLimits(options.ZipLimits),
 	}
-
-	err = eg.Wait()
-	if err != nil {
-		return nil, err
-	}
-
-	s.logger.Info(ctx, "Seeded manifest cache",
-		slog.F("count", count),
-		slog.F("took", time.Since(start)))
+	s.listDuration.Store(int64(options.ListCacheDuration))
 
 	return s, nil
 }
@@ -132,21 +160,41 @@ func NewArtifactoryStorage(ctx context.Context, options *ArtifactoryOptions) (*A
 // there is an error it reads the response first to get any error messages.  The
 // code is returned so it can be relayed when proxying file requests.  404s are
 // turned into os.ErrNotExist errors.
-func (s *Artifactory) request(ctx context.Context, method, endpoint string, r io.Reader) (*http.Response, int, error) {
+func (s *Artifactory) request(ctx context.Context, method, endpoint string, header http.Header, r io.Reader) (_ *http.Response, code int, err error) {
 	start := time.Now()
 	ctx = slog.With(ctx, slog.F("path", endpoint), slog.F("method", method))
+	ctx, span := s.tracer.Start(ctx, "artifactory "+method, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(method),
+			semconv.URLFull(s.uri+endpoint)))
 	defer func() {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(code))
+		// Missing files are expected, for example with optional state files.
+		if errors.Is(err, os.ErrNotExist) {
+			span.End()
+		} else {
+			tracing.End(span, err)
+		}
 		s.logger.Debug(ctx, "artifactory request", slog.F("took", time.Since(start)))
 	}()
 	req, err := http.NewRequestWithContext(ctx, method, s.uri+endpoint, r)
 	if err != nil {
 		return nil, http.StatusInternalServerError, err
 	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
 	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", s.token))
+	tracing.Propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, http.StatusInternalServerError, err
 	}
+	// An unsatisfiable range is relayed to the client rather than treated as a
+	// failure.
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && req.Header.Get("Range") != "" {
+		return resp, resp.StatusCode, nil
+	}
 	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
 		defer resp.Body.Close()
 		if resp.StatusCode == http.StatusNotFound {
@@ -173,7 +221,7 @@ func (s *Artifactory) request(ctx context.Context, method, endpoint string, r io
 
 func (s *Artifactory) list(ctx context.Context, endpoint string, depth int) ([]ArtifactoryFile, int, error) {
 	query := fmt.Sprintf("?list&deep=1&depth=%d&listFolders=1", depth)
-	resp, code, err := s.request(ctx, http.MethodGet, path.Join("api/storage", s.repo, endpoint)+query, nil)
+	resp, code, err := s.request(ctx, http.MethodGet, path.Join("api/storage", s.repo, endpoint)+query, nil, nil)
 	if err != nil {
 		return nil, code, err
 	}
@@ -191,7 +239,7 @@ func (s *Artifactory) list(ctx context.Context, endpoint string, depth int) ([]A
 }
 
 func (s *Artifactory) read(ctx context.Context, endpoint string) (io.ReadCloser, int, error) {
-	resp, code, err := s.request(ctx, http.MethodGet, path.Join(s.repo, endpoint), nil)
+	resp, code, err := s.request(ctx, http.MethodGet, path.Join(s.repo, endpoint), nil, nil)
 	if err != nil {
 		return nil, code, err
 	}
@@ -199,7 +247,7 @@ func (s *Artifactory) read(ctx context.Context, endpoint string) (io.ReadCloser,
 }
 
 func (s *Artifactory) delete(ctx context.Context, endpoint string) (int, error) {
-	resp, code, err := s.request(ctx, http.MethodDelete, path.Join(s.repo, endpoint), nil)
+	resp, code, err := s.request(ctx, http.MethodDelete, path.Join(s.repo, endpoint), nil, nil)
 	if err != nil {
 		return code, err
 	}
@@ -208,7 +256,7 @@ func (s *Artifactory) delete(ctx context.Context, endpoint string) (int, error)
 }
 
 func (s *Artifactory) upload(ctx context.Context, endpoint string, r io.Reader) (int, error) {
-	resp, code, err := s.request(ctx, http.MethodPut, path.Join(s.repo, endpoint), r)
+	resp, code, err := s.request(ctx, http.MethodPut, path.Join(s.repo, endpoint), nil, r)
 	if err != nil {
 		return code, err
 	}
@@ -217,6 +265,14 @@ func (s *Artifactory) upload(ctx context.Context, endpoint string, r io.Reader)
 }
 
 func (s *Artifactory) AddExtension(ctx context.Context, manifest *VSIXManifest, vsix []byte, extra ...File) (string, error) {
+	if err := validateAddition(vsix, s.zipLimits, extra); err != nil {
+		return "", err
+	}
+	checksums, err := computeChecksums(manifest, vsix, s.zipLimits, extra)
+	if err != nil {
+		return "", err
+	}
+
 	// Extract the zip to the correct path.
 	identity := manifest.Metadata.Identity
 	dir := path.Join(identity.Publisher, identity.ID, Version{
@@ -247,11 +303,13 @@ func (s *Artifactory) AddExtension(ctx context.Context, manifest *VSIXManifest,
 		}
 	}
 
-	err := easyzip.ExtractZip(vsix, func(name string, r io.Reader) error {
+	err = easyzip.ExtractZipWithLimits(vsix, s.zipLimits, func(name string, r io.Reader) error {
 		if util.Contains(assets, name) || (browser != "" && strings.HasPrefix(name, browser)) {
 			_, err := s.upload(ctx, path.Join(dir, name), r)
 			return err
 		}
+		// Only keep checksums for files that can be served.
+		delete(checksums, path.Clean(name))
 		return nil
 	})
 	if err != nil {
@@ -272,6 +330,10 @@ func (s *Artifactory) AddExtension(ctx context.Context, manifest *VSIXManifest,
 		}
 	}
 
+	if err := writeChecksums(ctx, s, manifest, checksums); err != nil {
+		return "", err
+	}
+
 	return s.uri + dir, nil
 }
 
@@ -285,18 +347,102 @@ func (s *Artifactory) FileServer() http.Handler {
 	// going to Artifactory for the VSIX when it is missing on disk (basically
 	// using the disk as a cache).
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
-		reader, code, err := s.read(r.Context(), r.URL.Path)
+		// Cleaning also keeps the path from reaching outside the repository.
+		filePath := cleanFilePath(r.URL.Path)
+		if isReserved(filePath) {
+			http.NotFound(rw, r)
+			return
+		}
+		// With a recorded checksum a matching If-None-Match can be answered
+		// without going to Artifactory at all, which is what makes revalidating
+		// on every use cheap.
+		etag, err := FileETag(r.Context(), s, filePath)
 		if err != nil {
+			s.logger.Warn(r.Context(), "Unable to read checksums", slog.Error(err))
+		} else if etag != "" {
+			rw.Header().Set("ETag", etag)
+			rw.Header().Set("Cache-Control", httpcache.RevalidateCacheControl)
+			if httpcache.ETagMatches(r, etag) {
+				rw.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		resp, code, err := s.request(r.Context(), http.MethodGet, path.Join(s.repo, filePath), rangeHeader(r, etag), nil)
+		if err != nil {
+			rw.Header().Del("ETag")
+			rw.Header().Del("Cache-Control")
 			http.Error(rw, err.Error(), code)
 			return
 		}
-		defer reader.Close()
-		rw.WriteHeader(http.StatusOK)
-		_, _ = io.Copy(rw, reader)
+		defer resp.Body.Close()
+		relay := []string{"Accept-Ranges", "Content-Length", "Content-Range", "Content-Type", "Last-Modified"}
+		if etag == "" {
+			// Without a recorded checksum Artifactory's own ETag is the only one
+			// clients can use for If-Range.
+			relay = append(relay, "ETag")
+		}
+		for _, header := range relay {
+			if value := resp.Header.Get(header); value != "" {
+				rw.Header().Set(header, value)
+			}
+		}
+		if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			rw.Header().Del("Cache-Control")
+		}
+		rw.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(rw, resp.Body)
 	})
 }
 
-func (s *Artifactory) Manifest(ctx context.Context, publisher, name string, version Version) (*VSIXManifest, error) {
+// rangeHeader returns the Range and If-Range headers to forward to Artifactory.
+// Artifactory does not know about the ETags we serve so an If-Range with an
+// entity tag is evaluated here against the recorded etag, if any, and the range
+// is dropped when it does not match so the whole file is returned instead.
+func rangeHeader(r *http.Request, etag string) http.Header {
+	header := http.Header{}
+	byteRange := r.Header.Get("Range")
+	if byteRange == "" {
+		return header
+	}
+	ifRange := r.Header.Get("If-Range")
+	if _, err := http.ParseTime(ifRange); ifRange == "" || err == nil || etag == "" {
+		header.Set("Range", byteRange)
+		if ifRange != "" {
+			header.Set("If-Range", ifRange)
+		}
+	} else if ifRange == etag {
+		// If-Range requires a strong comparison so weak tags never match.
+		header.Set("Range", byteRange)
+	}
+	return header
+}
+
+// Health checks that the manifest cache has been seeded and that the
+// repository can be read with the token.  Only the repository itself is checked
+// since the directory for extensions might not exist until one is added.
+func (s *Artifactory) Health(ctx context.Context) error {
+	switch status := s.seed.get(); status.State {
+	case SeedPending:
+		return xerrors.New("the manifest cache has not been seeded")
+	case Seeding:
+		return xerrors.Errorf("the manifest cache is still being seeded (%d of %d manifests)", status.Seeded, status.Total)
+	case SeedFailed:
+		return xerrors.Errorf("seeding the manifest cache failed: %s", status.Error)
+	}
+	repoKey, _, _ := strings.Cut(s.repo, "/")
+	resp, _, err := s.request(ctx, http.MethodGet, path.Join("api/storage", repoKey), nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *Artifactory) Manifest(ctx context.Context, publisher, name string, version Version) (_ *VSIXManifest, err error) {
+	ctx, span := startManifestSpan(ctx, s.tracer, publisher, name, version)
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	// These queries are so slow it seems worth the extra memory to cache the
 	// manifests for future use.
 	// TODO: Remove manifests that are no longer found in the list to prevent
@@ -309,6 +455,7 @@ func (s *Artifactory) Manifest(ctx context.Context, publisher, name string, vers
 	defer mutex.Unlock()
 
 	rawManifest, ok := s.manifests.Load(vsixName)
+	span.SetAttributes(attribute.Bool("cached", ok))
 	if ok {
 		return rawManifest.(*VSIXManifest), nil
 	}
@@ -338,30 +485,115 @@ func (s *Artifactory) Manifest(ctx context.Context, publisher, name string, vers
 	return rawManifest.(*VSIXManifest), nil
 }
 
+func (s *Artifactory) Open(ctx context.Context, publisher, name string, version Version, filePath string) (io.ReadCloser, error) {
+	if err := validateFilePath(filePath); err != nil {
+		return nil, err
+	}
+	reader, _, err := s.read(ctx, path.Join(publisher, name, version.String(), filePath))
+	return reader, err
+}
+
+func (s *Artifactory) ReadState(ctx context.Context, name string) ([]byte, error) {
+	if err := validateStateName(name); err != nil {
+		return nil, err
+	}
+	// State is read on every query so cache it, including whether it exists, for
+	// as long as we cache lists.  Updates skip the cache; see lockState.
+	rawState, ok := s.stateCache.Load(name)
+	if ok && !isUncachedState(ctx) && time.Now().Before(rawState.(*artifactoryState).expiration) {
+		state := rawState.(*artifactoryState)
+		return state.content, state.err
+	}
+	reader, _, err := s.read(ctx, path.Join(stateDir, name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			s.cacheState(name, nil, err)
+		}
+		return nil, err
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	s.cacheState(name, content, nil)
+	return content, nil
+}
+
 func (s *Artifactory) RemoveExtension(ctx context.Context, publisher, name string, version Version) error {
-	_, err := s.delete(ctx, path.Join(publisher, name, version.String()))
-	return err
+	if err := validateExtensionDir(publisher, name); err != nil {
+		return err
+	}
+	if version.Version == "" && version.TargetPlatform == "" {
+		versions, err := s.Versions(ctx, publisher, name)
+		if err != nil {
+			return err
+		}
+		_, err = s.delete(ctx, path.Join(publisher, name))
+		if err != nil {
+			return err
+		}
+		return removeChecksums(ctx, s, publisher, name, versions)
+	}
+
+	versions, err := s.Versions(ctx, publisher, name)
+	if err != nil {
+		return err
+	}
+	matched := MatchVersions(versions, version)
+	if len(matched) == 0 {
+		return xerrors.Errorf("%s: %w", ExtensionVSIXName(publisher, name, version), os.ErrNotExist)
+	}
+	for _, v := range matched {
+		_, err := s.delete(ctx, path.Join(publisher, name, v.String()))
+		if err != nil {
+			return err
+		}
+	}
+	return removeChecksums(ctx, s, publisher, name, matched)
 }
 
-func (s *Artifactory) listWithCache(ctx context.Context) *[]ArtifactoryFile {
+func (s *Artifactory) RemoveState(ctx context.Context, name string) error {
+	if err := validateStateName(name); err != nil {
+		return err
+	}
+	s.stateCache.Delete(name)
+	_, err := s.delete(ctx, path.Join(stateDir, name))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	s.cacheState(name, nil, xerrors.Errorf("state %s: %w", name, os.ErrNotExist))
+	return nil
+}
+
+// listWithCache returns the cached list of files along with the error from
+// listing them, if any.  A failed listing is cached as empty like any other so
+// Artifactory is not asked again on every request.
+func (s *Artifactory) listWithCache(ctx context.Context) (*[]ArtifactoryFile, error) {
 	s.listMutex.Lock()
 	defer s.listMutex.Unlock()
 	if s.listCache == nil || time.Now().After(s.listExpiration) {
-		s.listExpiration = time.Now().Add(s.listDuration)
+		s.listExpiration = time.Now().Add(time.Duration(s.listDuration.Load()))
 		list, _, err := s.list(ctx, "/", 3)
-		if err != nil && !errors.Is(err, os.ErrNotExist) {
+		if err != nil && errors.Is(err, os.ErrNotExist) {
+			err = nil
+		} else if err != nil {
 			s.logger.Error(ctx, "Error reading extensions", slog.Error(err))
 		}
 		s.listCache = &list
+		s.listErr = err
 	}
-	return s.listCache
+	return s.listCache, s.listErr
 }
 
-func (s *Artifactory) WalkExtensions(ctx context.Context, fn func(manifest *VSIXManifest, versions []Version) error) error {
+// extensions returns every extension with its versions in sorted order but
+// without its manifest.  If listing failed it returns no extensions along with
+// the error.
+func (s *Artifactory) extensions(ctx context.Context) (map[string]*extension, error) {
 	// Listing one directory at a time is very slow so get them all at once.  If
 	// we already fetched it recently just use that since getting them all at once
 	// is also pretty slow (on the parsing end).
-	files := s.listWithCache(ctx)
+	files, err := s.listWithCache(ctx)
 	extensions := make(map[string]*extension)
 	for _, file := range *files {
 		// There should only be folders up to this depth but check just in case.
@@ -371,7 +603,7 @@ func (s *Artifactory) WalkExtensions(ctx context.Context, fn func(manifest *VSIX
 		parts := strings.Split(file.URI, "/")
 		// We will get all directories up to the requested depth so for example
 		// /publisher, /publisher/extension, and /publisher/extension/version.
-		if len(parts) == 4 {
+		if len(parts) == 4 && !isReserved(parts[1]) {
 			id := fmt.Sprintf("%s.%s", parts[1], parts[2])
 			e, ok := extensions[id]
 			if ok {
@@ -385,16 +617,38 @@ func (s *Artifactory) WalkExtensions(ctx context.Context, fn func(manifest *VSIX
 			}
 		}
 	}
+	for _, ext := range extensions {
+		sort.Sort(ByVersion(ext.versions))
+	}
+	return extensions, err
+}
+
+func (s *Artifactory) WalkExtensions(ctx context.Context, fn func(manifest *VSIXManifest, versions []Version) error) error {
+	// Listing errors are logged and queries get whatever was listed, which is
+	// nothing, rather than failing outright.
+	extensions, _ := s.extensions(ctx)
+	// While seeding, only use manifests that are already cached rather than
+	// competing with the seed for the rest.  Extensions without one are left
+	// out until they are seeded.
+	if s.seed.get().State == Seeding {
+		for _, ext := range extensions {
+			rawManifest, ok := s.manifests.Load(ExtensionVSIXName(ext.publisher, ext.name, ext.versions[0]))
+			if ok {
+				ext.manifest = rawManifest.(*VSIXManifest)
+			}
+		}
+		return walkManifests(extensions, fn)
+	}
 	// The manifest from the latest version is used for filtering.  Fetching
 	// manifests is very slow so parallelize them.  We could call `fn` in this
 	// loop but it would require that `fn` be thread-safe.  For now I opted to
 	// fetch all the manifests then run the callback in a separate loop.
 	var eg errgroup.Group
+	eg.SetLimit(s.concurrency)
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	for _, ext := range extensions {
 		ext := ext
-		sort.Sort(ByVersion(ext.versions))
 		eg.Go(func() error {
 			manifest, err := s.Manifest(ctx, ext.publisher, ext.name, ext.versions[0])
 			if err != nil && errors.Is(err, context.Canceled) {
@@ -414,17 +668,148 @@ func (s *Artifactory) WalkExtensions(ctx context.Context, fn func(manifest *VSIX
 	if err != nil {
 		return err
 	}
+	return walkManifests(extensions, fn)
+}
+
+// walkManifests calls the function for each extension that has a manifest.
+func walkManifests(extensions map[string]*extension, fn func(manifest *VSIXManifest, versions []Version) error) error {
 	for _, ext := range extensions {
 		if ext.manifest == nil {
 			continue
 		}
-		if err = fn(ext.manifest, ext.versions); err != nil {
+		if err := fn(ext.manifest, ext.versions); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+func (s *Artifactory) WriteState(ctx context.Context, name string, content []byte) error {
+	if err := validateStateName(name); err != nil {
+		return err
+	}
+	_, err := s.upload(ctx, path.Join(stateDir, name), bytes.NewReader(content))
+	if err != nil {
+		s.stateCache.Delete(name)
+		return err
+	}
+	s.cacheState(name, content, nil)
+	return nil
+}
+
+// Seed reads every manifest into the cache, starting with the latest version
+// of each extension since those are the ones queries need.  Progress is logged
+// periodically and reported by SeedStatus.  Manifests that cannot be read are
+// counted as errors and will be fetched again when they are next needed.
+// Failing to list the extensions fails seeding, after which it can be tried
+// again.
+func (s *Artifactory) Seed(ctx context.Context) (err error) {
+	if !s.seed.start() {
+		return xerrors.New("seeding has already started")
+	}
+	defer func() {
+		s.seed.finish(err)
+	}()
+
+	s.logger.Info(ctx, "Seeding manifest cache...", slog.F("concurrency", s.concurrency))
+	start := time.Now()
+
+	extensions, err := s.extensions(ctx)
+	if err != nil {
+		s.seed.addError()
+		return xerrors.Errorf("list extensions: %w", err)
+	}
+	latest := []extensionVersion{}
+	older := []extensionVersion{}
+	for _, ext := range extensions {
+		for i, version := range ext.versions {
+			ev := extensionVersion{publisher: ext.publisher, name: ext.name, version: version}
+			if i == 0 {
+				latest = append(latest, ev)
+			} else {
+				older = append(older, ev)
+			}
+		}
+	}
+	versions := append(latest, older...)
+	s.seed.setTotal(len(versions))
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(seedProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			status := s.seed.get()
+			fields := []any{
+				slog.F("seeded", status.Seeded),
+				slog.F("total", status.Total),
+				slog.F("errors", status.Errors),
+			}
+			if !status.ETA.IsZero() {
+				fields = append(fields, slog.F("eta", time.Until(status.ETA).Round(time.Second)))
+			}
+			s.logger.Info(ctx, "Seeding manifest cache...", fields...)
+		}
+	}()
+
+	var eg errgroup.Group
+	eg.SetLimit(s.concurrency)
+	for _, ev := range versions {
+		if ctx.Err() != nil {
+			break
+		}
+		eg.Go(func() error {
+			_, err := s.Manifest(ctx, ev.publisher, ev.name, ev.version)
+			if err != nil && errors.Is(err, context.Canceled) {
+				return err
+			} else if err != nil {
+				s.logger.Error(ctx, "Unable to read extension manifest", slog.Error(err),
+					slog.F("id", ExtensionIDWithVersion(ev.publisher, ev.name, ev.version.Version)),
+					slog.F("targetPlatform", ev.version.TargetPlatform))
+			}
+			s.seed.add(err != nil)
+			return nil
+		})
+	}
+	err = eg.Wait()
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+
+	status := s.seed.get()
+	s.logger.Info(ctx, "Seeded manifest cache",
+		slog.F("count", status.Seeded),
+		slog.F("errors", status.Errors),
+		slog.F("took", time.Since(start)))
+	return nil
+}
+
+func (s *Artifactory) SeedStatus() *SeedStatus {
+	status := s.seed.get()
+	return &status
+}
+
+func (s *Artifactory) SetListCacheDuration(duration time.Duration) {
+	s.listMutex.Lock()
+	defer s.listMutex.Unlock()
+	s.listDuration.Store(int64(duration))
+	if expiration := time.Now().Add(duration); expiration.Before(s.listExpiration) {
+		s.listExpiration = expiration
+	}
+	// State files are cached for the same duration.  Simply drop them rather
+	// than working out which ones would outlive the new duration.
+	s.stateCache.Clear()
+}
+
 func (s *Artifactory) Versions(ctx context.Context, publisher, name string) ([]Version, error) {
 	files, _, err := s.list(ctx, path.Join(publisher, name), 1)
 	if err != nil {
@@ -13,15 +13,24 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 
 	"cdr.dev/slog"
 	"cdr.dev/slog/sloggers/slogtest"
 	"github.com/coder/code-marketplace/api/httpapi"
 	"github.com/coder/code-marketplace/storage"
+	"github.com/coder/code-marketplace/testutil"
 )
 
 const ArtifactoryURIEnvKey = "ARTIFACTORY_URI"
@@ -39,7 +48,7 @@ func readFiles(depth int, root, current string) ([]storage.ArtifactoryFile, erro
 			URI:    current,
 			Folder: file.IsDir(),
 		})
-		if depth > 1 {
+		if depth > 1 && file.IsDir() {
 			files, err := readFiles(depth-1, root, current)
 			if err != nil {
 				return nil, err
@@ -65,6 +74,9 @@ func handleArtifactory(extdir, repo string, rw http.ResponseWriter, r *http.Requ
 			return err
 		}
 		httpapi.Write(rw, http.StatusOK, &storage.ArtifactoryList{Files: files})
+	} else if repoKey, _, _ := strings.Cut(repo, "/"); r.Method == http.MethodGet && r.URL.Path == "/api/storage/"+repoKey {
+		// The repository always exists, even if nothing has been written yet.
+		httpapi.Write(rw, http.StatusOK, &storage.ArtifactoryList{})
 	} else if r.Method == http.MethodDelete {
 		filename := filepath.Join(extdir, filepath.FromSlash(r.URL.Path))
 		_, err := os.Stat(filename)
@@ -109,14 +121,13 @@ func handleArtifactory(extdir, repo string, rw http.ResponseWriter, r *http.Requ
 			httpapi.Write(rw, http.StatusOK, &storage.ArtifactoryList{})
 			return nil
 		}
-		b, err := os.ReadFile(filename)
-		if err != nil {
-			return err
-		}
-		_, err = rw.Write(b)
+		f, err := os.Open(filename)
 		if err != nil {
 			return err
 		}
+		defer f.Close()
+		// Like Artifactory, support ranges and conditional requests.
+		http.ServeContent(rw, r, stat.Name(), stat.ModTime(), f)
 	} else {
 		http.Error(rw, "not implemented", http.StatusNotImplemented)
 	}
@@ -211,3 +222,349 @@ func artifactoryFactory(t *testing.T) testStorage {
 		},
 	}
 }
+
+func TestArtifactoryTracing(t *testing.T) {
+	t.Parallel()
+
+	var traceparents []string
+	var mutex sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		traceparents = append(traceparents, r.Header.Get("traceparent"))
+		mutex.Unlock()
+		if strings.HasPrefix(r.URL.Path, "/api/storage/") {
+			httpapi.Write(rw, http.StatusOK, storage.ArtifactoryList{Files: []storage.ArtifactoryFile{}})
+			return
+		}
+		httpapi.Write(rw, http.StatusNotFound, storage.ArtifactoryResponse{})
+	}))
+	t.Cleanup(server.Close)
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	logger := slogtest.Make(t, &slogtest.Options{IgnoreErrors: true})
+	s, err := storage.NewArtifactoryStorage(context.Background(), &storage.ArtifactoryOptions{
+		Logger:         logger,
+		Repo:           "extensions",
+		Token:          "mock",
+		URI:            server.URL,
+		TracerProvider: provider,
+	})
+	require.NoError(t, err)
+	exporter.Reset()
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	_, err = s.Manifest(ctx, "foo", "bar", storage.Version{Version: "1.0.0", TargetPlatform: storage.PlatformLinuxX64})
+	require.ErrorIs(t, err, os.ErrNotExist)
+	parent.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	request, manifest := spans[0], spans[1]
+	require.Equal(t, "artifactory GET", request.Name)
+	require.Equal(t, trace.SpanKindClient, request.SpanKind)
+	require.Contains(t, request.Attributes, attribute.Int("http.response.status_code", http.StatusNotFound))
+	// A missing file is not an error for the request but is for the manifest.
+	require.Equal(t, codes.Unset, request.Status.Code)
+	require.Equal(t, manifest.SpanContext.SpanID(), request.Parent.SpanID())
+
+	require.Equal(t, "Manifest", manifest.Name)
+	require.Equal(t, codes.Error, manifest.Status.Code)
+	require.Contains(t, manifest.Attributes, attribute.String("extension", "foo.bar"))
+	require.Contains(t, manifest.Attributes, attribute.String("target_platform", "linux-x64"))
+	require.Contains(t, manifest.Attributes, attribute.Bool("cached", false))
+	require.Equal(t, parent.SpanContext().SpanID(), manifest.Parent.SpanID())
+
+	// The trace context should be sent to Artifactory.
+	mutex.Lock()
+	defer mutex.Unlock()
+	last := traceparents[len(traceparents)-1]
+	require.Contains(t, last, request.SpanContext.TraceID().String())
+	require.Contains(t, last, request.SpanContext.SpanID().String())
+}
+
+func TestArtifactorySeed(t *testing.T) {
+	t.Parallel()
+
+	const extensions = 5
+	release := make(chan struct{})
+	var (
+		mutex       sync.Mutex
+		inflight    int
+		maxInflight int
+		requested   []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Query().Has("list"):
+			files := []storage.ArtifactoryFile{{URI: "/foo", Folder: true}}
+			for i := 0; i < extensions; i++ {
+				files = append(files,
+					storage.ArtifactoryFile{URI: fmt.Sprintf("/foo/ext%d", i), Folder: true},
+					storage.ArtifactoryFile{URI: fmt.Sprintf("/foo/ext%d/1.0.0", i), Folder: true},
+					storage.ArtifactoryFile{URI: fmt.Sprintf("/foo/ext%d/2.0.0", i), Folder: true})
+			}
+			httpapi.Write(rw, http.StatusOK, storage.ArtifactoryList{Files: files})
+		case r.URL.Path == "/api/storage/extensions":
+			httpapi.Write(rw, http.StatusOK, storage.ArtifactoryList{})
+		case strings.HasSuffix(r.URL.Path, "/extension.vsixmanifest"):
+			mutex.Lock()
+			inflight++
+			maxInflight = max(maxInflight, inflight)
+			requested = append(requested, r.URL.Path)
+			mutex.Unlock()
+			defer func() {
+				mutex.Lock()
+				inflight--
+				mutex.Unlock()
+			}()
+			select {
+			case <-release:
+			case <-r.Context().Done():
+				return
+			}
+			// One manifest is missing.
+			parts := strings.Split(r.URL.Path, "/")
+			if parts[3] == "ext0" && parts[4] == "1.0.0" {
+				httpapi.Write(rw, http.StatusNotFound, storage.ArtifactoryResponse{})
+				return
+			}
+			ext := testutil.Extension{Publisher: parts[2], Name: parts[3]}
+			_, _ = rw.Write(testutil.ConvertExtensionToManifestBytes(t, ext, storage.Version{Version: parts[4]}))
+		default:
+			httpapi.Write(rw, http.StatusNotFound, storage.ArtifactoryResponse{})
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	s, err := storage.NewArtifactoryStorage(context.Background(), &storage.ArtifactoryOptions{
+		Logger:              slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}),
+		Repo:                "extensions",
+		Token:               "mock",
+		URI:                 server.URL,
+		ManifestConcurrency: 2,
+	})
+	require.NoError(t, err)
+	count := func() int {
+		count := 0
+		err := s.WalkExtensions(context.Background(), func(manifest *storage.VSIXManifest, versions []storage.Version) error {
+			count++
+			return nil
+		})
+		require.NoError(t, err)
+		return count
+	}
+
+	require.Equal(t, storage.SeedPending, s.SeedStatus().State)
+	require.ErrorContains(t, s.Health(context.Background()), "has not been seeded")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Seed(context.Background())
+	}()
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return inflight == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Nothing is cached yet, so nothing is walked and the storage is not ready.
+	status := s.SeedStatus()
+	require.Equal(t, storage.Seeding, status.State)
+	require.Equal(t, 2*extensions, status.Total)
+	require.Equal(t, 0, count())
+	require.ErrorContains(t, s.Health(context.Background()), "still being seeded (0 of 10 manifests)")
+
+	close(release)
+	require.NoError(t, <-done)
+
+	status = s.SeedStatus()
+	require.Equal(t, storage.SeedDone, status.State)
+	require.Equal(t, 2*extensions, status.Seeded)
+	require.Equal(t, 1, status.Errors)
+	require.False(t, status.FinishedAt.IsZero())
+	require.NoError(t, s.Health(context.Background()))
+	require.Equal(t, extensions, count())
+	require.ErrorContains(t, s.Seed(context.Background()), "already started")
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.Equal(t, 2, maxInflight)
+	// Latest versions are seeded first, although the last of them may race with
+	// the first older version.
+	for _, path := range requested[:extensions-1] {
+		require.Contains(t, path, "/2.0.0/")
+	}
+}
+
+func TestArtifactorySeedListError(t *testing.T) {
+	t.Parallel()
+
+	var broken atomic.Bool
+	broken.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Query().Has("list") && broken.Load():
+			httpapi.Write(rw, http.StatusInternalServerError, storage.ArtifactoryResponse{})
+		case r.URL.Query().Has("list"):
+			httpapi.Write(rw, http.StatusOK, storage.ArtifactoryList{Files: []storage.ArtifactoryFile{
+				{URI: "/foo", Folder: true},
+				{URI: "/foo/bar", Folder: true},
+				{URI: "/foo/bar/1.0.0", Folder: true},
+			}})
+		case strings.HasSuffix(r.URL.Path, "/extension.vsixmanifest"):
+			_, _ = rw.Write(testutil.ConvertExtensionToManifestBytes(t, testutil.Extension{Publisher: "foo", Name: "bar"}, storage.Version{Version: "1.0.0"}))
+		default:
+			httpapi.Write(rw, http.StatusOK, storage.ArtifactoryList{})
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	s, err := storage.NewArtifactoryStorage(context.Background(), &storage.ArtifactoryOptions{
+		Logger: slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}),
+		Repo:   "extensions",
+		Token:  "mock",
+		URI:    server.URL,
+	})
+	require.NoError(t, err)
+
+	// Failing to list is not mistaken for there being no extensions.
+	require.ErrorContains(t, s.Seed(context.Background()), "list extensions")
+	status := s.SeedStatus()
+	require.Equal(t, storage.SeedFailed, status.State)
+	require.Equal(t, 1, status.Errors)
+	require.NotEmpty(t, status.Error)
+	require.ErrorContains(t, s.Health(context.Background()), "seeding the manifest cache failed")
+
+	// Seeding can be tried again once the list is no longer cached.
+	broken.Store(false)
+	require.NoError(t, s.Seed(context.Background()))
+	status = s.SeedStatus()
+	require.Equal(t, storage.SeedDone, status.State)
+	require.Equal(t, 1, status.Total)
+	require.Equal(t, 0, status.Errors)
+	require.NoError(t, s.Health(context.Background()))
+}
+
+func TestArtifactoryStateCache(t *testing.T) {
+	t.Parallel()
+
+	const prefix = "/extensions/.marketplace/"
+	var mutex sync.Mutex
+	files := map[string][]byte{}
+	gets := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		name := strings.TrimPrefix(r.URL.Path, prefix)
+		switch r.Method {
+		case http.MethodPut:
+			b, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			files[name] = b
+			_, _ = rw.Write([]byte("ok"))
+		case http.MethodDelete:
+			delete(files, name)
+			_, _ = rw.Write([]byte("ok"))
+		case http.MethodGet:
+			gets[name]++
+			if content, ok := files[name]; ok {
+				_, _ = rw.Write(content)
+				return
+			}
+			httpapi.Write(rw, http.StatusNotFound, storage.ArtifactoryResponse{})
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	s, err := storage.NewArtifactoryStorage(context.Background(), &storage.ArtifactoryOptions{
+		ListCacheDuration: time.Hour,
+		Logger:            slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}),
+		Repo:              "extensions",
+		Token:             "mock",
+		URI:               server.URL,
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+	getCount := func(name string) int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return gets[name]
+	}
+
+	// State files that do not exist are cached too.
+	for i := 0; i < 3; i++ {
+		unpublished, err := storage.ReadUnpublished(ctx, s)
+		require.NoError(t, err)
+		require.Empty(t, unpublished)
+	}
+	require.Equal(t, 1, getCount("unpublished.json"))
+
+	// Updates read around the cache so changes made elsewhere, like another
+	// replica or the CLI, are seen.
+	mutex.Lock()
+	files["unpublished.json"] = []byte(`{"foo.elsewhere":{"all":true}}`)
+	mutex.Unlock()
+	err = storage.Republish(ctx, s, "foo", "elsewhere", "")
+	require.NoError(t, err)
+	unpublished, err := storage.ReadUnpublished(ctx, s)
+	require.NoError(t, err)
+	require.Empty(t, unpublished)
+
+	manifest, err := storage.ReadControlManifest(ctx, s)
+	require.NoError(t, err)
+	require.Empty(t, manifest.Malicious)
+	mutex.Lock()
+	files["control.json"] = []byte(`{"malicious":["foo.elsewhere"]}`)
+	mutex.Unlock()
+	err = storage.UpdateControlManifest(ctx, s, func(manifest *storage.ControlManifest) error {
+		manifest.Malicious = append(manifest.Malicious, "foo.here")
+		return nil
+	})
+	require.NoError(t, err)
+	manifest, err = storage.ReadControlManifest(ctx, s)
+	require.NoError(t, err)
+	require.Equal(t, []string{"foo.elsewhere", "foo.here"}, manifest.Malicious)
+
+	// Concurrent updates are not lost.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := storage.UpdateControlManifest(ctx, s, func(manifest *storage.ControlManifest) error {
+				manifest.Malicious = append(manifest.Malicious, fmt.Sprintf("foo.concurrent%d", i))
+				return nil
+			})
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	manifest, err = storage.ReadControlManifest(ctx, s)
+	require.NoError(t, err)
+	require.Len(t, manifest.Malicious, 12)
+
+	// Pending extensions are never cached.
+	name := "pending/foo.bar-1.0.0/extension.vsix"
+	require.NoError(t, s.WriteState(ctx, name, []byte("vsix")))
+	for i := 0; i < 2; i++ {
+		content, err := s.ReadState(ctx, name)
+		require.NoError(t, err)
+		require.Equal(t, []byte("vsix"), content)
+	}
+	require.Equal(t, 2, getCount(name))
+
+	// Looking up ETags for files served from /files hits the cache as well,
+	// whether or not there are checksums.
+	require.NoError(t, s.WriteState(ctx, "checksums/foo/bar/1.0.0.json", []byte(`{"extension/package.json":"abc"}`)))
+	for i := 0; i < 3; i++ {
+		etag, err := storage.FileETag(ctx, s, "/foo/bar/1.0.0/extension/package.json")
+		require.NoError(t, err)
+		require.Equal(t, `"abc"`, etag)
+		etag, err = storage.FileETag(ctx, s, "/foo/bar/2.0.0/extension/package.json")
+		require.NoError(t, err)
+		require.Empty(t, etag)
+	}
+	require.Equal(t, 0, getCount("checksums/foo/bar/1.0.0.json"))
+	require.Equal(t, 1, getCount("checksums/foo/bar/2.0.0.json"))
+}
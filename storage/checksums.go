@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/coder/code-marketplace/storage/easyzip"
+)
+
+// Checksums maps file paths, relative to an extension version's directory, to
+// the hex-encoded SHA-256 of their contents.
+type Checksums map[string]string
+
+// ETag returns the strong ETag for the file or a blank string if its checksum
+// was not recorded.
+func (c Checksums) ETag(p string) string {
+	sum, ok := c[path.Clean(strings.TrimLeft(p, "/"))]
+	if !ok {
+		return ""
+	}
+	return `"` + sum + `"`
+}
+
+// checksumsStateName returns the name of the state file holding a version's
+// checksums.
+func checksumsStateName(publisher, name string, version Version) string {
+	return path.Join("checksums", publisher, name, version.String()+".json")
+}
+
+// computeChecksums hashes every file in the VSIX along with the VSIX itself and
+// any extra files, keyed by where they will be stored.
+func computeChecksums(manifest *VSIXManifest, vsix []byte, limits easyzip.Limits, extra []File) (Checksums, error) {
+	checksums := Checksums{}
+	err := easyzip.ExtractZipWithLimits(vsix, limits, func(name string, r io.Reader) error {
+		h := sha256.New()
+		if _, err := io.Copy(h, r); err != nil {
+			return err
+		}
+		checksums[path.Clean(name)] = hex.EncodeToString(h.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("hash files: %w", err)
+	}
+	sum := sha256.Sum256(vsix)
+	checksums[fmt.Sprintf("%s.vsix", ExtensionVSIXNameFromManifest(manifest))] = hex.EncodeToString(sum[:])
+	for _, file := range extra {
+		sum := sha256.Sum256(file.Content)
+		checksums[path.Clean(file.RelativePath)] = hex.EncodeToString(sum[:])
+	}
+	return checksums, nil
+}
+
+// writeChecksums records the checksums of a newly added version.
+func writeChecksums(ctx context.Context, s Storage, manifest *VSIXManifest, checksums Checksums) error {
+	identity := manifest.Metadata.Identity
+	return writeStateJSON(ctx, s, checksumsStateName(identity.Publisher, identity.ID, Version{
+		Version:        identity.Version,
+		TargetPlatform: identity.TargetPlatform,
+	}), checksums)
+}
+
+// removeChecksums forgets the checksums of removed versions.
+func removeChecksums(ctx context.Context, s Storage, publisher, name string, versions []Version) error {
+	for _, version := range versions {
+		if err := s.RemoveState(ctx, checksumsStateName(publisher, name, version)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadChecksums returns the checksums recorded when a version was added.
+// Versions added before checksums were recorded have none.
+func ReadChecksums(ctx context.Context, s Storage, publisher, name string, version Version) (Checksums, error) {
+	checksums := Checksums{}
+	err := readStateJSON(ctx, s, checksumsStateName(publisher, name, version), &checksums)
+	if err != nil {
+		return nil, err
+	}
+	return checksums, nil
+}
+
+// FileETag returns the strong ETag of a file given its path relative to the
+// extension root, for example publisher/name/1.0.0/extension/package.json.  A
+// blank string is returned if the checksum is unknown.  Checksums are read as
+// state so storage that caches state, found or not, caches these lookups too.
+func FileETag(ctx context.Context, s Storage, p string) (string, error) {
+	parts := strings.SplitN(strings.TrimLeft(p, "/"), "/", 4)
+	if len(parts) < 4 || parts[3] == "" {
+		return "", nil
+	}
+	// Do not let the path point the state file name somewhere else.
+	for _, part := range parts[:3] {
+		if part == "" || strings.HasPrefix(part, ".") {
+			return "", nil
+		}
+	}
+	version := VersionFromString(parts[2])
+	checksums, err := ReadChecksums(ctx, s, parts[0], parts[1], version)
+	if err != nil {
+		return "", err
+	}
+	return checksums.ETag(parts[3]), nil
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+const controlStateName = "control.json"
+
+// ControlManifest implements IRawExtensionsControlManifest.  VS Code fetches
+// it to show deprecation notices, suggest replacements, and block malicious
+// extensions.
+// https://github.com/microsoft/vscode/blob/main/src/vs/platform/extensionManagement/common/extensionGalleryService.ts
+type ControlManifest struct {
+	Malicious  []string                `json:"malicious"`
+	Deprecated map[string]*Deprecation `json:"deprecated,omitempty"`
+}
+
+// Deprecation implements the object form of
+// IRawExtensionsControlManifest.deprecated.
+// https://github.com/microsoft/vscode/blob/main/src/vs/platform/extensionManagement/common/extensionGalleryService.ts
+type Deprecation struct {
+	DisallowInstall bool                  `json:"disallowInstall,omitempty"`
+	Extension       *DeprecationExtension `json:"extension,omitempty"`
+	Settings        []string              `json:"settings,omitempty"`
+	AdditionalInfo  string                `json:"additionalInfo,omitempty"`
+}
+
+// DeprecationExtension is the extension that replaces a deprecated extension.
+type DeprecationExtension struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName"`
+}
+
+// IsMalicious returns true if the extension (publisher.name) is blocked.
+func (m *ControlManifest) IsMalicious(id string) bool {
+	return slices.ContainsFunc(m.Malicious, func(malicious string) bool {
+		return strings.EqualFold(malicious, id)
+	})
+}
+
+// SetMalicious blocks the extension (publisher.name).
+func (m *ControlManifest) SetMalicious(id string) {
+	if !m.IsMalicious(id) {
+		m.Malicious = append(m.Malicious, id)
+		slices.Sort(m.Malicious)
+	}
+}
+
+// Deprecate marks the extension (publisher.name) as deprecated, replacing any
+// existing deprecation.
+func (m *ControlManifest) Deprecate(id string, deprecation *Deprecation) {
+	m.Clear(id, false)
+	m.Deprecated[id] = deprecation
+}
+
+// Clear removes the extension (publisher.name) from the deprecated list and, if
+// malicious is set, from the malicious list as well.  It returns true if
+// anything was removed.
+func (m *ControlManifest) Clear(id string, malicious bool) bool {
+	cleared := false
+	for deprecated := range m.Deprecated {
+		if strings.EqualFold(deprecated, id) {
+			delete(m.Deprecated, deprecated)
+			cleared = true
+		}
+	}
+	if malicious && m.IsMalicious(id) {
+		m.Malicious = slices.DeleteFunc(m.Malicious, func(malicious string) bool {
+			return strings.EqualFold(malicious, id)
+		})
+		cleared = true
+	}
+	return cleared
+}
+
+// ReadControlManifest returns the control manifest.  If one has never been
+// written an empty manifest is returned.
+func ReadControlManifest(ctx context.Context, s Storage) (*ControlManifest, error) {
+	manifest := &ControlManifest{}
+	err := readStateJSON(ctx, s, controlStateName, manifest)
+	if err != nil {
+		return nil, err
+	}
+	// VS Code expects the malicious list to always be present.
+	if manifest.Malicious == nil {
+		manifest.Malicious = []string{}
+	}
+	if manifest.Deprecated == nil {
+		manifest.Deprecated = map[string]*Deprecation{}
+	}
+	return manifest, nil
+}
+
+// UpdateControlManifest applies a function to the control manifest then writes
+// the result.  If the function errors nothing is written.
+func UpdateControlManifest(ctx context.Context, s Storage, fn func(manifest *ControlManifest) error) error {
+	ctx, unlock := lockState(ctx, controlStateName)
+	defer unlock()
+	manifest, err := ReadControlManifest(ctx, s)
+	if err != nil {
+		return err
+	}
+	err = fn(manifest)
+	if err != nil {
+		return err
+	}
+	return writeStateJSON(ctx, s, controlStateName, manifest)
+}
@@ -0,0 +1,66 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/code-marketplace/storage"
+	"github.com/coder/code-marketplace/testutil"
+)
+
+func TestControlManifest(t *testing.T) {
+	t.Parallel()
+
+	s := testutil.NewMockStorage()
+
+	// Should get an empty (but non-nil) manifest when none has been written.
+	manifest, err := storage.ReadControlManifest(context.Background(), s)
+	require.NoError(t, err)
+	require.Equal(t, []string{}, manifest.Malicious)
+	require.Empty(t, manifest.Deprecated)
+
+	err = storage.UpdateControlManifest(context.Background(), s, func(manifest *storage.ControlManifest) error {
+		manifest.SetMalicious("foo.bad")
+		manifest.SetMalicious("Foo.Bad")
+		manifest.SetMalicious("bar.bad")
+		manifest.Deprecate("foo.old", &storage.Deprecation{
+			Extension: &storage.DeprecationExtension{ID: "foo.new", DisplayName: "New"},
+		})
+		manifest.Deprecate("foo.older", &storage.Deprecation{})
+		return nil
+	})
+	require.NoError(t, err)
+
+	manifest, err = storage.ReadControlManifest(context.Background(), s)
+	require.NoError(t, err)
+	require.Equal(t, []string{"bar.bad", "foo.bad"}, manifest.Malicious)
+	require.True(t, manifest.IsMalicious("FOO.BAD"))
+	require.False(t, manifest.IsMalicious("foo.old"))
+	require.Equal(t, map[string]*storage.Deprecation{
+		"foo.old": {
+			Extension: &storage.DeprecationExtension{ID: "foo.new", DisplayName: "New"},
+		},
+		"foo.older": {},
+	}, manifest.Deprecated)
+
+	// Clearing should be case-insensitive and only clear malicious entries when
+	// asked.
+	require.True(t, manifest.Clear("FOO.OLD", true))
+	require.False(t, manifest.Clear("foo.old", true))
+	require.False(t, manifest.Clear("foo.bad", false))
+	require.True(t, manifest.Clear("foo.bad", true))
+	require.Equal(t, []string{"bar.bad"}, manifest.Malicious)
+	require.Len(t, manifest.Deprecated, 1)
+
+	// Errors should prevent writes.
+	err = storage.UpdateControlManifest(context.Background(), s, func(manifest *storage.ControlManifest) error {
+		manifest.SetMalicious("baz.bad")
+		return context.Canceled
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	manifest, err = storage.ReadControlManifest(context.Background(), s)
+	require.NoError(t, err)
+	require.False(t, manifest.IsMalicious("baz.bad"))
+}
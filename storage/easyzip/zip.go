@@ -3,21 +3,159 @@ package easyzip
 import (
 	"archive/zip"
 	"bytes"
+	"fmt"
 	"io"
+	"path"
+	"strings"
 
 	"golang.org/x/xerrors"
 )
 
-// WalkZip applies a function over every file in the zip. If the function
-// returns true a reader for that file will be immediately returned. If it
-// returns an error the error will immediately be returned. Otherwise `nil` will
-// be returned once the archive's end is reached.
+var (
+	ErrTooManyEntries   = xerrors.New("too many entries")
+	ErrFileTooLarge     = xerrors.New("file too large")
+	ErrTooLarge         = xerrors.New("uncompressed size too large")
+	ErrCompressionRatio = xerrors.New("compression ratio too high")
+	ErrDuplicateEntry   = xerrors.New("duplicate entry")
+	ErrUnsafePath       = xerrors.New("unsafe path")
+)
+
+// ArchiveError is returned when an archive is rejected.  It wraps one of the
+// Err* errors above so callers can tell what was wrong with errors.Is.
+type ArchiveError struct {
+	// Name is the entry that was rejected, if the problem is with a single
+	// entry.
+	Name string
+	Err  error
+}
+
+func (e *ArchiveError) Error() string {
+	if e.Name != "" {
+		return fmt.Sprintf("invalid archive: %q: %s", e.Name, e.Err)
+	}
+	return fmt.Sprintf("invalid archive: %s", e.Err)
+}
+
+func (e *ArchiveError) Unwrap() error {
+	return e.Err
+}
+
+// Limits bounds what an archive can contain.  Zero means no limit.
+type Limits struct {
+	// MaxEntries limits the number of files and directories.
+	MaxEntries int
+	// MaxFileSize limits the uncompressed size of each file.
+	MaxFileSize int64
+	// MaxTotalSize limits the uncompressed size of all the files together.
+	MaxTotalSize int64
+	// MaxCompressionRatio limits how many times larger a file can be
+	// uncompressed than compressed.  Files under a mebibyte are not checked
+	// since small files of repeated content legitimately compress well.
+	MaxCompressionRatio int64
+}
+
+// DefaultLimits comfortably fit the largest extensions on the official
+// marketplace while still stopping zip bombs.
+var DefaultLimits = Limits{
+	MaxEntries:          50_000,
+	MaxFileSize:         1 << 30,
+	MaxTotalSize:        2 << 30,
+	MaxCompressionRatio: 200,
+}
+
+// ratioMinSize is the smallest file the compression ratio limit applies to.
+const ratioMinSize = 1 << 20
+
+// CheckName errors with ErrUnsafePath if the name could point outside of the
+// directory it is extracted to.  Backslashes are treated as separators since
+// that is how they would be interpreted on Windows.
+func CheckName(name string) error {
+	slashed := strings.ReplaceAll(name, `\`, "/")
+	if name == "" || strings.ContainsRune(name, 0) || strings.HasPrefix(slashed, "/") ||
+		// Windows drive letters like C: or C:/.
+		(len(slashed) >= 2 && slashed[1] == ':') {
+		return ErrUnsafePath
+	}
+	for _, part := range strings.Split(slashed, "/") {
+		if part == ".." {
+			return ErrUnsafePath
+		}
+	}
+	return nil
+}
+
+// check validates every entry in the archive against the limits using the
+// sizes recorded in the archive.  The recorded sizes are also enforced while
+// reading by archive/zip, which errors if a file decompresses to more than its
+// recorded size.
+func check(zr *zip.Reader, limits Limits) error {
+	if limits.MaxEntries > 0 && len(zr.File) > limits.MaxEntries {
+		return &ArchiveError{Err: xerrors.Errorf("%w: %d is more than %d", ErrTooManyEntries, len(zr.File), limits.MaxEntries)}
+	}
+	seen := make(map[string]struct{}, len(zr.File))
+	var total uint64
+	for _, zf := range zr.File {
+		if err := CheckName(zf.Name); err != nil {
+			return &ArchiveError{Name: zf.Name, Err: err}
+		}
+		// Directories are identified by a trailing slash and do not count as
+		// duplicates of files inside them.
+		cleaned := path.Clean(strings.ReplaceAll(zf.Name, `\`, "/"))
+		if strings.HasSuffix(zf.Name, "/") {
+			cleaned += "/"
+		}
+		if _, ok := seen[cleaned]; ok {
+			return &ArchiveError{Name: zf.Name, Err: ErrDuplicateEntry}
+		}
+		seen[cleaned] = struct{}{}
+
+		size := zf.UncompressedSize64
+		if limits.MaxFileSize > 0 && size > uint64(limits.MaxFileSize) {
+			return &ArchiveError{Name: zf.Name, Err: xerrors.Errorf("%w: %d bytes is more than %d", ErrFileTooLarge, size, limits.MaxFileSize)}
+		}
+		if limits.MaxCompressionRatio > 0 && size >= ratioMinSize &&
+			size/max(zf.CompressedSize64, 1) > uint64(limits.MaxCompressionRatio) {
+			return &ArchiveError{Name: zf.Name, Err: xerrors.Errorf("%w: more than %d to 1", ErrCompressionRatio, limits.MaxCompressionRatio)}
+		}
+		total += size
+		if limits.MaxTotalSize > 0 && total > uint64(limits.MaxTotalSize) {
+			return &ArchiveError{Err: xerrors.Errorf("%w: more than %d bytes", ErrTooLarge, limits.MaxTotalSize)}
+		}
+	}
+	return nil
+}
+
+// Validate checks the archive against the limits without reading any files.
+// A rejected archive errors with an *ArchiveError.
+func Validate(rawZip []byte, limits Limits) error {
+	b := bytes.NewReader(rawZip)
+	zr, err := zip.NewReader(b, b.Size())
+	if err != nil {
+		return err
+	}
+	return check(zr, limits)
+}
+
+// WalkZip applies a function over every file in the zip after checking the
+// archive against DefaultLimits. If the function returns true a reader for that
+// file will be immediately returned. If it returns an error the error will
+// immediately be returned. Otherwise `nil` will be returned once the archive's
+// end is reached.
 func WalkZip(rawZip []byte, fn func(*zip.File) (bool, error)) (io.ReadCloser, error) {
+	return WalkZipWithLimits(rawZip, DefaultLimits, fn)
+}
+
+// WalkZipWithLimits is WalkZip with the provided limits.  A rejected archive
+// errors with an *ArchiveError before the function is called for any file.
+func WalkZipWithLimits(rawZip []byte, limits Limits, fn func(*zip.File) (bool, error)) (io.ReadCloser, error) {
 	b := bytes.NewReader(rawZip)
 	zr, err := zip.NewReader(b, b.Size())
 	if err != nil {
 		return nil, err
 	}
+	if err := check(zr, limits); err != nil {
+		return nil, err
+	}
 	for _, zf := range zr.File {
 		stop, err := fn(zf)
 		if err != nil {
@@ -48,10 +186,16 @@ func GetZipFileReader(rawZip []byte, filename string) (io.ReadCloser, error) {
 	return reader, nil
 }
 
-// ExtractZip applies a function with a reader for every file in the zip.  If
-// the function returns an error the walk is aborted.
+// ExtractZip applies a function with a reader for every file in the zip after
+// checking the archive against DefaultLimits.  If the function returns an
+// error the walk is aborted.
 func ExtractZip(rawZip []byte, fn func(name string, reader io.Reader) error) error {
-	_, err := WalkZip(rawZip, func(zf *zip.File) (stop bool, err error) {
+	return ExtractZipWithLimits(rawZip, DefaultLimits, fn)
+}
+
+// ExtractZipWithLimits is ExtractZip with the provided limits.
+func ExtractZipWithLimits(rawZip []byte, limits Limits, fn func(name string, reader io.Reader) error) error {
+	_, err := WalkZipWithLimits(rawZip, limits, func(zf *zip.File) (stop bool, err error) {
 		if !zf.FileInfo().IsDir() {
 			zr, err := zf.Open()
 			if err != nil {
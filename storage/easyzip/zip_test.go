@@ -79,3 +79,163 @@ func TestExtract(t *testing.T) {
 		require.Equal(t, []string{"alpha.txt", "beta.txt", "charlie.txt", "delta/delta.txt"}, called)
 	})
 }
+
+// createZipWith creates a zip with the provided entries, compressing them
+// unless store is true.
+func createZipWith(t *testing.T, store bool, entries map[string][]byte) []byte {
+	buf := bytes.NewBuffer(nil)
+	zw := zip.NewWriter(buf)
+	method := zip.Deflate
+	if store {
+		method = zip.Store
+	}
+	for name, body := range entries {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		require.NoError(t, err)
+		_, err = fw.Write(body)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestCheckName(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"a.txt", "extension/a.txt", "extension/", "a..b/c", ".hidden"} {
+		require.NoError(t, CheckName(name), name)
+	}
+	for _, name := range []string{"", "../a", "a/../../b", "/etc/passwd", `..\a`, `a\..\..\b`, `\a`, "C:/a", `C:\a`, "C:a", "a\x00b"} {
+		require.ErrorIs(t, CheckName(name), ErrUnsafePath, name)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	t.Parallel()
+
+	// Compresses to a few kilobytes.
+	bomb := bytes.Repeat([]byte{0}, 4<<20)
+
+	tests := []struct {
+		name    string
+		entries map[string][]byte
+		store   bool
+		limits  Limits
+		error   error
+	}{
+		{
+			name:    "Unlimited",
+			entries: map[string][]byte{"a": bomb, "b": bomb, "c": []byte("c")},
+		},
+		{
+			name: "Defaults",
+			// Small files are exempt from the compression ratio check.
+			entries: map[string][]byte{"a": bytes.Repeat([]byte{0}, 512<<10), "b": []byte("b")},
+			limits:  DefaultLimits,
+		},
+		{
+			name:    "TooManyEntries",
+			entries: map[string][]byte{"a": nil, "b": nil, "c/": nil},
+			limits:  Limits{MaxEntries: 2},
+			error:   ErrTooManyEntries,
+		},
+		{
+			name:    "FileTooLarge",
+			entries: map[string][]byte{"a": []byte("12345")},
+			limits:  Limits{MaxFileSize: 4},
+			error:   ErrFileTooLarge,
+		},
+		{
+			name:    "TooLarge",
+			entries: map[string][]byte{"a": []byte("123"), "b": []byte("456")},
+			limits:  Limits{MaxFileSize: 4, MaxTotalSize: 5},
+			error:   ErrTooLarge,
+		},
+		{
+			name:    "CompressionRatio",
+			entries: map[string][]byte{"a": bomb},
+			limits:  DefaultLimits,
+			error:   ErrCompressionRatio,
+		},
+		{
+			name:    "StoredBomb",
+			entries: map[string][]byte{"a": bomb},
+			store:   true,
+			limits:  DefaultLimits,
+		},
+		{
+			name:    "Duplicate",
+			entries: map[string][]byte{"a/b": nil, "a//b": nil},
+			error:   ErrDuplicateEntry,
+		},
+		{
+			name:    "DirectoryAndFile",
+			entries: map[string][]byte{"a/": nil, "a/b": nil},
+		},
+		{
+			name:    "Traversal",
+			entries: map[string][]byte{"a/../../b": nil},
+			error:   ErrUnsafePath,
+		},
+		{
+			name:    "Absolute",
+			entries: map[string][]byte{"/b": nil},
+			error:   ErrUnsafePath,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			raw := createZipWith(t, test.store, test.entries)
+			err := Validate(raw, test.limits)
+			called := false
+			extractErr := ExtractZipWithLimits(raw, test.limits, func(name string, reader io.Reader) error {
+				called = true
+				_, err := io.Copy(io.Discard, reader)
+				return err
+			})
+			if test.error == nil {
+				require.NoError(t, err)
+				require.NoError(t, extractErr)
+				return
+			}
+			for _, err := range []error{err, extractErr} {
+				require.ErrorIs(t, err, test.error)
+				var archiveErr *ArchiveError
+				require.ErrorAs(t, err, &archiveErr)
+				require.Contains(t, err.Error(), "invalid archive")
+			}
+			// Nothing should be extracted from a rejected archive.
+			require.False(t, called)
+		})
+	}
+}
+
+func TestLyingSize(t *testing.T) {
+	t.Parallel()
+
+	// Claim the file is smaller than it is to get past the size limits.
+	buf := bytes.NewBuffer(nil)
+	zw := zip.NewWriter(buf)
+	body := []byte("123456789")
+	fw, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "a",
+		Method:             zip.Store,
+		CRC32:              0,
+		CompressedSize64:   uint64(len(body)),
+		UncompressedSize64: 2,
+	})
+	require.NoError(t, err)
+	_, err = fw.Write(body)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	err = ExtractZipWithLimits(buf.Bytes(), Limits{MaxFileSize: 4}, func(name string, reader io.Reader) error {
+		_, err := io.Copy(io.Discard, reader)
+		return err
+	})
+	require.Error(t, err)
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+const featuredStateName = "featured.json"
+
+var (
+	ErrAlreadyFeatured = xerrors.New("already featured")
+	ErrNotFeatured     = xerrors.New("not featured")
+)
+
+// Featured is the ordered list of featured extension IDs (publisher.name).
+// These are returned, in order, for queries using the Featured criteria.
+type Featured []string
+
+// Index returns the position of the extension (publisher.name) in the featured
+// list or -1 if it is not featured.
+func (f Featured) Index(id string) int {
+	return slices.IndexFunc(f, func(featured string) bool {
+		return strings.EqualFold(featured, id)
+	})
+}
+
+// ReadFeatured returns the featured extensions.
+func ReadFeatured(ctx context.Context, s Storage) (Featured, error) {
+	featured := Featured{}
+	err := readStateJSON(ctx, s, featuredStateName, &featured)
+	if err != nil {
+		return nil, err
+	}
+	return featured, nil
+}
+
+// Feature adds an extension to the featured list at the provided zero-based
+// position.  A negative position or one past the end of the list appends the
+// extension.  If the extension is already featured it is moved to the position
+// instead, unless the position is negative in which case it errors.  It also
+// errors if the extension does not exist.
+func Feature(ctx context.Context, s Storage, publisher, name string, position int) error {
+	versions, err := s.Versions(ctx, publisher, name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	id := ExtensionIDWithoutVersion(publisher, name)
+	if len(versions) == 0 {
+		return xerrors.Errorf("%s: %w", id, os.ErrNotExist)
+	}
+
+	ctx, unlock := lockState(ctx, featuredStateName)
+	defer unlock()
+	featured, err := ReadFeatured(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	if index := featured.Index(id); index != -1 {
+		if position < 0 {
+			return xerrors.Errorf("%s: %w", id, ErrAlreadyFeatured)
+		}
+		featured = slices.Delete(featured, index, index+1)
+	}
+	if position < 0 || position > len(featured) {
+		position = len(featured)
+	}
+	featured = slices.Insert(featured, position, id)
+
+	return writeStateJSON(ctx, s, featuredStateName, featured)
+}
+
+// Unfeature removes an extension from the featured list.  Unlike Feature the
+// extension does not need to exist, so extensions that were removed after
+// being featured can still be cleaned up.
+func Unfeature(ctx context.Context, s Storage, publisher, name string) error {
+	ctx, unlock := lockState(ctx, featuredStateName)
+	defer unlock()
+	featured, err := ReadFeatured(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	id := ExtensionIDWithoutVersion(publisher, name)
+	index := featured.Index(id)
+	if index == -1 {
+		return xerrors.Errorf("%s: %w", id, ErrNotFeatured)
+	}
+	featured = slices.Delete(featured, index, index+1)
+
+	return writeStateJSON(ctx, s, featuredStateName, featured)
+}
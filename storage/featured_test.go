@@ -0,0 +1,144 @@
+package storage_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/code-marketplace/storage"
+	"github.com/coder/code-marketplace/testutil"
+)
+
+func TestFeatured(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		// error is the expected error of the last change, if any.
+		error error
+		// expected is the expected featured list afterward.
+		expected storage.Featured
+		// name is the name of the test.
+		name string
+		// run makes the changes under test.
+		run func(ctx context.Context, s storage.Storage) error
+	}{
+		{
+			name:     "Empty",
+			run:      func(ctx context.Context, s storage.Storage) error { return nil },
+			expected: storage.Featured{},
+		},
+		{
+			name: "Append",
+			run: func(ctx context.Context, s storage.Storage) error {
+				err := storage.Feature(ctx, s, "foo", "zany", -1)
+				if err != nil {
+					return err
+				}
+				return storage.Feature(ctx, s, "foo", "buz", -1)
+			},
+			expected: storage.Featured{"foo.zany", "foo.buz"},
+		},
+		{
+			name: "Insert",
+			run: func(ctx context.Context, s storage.Storage) error {
+				err := storage.Feature(ctx, s, "foo", "zany", -1)
+				if err != nil {
+					return err
+				}
+				err = storage.Feature(ctx, s, "foo", "buz", -1)
+				if err != nil {
+					return err
+				}
+				return storage.Feature(ctx, s, "bar", "squigly", 1)
+			},
+			expected: storage.Featured{"foo.zany", "bar.squigly", "foo.buz"},
+		},
+		{
+			name: "Move",
+			run: func(ctx context.Context, s storage.Storage) error {
+				err := storage.Feature(ctx, s, "foo", "zany", -1)
+				if err != nil {
+					return err
+				}
+				err = storage.Feature(ctx, s, "foo", "buz", -1)
+				if err != nil {
+					return err
+				}
+				return storage.Feature(ctx, s, "foo", "buz", 0)
+			},
+			expected: storage.Featured{"foo.buz", "foo.zany"},
+		},
+		{
+			name: "PastEnd",
+			run: func(ctx context.Context, s storage.Storage) error {
+				return storage.Feature(ctx, s, "foo", "zany", 10)
+			},
+			expected: storage.Featured{"foo.zany"},
+		},
+		{
+			name:  "Twice",
+			error: storage.ErrAlreadyFeatured,
+			run: func(ctx context.Context, s storage.Storage) error {
+				err := storage.Feature(ctx, s, "foo", "zany", -1)
+				if err != nil {
+					return err
+				}
+				return storage.Feature(ctx, s, "foo", "zany", -1)
+			},
+			expected: storage.Featured{"foo.zany"},
+		},
+		{
+			name:  "NoExtension",
+			error: os.ErrNotExist,
+			run: func(ctx context.Context, s storage.Storage) error {
+				return storage.Feature(ctx, s, "foo", "does-not-exist", -1)
+			},
+			expected: storage.Featured{},
+		},
+		{
+			name: "Unfeature",
+			run: func(ctx context.Context, s storage.Storage) error {
+				err := storage.Feature(ctx, s, "foo", "zany", -1)
+				if err != nil {
+					return err
+				}
+				err = storage.Feature(ctx, s, "foo", "buz", -1)
+				if err != nil {
+					return err
+				}
+				return storage.Unfeature(ctx, s, "FOO", "ZANY")
+			},
+			expected: storage.Featured{"foo.buz"},
+		},
+		{
+			name:  "UnfeatureNotFeatured",
+			error: storage.ErrNotFeatured,
+			run: func(ctx context.Context, s storage.Storage) error {
+				return storage.Unfeature(ctx, s, "foo", "zany")
+			},
+			expected: storage.Featured{},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			s := testutil.NewMockStorage()
+			err := test.run(ctx, s)
+			if test.error != nil {
+				require.ErrorIs(t, err, test.error)
+			} else {
+				require.NoError(t, err)
+			}
+
+			featured, err := storage.ReadFeatured(ctx, s)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, featured)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,12 +10,16 @@ import (
 	"path/filepath"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/xerrors"
 
 	"cdr.dev/slog"
+	"github.com/coder/code-marketplace/httpcache"
 	"github.com/coder/code-marketplace/storage/easyzip"
+	"github.com/coder/code-marketplace/tracing"
 )
 
 var _ Storage = (*Local)(nil)
@@ -24,11 +29,13 @@ var _ Storage = (*Local)(nil)
 // publisher/extension/version to easily serve individual assets via HTTP.
 type Local struct {
 	listCache      []extension
-	listDuration   time.Duration
+	listDuration   atomic.Int64
 	listExpiration time.Time
 	listMutex      sync.Mutex
 	extdir         string
 	logger         slog.Logger
+	tracer         trace.Tracer
+	zipLimits      easyzip.Limits
 }
 
 type LocalOptions struct {
@@ -36,6 +43,12 @@ type LocalOptions struct {
 	// no cache.
 	ListCacheDuration time.Duration
 	ExtDir            string
+	// ZipLimits bound the archives that can be added.  Defaults to
+	// easyzip.DefaultLimits.
+	ZipLimits *easyzip.Limits
+	// TracerProvider receives spans for manifest reads.  Defaults to discarding
+	// them.
+	TracerProvider trace.TracerProvider
 }
 
 func NewLocalStorage(options *LocalOptions, logger slog.Logger) (*Local, error) {
@@ -43,13 +56,16 @@ func NewLocalStorage(options *LocalOptions, logger slog.Logger) (*Local, error)
 	if err != nil {
 		return nil, err
 	}
-	return &Local{
+	s := &Local{
 		// TODO: Eject the cache when adding/removing extensions and/or add a
 		// command to eject the cache?
-		extdir:       extdir,
-		listDuration: options.ListCacheDuration,
-		logger:       logger,
-	}, nil
+		extdir:    extdir,
+		logger:    logger,
+		tracer:    tracing.Tracer(options.TracerProvider),
+		zipLimits: zipLimits(options.ZipLimits),
+	}
+	s.listDuration.Store(int64(options.ListCacheDuration))
+	return s, nil
 }
 
 func (s *Local) list(ctx context.Context) []extension {
@@ -59,6 +75,9 @@ func (s *Local) list(ctx context.Context) []extension {
 		s.logger.Error(ctx, "Error reading publisher", slog.Error(err))
 	}
 	for _, publisher := range publishers {
+		if isReserved(publisher) {
+			continue
+		}
 		ctx := slog.With(ctx, slog.F("publisher", publisher))
 		dir := filepath.Join(s.extdir, publisher)
 
@@ -94,8 +113,15 @@ func (s *Local) list(ctx context.Context) []extension {
 	return list
 }
 
-
 func (s *Local) AddExtension(ctx context.Context, manifest *VSIXManifest, vsix []byte, extra ...File) (string, error) {
+	if err := validateAddition(vsix, s.zipLimits, extra); err != nil {
+		return "", err
+	}
+	checksums, err := computeChecksums(manifest, vsix, s.zipLimits, extra)
+	if err != nil {
+		return "", err
+	}
+
 	// Extract the zip to the correct path.
 	identity := manifest.Metadata.Identity
 	dir := filepath.Join(s.extdir, identity.Publisher, identity.ID, Version{
@@ -115,7 +141,7 @@ func (s *Local) AddExtension(ctx context.Context, manifest *VSIXManifest, vsix [
 	}
 	defer root.Close()
 
-	err = easyzip.ExtractZip(vsix, func(name string, r io.Reader) error {
+	err = easyzip.ExtractZipWithLimits(vsix, s.zipLimits, func(name string, r io.Reader) error {
 		if err := root.MkdirAll(filepath.Dir(name), 0o755); err != nil {
 			return err
 		}
@@ -158,14 +184,55 @@ func (s *Local) AddExtension(ctx context.Context, manifest *VSIXManifest, vsix [
 		}
 	}
 
+	if err := writeChecksums(ctx, s, manifest, checksums); err != nil {
+		return dir, err
+	}
+
 	return dir, nil
 }
 
 func (s *Local) FileServer() http.Handler {
-	return http.FileServer(http.Dir(s.extdir))
+	fs := http.FileServer(http.Dir(s.extdir))
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		filePath := cleanFilePath(r.URL.Path)
+		if isReserved(filePath) {
+			http.NotFound(rw, r)
+			return
+		}
+		// The file server handles If-None-Match once the ETag is set.
+		etag, err := FileETag(r.Context(), s, filePath)
+		if err != nil {
+			s.logger.Warn(r.Context(), "Unable to read checksums", slog.Error(err))
+		} else if etag != "" {
+			rw.Header().Set("ETag", etag)
+			// Re-adding a version can change its files without changing their
+			// URLs, so clients must revalidate rather than cache them forever.
+			rw.Header().Set("Cache-Control", httpcache.RevalidateCacheControl)
+		}
+		fs.ServeHTTP(rw, r)
+	})
+}
+
+// Health checks that the extension directory can be read.
+func (s *Local) Health(ctx context.Context) error {
+	dir, err := os.Open(s.extdir)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	_, err = dir.Readdirnames(1)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
 }
 
-func (s *Local) Manifest(ctx context.Context, publisher, name string, version Version) (*VSIXManifest, error) {
+func (s *Local) Manifest(ctx context.Context, publisher, name string, version Version) (_ *VSIXManifest, err error) {
+	ctx, span := startManifestSpan(ctx, s.tracer, publisher, name, version)
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	reader, err := os.Open(filepath.Join(s.extdir, publisher, name, version.String(), "extension.vsixmanifest"))
 	if err != nil {
 		return nil, err
@@ -190,15 +257,78 @@ func (s *Local) Manifest(ctx context.Context, publisher, name string, version Ve
 	return manifest, nil
 }
 
+func (s *Local) Open(ctx context.Context, publisher, name string, version Version, path string) (io.ReadCloser, error) {
+	if err := validateFilePath(path); err != nil {
+		return nil, err
+	}
+	return os.Open(filepath.Join(s.extdir, publisher, name, version.String(), filepath.FromSlash(path)))
+}
+
+func (s *Local) ReadState(ctx context.Context, name string) ([]byte, error) {
+	if err := validateStateName(name); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(filepath.Join(s.extdir, stateDir, filepath.FromSlash(name)))
+}
+
 func (s *Local) RemoveExtension(ctx context.Context, publisher, name string, version Version) error {
-	dir := filepath.Join(s.extdir, publisher, name, version.String())
-	// RemoveAll() will not error if the directory does not exist so check first
-	// as this function should error when removing versions that do not exist.
-	_, err := os.Stat(dir)
+	if err := validateExtensionDir(publisher, name); err != nil {
+		return err
+	}
+	dir := filepath.Join(s.extdir, publisher, name)
+	if version.Version == "" && version.TargetPlatform == "" {
+		// RemoveAll() will not error if the directory does not exist so check
+		// first as this function should error when removing extensions that do
+		// not exist.
+		_, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+		versions, err := s.Versions(ctx, publisher, name)
+		if err != nil {
+			return err
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		return removeChecksums(ctx, s, publisher, name, versions)
+	}
+
+	versions, err := s.Versions(ctx, publisher, name)
 	if err != nil {
 		return err
 	}
-	return os.RemoveAll(dir)
+	matched := MatchVersions(versions, version)
+	if len(matched) == 0 {
+		return xerrors.Errorf("%s: %w", ExtensionVSIXName(publisher, name, version), os.ErrNotExist)
+	}
+	for _, v := range matched {
+		err := os.RemoveAll(filepath.Join(dir, v.String()))
+		if err != nil {
+			return err
+		}
+	}
+	return removeChecksums(ctx, s, publisher, name, matched)
+}
+
+func (s *Local) RemoveState(ctx context.Context, name string) error {
+	if err := validateStateName(name); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(s.extdir, stateDir, filepath.FromSlash(name)))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *Local) SetListCacheDuration(duration time.Duration) {
+	s.listMutex.Lock()
+	defer s.listMutex.Unlock()
+	s.listDuration.Store(int64(duration))
+	if expiration := time.Now().Add(duration); expiration.Before(s.listExpiration) {
+		s.listExpiration = expiration
+	}
 }
 
 func (s *Local) Versions(ctx context.Context, publisher, name string) ([]Version, error) {
@@ -217,7 +347,7 @@ func (s *Local) listWithCache(ctx context.Context) []extension {
 	s.listMutex.Lock()
 	defer s.listMutex.Unlock()
 	if s.listCache == nil || time.Now().After(s.listExpiration) {
-		s.listExpiration = time.Now().Add(s.listDuration)
+		s.listExpiration = time.Now().Add(time.Duration(s.listDuration.Load()))
 		s.listCache = s.list(ctx)
 	}
 	return s.listCache
@@ -235,6 +365,31 @@ func (s *Local) WalkExtensions(ctx context.Context, fn func(manifest *VSIXManife
 	return nil
 }
 
+func (s *Local) WriteState(ctx context.Context, name string, content []byte) error {
+	if err := validateStateName(name); err != nil {
+		return err
+	}
+	dest := filepath.Join(s.extdir, stateDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	// Write to a temporary file first then rename so readers never see a
+	// partially written file.
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
 // getDirNames get the names of directories in the provided directory.  If an
 // error is occured it will be returned along with any directories that were
 // able to be read.
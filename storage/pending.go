@@ -0,0 +1,270 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	pendingStateName = "pending.json"
+	reviewsStateName = "reviews.json"
+	// pendingDir holds the VSIX and extra files of each pending extension,
+	// relative to the state directory.
+	pendingDir = "pending"
+)
+
+var ErrSelfApproval = xerrors.New("cannot approve your own submission")
+
+// PendingExtension is a version of an extension that was submitted but is not
+// available until it is approved.
+type PendingExtension struct {
+	Publisher      string    `json:"publisher"`
+	Name           string    `json:"name"`
+	Version        string    `json:"version"`
+	TargetPlatform Platform  `json:"targetPlatform,omitempty"`
+	SHA256         string    `json:"sha256"`
+	SubmittedBy    string    `json:"submittedBy"`
+	SubmittedAt    time.Time `json:"submittedAt"`
+	// Files are the relative paths of extra files, like signatures, that are
+	// added alongside the extension when it is approved.
+	Files []string `json:"files,omitempty"`
+}
+
+func (p *PendingExtension) version() Version {
+	return Version{Version: p.Version, TargetPlatform: p.TargetPlatform}
+}
+
+// ID returns the ID used to approve or reject the pending extension, for
+// example publisher.name@1.0.0 or publisher.name@1.0.0@linux-x64.
+func (p *PendingExtension) ID() string {
+	return ExtensionIDWithoutVersion(p.Publisher, p.Name) + "@" + p.version().String()
+}
+
+// dir returns the directory, relative to the state directory, that holds the
+// pending extension's files.
+func (p *PendingExtension) dir() string {
+	return path.Join(pendingDir, ExtensionVSIXName(p.Publisher, p.Name, p.version()))
+}
+
+// Pending maps the IDs of pending extensions to their details.
+type Pending map[string]*PendingExtension
+
+// Sorted returns the pending extensions ordered by when they were submitted.
+func (p Pending) Sorted() []*PendingExtension {
+	sorted := make([]*PendingExtension, 0, len(p))
+	for _, ext := range p {
+		sorted = append(sorted, ext)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if !sorted[i].SubmittedAt.Equal(sorted[j].SubmittedAt) {
+			return sorted[i].SubmittedAt.Before(sorted[j].SubmittedAt)
+		}
+		return sorted[i].ID() < sorted[j].ID()
+	})
+	return sorted
+}
+
+// Review records the approval or rejection of a pending extension.
+type Review struct {
+	PendingExtension
+	Approved   bool      `json:"approved"`
+	ReviewedBy string    `json:"reviewedBy"`
+	ReviewedAt time.Time `json:"reviewedAt"`
+	Reason     string    `json:"reason,omitempty"`
+}
+
+// ReadPending returns the extensions awaiting approval.
+func ReadPending(ctx context.Context, s Storage) (Pending, error) {
+	pending := Pending{}
+	err := readStateJSON(ctx, s, pendingStateName, &pending)
+	if err != nil {
+		return nil, err
+	}
+	return pending, nil
+}
+
+// ReadReviews returns every approval and rejection in the order they were
+// made.
+func ReadReviews(ctx context.Context, s Storage) ([]Review, error) {
+	reviews := []Review{}
+	err := readStateJSON(ctx, s, reviewsStateName, &reviews)
+	if err != nil {
+		return nil, err
+	}
+	return reviews, nil
+}
+
+// AddPending stores an extension in the pending area, which is neither walked
+// nor served, until it is approved with ApprovePending.  The submitter must be
+// authenticated, like with an admin token, since it is what keeps them from
+// approving the extension themselves.  Submitting a version that is already
+// pending replaces it.  It returns the pending extension's ID.
+func AddPending(ctx context.Context, s Storage, submitter string, manifest *VSIXManifest, vsix []byte, extra ...File) (string, error) {
+	if submitter == "" {
+		return "", xerrors.New("a submitter is required")
+	}
+	identity := manifest.Metadata.Identity
+	sum := sha256.Sum256(vsix)
+	ext := &PendingExtension{
+		Publisher:      identity.Publisher,
+		Name:           identity.ID,
+		Version:        identity.Version,
+		TargetPlatform: identity.TargetPlatform,
+		SHA256:         hex.EncodeToString(sum[:]),
+		SubmittedBy:    submitter,
+		SubmittedAt:    time.Now().UTC(),
+	}
+	if ext.version().IsUniversal() {
+		ext.TargetPlatform = ""
+	}
+
+	// Write the files first so the extension is never listed without them.
+	err := s.WriteState(ctx, path.Join(ext.dir(), "extension.vsix"), vsix)
+	if err != nil {
+		return "", xerrors.Errorf("write pending extension: %w", err)
+	}
+	for _, file := range extra {
+		err = s.WriteState(ctx, path.Join(ext.dir(), "extra", file.RelativePath), file.Content)
+		if err != nil {
+			return "", xerrors.Errorf("write pending extension: %w", err)
+		}
+		ext.Files = append(ext.Files, file.RelativePath)
+	}
+
+	ctx, unlock := lockState(ctx, pendingStateName)
+	defer unlock()
+	pending, err := ReadPending(ctx, s)
+	if err != nil {
+		return "", err
+	}
+	pending[ext.ID()] = ext
+	err = writeStateJSON(ctx, s, pendingStateName, pending)
+	if err != nil {
+		return "", err
+	}
+	return ext.ID(), nil
+}
+
+// ApprovePending adds the pending extension to the marketplace and records who
+// approved it.  The approver must be authenticated, like with an admin token,
+// and it errors with ErrSelfApproval if they submitted the extension.  It errors
+// with os.ErrNotExist if there is no such pending extension and returns the
+// location the extension was added to.
+func ApprovePending(ctx context.Context, s Storage, id, approver string) (string, error) {
+	if approver == "" {
+		return "", xerrors.Errorf("%s: an approver is required", id)
+	}
+	// Reviews are only recorded while the pending list is locked so it covers
+	// both.
+	ctx, unlock := lockState(ctx, pendingStateName)
+	defer unlock()
+	pending, ext, err := findPending(ctx, s, id)
+	if err != nil {
+		return "", err
+	}
+	if approver == ext.SubmittedBy {
+		return "", xerrors.Errorf("%s: %w", id, ErrSelfApproval)
+	}
+
+	vsix, err := s.ReadState(ctx, path.Join(ext.dir(), "extension.vsix"))
+	if err != nil {
+		return "", xerrors.Errorf("read pending extension: %w", err)
+	}
+	// Guard against the files changing since they were submitted.
+	sum := sha256.Sum256(vsix)
+	if hex.EncodeToString(sum[:]) != ext.SHA256 {
+		return "", xerrors.Errorf("%s has changed since it was submitted", id)
+	}
+	manifest, err := ReadVSIXManifest(vsix)
+	if err != nil {
+		return "", err
+	}
+	extra := []File{}
+	for _, name := range ext.Files {
+		content, err := s.ReadState(ctx, path.Join(ext.dir(), "extra", name))
+		if err != nil {
+			return "", xerrors.Errorf("read pending extension: %w", err)
+		}
+		extra = append(extra, File{RelativePath: name, Content: content})
+	}
+
+	location, err := s.AddExtension(ctx, manifest, vsix, extra...)
+	if err != nil {
+		return "", err
+	}
+
+	err = finishReview(ctx, s, pending, ext, Review{Approved: true, ReviewedBy: approver})
+	if err != nil {
+		return "", err
+	}
+	return location, nil
+}
+
+// RejectPending discards the pending extension and records who rejected it and
+// why.  It errors with os.ErrNotExist if there is no such pending extension.
+func RejectPending(ctx context.Context, s Storage, id, reviewer, reason string) error {
+	ctx, unlock := lockState(ctx, pendingStateName)
+	defer unlock()
+	pending, ext, err := findPending(ctx, s, id)
+	if err != nil {
+		return err
+	}
+	return finishReview(ctx, s, pending, ext, Review{ReviewedBy: reviewer, Reason: reason})
+}
+
+// findPending returns the pending extension with the ID, which is parsed so
+// that platforms are matched the same way everywhere else.
+func findPending(ctx context.Context, s Storage, id string) (Pending, *PendingExtension, error) {
+	publisher, name, version, err := ParseExtensionIDWithPlatform(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if version.IsUniversal() {
+		version.TargetPlatform = ""
+	}
+	pending, err := ReadPending(ctx, s)
+	if err != nil {
+		return nil, nil, err
+	}
+	ext, ok := pending[ExtensionIDWithoutVersion(publisher, name)+"@"+version.String()]
+	if !ok {
+		return nil, nil, xerrors.Errorf("pending %s: %w", id, os.ErrNotExist)
+	}
+	return pending, ext, nil
+}
+
+// finishReview records the review and removes the pending extension.
+func finishReview(ctx context.Context, s Storage, pending Pending, ext *PendingExtension, review Review) error {
+	reviews, err := ReadReviews(ctx, s)
+	if err != nil {
+		return err
+	}
+	review.PendingExtension = *ext
+	review.ReviewedAt = time.Now().UTC()
+	reviews = append(reviews, review)
+	err = writeStateJSON(ctx, s, reviewsStateName, reviews)
+	if err != nil {
+		return err
+	}
+
+	delete(pending, ext.ID())
+	err = writeStateJSON(ctx, s, pendingStateName, pending)
+	if err != nil {
+		return err
+	}
+
+	// The extension is no longer listed so failing to clean up its files only
+	// leaves garbage behind and should not fail a review that already happened.
+	for _, name := range ext.Files {
+		_ = s.RemoveState(ctx, path.Join(ext.dir(), "extra", name))
+	}
+	_ = s.RemoveState(ctx, path.Join(ext.dir(), "extension.vsix"))
+	return nil
+}
@@ -0,0 +1,192 @@
+package storage_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"cdr.dev/slog/sloggers/slogtest"
+	"github.com/coder/code-marketplace/storage"
+	"github.com/coder/code-marketplace/testutil"
+)
+
+func TestPending(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	newStorage := func(t *testing.T) storage.Storage {
+		logger := slogtest.Make(t, &slogtest.Options{IgnoreErrors: true})
+		s, err := storage.NewLocalStorage(&storage.LocalOptions{ExtDir: t.TempDir()}, logger)
+		require.NoError(t, err)
+		return s
+	}
+	ext := testutil.Extensions[0]
+	submit := func(t *testing.T, s storage.Storage, version storage.Version, extra ...storage.File) (string, []byte) {
+		manifest := testutil.ConvertExtensionToManifest(ext, version)
+		vsix := testutil.CreateVSIXFromManifest(t, manifest)
+		id, err := storage.AddPending(ctx, s, "alice", manifest, vsix, extra...)
+		require.NoError(t, err)
+		return id, vsix
+	}
+
+	t.Run("Hidden", func(t *testing.T) {
+		t.Parallel()
+
+		s := newStorage(t)
+		id, vsix := submit(t, s, storage.Version{Version: "1.0.0", TargetPlatform: storage.PlatformLinuxX64})
+		require.Equal(t, "foo.zany@1.0.0@linux-x64", id)
+
+		pending, err := storage.ReadPending(ctx, s)
+		require.NoError(t, err)
+		sorted := pending.Sorted()
+		require.Len(t, sorted, 1)
+		require.Equal(t, "foo.zany@1.0.0@linux-x64", sorted[0].ID())
+		require.Equal(t, "alice", sorted[0].SubmittedBy)
+		sum := sha256.Sum256(vsix)
+		require.Equal(t, hex.EncodeToString(sum[:]), sorted[0].SHA256)
+
+		// Pending extensions are not walked, listed, or served.
+		err = s.WalkExtensions(ctx, func(manifest *storage.VSIXManifest, versions []storage.Version) error {
+			t.Fatalf("unexpected extension %s", storage.ExtensionIDFromManifest(manifest))
+			return nil
+		})
+		require.NoError(t, err)
+		_, err = s.Versions(ctx, ext.Publisher, ext.Name)
+		require.Error(t, err)
+		for _, path := range []string{
+			"/foo/zany/1.0.0@linux-x64/extension.vsixmanifest",
+			"/.marketplace/pending/foo.zany-1.0.0@linux-x64/extension.vsix",
+		} {
+			rec := httptest.NewRecorder()
+			s.FileServer().ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+			require.Equal(t, http.StatusNotFound, rec.Code)
+		}
+	})
+
+	t.Run("Approve", func(t *testing.T) {
+		t.Parallel()
+
+		s := newStorage(t)
+		signature := storage.File{RelativePath: "signature.p7s", Content: []byte("signed")}
+		submit(t, s, storage.Version{Version: "1.0.0"}, signature)
+		submit(t, s, storage.Version{Version: "2.0.0"})
+
+		// The submitter cannot approve their own extension.
+		_, err := storage.ApprovePending(ctx, s, "foo.zany@1.0.0", "alice")
+		require.ErrorIs(t, err, storage.ErrSelfApproval)
+
+		location, err := storage.ApprovePending(ctx, s, "foo.zany@1.0.0", "bob")
+		require.NoError(t, err)
+		require.NotEmpty(t, location)
+
+		versions, err := s.Versions(ctx, ext.Publisher, ext.Name)
+		require.NoError(t, err)
+		require.Equal(t, []storage.Version{{Version: "1.0.0"}}, versions)
+		reader, err := s.Open(ctx, ext.Publisher, ext.Name, storage.Version{Version: "1.0.0"}, "signature.p7s")
+		require.NoError(t, err)
+		_ = reader.Close()
+
+		pending, err := storage.ReadPending(ctx, s)
+		require.NoError(t, err)
+		require.Len(t, pending, 1)
+		require.Contains(t, pending, "foo.zany@2.0.0")
+
+		reviews, err := storage.ReadReviews(ctx, s)
+		require.NoError(t, err)
+		require.Len(t, reviews, 1)
+		require.True(t, reviews[0].Approved)
+		require.Equal(t, "bob", reviews[0].ReviewedBy)
+		require.Equal(t, "alice", reviews[0].SubmittedBy)
+		require.Equal(t, "1.0.0", reviews[0].Version)
+		require.False(t, reviews[0].ReviewedAt.IsZero())
+
+		// The files are cleaned up.
+		_, err = s.ReadState(ctx, "pending/foo.zany-1.0.0/extension.vsix")
+		require.ErrorIs(t, err, os.ErrNotExist)
+
+		// It cannot be approved twice.
+		_, err = storage.ApprovePending(ctx, s, "foo.zany@1.0.0", "bob")
+		require.ErrorIs(t, err, os.ErrNotExist)
+
+		// Someone has to approve it.
+		_, err = storage.ApprovePending(ctx, s, "foo.zany@2.0.0", "")
+		require.Error(t, err)
+		pending, err = storage.ReadPending(ctx, s)
+		require.NoError(t, err)
+		require.Contains(t, pending, "foo.zany@2.0.0")
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		t.Parallel()
+
+		s := newStorage(t)
+		submit(t, s, storage.Version{Version: "1.0.0", TargetPlatform: storage.PlatformWin32X64})
+
+		// The submitter can withdraw their own extension.
+		err := storage.RejectPending(ctx, s, "foo.zany@1.0.0@win32-x64", "alice", "wrong build")
+		require.NoError(t, err)
+
+		_, err = s.Versions(ctx, ext.Publisher, ext.Name)
+		require.Error(t, err)
+		pending, err := storage.ReadPending(ctx, s)
+		require.NoError(t, err)
+		require.Empty(t, pending)
+
+		reviews, err := storage.ReadReviews(ctx, s)
+		require.NoError(t, err)
+		require.Len(t, reviews, 1)
+		require.False(t, reviews[0].Approved)
+		require.Equal(t, "wrong build", reviews[0].Reason)
+		require.Equal(t, storage.PlatformWin32X64, reviews[0].TargetPlatform)
+	})
+
+	t.Run("NotExist", func(t *testing.T) {
+		t.Parallel()
+
+		s := newStorage(t)
+		submit(t, s, storage.Version{Version: "1.0.0", TargetPlatform: storage.PlatformWin32X64})
+
+		for _, id := range []string{"foo.zany@1.0.0", "foo.zany@1.0.0@universal", "foo.zany@2.0.0@win32-x64", "foo.nope@1.0.0"} {
+			_, err := storage.ApprovePending(ctx, s, id, "bob")
+			require.ErrorIs(t, err, os.ErrNotExist, id)
+			err = storage.RejectPending(ctx, s, id, "bob", "")
+			require.ErrorIs(t, err, os.ErrNotExist, id)
+		}
+
+		_, err := storage.ApprovePending(ctx, s, "foo", "bob")
+		require.Error(t, err)
+	})
+
+	t.Run("Anonymous", func(t *testing.T) {
+		t.Parallel()
+
+		s := newStorage(t)
+		manifest := testutil.ConvertExtensionToManifest(ext, storage.Version{Version: "1.0.0"})
+		_, err := storage.AddPending(ctx, s, "", manifest, testutil.CreateVSIXFromManifest(t, manifest))
+		require.Error(t, err)
+
+		pending, err := storage.ReadPending(ctx, s)
+		require.NoError(t, err)
+		require.Empty(t, pending)
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		t.Parallel()
+
+		s := newStorage(t)
+		submit(t, s, storage.Version{Version: "1.0.0"})
+		other := testutil.CreateVSIXFromExtension(t, ext, storage.Version{Version: "1.0.0", TargetPlatform: storage.PlatformWeb})
+		err := s.WriteState(ctx, "pending/foo.zany-1.0.0/extension.vsix", other)
+		require.NoError(t, err)
+
+		_, err = storage.ApprovePending(ctx, s, "foo.zany@1.0.0", "bob")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "changed since it was submitted")
+	})
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"slices"
+
+	"golang.org/x/xerrors"
+)
+
+// Platforms lists every specific platform an extension can target.
+var Platforms = []Platform{
+	PlatformWin32X64,
+	PlatformWin32Ia32,
+	PlatformWin32Arm64,
+	PlatformLinuxX64,
+	PlatformLinuxArm64,
+	PlatformLinuxArmhf,
+	PlatformAlpineX64,
+	PlatformAlpineArm64,
+	PlatformDarwinX64,
+	PlatformDarwinArm64,
+	PlatformWeb,
+}
+
+// platformFallbacks maps platforms to other platforms whose builds also run on
+// them, in order of preference.  Alpine can run glibc builds through a
+// compatibility layer, Windows on Arm can emulate x64, and macOS on Apple
+// silicon can run x64 builds through Rosetta.
+var platformFallbacks = map[Platform][]Platform{
+	PlatformAlpineX64:   {PlatformLinuxX64},
+	PlatformAlpineArm64: {PlatformLinuxArm64},
+	PlatformWin32Arm64:  {PlatformWin32X64},
+	PlatformDarwinArm64: {PlatformDarwinX64},
+}
+
+// Compatible returns the platforms whose builds can be installed on this
+// platform in order of preference: the platform itself, then its fallbacks,
+// then universal.
+func (p Platform) Compatible() []Platform {
+	if (Version{TargetPlatform: p}).IsUniversal() {
+		return []Platform{PlatformUniversal}
+	}
+	compatible := []Platform{p}
+	compatible = append(compatible, platformFallbacks[p]...)
+	return append(compatible, PlatformUniversal)
+}
+
+// ResolveVersion returns the build of the version best suited to the platform
+// out of the provided versions.  A build for the platform itself is preferred,
+// then a build for one of its fallbacks, then a universal build.
+func ResolveVersion(versions []Version, version string, platform Platform) (Version, bool) {
+	for _, compatible := range platform.Compatible() {
+		for _, v := range versions {
+			if v.Version != version {
+				continue
+			}
+			if v.TargetPlatform == compatible || (compatible == PlatformUniversal && v.IsUniversal()) {
+				return v, true
+			}
+		}
+	}
+	return Version{}, false
+}
+
+// ValidatePlatform errors if the platform is not blank, universal, or one of
+// Platforms.
+func ValidatePlatform(platform Platform) error {
+	if (Version{TargetPlatform: platform}).IsUniversal() || slices.Contains(Platforms, platform) {
+		return nil
+	}
+	return xerrors.Errorf("%q is not a valid platform", platform)
+}
+
+// MatchVersions returns the builds out of versions that the target refers to.
+// A blank version matches every version and a blank platform matches every
+// platform, while an explicitly universal platform only matches universal
+// builds.
+func MatchVersions(versions []Version, target Version) []Version {
+	matched := []Version{}
+	for _, version := range versions {
+		if target.Version != "" && version.Version != target.Version {
+			continue
+		}
+		switch {
+		case target.TargetPlatform == "":
+		case target.IsUniversal():
+			if !version.IsUniversal() {
+				continue
+			}
+		case version.TargetPlatform != target.TargetPlatform:
+			continue
+		}
+		matched = append(matched, version)
+	}
+	return matched
+}
@@ -0,0 +1,153 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/code-marketplace/storage"
+)
+
+func TestResolveVersion(t *testing.T) {
+	t.Parallel()
+
+	versions := []storage.Version{
+		{Version: "2.0.0", TargetPlatform: storage.PlatformLinuxX64},
+		{Version: "2.0.0", TargetPlatform: storage.PlatformAlpineArm64},
+		{Version: "2.0.0"},
+		{Version: "1.0.0", TargetPlatform: storage.PlatformLinuxX64},
+		{Version: "1.0.0", TargetPlatform: storage.PlatformDarwinX64},
+	}
+
+	tests := []struct {
+		name     string
+		version  string
+		platform storage.Platform
+		expected storage.Version
+		ok       bool
+	}{
+		{
+			name:     "Exact",
+			version:  "2.0.0",
+			platform: storage.PlatformLinuxX64,
+			expected: storage.Version{Version: "2.0.0", TargetPlatform: storage.PlatformLinuxX64},
+			ok:       true,
+		},
+		{
+			name:     "ExactOverFallback",
+			version:  "2.0.0",
+			platform: storage.PlatformAlpineArm64,
+			expected: storage.Version{Version: "2.0.0", TargetPlatform: storage.PlatformAlpineArm64},
+			ok:       true,
+		},
+		{
+			name:     "Fallback",
+			version:  "2.0.0",
+			platform: storage.PlatformAlpineX64,
+			expected: storage.Version{Version: "2.0.0", TargetPlatform: storage.PlatformLinuxX64},
+			ok:       true,
+		},
+		{
+			name:     "FallbackOverUniversal",
+			version:  "1.0.0",
+			platform: storage.PlatformDarwinArm64,
+			expected: storage.Version{Version: "1.0.0", TargetPlatform: storage.PlatformDarwinX64},
+			ok:       true,
+		},
+		{
+			name:     "Universal",
+			version:  "2.0.0",
+			platform: storage.PlatformLinuxArm64,
+			expected: storage.Version{Version: "2.0.0"},
+			ok:       true,
+		},
+		{
+			name:     "NoPlatform",
+			version:  "2.0.0",
+			expected: storage.Version{Version: "2.0.0"},
+			ok:       true,
+		},
+		{
+			name:     "NoCompatibleBuild",
+			version:  "1.0.0",
+			platform: storage.PlatformWin32X64,
+		},
+		{
+			name:     "NoUniversalBuild",
+			version:  "1.0.0",
+			platform: storage.PlatformUniversal,
+		},
+		{
+			name:     "NoVersion",
+			version:  "3.0.0",
+			platform: storage.PlatformLinuxX64,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			version, ok := storage.ResolveVersion(versions, test.version, test.platform)
+			require.Equal(t, test.ok, ok)
+			require.Equal(t, test.expected, version)
+		})
+	}
+}
+
+func TestMatchVersions(t *testing.T) {
+	t.Parallel()
+
+	versions := []storage.Version{
+		{Version: "2.0.0"},
+		{Version: "2.0.0", TargetPlatform: storage.PlatformLinuxX64},
+		{Version: "1.0.0"},
+		{Version: "1.0.0", TargetPlatform: storage.PlatformLinuxX64},
+		{Version: "1.0.0", TargetPlatform: storage.PlatformWeb},
+	}
+
+	tests := []struct {
+		name     string
+		target   storage.Version
+		expected []storage.Version
+	}{
+		{
+			name:     "All",
+			target:   storage.Version{},
+			expected: versions,
+		},
+		{
+			name:     "AllPlatforms",
+			target:   storage.Version{Version: "2.0.0"},
+			expected: versions[:2],
+		},
+		{
+			name:     "Universal",
+			target:   storage.Version{Version: "1.0.0", TargetPlatform: storage.PlatformUniversal},
+			expected: versions[2:3],
+		},
+		{
+			name:     "Platform",
+			target:   storage.Version{Version: "1.0.0", TargetPlatform: storage.PlatformWeb},
+			expected: versions[4:],
+		},
+		{
+			name:     "PlatformAllVersions",
+			target:   storage.Version{TargetPlatform: storage.PlatformLinuxX64},
+			expected: []storage.Version{versions[1], versions[3]},
+		},
+		{
+			name:     "NoMatch",
+			target:   storage.Version{Version: "2.0.0", TargetPlatform: storage.PlatformWeb},
+			expected: []storage.Version{},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, test.expected, storage.MatchVersions(versions, test.target))
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ManifestConcurrencyDefault is the default number of manifests fetched from
+// remote storage at the same time.
+const ManifestConcurrencyDefault = 16
+
+// seedProgressInterval is how often seeding progress is logged.
+const seedProgressInterval = 10 * time.Second
+
+// Seeder is implemented by storage that keeps a cache of remote manifests that
+// can be filled ahead of time.
+type Seeder interface {
+	// Seed fills the cache and blocks until it is done.  Until then Health
+	// reports the storage as not ready and WalkExtensions only includes
+	// extensions that have been cached.  It can be called again if it fails.
+	Seed(ctx context.Context) error
+	// SeedStatus reports the progress of Seed.
+	SeedStatus() *SeedStatus
+}
+
+// Seed seeds the storage if it or a storage it wraps is a Seeder and otherwise
+// returns immediately.
+func Seed(ctx context.Context, s Storage) error {
+	if seeder, ok := find[Seeder](s); ok {
+		return seeder.Seed(ctx)
+	}
+	return nil
+}
+
+// SeedProgress returns the progress of seeding the storage, or nil if neither
+// it nor a storage it wraps is a Seeder and there is nothing to seed.
+func SeedProgress(s Storage) *SeedStatus {
+	if seeder, ok := find[Seeder](s); ok {
+		return seeder.SeedStatus()
+	}
+	return nil
+}
+
+// SeedState is the state of seeding a storage's cache.
+type SeedState string
+
+const (
+	// SeedPending means seeding has not started yet.
+	SeedPending SeedState = "pending"
+	// Seeding means the cache is being seeded.  Queries are answered from
+	// whatever has been cached so far.
+	Seeding SeedState = "seeding"
+	// SeedDone means seeding finished, although some manifests may have failed
+	// to be read.
+	SeedDone SeedState = "done"
+	// SeedFailed means seeding was interrupted or the extensions could not be
+	// listed.  Seeding can be started again.
+	SeedFailed SeedState = "failed"
+)
+
+// SeedStatus reports the progress of seeding a storage's cache.
+type SeedStatus struct {
+	State SeedState `json:"state"`
+	// Total is the number of manifests to seed.  It is zero until the
+	// extensions have been listed.
+	Total int `json:"total"`
+	// Seeded is the number of manifests read so far, including ones that
+	// failed.
+	Seeded int `json:"seeded"`
+	// Errors is the number of manifests that could not be read, plus one if the
+	// extensions could not be listed.
+	Errors int `json:"errors"`
+	// Error is why seeding failed.
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"startedAt,omitzero"`
+	FinishedAt time.Time `json:"finishedAt,omitzero"`
+	// ETA estimates when seeding will finish from the rate so far.
+	ETA time.Time `json:"eta,omitzero"`
+}
+
+// seedProgress tracks a SeedStatus while seeding runs.
+type seedProgress struct {
+	mutex  sync.Mutex
+	status SeedStatus
+}
+
+func newSeedProgress() *seedProgress {
+	return &seedProgress{status: SeedStatus{State: SeedPending}}
+}
+
+// start marks seeding as started, starting over if it failed before.  It
+// returns false if seeding is in progress or done.
+func (p *seedProgress) start() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.status.State != SeedPending && p.status.State != SeedFailed {
+		return false
+	}
+	p.status = SeedStatus{State: Seeding, StartedAt: time.Now()}
+	return true
+}
+
+func (p *seedProgress) setTotal(total int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.status.Total = total
+}
+
+// add records a manifest as read.
+func (p *seedProgress) add(failed bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.status.Seeded++
+	if failed {
+		p.status.Errors++
+	}
+}
+
+// addError records an error that is not tied to a single manifest.
+func (p *seedProgress) addError() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.status.Errors++
+}
+
+// finish marks seeding as done, or failed if there is an error.
+func (p *seedProgress) finish(err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.status.State = SeedDone
+	if err != nil {
+		p.status.State = SeedFailed
+		p.status.Error = err.Error()
+	}
+	p.status.FinishedAt = time.Now()
+}
+
+// get returns a copy of the status with an up to date ETA.
+func (p *seedProgress) get() SeedStatus {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	status := p.status
+	if status.State == Seeding && status.Seeded > 0 {
+		elapsed := time.Since(status.StartedAt)
+		remaining := time.Duration(status.Total-status.Seeded) * elapsed / time.Duration(status.Seeded)
+		status.ETA = time.Now().Add(remaining)
+	}
+	return status
+}
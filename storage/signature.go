@@ -13,7 +13,10 @@ import (
 	"github.com/coder/code-marketplace/extensionsign"
 )
 
-var _ Storage = (*Signature)(nil)
+var (
+	_ Storage   = (*Signature)(nil)
+	_ Unwrapper = (*Signature)(nil)
+)
 
 const (
 	SigzipFileExtension = ".signature.p7s"
@@ -42,6 +45,11 @@ func NewSignatureStorage(logger slog.Logger, includeEmptySignatures bool, s Stor
 	}
 }
 
+// Unwrap returns the wrapped storage.
+func (s *Signature) Unwrap() Storage {
+	return s.Storage
+}
+
 func (s *Signature) SigningEnabled() bool {
 	return s.IncludeEmptySignatures
 }
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+// stateDir is the directory, relative to the extension root, that holds state
+// files.  Since publishers cannot start with a dot it will never clash with an
+// extension.
+const stateDir = ".marketplace"
+
+// isReserved returns true if the provided path (relative to the extension root)
+// points into a reserved directory like the state directory.  The path is
+// cleaned first so `..` segments cannot be used to reach one.
+func isReserved(p string) bool {
+	return strings.HasPrefix(strings.TrimLeft(cleanFilePath(p), "/"), ".")
+}
+
+// cleanFilePath cleans a request path as if it were rooted at the extension
+// root, so it can never point above it.
+func cleanFilePath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// stateLocks holds a mutex for each state file updated in this process.
+var stateLocks sync.Map
+
+type uncachedStateKey struct{}
+
+// lockState serializes read-modify-write updates of the named state file
+// within the process.  The returned context makes state reads bypass any cache
+// so the update starts from what is actually stored rather than a copy that
+// may be stale.  Call the returned function to unlock.
+func lockState(ctx context.Context, name string) (context.Context, func()) {
+	rawMutex, _ := stateLocks.LoadOrStore(name, &sync.Mutex{})
+	mutex := rawMutex.(*sync.Mutex)
+	mutex.Lock()
+	return context.WithValue(ctx, uncachedStateKey{}, true), mutex.Unlock
+}
+
+// isUncachedState returns true if state reads made with the context must
+// bypass any cache.  See lockState.
+func isUncachedState(ctx context.Context) bool {
+	uncached, _ := ctx.Value(uncachedStateKey{}).(bool)
+	return uncached
+}
+
+// validateStateName ensures a state file name cannot escape the state
+// directory.
+func validateStateName(name string) error {
+	if name == "" || !filepath.IsLocal(filepath.FromSlash(name)) {
+		return xerrors.Errorf("invalid state file name %q", name)
+	}
+	return nil
+}
+
+// readStateJSON decodes the named state file into v.  A state file that does
+// not exist yet leaves v untouched and is not an error.
+func readStateJSON(ctx context.Context, s Storage, name string, v any) error {
+	content, err := s.ReadState(ctx, name)
+	if err != nil && errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return xerrors.Errorf("read %s: %w", name, err)
+	}
+	err = json.Unmarshal(content, v)
+	if err != nil {
+		return xerrors.Errorf("parse %s: %w", name, err)
+	}
+	return nil
+}
+
+// writeStateJSON encodes v into the named state file.
+func writeStateJSON(ctx context.Context, s Storage, name string, v any) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = s.WriteState(ctx, name, content)
+	if err != nil {
+		return xerrors.Errorf("write %s: %w", name, err)
+	}
+	return nil
+}
@@ -8,10 +8,13 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/mod/semver"
 
 	"golang.org/x/xerrors"
@@ -115,6 +118,7 @@ const (
 	ManifestAssetType AssetType = "Microsoft.VisualStudio.Code.Manifest" // This is the package.json.
 	VSIXAssetType     AssetType = "Microsoft.VisualStudio.Services.VSIXPackage"
 	VSIXSignatureType AssetType = "Microsoft.VisualStudio.Services.VsixSignature"
+	DetailsAssetType  AssetType = "Microsoft.VisualStudio.Services.Content.Details" // This is the README.
 )
 
 // VSIXAsset implements XMLManifest.PackageManifest.Assets.Asset.
@@ -128,10 +132,22 @@ type VSIXAsset struct {
 type Options struct {
 	IncludeEmptySignatures bool
 	Artifactory            string
-	ExtDir                 string
-	Repo                   string
-	Logger                 slog.Logger
-	ListCacheDuration      time.Duration
+	// ArtifactoryToken authenticates with Artifactory.  Defaults to the
+	// ARTIFACTORY_TOKEN environment variable.
+	ArtifactoryToken  string
+	ExtDir            string
+	Repo              string
+	Logger            slog.Logger
+	ListCacheDuration time.Duration
+	// ZipLimits bound the archives that can be added.  Defaults to
+	// easyzip.DefaultLimits.
+	ZipLimits *easyzip.Limits
+	// TracerProvider receives spans for manifest reads and Artifactory
+	// requests.  Defaults to discarding them.
+	TracerProvider trace.TracerProvider
+	// ManifestConcurrency limits how many manifests are fetched from
+	// Artifactory at the same time.  Defaults to ManifestConcurrencyDefault.
+	ManifestConcurrency int
 }
 
 type extension struct {
@@ -147,7 +163,8 @@ type Version struct {
 	Version        string   `json:"version"`
 }
 
-func (v Version) isUniversal() bool {
+// IsUniversal returns true if the version is not specific to a platform.
+func (v Version) IsUniversal() bool {
 	switch v.TargetPlatform {
 	case PlatformUniversal, PlatformUnknown, PlatformUndefined, "":
 		return true
@@ -166,7 +183,7 @@ func (v Version) isUniversal() bool {
 // have to migrate existing extensions or have a mechanism for detecting in
 // which format the extension was being stored.
 func (v Version) String() string {
-	if v.isUniversal() {
+	if v.IsUniversal() {
 		return v.Version
 	} else {
 		return fmt.Sprintf("%s@%s", v.Version, v.TargetPlatform)
@@ -213,17 +230,35 @@ type Storage interface {
 	// FileServer provides a handler for fetching extension repository files from
 	// a client.
 	FileServer() http.Handler
+	// Health returns an error if the storage cannot be reached, for example if
+	// the extension directory is unreadable or Artifactory is down.
+	Health(ctx context.Context) error
 	// Manifest returns the manifest bytes for the provided extension.  The
 	// extension asset itself (the VSIX) will be included on the manifest even if
 	// it does not exist on the manifest on disk.
 	Manifest(ctx context.Context, publisher, name string, version Version) (*VSIXManifest, error)
-	// RemoveExtension removes the provided version of the extension.  It errors
-	// if the version does not exist or if removing it fails.  If both the version
-	// and platform are blank all versions of that extension will be removed.  If
-	// only the platform is blank the universal version will be removed.  If only
-	// the version is blank it will error; it is not currently possible to delete
-	// all versions for a specific platform.
+	// Open returns a reader for a file belonging to the provided extension
+	// version, like one of the assets listed in its manifest.  The path is
+	// relative to the version and uses forward slashes.  It errors with
+	// os.ErrNotExist if the file does not exist.
+	Open(ctx context.Context, publisher, name string, version Version, path string) (io.ReadCloser, error)
+	// ReadState returns the contents of the named state file.  State files hold
+	// marketplace-owned data (like the list of unpublished versions) and live in
+	// a reserved directory that is neither walked nor served.  If the file has
+	// never been written an os.ErrNotExist error is returned.
+	ReadState(ctx context.Context, name string) ([]byte, error)
+	// RemoveExtension removes the builds of the extension that the provided
+	// version refers to (see MatchVersions).  If both the version and platform
+	// are blank the entire extension is removed, if only the platform is blank
+	// every platform of the version is removed, and if only the version is blank
+	// every version of the platform is removed.  Only the universal build is
+	// removed if the platform is explicitly universal.  It errors with
+	// os.ErrNotExist if nothing matches or with any error encountered while
+	// removing.
 	RemoveExtension(ctx context.Context, publisher, name string, version Version) error
+	// RemoveState removes the named state file.  Removing a file that does not
+	// exist is not an error.
+	RemoveState(ctx context.Context, name string) error
 	// Versions returns the available versions of the provided extension in sorted
 	// order.  If the extension does not exits it returns an error.
 	Versions(ctx context.Context, publisher, name string) ([]Version, error)
@@ -233,6 +268,49 @@ type Storage interface {
 	// [0]).  If the function returns an error the error is immediately returned
 	// which aborts the walk.
 	WalkExtensions(ctx context.Context, fn func(manifest *VSIXManifest, versions []Version) error) error
+	// WriteState replaces the contents of the named state file.
+	WriteState(ctx context.Context, name string, content []byte) error
+}
+
+// ListCacher is implemented by storage that caches the list of extensions.
+type ListCacher interface {
+	// SetListCacheDuration changes how long the list of extensions is cached.  A
+	// cached list that would outlive the new duration expires early.
+	SetListCacheDuration(duration time.Duration)
+}
+
+// SetListCacheDuration changes how long the storage caches the list of
+// extensions if it or a storage it wraps is a ListCacher and otherwise does
+// nothing.
+func SetListCacheDuration(s Storage, duration time.Duration) {
+	if cacher, ok := find[ListCacher](s); ok {
+		cacher.SetListCacheDuration(duration)
+	}
+}
+
+// Unwrapper is implemented by storage wrappers so optional interfaces like
+// Seeder and ListCacher are found on the storage they wrap without each
+// wrapper forwarding them.
+type Unwrapper interface {
+	// Unwrap returns the wrapped storage.
+	Unwrap() Storage
+}
+
+// find returns the first storage in the chain of wrappers starting at s that
+// implements T.
+func find[T any](s Storage) (T, bool) {
+	for s != nil {
+		if t, ok := s.(T); ok {
+			return t, true
+		}
+		wrapper, ok := s.(Unwrapper)
+		if !ok {
+			break
+		}
+		s = wrapper.Unwrap()
+	}
+	var zero T
+	return zero, false
 }
 
 type File struct {
@@ -240,6 +318,29 @@ type File struct {
 	Content      []byte
 }
 
+// zipLimits returns the provided limits or the defaults if they are nil.
+func zipLimits(limits *easyzip.Limits) easyzip.Limits {
+	if limits == nil {
+		return easyzip.DefaultLimits
+	}
+	return *limits
+}
+
+// validateAddition checks that an extension is safe to add before anything is
+// written so a rejected extension leaves nothing behind.
+func validateAddition(vsix []byte, limits easyzip.Limits, extra []File) error {
+	err := easyzip.Validate(vsix, limits)
+	if err != nil {
+		return err
+	}
+	for _, file := range extra {
+		if err := easyzip.CheckName(file.RelativePath); err != nil {
+			return xerrors.Errorf("extra file %q: %w", file.RelativePath, err)
+		}
+	}
+	return nil
+}
+
 const ArtifactoryTokenEnvKey = "ARTIFACTORY_TOKEN"
 
 // NewStorage returns a storage instance based on the provided extension
@@ -256,21 +357,29 @@ func NewStorage(ctx context.Context, options *Options) (Storage, error) {
 	var err error
 	switch {
 	case options.Artifactory != "":
-		token := os.Getenv(ArtifactoryTokenEnvKey)
+		token := options.ArtifactoryToken
+		if token == "" {
+			token = os.Getenv(ArtifactoryTokenEnvKey)
+		}
 		if token == "" {
-			return nil, xerrors.Errorf("the %s environment variable must be set", ArtifactoryTokenEnvKey)
+			return nil, xerrors.Errorf("an Artifactory token must be set with artifactory-token or the %s environment variable", ArtifactoryTokenEnvKey)
 		}
 		store, err = NewArtifactoryStorage(ctx, &ArtifactoryOptions{
-			ListCacheDuration: options.ListCacheDuration,
-			Logger:            options.Logger,
-			Repo:              options.Repo,
-			Token:             token,
-			URI:               options.Artifactory,
+			ListCacheDuration:   options.ListCacheDuration,
+			Logger:              options.Logger,
+			Repo:                options.Repo,
+			Token:               token,
+			URI:                 options.Artifactory,
+			ZipLimits:           options.ZipLimits,
+			TracerProvider:      options.TracerProvider,
+			ManifestConcurrency: options.ManifestConcurrency,
 		})
 	case options.ExtDir != "":
 		store, err = NewLocalStorage(&LocalOptions{
 			ListCacheDuration: options.ListCacheDuration,
 			ExtDir:            options.ExtDir,
+			ZipLimits:         options.ZipLimits,
+			TracerProvider:    options.TracerProvider,
 		}, options.Logger)
 	default:
 		return nil, xerrors.Errorf("must provide an Artifactory repository or local directory")
@@ -284,6 +393,14 @@ func NewStorage(ctx context.Context, options *Options) (Storage, error) {
 	return signingStorage, nil
 }
 
+// startManifestSpan starts a span for reading an extension version's manifest.
+func startManifestSpan(ctx context.Context, tracer trace.Tracer, publisher, name string, version Version) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "Manifest", trace.WithAttributes(
+		attribute.String("extension", ExtensionIDWithoutVersion(publisher, name)),
+		attribute.String("version", version.Version),
+		attribute.String("target_platform", string(version.TargetPlatform))))
+}
+
 // ReadVSIXManifest reads and parses an extension manifest from a vsix file.  If
 // the manifest is invalid it will be returned along with the validation error.
 func ReadVSIXManifest(vsix []byte) (*VSIXManifest, error) {
@@ -339,7 +456,10 @@ func validateManifest(manifest *VSIXManifest) error {
 // VSIXPackageJSON partially implements Manifest.
 // https://github.com/microsoft/vscode-vsce/blob/main/src/manifest.ts#L40-L99
 type VSIXPackageJSON struct {
-	Browser string `json:"browser"`
+	Name      string `json:"name"`
+	Publisher string `json:"publisher"`
+	Version   string `json:"version"`
+	Browser   string `json:"browser"`
 }
 
 // ReadVSIXPackageJSON reads and parses an extension's package.json from a vsix
@@ -423,15 +543,83 @@ func ExtensionVSIXName(publisher, name string, version Version) string {
 	return fmt.Sprintf("%s.%s-%s", publisher, name, version)
 }
 
+// identifierRe matches publisher and extension names the way vsce does.
+var identifierRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9-]*$`)
+
+// versionRe matches the version in an extension ID, which may be followed by
+// @<platform>.  Since IDs are turned into paths the version cannot contain
+// separators or start with a dot.
+var versionRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9.+_@-]*$`)
+
 // ParseExtensionID parses an full or partial extension ID into its separate
-// parts: publisher, name, and version (version may be blank).  It does not
-// support specifying the platform and requires that the delimiter for the
-// version be @.
+// parts: publisher, name, and version (version may be blank).  It requires that
+// the delimiter for the version be @.  Any platform is left on the version; use
+// ParseExtensionIDWithPlatform to parse it as well.  The publisher and name must
+// be valid identifiers.
 func ParseExtensionID(id string) (string, string, string, error) {
 	re := regexp.MustCompile(`^([^.]+)\.([^@]+)@?(.*)$`)
 	match := re.FindAllStringSubmatch(id, -1)
 	if match == nil {
 		return "", "", "", xerrors.Errorf("\"%s\" does not match <publisher>.<name> or <publisher>.<name>@<version>", id)
 	}
-	return match[0][1], match[0][2], match[0][3], nil
+	publisher, name, version := match[0][1], match[0][2], match[0][3]
+	if !identifierRe.MatchString(publisher) || !identifierRe.MatchString(name) {
+		return "", "", "", xerrors.Errorf("\"%s\" has a publisher or name with characters other than letters, numbers, and dashes", id)
+	}
+	if version != "" && !versionRe.MatchString(version) {
+		return "", "", "", xerrors.Errorf("\"%s\" has an invalid version", id)
+	}
+	return publisher, name, version, nil
+}
+
+// ParseExtensionIDWithPlatform parses an extension ID that may include a
+// version and a platform, for example publisher.name@1.2.3@linux-x64, into its
+// publisher, name, and version.  The version and platform may be blank.
+func ParseExtensionIDWithPlatform(id string) (string, string, Version, error) {
+	publisher, name, versionStr, err := ParseExtensionID(id)
+	if err != nil {
+		return "", "", Version{}, err
+	}
+	version := VersionFromString(versionStr)
+	if strings.HasSuffix(versionStr, "@") || (version.Version == "" && version.TargetPlatform != "") {
+		return "", "", Version{}, xerrors.Errorf("\"%s\" does not match <publisher>.<name>@<version>@<platform>", id)
+	}
+	if err := ValidatePlatform(version.TargetPlatform); err != nil {
+		return "", "", Version{}, err
+	}
+	return publisher, name, version, nil
+}
+
+// ParseExtensionIDWithoutVersion parses an extension ID into its publisher and
+// name, erroring if it includes a version.
+func ParseExtensionIDWithoutVersion(id string) (string, string, error) {
+	publisher, name, version, err := ParseExtensionID(id)
+	if err != nil {
+		return "", "", err
+	}
+	if version != "" {
+		return "", "", xerrors.Errorf("\"%s\" must not include a version", id)
+	}
+	return publisher, name, nil
+}
+
+// validateExtensionDir errors unless the publisher and name each name a single
+// directory below the extension root, so operations on the extension's
+// directory cannot reach outside of it or into reserved directories.
+func validateExtensionDir(publisher, name string) error {
+	for _, elem := range []string{publisher, name} {
+		if elem == "" || elem == "." || strings.ContainsAny(elem, `/\`) || !filepath.IsLocal(elem) || isReserved(elem) {
+			return xerrors.Errorf("invalid extension %q", ExtensionIDWithoutVersion(publisher, name))
+		}
+	}
+	return nil
+}
+
+// validateFilePath errors if the path could escape the extension version
+// directory.
+func validateFilePath(p string) error {
+	if p == "" || !filepath.IsLocal(filepath.FromSlash(p)) {
+		return xerrors.Errorf("invalid file path %q", p)
+	}
+	return nil
 }
@@ -4,6 +4,8 @@ import (
 	"archive/zip"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -11,15 +13,20 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
 	"sort"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
+	"cdr.dev/slog"
+	"github.com/coder/code-marketplace/httpcache"
 	"github.com/coder/code-marketplace/storage"
+	"github.com/coder/code-marketplace/storage/easyzip"
 	"github.com/coder/code-marketplace/testutil"
 )
 
@@ -62,9 +69,17 @@ func TestNewStorage(t *testing.T) {
 				Repo:        "extensions",
 			},
 		},
+		{
+			name: "ArtifactoryWithTokenOption",
+			options: &storage.Options{
+				Artifactory:      "coder.com",
+				ArtifactoryToken: "foo",
+				Repo:             "extensions",
+			},
+		},
 		{
 			name:  "ArtifactoryWithoutKey",
-			error: "environment variable must be set",
+			error: "token must be set",
 			options: &storage.Options{
 				Artifactory: "coder.com",
 				Repo:        "extensions",
@@ -114,16 +129,64 @@ func TestNewStorage(t *testing.T) {
 				_, ok := under.Storage.(*storage.Local)
 				require.True(t, ok)
 				require.NoError(t, err)
+				// Local storage has nothing to seed.
+				require.Nil(t, storage.SeedProgress(s))
+				require.NoError(t, storage.Seed(context.Background(), s))
 			} else {
 				under := s.(*storage.Signature)
 				_, ok := under.Storage.(*storage.Artifactory)
 				require.True(t, ok)
 				require.NoError(t, err)
+				// Seeding is found on the storage the wrapper wraps.
+				status := storage.SeedProgress(s)
+				require.NotNil(t, status)
+				require.Equal(t, storage.SeedPending, status.State)
 			}
 		})
 	}
 }
 
+func TestUnwrap(t *testing.T) {
+	t.Parallel()
+
+	// Optional interfaces are found through any number of wrappers.
+	mock := testutil.NewMockStorage()
+	mock.Seeding = &storage.SeedStatus{State: storage.Seeding, Total: 2}
+	var s storage.Storage = storage.NewSignatureStorage(slog.Make(), false, storage.NewSignatureStorage(slog.Make(), true, mock))
+	require.Equal(t, mock.Seeding, storage.SeedProgress(s))
+	require.NoError(t, storage.Seed(context.Background(), s))
+
+	// Without a Seeder at the bottom there is nothing to seed.
+	local, err := storage.NewLocalStorage(&storage.LocalOptions{ExtDir: t.TempDir()}, slog.Make())
+	require.NoError(t, err)
+	s = storage.NewSignatureStorage(slog.Make(), false, storage.NewSignatureStorage(slog.Make(), true, local))
+	require.Nil(t, storage.SeedProgress(s))
+
+	count := func() int {
+		count := 0
+		err := s.WalkExtensions(context.Background(), func(manifest *storage.VSIXManifest, versions []storage.Version) error {
+			count++
+			return nil
+		})
+		require.NoError(t, err)
+		return count
+	}
+	add := func(ext testutil.Extension) {
+		manifest := testutil.ConvertExtensionToManifest(ext, storage.Version{Version: ext.LatestVersion})
+		_, err := s.AddExtension(context.Background(), manifest, testutil.CreateVSIXFromManifest(t, manifest))
+		require.NoError(t, err)
+	}
+	add(testutil.Extensions[0])
+	storage.SetListCacheDuration(s, time.Hour)
+	require.Equal(t, 1, count())
+	// The duration reached the local storage so the new extension is not seen
+	// until it is shortened.
+	add(testutil.Extensions[1])
+	require.Equal(t, 1, count())
+	storage.SetListCacheDuration(s, 0)
+	require.Equal(t, 2, count())
+}
+
 func TestStorage(t *testing.T) {
 	t.Parallel()
 	factories := []struct {
@@ -155,19 +218,22 @@ func TestStorage(t *testing.T) {
 			t.Run("AddExtension", func(t *testing.T) {
 				testAddExtension(t, sf.factory)
 			})
+			t.Run("AddExtensionZipTraversal", func(t *testing.T) {
+				testAddExtensionZipTraversal(t, sf.factory)
+			})
+			t.Run("AddExtensionExtraTraversal", func(t *testing.T) {
+				testAddExtensionExtraTraversal(t, sf.factory)
+			})
+			t.Run("AddExtensionZipAbsolutePath", func(t *testing.T) {
+				testAddExtensionZipAbsolutePath(t, sf.factory)
+			})
+			t.Run("AddExtensionExtraAbsolutePath", func(t *testing.T) {
+				testAddExtensionExtraAbsolutePath(t, sf.factory)
+			})
+			t.Run("AddExtensionInvalidArchive", func(t *testing.T) {
+				testAddExtensionInvalidArchive(t, sf.factory)
+			})
 			if sf.localOnly {
-				t.Run("AddExtensionZipTraversal", func(t *testing.T) {
-					testAddExtensionZipTraversal(t, sf.factory)
-				})
-				t.Run("AddExtensionExtraTraversal", func(t *testing.T) {
-					testAddExtensionExtraTraversal(t, sf.factory)
-				})
-				t.Run("AddExtensionZipAbsolutePath", func(t *testing.T) {
-					testAddExtensionZipAbsolutePath(t, sf.factory)
-				})
-				t.Run("AddExtensionExtraAbsolutePath", func(t *testing.T) {
-					testAddExtensionExtraAbsolutePath(t, sf.factory)
-				})
 				t.Run("AddExtensionSymlinkEscape", func(t *testing.T) {
 					testAddExtensionSymlinkEscape(t, sf.factory)
 				})
@@ -178,17 +244,84 @@ func TestStorage(t *testing.T) {
 			t.Run("FileServer", func(t *testing.T) {
 				testFileServer(t, sf.factory)
 			})
+			t.Run("FileServerCaching", func(t *testing.T) {
+				testFileServerCaching(t, sf.factory)
+			})
+			t.Run("FileServerRange", func(t *testing.T) {
+				testFileServerRange(t, sf.factory)
+			})
 			t.Run("Manifest", func(t *testing.T) {
 				testManifest(t, sf.factory)
 			})
+			t.Run("Open", func(t *testing.T) {
+				testOpen(t, sf.factory)
+			})
 			t.Run("WalkExtensions", func(t *testing.T) {
 				testWalkExtensions(t, sf.factory)
 			})
+			t.Run("Health", func(t *testing.T) {
+				testHealth(t, sf.factory)
+			})
+			t.Run("ListCacheDuration", func(t *testing.T) {
+				testListCacheDuration(t, sf.factory)
+			})
 			t.Run("Versions", func(t *testing.T) {
 				testVersions(t, sf.factory)
 			})
+			t.Run("State", func(t *testing.T) {
+				testState(t, sf.factory)
+			})
+		})
+	}
+}
+
+func testHealth(t *testing.T, factory storageFactory) {
+	t.Parallel()
+
+	f := factory(t)
+	require.NoError(t, storage.Seed(context.Background(), f.storage))
+	require.NoError(t, f.storage.Health(context.Background()))
+	if status := storage.SeedProgress(f.storage); status != nil {
+		require.Equal(t, storage.SeedDone, status.State)
+	}
+
+	if f.dir != "" {
+		require.NoError(t, os.RemoveAll(f.dir))
+		require.ErrorIs(t, f.storage.Health(context.Background()), os.ErrNotExist)
+	}
+}
+
+func testListCacheDuration(t *testing.T, factory storageFactory) {
+	t.Parallel()
+
+	f := factory(t)
+	add := func(ext testutil.Extension) {
+		manifest := testutil.ConvertExtensionToManifest(ext, storage.Version{Version: ext.LatestVersion})
+		vsix := testutil.CreateVSIXFromManifest(t, manifest)
+		_, err := f.storage.AddExtension(context.Background(), manifest, vsix)
+		require.NoError(t, err)
+	}
+	count := func() int {
+		count := 0
+		err := f.storage.WalkExtensions(context.Background(), func(manifest *storage.VSIXManifest, versions []storage.Version) error {
+			count++
+			return nil
 		})
+		require.NoError(t, err)
+		return count
 	}
+
+	add(testutil.Extensions[0])
+	storage.SetListCacheDuration(f.storage, time.Hour)
+	require.Equal(t, 1, count())
+
+	// The list is cached so the new extension is not seen yet.
+	add(testutil.Extensions[1])
+	require.Equal(t, 1, count())
+
+	// Shortening the duration expires the cached list.
+	storage.SetListCacheDuration(f.storage, 0)
+	require.Equal(t, 2, count())
 }
 
 func testFileServer(t *testing.T, factory storageFactory) {
@@ -243,6 +376,181 @@ func testFileServer(t *testing.T, factory storageFactory) {
 	}
 }
 
+func testFileServerRange(t *testing.T, factory storageFactory) {
+	t.Parallel()
+
+	f := factory(t)
+	ext := testutil.Extensions[0]
+	version := storage.Version{Version: "1.0.0"}
+	manifest := testutil.ConvertExtensionToManifest(ext, version)
+	vsix := testutil.CreateVSIXFromManifest(t, manifest)
+	_, err := f.storage.AddExtension(context.Background(), manifest, vsix, storage.File{
+		RelativePath: "extra/file.txt",
+		Content:      []byte("0123456789"),
+	})
+	require.NoError(t, err)
+
+	p := path.Join("/", ext.Publisher, ext.Name, version.String(), "extra/file.txt")
+	serve := func(header http.Header) (*http.Response, string) {
+		req := httptest.NewRequest("GET", p, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rec := httptest.NewRecorder()
+		f.storage.FileServer().ServeHTTP(rec, req)
+		resp := rec.Result()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp, string(body)
+	}
+
+	resp, body := serve(nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "0123456789", body)
+	require.Equal(t, "10", resp.Header.Get("Content-Length"))
+	require.Contains(t, resp.Header.Get("Content-Type"), "text/plain")
+	etag := resp.Header.Get("ETag")
+	require.NotEmpty(t, etag)
+	lastModified := resp.Header.Get("Last-Modified")
+	require.NotEmpty(t, lastModified)
+
+	tests := []struct {
+		name    string
+		ifRange string
+		partial bool
+	}{
+		{
+			name:    "NoIfRange",
+			partial: true,
+		},
+		{
+			name:    "MatchingETag",
+			ifRange: etag,
+			partial: true,
+		},
+		{
+			name:    "WeakETag",
+			ifRange: "W/" + etag,
+		},
+		{
+			name:    "OtherETag",
+			ifRange: `"other"`,
+		},
+		{
+			name:    "MatchingDate",
+			ifRange: lastModified,
+			partial: true,
+		},
+		{
+			name:    "OldDate",
+			ifRange: "Thu, 01 Jan 1970 00:00:00 GMT",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			header := http.Header{"Range": {"bytes=2-5"}}
+			if test.ifRange != "" {
+				header.Set("If-Range", test.ifRange)
+			}
+			resp, body := serve(header)
+			if test.partial {
+				require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+				require.Equal(t, "2345", body)
+				require.Equal(t, "bytes 2-5/10", resp.Header.Get("Content-Range"))
+				require.Equal(t, "4", resp.Header.Get("Content-Length"))
+			} else {
+				require.Equal(t, http.StatusOK, resp.StatusCode)
+				require.Equal(t, "0123456789", body)
+				require.Empty(t, resp.Header.Get("Content-Range"))
+			}
+			require.Equal(t, etag, resp.Header.Get("ETag"))
+		})
+	}
+
+	t.Run("Unsatisfiable", func(t *testing.T) {
+		t.Parallel()
+		resp, _ := serve(http.Header{"Range": {"bytes=20-"}})
+		require.Equal(t, http.StatusRequestedRangeNotSatisfiable, resp.StatusCode)
+		require.Equal(t, "bytes */10", resp.Header.Get("Content-Range"))
+	})
+}
+
+func testFileServerCaching(t *testing.T, factory storageFactory) {
+	t.Parallel()
+
+	f := factory(t)
+	ext := testutil.Extensions[0]
+	version := storage.Version{Version: "1.0.0", TargetPlatform: storage.PlatformLinuxX64}
+	manifest := testutil.ConvertExtensionToManifest(ext, version)
+	vsix := testutil.CreateVSIXFromManifest(t, manifest)
+	_, err := f.storage.AddExtension(context.Background(), manifest, vsix, storage.File{
+		RelativePath: "extra/file.txt",
+		Content:      []byte("extra"),
+	})
+	require.NoError(t, err)
+
+	serve := func(p string, header http.Header) *http.Response {
+		req := httptest.NewRequest("GET", p, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rec := httptest.NewRecorder()
+		f.storage.FileServer().ServeHTTP(rec, req)
+		return rec.Result()
+	}
+
+	dir := path.Join("/", ext.Publisher, ext.Name, version.String())
+	for _, name := range []string{"extension.vsixmanifest", "extra/file.txt", storage.ExtensionVSIXNameFromManifest(manifest) + ".vsix"} {
+		p := path.Join(dir, name)
+		resp := serve(p, nil)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode, name)
+
+		sum := sha256.Sum256(body)
+		etag := `"` + hex.EncodeToString(sum[:]) + `"`
+		require.Equal(t, etag, resp.Header.Get("ETag"), name)
+		require.Equal(t, httpcache.RevalidateCacheControl, resp.Header.Get("Cache-Control"), name)
+
+		gotETag, err := storage.FileETag(context.Background(), f.storage, p)
+		require.NoError(t, err)
+		require.Equal(t, etag, gotETag)
+
+		for _, match := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+			resp = serve(p, http.Header{"If-None-Match": {match}})
+			resp.Body.Close()
+			require.Equal(t, http.StatusNotModified, resp.StatusCode, match)
+		}
+		resp = serve(p, http.Header{"If-None-Match": {`"other"`}})
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	// Missing files should not get caching headers.
+	resp := serve(path.Join(dir, "missing"), nil)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	require.Empty(t, resp.Header.Get("ETag"))
+	require.Empty(t, resp.Header.Get("Cache-Control"))
+
+	// Paths cannot be used to read other state files.
+	etag, err := storage.FileETag(context.Background(), f.storage, "/../pending/foo/bar")
+	require.NoError(t, err)
+	require.Empty(t, etag)
+
+	// Removing the version should forget its checksums.
+	err = f.storage.RemoveExtension(context.Background(), ext.Publisher, ext.Name, version)
+	require.NoError(t, err)
+	checksums, err := storage.ReadChecksums(context.Background(), f.storage, ext.Publisher, ext.Name, version)
+	require.NoError(t, err)
+	require.Empty(t, checksums)
+}
+
 func testManifest(t *testing.T, factory storageFactory) {
 	t.Parallel()
 
@@ -973,8 +1281,8 @@ func testAddExtensionZipTraversal(t *testing.T, factory storageFactory) {
 	manifest := testutil.ConvertExtensionToManifest(ext, storage.Version{Version: ext.LatestVersion})
 	vsix := createTraversalVSIX(t, "../../../../tmp/evil")
 	_, err := f.storage.AddExtension(context.Background(), manifest, vsix)
-	require.Error(t, err)
-	require.Contains(t, err.Error(), "path escapes from parent")
+	require.ErrorIs(t, err, easyzip.ErrUnsafePath)
+	require.False(t, f.exists(ext.Publisher, ext.Name))
 }
 
 func testAddExtensionExtraTraversal(t *testing.T, factory storageFactory) {
@@ -986,8 +1294,8 @@ func testAddExtensionExtraTraversal(t *testing.T, factory storageFactory) {
 	vsix := testutil.CreateVSIXFromManifest(t, manifest)
 	evil := storage.File{RelativePath: "../../../../tmp/evil", Content: []byte("evil")}
 	_, err := f.storage.AddExtension(context.Background(), manifest, vsix, evil)
-	require.Error(t, err)
-	require.Contains(t, err.Error(), "path escapes from parent")
+	require.ErrorIs(t, err, easyzip.ErrUnsafePath)
+	require.False(t, f.exists(ext.Publisher, ext.Name))
 }
 
 func testAddExtensionZipAbsolutePath(t *testing.T, factory storageFactory) {
@@ -998,8 +1306,8 @@ func testAddExtensionZipAbsolutePath(t *testing.T, factory storageFactory) {
 	manifest := testutil.ConvertExtensionToManifest(ext, storage.Version{Version: ext.LatestVersion})
 	vsix := createTraversalVSIX(t, "/tmp/evil")
 	_, err := f.storage.AddExtension(context.Background(), manifest, vsix)
-	require.Error(t, err)
-	require.Contains(t, err.Error(), "path escapes from parent")
+	require.ErrorIs(t, err, easyzip.ErrUnsafePath)
+	require.False(t, f.exists(ext.Publisher, ext.Name))
 }
 
 func testAddExtensionExtraAbsolutePath(t *testing.T, factory storageFactory) {
@@ -1011,8 +1319,62 @@ func testAddExtensionExtraAbsolutePath(t *testing.T, factory storageFactory) {
 	vsix := testutil.CreateVSIXFromManifest(t, manifest)
 	evil := storage.File{RelativePath: "/tmp/evil", Content: []byte("evil")}
 	_, err := f.storage.AddExtension(context.Background(), manifest, vsix, evil)
-	require.Error(t, err)
-	require.Contains(t, err.Error(), "path escapes from parent")
+	require.ErrorIs(t, err, easyzip.ErrUnsafePath)
+	require.False(t, f.exists(ext.Publisher, ext.Name))
+}
+
+func testAddExtensionInvalidArchive(t *testing.T, factory storageFactory) {
+	t.Parallel()
+
+	ext := testutil.Extensions[0]
+	manifest := testutil.ConvertExtensionToManifest(ext, storage.Version{Version: ext.LatestVersion})
+	manifestBytes := testutil.ConvertExtensionToManifestBytes(t, ext, storage.Version{Version: ext.LatestVersion})
+
+	tests := []struct {
+		name    string
+		entries []string
+		error   error
+	}{
+		{
+			name:    "Duplicate",
+			entries: []string{"extension.vsixmanifest", "extension/readme.md", "extension/readme.md"},
+			error:   easyzip.ErrDuplicateEntry,
+		},
+		{
+			name:    "DuplicateAfterCleaning",
+			entries: []string{"extension.vsixmanifest", "./extension.vsixmanifest"},
+			error:   easyzip.ErrDuplicateEntry,
+		},
+		{
+			name:    "Backslash",
+			entries: []string{"extension.vsixmanifest", `extension\..\..\evil`},
+			error:   easyzip.ErrUnsafePath,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			f := factory(t)
+			buf := bytes.NewBuffer(nil)
+			zw := zip.NewWriter(buf)
+			for _, name := range test.entries {
+				fw, err := zw.Create(name)
+				require.NoError(t, err)
+				_, err = fw.Write(manifestBytes)
+				require.NoError(t, err)
+			}
+			require.NoError(t, zw.Close())
+
+			_, err := f.storage.AddExtension(context.Background(), manifest, buf.Bytes())
+			require.ErrorIs(t, err, test.error)
+			var archiveErr *easyzip.ArchiveError
+			require.ErrorAs(t, err, &archiveErr)
+			require.False(t, f.exists(ext.Publisher, ext.Name))
+		})
+	}
 }
 
 func testAddExtensionSymlinkEscape(t *testing.T, factory storageFactory) {
@@ -1052,6 +1414,10 @@ func testRemoveExtension(t *testing.T, factory storageFactory) {
 		extension testutil.Extension
 		// name is the name of the test.
 		name string
+		// removed and kept are builds that should and should not have been
+		// removed.  If both are blank only the version itself is checked.
+		removed []storage.Version
+		kept    []storage.Version
 		// version is the version to remove.
 		version storage.Version
 	}{
@@ -1060,6 +1426,55 @@ func testRemoveExtension(t *testing.T, factory storageFactory) {
 			extension: testutil.Extensions[0],
 			version:   storage.Version{Version: testutil.Extensions[0].LatestVersion},
 		},
+		{
+			name:      "AllPlatforms",
+			extension: testutil.Extensions[0],
+			version:   storage.Version{Version: "3.0.0"},
+			removed: []storage.Version{
+				{Version: "3.0.0"},
+				{Version: "3.0.0", TargetPlatform: storage.PlatformLinuxX64},
+				{Version: "3.0.0", TargetPlatform: storage.PlatformWin32X64},
+			},
+			kept: []storage.Version{
+				{Version: "2.0.0"},
+			},
+		},
+		{
+			name:      "Universal",
+			extension: testutil.Extensions[0],
+			version:   storage.Version{Version: "3.0.0", TargetPlatform: storage.PlatformUniversal},
+			removed: []storage.Version{
+				{Version: "3.0.0"},
+			},
+			kept: []storage.Version{
+				{Version: "3.0.0", TargetPlatform: storage.PlatformLinuxX64},
+			},
+		},
+		{
+			name:      "Platform",
+			extension: testutil.Extensions[0],
+			version:   storage.Version{Version: "3.0.0", TargetPlatform: storage.PlatformLinuxX64},
+			removed: []storage.Version{
+				{Version: "3.0.0", TargetPlatform: storage.PlatformLinuxX64},
+			},
+			kept: []storage.Version{
+				{Version: "3.0.0"},
+				{Version: "3.0.0", TargetPlatform: storage.PlatformLinuxArm64},
+			},
+		},
+		{
+			name:      "PlatformAllVersions",
+			extension: testutil.Extensions[0],
+			version:   storage.Version{TargetPlatform: storage.PlatformWin32X64},
+			removed: []storage.Version{
+				{Version: "1.0.0", TargetPlatform: storage.PlatformWin32X64},
+				{Version: "3.0.0", TargetPlatform: storage.PlatformWin32X64},
+			},
+			kept: []storage.Version{
+				{Version: "1.0.0"},
+				{Version: "3.0.0"},
+			},
+		},
 		{
 			name:      "NoVersionMatch",
 			error:     os.ErrNotExist,
@@ -1087,13 +1502,17 @@ func testRemoveExtension(t *testing.T, factory storageFactory) {
 			version:   storage.Version{Version: testutil.Extensions[1].LatestVersion, TargetPlatform: storage.PlatformWeb},
 		},
 		{
-			// We could support this as a way to delete all versions belonging to a
-			// specific platform, but for now it is an error.
 			name:      "NoVersion",
 			error:     os.ErrNotExist,
 			extension: testutil.Extensions[1],
 			version:   storage.Version{TargetPlatform: storage.PlatformWeb},
 		},
+		{
+			name:      "NoPlatformAllVersions",
+			error:     os.ErrNotExist,
+			extension: testutil.Extensions[0],
+			version:   storage.Version{TargetPlatform: storage.PlatformWeb},
+		},
 		{
 			name:      "All",
 			extension: testutil.Extensions[0],
@@ -1121,7 +1540,14 @@ func testRemoveExtension(t *testing.T, factory storageFactory) {
 				require.NoError(t, err)
 				// If a version was specified the parent extension directory should
 				// still exist otherwise the whole thing should have been removed.
-				if test.version.Version != "" {
+				if len(test.removed) > 0 || len(test.kept) > 0 {
+					for _, version := range test.removed {
+						require.False(t, f.exists(test.extension.Publisher, test.extension.Name, version.String()), "%s should be removed", version)
+					}
+					for _, version := range test.kept {
+						require.True(t, f.exists(test.extension.Publisher, test.extension.Name, version.String()), "%s should be kept", version)
+					}
+				} else if test.version.Version != "" {
 					require.True(t, f.exists(test.extension.Publisher, test.extension.Name))
 					require.False(t, f.exists(test.extension.Publisher, test.extension.Name, test.version.String()))
 				} else {
@@ -1130,6 +1556,24 @@ func testRemoveExtension(t *testing.T, factory storageFactory) {
 			}
 		})
 	}
+
+	t.Run("Traversal", func(t *testing.T) {
+		t.Parallel()
+
+		f := factory(t)
+		ext := testutil.Extensions[0]
+		for _, version := range ext.Versions {
+			f.write(testutil.ConvertExtensionToManifestBytes(t, ext, version), ext.Publisher, ext.Name, version.String(), "extension.vsixmanifest")
+		}
+
+		for _, name := range []string{"..", ".", "", "../" + ext.Publisher, ".marketplace"} {
+			err := f.storage.RemoveExtension(context.Background(), ext.Publisher, name, storage.Version{})
+			require.Error(t, err, "%q should be rejected", name)
+		}
+		err := f.storage.RemoveExtension(context.Background(), "..", ext.Publisher, storage.Version{})
+		require.Error(t, err)
+		require.True(t, f.exists(ext.Publisher, ext.Name))
+	})
 }
 
 func testVersions(t *testing.T, factory storageFactory) {
@@ -1184,6 +1628,104 @@ func testVersions(t *testing.T, factory storageFactory) {
 	}
 }
 
+func testOpen(t *testing.T, factory storageFactory) {
+	t.Parallel()
+
+	f := factory(t)
+	ext := testutil.Extensions[0]
+	version := storage.Version{Version: ext.LatestVersion}
+	f.write([]byte("# README"), ext.Publisher, ext.Name, version.String(), "extension/README.md")
+
+	reader, err := f.storage.Open(context.Background(), ext.Publisher, ext.Name, version, "extension/README.md")
+	require.NoError(t, err)
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "# README", string(content))
+
+	_, err = f.storage.Open(context.Background(), ext.Publisher, ext.Name, version, "extension/nope.md")
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// Paths must stay within the version.
+	for _, path := range []string{"", "../extension.vsixmanifest", "/absolute.md"} {
+		_, err = f.storage.Open(context.Background(), ext.Publisher, ext.Name, version, path)
+		require.Error(t, err)
+	}
+}
+
+func testState(t *testing.T, factory storageFactory) {
+	t.Parallel()
+
+	f := factory(t)
+	ext := testutil.Extensions[0]
+	f.write(testutil.ConvertExtensionToManifestBytes(t, ext, storage.Version{Version: ext.LatestVersion}), ext.Publisher, ext.Name, ext.LatestVersion, "extension.vsixmanifest")
+
+	_, err := f.storage.ReadState(context.Background(), "state.json")
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	err = f.storage.WriteState(context.Background(), "state.json", []byte("foo"))
+	require.NoError(t, err)
+	err = f.storage.WriteState(context.Background(), "nested/state.json", []byte("bar"))
+	require.NoError(t, err)
+
+	content, err := f.storage.ReadState(context.Background(), "state.json")
+	require.NoError(t, err)
+	require.Equal(t, "foo", string(content))
+	content, err = f.storage.ReadState(context.Background(), "nested/state.json")
+	require.NoError(t, err)
+	require.Equal(t, "bar", string(content))
+
+	// Overwriting should replace the contents.
+	err = f.storage.WriteState(context.Background(), "state.json", []byte("baz"))
+	require.NoError(t, err)
+	content, err = f.storage.ReadState(context.Background(), "state.json")
+	require.NoError(t, err)
+	require.Equal(t, "baz", string(content))
+
+	// Removing should make it read as missing again, and removing a file that
+	// does not exist is not an error.
+	err = f.storage.RemoveState(context.Background(), "nested/state.json")
+	require.NoError(t, err)
+	_, err = f.storage.ReadState(context.Background(), "nested/state.json")
+	require.ErrorIs(t, err, os.ErrNotExist)
+	err = f.storage.RemoveState(context.Background(), "nested/state.json")
+	require.NoError(t, err)
+
+	// Names must stay within the state directory.
+	for _, name := range []string{"", "../escape.json", "/absolute.json"} {
+		err = f.storage.WriteState(context.Background(), name, []byte("nope"))
+		require.Error(t, err)
+		_, err = f.storage.ReadState(context.Background(), name)
+		require.Error(t, err)
+		err = f.storage.RemoveState(context.Background(), name)
+		require.Error(t, err)
+	}
+
+	// State should not show up as an extension.
+	count := 0
+	err = f.storage.WalkExtensions(context.Background(), func(manifest *storage.VSIXManifest, versions []storage.Version) error {
+		count++
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	// Nor should it be served, even through a path that only reaches it once
+	// cleaned.
+	for _, target := range []string{
+		"/.marketplace/state.json",
+		"//.marketplace/state.json",
+		"/x/../.marketplace/state.json",
+		"/x/%2e%2e/.marketplace/state.json",
+		"/x/y/../../.marketplace/state.json",
+	} {
+		req := httptest.NewRequest("GET", target, nil)
+		rec := httptest.NewRecorder()
+		f.storage.FileServer().ServeHTTP(rec, req)
+		require.Equal(t, http.StatusNotFound, rec.Code, target)
+	}
+}
+
 func TestExtensionIDFromManifest(t *testing.T) {
 	t.Parallel()
 
@@ -1356,6 +1898,12 @@ func TestParseExtensionID(t *testing.T) {
 			expected: []string{"foo", "bar", "test.test"},
 			id:       "foo.bar@test.test",
 		},
+		{
+			// The platform is left on the version.
+			name:     "Platform",
+			expected: []string{"foo", "bar", "test@linux-x64"},
+			id:       "foo.bar@test@linux-x64",
+		},
 		{
 			name:  "EmptyID",
 			error: true,
@@ -1386,6 +1934,26 @@ func TestParseExtensionID(t *testing.T) {
 			error: true,
 			id:    "publisher@version",
 		},
+		{
+			name:  "TraversalName",
+			error: true,
+			id:    "foo...",
+		},
+		{
+			name:  "SeparatorInName",
+			error: true,
+			id:    "foo.bar/../baz",
+		},
+		{
+			name:  "TraversalVersion",
+			error: true,
+			id:    "foo.bar@../baz",
+		},
+		{
+			name:  "SeparatorInVersion",
+			error: true,
+			id:    "foo.bar@1.0.0/../../baz",
+		},
 	}
 
 	for _, test := range tests {
@@ -1403,6 +1971,77 @@ func TestParseExtensionID(t *testing.T) {
 	}
 }
 
+func TestParseExtensionIDWithPlatform(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		// error is whether an error is expected.
+		error bool
+		// expected is the expected version.  It is ignored if an error is expected.
+		expected storage.Version
+		// id is the id to parse.
+		id string
+		// name is the name of the test.
+		name string
+	}{
+		{
+			name: "NoVersion",
+			id:   "foo.bar",
+		},
+		{
+			name:     "Version",
+			expected: storage.Version{Version: "1.2.3"},
+			id:       "foo.bar@1.2.3",
+		},
+		{
+			name:     "Platform",
+			expected: storage.Version{Version: "1.2.3", TargetPlatform: storage.PlatformLinuxX64},
+			id:       "foo.bar@1.2.3@linux-x64",
+		},
+		{
+			name:     "Universal",
+			expected: storage.Version{Version: "1.2.3", TargetPlatform: storage.PlatformUniversal},
+			id:       "foo.bar@1.2.3@universal",
+		},
+		{
+			name:  "InvalidPlatform",
+			error: true,
+			id:    "foo.bar@1.2.3@linux-x86",
+		},
+		{
+			name:  "EmptyPlatform",
+			error: true,
+			id:    "foo.bar@1.2.3@",
+		},
+		{
+			name:  "PlatformWithoutVersion",
+			error: true,
+			id:    "foo.bar@@linux-x64",
+		},
+		{
+			name:  "InvalidID",
+			error: true,
+			id:    "foo@linux-x64",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			publisher, name, version, err := storage.ParseExtensionIDWithPlatform(test.id)
+			if test.error {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, "foo", publisher)
+				require.Equal(t, "bar", name)
+				require.Equal(t, test.expected, version)
+			}
+		})
+	}
+}
+
 func TestSortByVersion(t *testing.T) {
 	t.Parallel()
 
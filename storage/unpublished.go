@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+
+	"golang.org/x/xerrors"
+)
+
+const unpublishedStateName = "unpublished.json"
+
+var (
+	ErrAlreadyUnpublished = xerrors.New("already unpublished")
+	ErrNotUnpublished     = xerrors.New("not unpublished")
+)
+
+// UnpublishedExtension holds the unpublished versions of a single extension.
+type UnpublishedExtension struct {
+	// All means every version is unpublished, including versions added later.
+	All bool `json:"all,omitempty"`
+	// Versions holds unpublished version numbers.  Every platform of a version
+	// is unpublished together.
+	Versions []string `json:"versions,omitempty"`
+}
+
+// Unpublished maps extension IDs (publisher.name) to their unpublished
+// versions.  Unpublished versions are hidden from queries but their files are
+// kept so anything that already references them continues to work.
+type Unpublished map[string]*UnpublishedExtension
+
+// IsUnpublished returns true if the provided version has been unpublished.
+func (u Unpublished) IsUnpublished(publisher, name string, version Version) bool {
+	ext, ok := u[ExtensionIDWithoutVersion(publisher, name)]
+	if !ok {
+		return false
+	}
+	return ext.All || slices.Contains(ext.Versions, version.Version)
+}
+
+// ReadUnpublished returns the unpublished versions of every extension.
+func ReadUnpublished(ctx context.Context, s Storage) (Unpublished, error) {
+	unpublished := Unpublished{}
+	err := readStateJSON(ctx, s, unpublishedStateName, &unpublished)
+	if err != nil {
+		return nil, err
+	}
+	return unpublished, nil
+}
+
+// Unpublish hides the provided version of an extension from queries.  If the
+// version is blank every version of the extension is hidden.  It errors if the
+// extension or version does not exist.
+func Unpublish(ctx context.Context, s Storage, publisher, name, version string) error {
+	versions, err := s.Versions(ctx, publisher, name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	exists := slices.ContainsFunc(versions, func(v Version) bool {
+		return version == "" || v.Version == version
+	})
+	if !exists {
+		return xerrors.Errorf("%s: %w", displayID(publisher, name, version), os.ErrNotExist)
+	}
+
+	ctx, unlock := lockState(ctx, unpublishedStateName)
+	defer unlock()
+	unpublished, err := ReadUnpublished(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	id := ExtensionIDWithoutVersion(publisher, name)
+	ext, ok := unpublished[id]
+	if !ok {
+		ext = &UnpublishedExtension{}
+		unpublished[id] = ext
+	}
+
+	switch {
+	case ext.All || slices.Contains(ext.Versions, version):
+		return xerrors.Errorf("%s: %w", displayID(publisher, name, version), ErrAlreadyUnpublished)
+	case version == "":
+		ext.All = true
+		ext.Versions = nil
+	default:
+		ext.Versions = append(ext.Versions, version)
+	}
+
+	return writeStateJSON(ctx, s, unpublishedStateName, unpublished)
+}
+
+// Republish reverses Unpublish.  If the version is blank every version of the
+// extension is made visible again.  Republishing a single version of an
+// extension that was unpublished as a whole unpublishes the remaining versions
+// individually, so versions added afterward will be visible.
+func Republish(ctx context.Context, s Storage, publisher, name, version string) error {
+	ctx, unlock := lockState(ctx, unpublishedStateName)
+	defer unlock()
+	unpublished, err := ReadUnpublished(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	id := ExtensionIDWithoutVersion(publisher, name)
+	ext, ok := unpublished[id]
+	switch {
+	case !ok, version != "" && !ext.All && !slices.Contains(ext.Versions, version):
+		return xerrors.Errorf("%s: %w", displayID(publisher, name, version), ErrNotUnpublished)
+	case version == "":
+		delete(unpublished, id)
+	default:
+		if ext.All {
+			versions, err := s.Versions(ctx, publisher, name)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			ext.All = false
+			for _, v := range versions {
+				if !slices.Contains(ext.Versions, v.Version) {
+					ext.Versions = append(ext.Versions, v.Version)
+				}
+			}
+		}
+		ext.Versions = slices.DeleteFunc(ext.Versions, func(v string) bool {
+			return v == version
+		})
+		if len(ext.Versions) == 0 {
+			delete(unpublished, id)
+		}
+	}
+
+	return writeStateJSON(ctx, s, unpublishedStateName, unpublished)
+}
+
+// displayID returns publisher.name or publisher.name@version if the version is
+// not blank.
+func displayID(publisher, name, version string) string {
+	if version == "" {
+		return ExtensionIDWithoutVersion(publisher, name)
+	}
+	return ExtensionIDWithVersion(publisher, name, version)
+}
@@ -0,0 +1,168 @@
+package storage_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/code-marketplace/storage"
+	"github.com/coder/code-marketplace/testutil"
+)
+
+func TestUnpublish(t *testing.T) {
+	t.Parallel()
+
+	ext := testutil.Extensions[0]
+	v1 := storage.Version{Version: "1.0.0"}
+	v1Win := storage.Version{Version: "1.0.0", TargetPlatform: storage.PlatformWin32X64}
+	v2 := storage.Version{Version: "2.0.0"}
+
+	tests := []struct {
+		// error is the expected error, if any.
+		error error
+		// name is the name of the test.
+		name string
+		// run makes the changes under test.
+		run func(ctx context.Context, s storage.Storage) error
+		// unpublished are versions that should be unpublished afterward.
+		unpublished []storage.Version
+		// published are versions that should be published afterward.
+		published []storage.Version
+	}{
+		{
+			name: "Version",
+			run: func(ctx context.Context, s storage.Storage) error {
+				return storage.Unpublish(ctx, s, ext.Publisher, ext.Name, "1.0.0")
+			},
+			unpublished: []storage.Version{v1, v1Win},
+			published:   []storage.Version{v2},
+		},
+		{
+			name: "All",
+			run: func(ctx context.Context, s storage.Storage) error {
+				return storage.Unpublish(ctx, s, ext.Publisher, ext.Name, "")
+			},
+			unpublished: []storage.Version{v1, v1Win, v2, {Version: "4.0.0"}},
+		},
+		{
+			name:  "NoVersion",
+			error: os.ErrNotExist,
+			run: func(ctx context.Context, s storage.Storage) error {
+				return storage.Unpublish(ctx, s, ext.Publisher, ext.Name, "4.0.0")
+			},
+		},
+		{
+			name:  "NoExtension",
+			error: os.ErrNotExist,
+			run: func(ctx context.Context, s storage.Storage) error {
+				return storage.Unpublish(ctx, s, "foo", "does-not-exist", "")
+			},
+		},
+		{
+			name:  "AlreadyUnpublished",
+			error: storage.ErrAlreadyUnpublished,
+			run: func(ctx context.Context, s storage.Storage) error {
+				err := storage.Unpublish(ctx, s, ext.Publisher, ext.Name, "1.0.0")
+				if err != nil {
+					return err
+				}
+				return storage.Unpublish(ctx, s, ext.Publisher, ext.Name, "1.0.0")
+			},
+		},
+		{
+			name:  "AlreadyUnpublishedAll",
+			error: storage.ErrAlreadyUnpublished,
+			run: func(ctx context.Context, s storage.Storage) error {
+				err := storage.Unpublish(ctx, s, ext.Publisher, ext.Name, "")
+				if err != nil {
+					return err
+				}
+				return storage.Unpublish(ctx, s, ext.Publisher, ext.Name, "1.0.0")
+			},
+		},
+		{
+			name: "Republish",
+			run: func(ctx context.Context, s storage.Storage) error {
+				err := storage.Unpublish(ctx, s, ext.Publisher, ext.Name, "1.0.0")
+				if err != nil {
+					return err
+				}
+				err = storage.Unpublish(ctx, s, ext.Publisher, ext.Name, "2.0.0")
+				if err != nil {
+					return err
+				}
+				return storage.Republish(ctx, s, ext.Publisher, ext.Name, "1.0.0")
+			},
+			unpublished: []storage.Version{v2},
+			published:   []storage.Version{v1, v1Win},
+		},
+		{
+			name: "RepublishAll",
+			run: func(ctx context.Context, s storage.Storage) error {
+				err := storage.Unpublish(ctx, s, ext.Publisher, ext.Name, "1.0.0")
+				if err != nil {
+					return err
+				}
+				return storage.Republish(ctx, s, ext.Publisher, ext.Name, "")
+			},
+			published: []storage.Version{v1, v1Win, v2},
+		},
+		{
+			name: "RepublishOneOfAll",
+			run: func(ctx context.Context, s storage.Storage) error {
+				err := storage.Unpublish(ctx, s, ext.Publisher, ext.Name, "")
+				if err != nil {
+					return err
+				}
+				return storage.Republish(ctx, s, ext.Publisher, ext.Name, "2.0.0")
+			},
+			unpublished: []storage.Version{v1, v1Win},
+			// Versions added afterward are no longer covered.
+			published: []storage.Version{v2, {Version: "4.0.0"}},
+		},
+		{
+			name:  "RepublishNotUnpublished",
+			error: storage.ErrNotUnpublished,
+			run: func(ctx context.Context, s storage.Storage) error {
+				return storage.Republish(ctx, s, ext.Publisher, ext.Name, "1.0.0")
+			},
+		},
+		{
+			name:  "RepublishOtherVersion",
+			error: storage.ErrNotUnpublished,
+			run: func(ctx context.Context, s storage.Storage) error {
+				err := storage.Unpublish(ctx, s, ext.Publisher, ext.Name, "1.0.0")
+				if err != nil {
+					return err
+				}
+				return storage.Republish(ctx, s, ext.Publisher, ext.Name, "2.0.0")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := testutil.NewMockStorage()
+			err := test.run(context.Background(), s)
+			if test.error != nil {
+				require.ErrorIs(t, err, test.error)
+				return
+			}
+			require.NoError(t, err)
+
+			unpublished, err := storage.ReadUnpublished(context.Background(), s)
+			require.NoError(t, err)
+			for _, version := range test.unpublished {
+				require.True(t, unpublished.IsUnpublished(ext.Publisher, ext.Name, version), version)
+			}
+			for _, version := range test.published {
+				require.False(t, unpublished.IsUnpublished(ext.Publisher, ext.Name, version), version)
+			}
+		})
+	}
+}
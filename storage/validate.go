@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"archive/zip"
+	"fmt"
+	"path"
+	"strings"
+
+	"golang.org/x/mod/semver"
+
+	"github.com/coder/code-marketplace/storage/easyzip"
+)
+
+// Checks performed by ValidateVSIX.
+const (
+	CheckArchive        = "archive"
+	CheckManifest       = "manifest"
+	CheckVersion        = "version"
+	CheckTargetPlatform = "targetPlatform"
+	CheckPackageJSON    = "packageJSON"
+	CheckAssets         = "assets"
+	CheckIcon           = "icon"
+	CheckDependencies   = "dependencies"
+)
+
+// ValidationIssue is a single problem found with a VSIX.
+type ValidationIssue struct {
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+// ValidationReport is the result of validating a VSIX.
+type ValidationReport struct {
+	// Source is where the VSIX was read from, if known.
+	Source         string            `json:"source,omitempty"`
+	Extension      string            `json:"extension,omitempty"`
+	Version        string            `json:"version,omitempty"`
+	TargetPlatform Platform          `json:"targetPlatform,omitempty"`
+	Valid          bool              `json:"valid"`
+	Issues         []ValidationIssue `json:"issues"`
+}
+
+func (r *ValidationReport) add(check, format string, args ...any) {
+	r.Valid = false
+	r.Issues = append(r.Issues, ValidationIssue{Check: check, Message: fmt.Sprintf(format, args...)})
+}
+
+// Err returns an error describing the issues or nil if there are none.
+func (r *ValidationReport) Err() error {
+	if r.Valid {
+		return nil
+	}
+	return &ValidationError{Report: r}
+}
+
+// ValidationError is returned when a VSIX fails validation.
+type ValidationError struct {
+	Report *ValidationReport
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Report.Issues))
+	for i, issue := range e.Report.Issues {
+		messages[i] = issue.Check + ": " + issue.Message
+	}
+	return "extension failed validation: " + strings.Join(messages, "; ")
+}
+
+// ValidateVSIX checks a VSIX for problems that would keep it from working in
+// VS Code, beyond the basic checks done when reading its manifest.  The archive
+// is checked against the limits, or easyzip.DefaultLimits if they are nil, so
+// it agrees with what storage configured with the same limits would accept.
+func ValidateVSIX(vsix []byte, limits *easyzip.Limits) *ValidationReport {
+	report := &ValidationReport{Valid: true, Issues: []ValidationIssue{}}
+
+	files := map[string]bool{}
+	_, err := easyzip.WalkZipWithLimits(vsix, zipLimits(limits), func(zf *zip.File) (bool, error) {
+		files[path.Clean(zf.Name)] = true
+		return false, nil
+	})
+	if err != nil {
+		report.add(CheckArchive, "%s", err)
+		return report
+	}
+
+	manifest, err := ReadVSIXManifest(vsix)
+	if manifest == nil {
+		report.add(CheckManifest, "%s", err)
+		return report
+	}
+	identity := manifest.Metadata.Identity
+	if identity.Publisher != "" && identity.ID != "" {
+		report.Extension = ExtensionIDWithoutVersion(identity.Publisher, identity.ID)
+	}
+	report.Version = identity.Version
+	report.TargetPlatform = identity.TargetPlatform
+	if err != nil {
+		report.add(CheckManifest, "%s", err)
+	}
+	if identity.Publisher != "" && !identifierRe.MatchString(identity.Publisher) {
+		report.add(CheckManifest, "publisher %q is not a valid identifier", identity.Publisher)
+	}
+	if identity.ID != "" && !identifierRe.MatchString(identity.ID) {
+		report.add(CheckManifest, "name %q is not a valid identifier", identity.ID)
+	}
+
+	if identity.Version != "" && !isSemver(identity.Version) {
+		report.add(CheckVersion, "%q is not a valid semantic version", identity.Version)
+	}
+
+	if err := ValidatePlatform(identity.TargetPlatform); err != nil {
+		report.add(CheckTargetPlatform, "%s", err)
+	}
+
+	exists := func(p string) bool {
+		return p != "" && files[path.Clean(p)]
+	}
+
+	var packageJSONPath string
+	for _, asset := range manifest.Assets.Asset {
+		// A missing package.json is reported below.
+		if asset.Type == ManifestAssetType {
+			packageJSONPath = asset.Path
+			continue
+		}
+		if asset.Addressable == "true" && !exists(asset.Path) {
+			report.add(CheckAssets, "asset %s at %q does not exist", asset.Type, asset.Path)
+		}
+	}
+
+	if packageJSONPath == "" {
+		report.add(CheckPackageJSON, "manifest does not list a package.json")
+	} else if !exists(packageJSONPath) {
+		report.add(CheckPackageJSON, "%q does not exist", packageJSONPath)
+	} else {
+		pj, err := ReadVSIXPackageJSON(vsix, packageJSONPath)
+		switch {
+		case err != nil:
+			report.add(CheckPackageJSON, "unable to read %q: %s", packageJSONPath, err)
+		case pj == nil:
+			report.add(CheckPackageJSON, "%q is empty", packageJSONPath)
+		default:
+			compare := func(field, got, want string) {
+				if got != want {
+					report.add(CheckPackageJSON, "%s %q does not match manifest %q", field, got, want)
+				}
+			}
+			compare("name", pj.Name, identity.ID)
+			compare("publisher", pj.Publisher, identity.Publisher)
+			compare("version", pj.Version, identity.Version)
+		}
+	}
+
+	if icon := manifest.Metadata.Icon; icon != "" && !exists(icon) {
+		report.add(CheckIcon, "icon %q does not exist", icon)
+	}
+
+	for _, prop := range manifest.Metadata.Properties.Property {
+		if prop.Value == "" || (prop.ID != DependencyPropertyType && prop.ID != PackPropertyType) {
+			continue
+		}
+		for _, id := range strings.Split(prop.Value, ",") {
+			publisher, name, version, err := ParseExtensionID(id)
+			if err != nil || version != "" || !identifierRe.MatchString(publisher) || !identifierRe.MatchString(name) {
+				report.add(CheckDependencies, "%q is not a valid extension ID", id)
+			}
+		}
+	}
+
+	return report
+}
+
+// isSemver returns whether the version is a full semantic version, for example
+// 1.2.3 or 1.2.3-beta.1+build, but not 1.2 or v1.2.3.
+func isSemver(version string) bool {
+	v := "v" + version
+	if !semver.IsValid(v) {
+		return false
+	}
+	core, _, _ := strings.Cut(v, "+")
+	return semver.Canonical(v) == core
+}
@@ -0,0 +1,259 @@
+package storage_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/coder/code-marketplace/storage"
+	"github.com/coder/code-marketplace/storage/easyzip"
+)
+
+// validManifest returns a manifest that passes validation when packaged with
+// the files from validFiles.
+func validManifest() *storage.VSIXManifest {
+	return &storage.VSIXManifest{
+		Metadata: storage.VSIXMetadata{
+			Identity: storage.VSIXIdentity{
+				ID:        "name",
+				Version:   "1.2.3",
+				Publisher: "publisher",
+			},
+			Icon: "extension/icon.png",
+			Properties: storage.VSIXProperties{
+				Property: []storage.VSIXProperty{
+					{ID: storage.DependencyPropertyType, Value: "foo.bar,baz.qux-2"},
+					{ID: storage.PackPropertyType, Value: ""},
+				},
+			},
+		},
+		Assets: storage.VSIXAssets{
+			Asset: []storage.VSIXAsset{
+				{Type: storage.ManifestAssetType, Path: "extension/package.json", Addressable: "true"},
+				{Type: storage.DetailsAssetType, Path: "extension/README.md", Addressable: "true"},
+				{Type: "Microsoft.VisualStudio.Services.Icons.Default", Path: "extension/icon.png", Addressable: "true"},
+			},
+		},
+	}
+}
+
+func validFiles() map[string]any {
+	return map[string]any{
+		"extension/package.json": storage.VSIXPackageJSON{Name: "name", Publisher: "publisher", Version: "1.2.3"},
+		"extension/README.md":    "# Name",
+		"extension/icon.png":     "icon",
+	}
+}
+
+func createValidationVSIX(t *testing.T, manifest *storage.VSIXManifest, files map[string]any) []byte {
+	buf := bytes.NewBuffer(nil)
+	zw := zip.NewWriter(buf)
+	write := func(name string, body []byte) {
+		fw, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = fw.Write(body)
+		require.NoError(t, err)
+	}
+	if manifest != nil {
+		b, err := xml.Marshal(manifest)
+		require.NoError(t, err)
+		write("extension.vsixmanifest", b)
+	}
+	for name, body := range files {
+		switch body := body.(type) {
+		case string:
+			write(name, []byte(body))
+		default:
+			b, err := json.Marshal(body)
+			require.NoError(t, err)
+			write(name, b)
+		}
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestValidateVSIX(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		// modify changes the valid manifest and files.
+		modify func(manifest *storage.VSIXManifest, files map[string]any)
+		// raw replaces the generated VSIX.
+		raw []byte
+		// limits are passed to ValidateVSIX.
+		limits *easyzip.Limits
+		// checks are the checks expected to fail.
+		checks []string
+	}{
+		{
+			name: "Valid",
+		},
+		{
+			name: "Prerelease",
+			modify: func(manifest *storage.VSIXManifest, files map[string]any) {
+				manifest.Metadata.Identity.Version = "1.2.3-beta.1+build"
+				files["extension/package.json"] = storage.VSIXPackageJSON{Name: "name", Publisher: "publisher", Version: "1.2.3-beta.1+build"}
+			},
+		},
+		{
+			name: "Platform",
+			modify: func(manifest *storage.VSIXManifest, files map[string]any) {
+				manifest.Metadata.Identity.TargetPlatform = storage.PlatformLinuxX64
+			},
+		},
+		{
+			name:   "NotZip",
+			raw:    []byte("foo"),
+			checks: []string{storage.CheckArchive},
+		},
+		{
+			name: "NoManifest",
+			modify: func(manifest *storage.VSIXManifest, files map[string]any) {
+				*manifest = storage.VSIXManifest{}
+			},
+			checks: []string{storage.CheckManifest, storage.CheckPackageJSON},
+		},
+		{
+			name: "InvalidIdentifiers",
+			modify: func(manifest *storage.VSIXManifest, files map[string]any) {
+				manifest.Metadata.Identity.Publisher = "pub lisher"
+				manifest.Metadata.Identity.ID = "-name"
+				files["extension/package.json"] = storage.VSIXPackageJSON{Name: "-name", Publisher: "pub lisher", Version: "1.2.3"}
+			},
+			checks: []string{storage.CheckManifest, storage.CheckManifest},
+		},
+		{
+			name: "ShortVersion",
+			modify: func(manifest *storage.VSIXManifest, files map[string]any) {
+				manifest.Metadata.Identity.Version = "1.2"
+				files["extension/package.json"] = storage.VSIXPackageJSON{Name: "name", Publisher: "publisher", Version: "1.2"}
+			},
+			checks: []string{storage.CheckVersion},
+		},
+		{
+			name: "PrefixedVersion",
+			modify: func(manifest *storage.VSIXManifest, files map[string]any) {
+				manifest.Metadata.Identity.Version = "v1.2.3"
+				files["extension/package.json"] = storage.VSIXPackageJSON{Name: "name", Publisher: "publisher", Version: "v1.2.3"}
+			},
+			checks: []string{storage.CheckVersion},
+		},
+		{
+			name: "UnknownPlatform",
+			modify: func(manifest *storage.VSIXManifest, files map[string]any) {
+				manifest.Metadata.Identity.TargetPlatform = "plan9-x64"
+			},
+			checks: []string{storage.CheckTargetPlatform},
+		},
+		{
+			name: "PackageJSONMismatch",
+			modify: func(manifest *storage.VSIXManifest, files map[string]any) {
+				files["extension/package.json"] = storage.VSIXPackageJSON{Name: "other", Publisher: "publisher", Version: "1.2.4"}
+			},
+			checks: []string{storage.CheckPackageJSON, storage.CheckPackageJSON},
+		},
+		{
+			name: "PackageJSONInvalid",
+			modify: func(manifest *storage.VSIXManifest, files map[string]any) {
+				files["extension/package.json"] = "{"
+			},
+			checks: []string{storage.CheckPackageJSON},
+		},
+		{
+			name: "PackageJSONMissing",
+			modify: func(manifest *storage.VSIXManifest, files map[string]any) {
+				delete(files, "extension/package.json")
+			},
+			checks: []string{storage.CheckPackageJSON},
+		},
+		{
+			name: "PackageJSONUnlisted",
+			modify: func(manifest *storage.VSIXManifest, files map[string]any) {
+				manifest.Assets.Asset = manifest.Assets.Asset[1:]
+			},
+			checks: []string{storage.CheckPackageJSON},
+		},
+		{
+			name: "AssetMissing",
+			modify: func(manifest *storage.VSIXManifest, files map[string]any) {
+				delete(files, "extension/README.md")
+			},
+			checks: []string{storage.CheckAssets},
+		},
+		{
+			name: "NonAddressableAssetMissing",
+			modify: func(manifest *storage.VSIXManifest, files map[string]any) {
+				manifest.Assets.Asset[1].Addressable = "false"
+				delete(files, "extension/README.md")
+			},
+		},
+		{
+			name: "IconMissing",
+			modify: func(manifest *storage.VSIXManifest, files map[string]any) {
+				manifest.Metadata.Icon = "extension/missing.png"
+			},
+			checks: []string{storage.CheckIcon},
+		},
+		{
+			name:   "TooManyFiles",
+			limits: &easyzip.Limits{MaxEntries: 1},
+			checks: []string{storage.CheckArchive},
+		},
+		{
+			// Zero turns every limit off.
+			name:   "NoLimits",
+			limits: &easyzip.Limits{},
+		},
+		{
+			name: "InvalidDependencies",
+			modify: func(manifest *storage.VSIXManifest, files map[string]any) {
+				manifest.Metadata.Properties.Property = []storage.VSIXProperty{
+					{ID: storage.DependencyPropertyType, Value: "foo,foo.bar@1.0.0"},
+					{ID: storage.PackPropertyType, Value: "foo.bar, baz.qux"},
+				}
+			},
+			checks: []string{storage.CheckDependencies, storage.CheckDependencies, storage.CheckDependencies},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			vsix := test.raw
+			if vsix == nil {
+				manifest := validManifest()
+				files := validFiles()
+				if test.modify != nil {
+					test.modify(manifest, files)
+				}
+				vsix = createValidationVSIX(t, manifest, files)
+			}
+
+			report := storage.ValidateVSIX(vsix, test.limits)
+			checks := []string{}
+			for _, issue := range report.Issues {
+				checks = append(checks, issue.Check)
+			}
+			if len(test.checks) == 0 {
+				require.True(t, report.Valid, report.Issues)
+				require.Empty(t, report.Issues)
+				require.NoError(t, report.Err())
+				return
+			}
+			require.False(t, report.Valid)
+			require.Equal(t, test.checks, checks, report.Issues)
+			err := report.Err()
+			var validationErr *storage.ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			require.Contains(t, err.Error(), "extension failed validation")
+		})
+	}
+}
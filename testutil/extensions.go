@@ -24,6 +24,8 @@ type Extension struct {
 	LatestVersion string
 	Dependencies  []string
 	Pack          []string
+	// Readme is added as the README.md details asset if set.
+	Readme string
 }
 
 func (e Extension) Copy() Extension {
@@ -107,12 +109,13 @@ var Extensions = []Extension{
 		Categories:    "category1",
 		Versions:      []storage.Version{{Version: "version1"}, {Version: "version2"}},
 		LatestVersion: "version2",
+		Readme:        "# Thud\n\nKeeps the grue away while running quick tests in dark places.",
 	},
 	{
 		Publisher:     "qqqqqqqqqqq",
 		Name:          "qqqqq",
 		Description:   "qqqqqqqqqqqqqqqqqqq",
-		Tags:          "qq,qqq,qqqq",
+		Tags:          "qq,qqq,qqqq,__ext_qq",
 		Categories:    "q",
 		Versions:      []storage.Version{{Version: "qqq"}, {Version: "q"}},
 		LatestVersion: "qqq",
@@ -121,6 +124,13 @@ var Extensions = []Extension{
 
 func ConvertExtensionToManifest(ext Extension, version storage.Version) *storage.VSIXManifest {
 	ext = ext.Copy()
+	if ext.Readme != "" {
+		ext.Files = append(ext.Files, storage.VSIXAsset{
+			Type:        storage.DetailsAssetType,
+			Path:        "README.md",
+			Addressable: "true",
+		})
+	}
 	return &storage.VSIXManifest{
 		Metadata: storage.VSIXMetadata{
 			Identity: storage.VSIXIdentity{
@@ -13,6 +13,9 @@ import (
 
 // MockDB implements database.Database for tests.
 type MockDB struct {
+	// HealthError is returned from Health.
+	HealthError error
+
 	exts []*database.Extension
 }
 
@@ -34,18 +37,44 @@ func (db *MockDB) GetExtensionAssetPath(ctx context.Context, asset *database.Ass
 	return strings.Join([]string{baseURL.Path, "files", asset.Publisher, asset.Extension, asset.Version.String(), assetPath}, "/"), nil
 }
 
-func (db *MockDB) GetExtensions(ctx context.Context, filter database.Filter, flags database.Flag, baseURL url.URL) ([]*database.Extension, int, error) {
+func (db *MockDB) Health(ctx context.Context) error {
+	return db.HealthError
+}
+
+func (db *MockDB) GetExtensions(ctx context.Context, filter database.Filter, flags database.Flag, baseURL url.URL) ([]*database.Extension, *database.Totals, error) {
 	if flags&database.Unpublished != 0 {
-		return nil, 0, errors.New("fake error")
+		return nil, nil, errors.New("fake error")
 	}
 	if len(filter.Criteria) == 0 {
-		return nil, 0, nil
+		return nil, &database.Totals{}, nil
 	}
 	if len(filter.Criteria) > 1 && filter.Criteria[1].Type == database.ExtensionName {
 		if strings.HasPrefix(filter.Criteria[1].Value, "notexist") {
-			return nil, 0, nil
+			return nil, &database.Totals{}, nil
+		}
+		return db.exts[:1], &database.Totals{Count: 1}, nil
+	}
+	return db.exts, db.totals(), nil
+}
+
+// totals counts categories and platforms like a real database would.
+func (db *MockDB) totals() *database.Totals {
+	totals := &database.Totals{
+		Count:           len(db.exts),
+		Categories:      map[string]int{},
+		TargetPlatforms: map[storage.Platform]int{},
+	}
+	for _, ext := range db.exts {
+		for _, category := range ext.Categories {
+			totals.Categories[category]++
+		}
+		platforms := map[storage.Platform]struct{}{}
+		for _, version := range ext.Versions {
+			platforms[version.TargetPlatform] = struct{}{}
+		}
+		for platform := range platforms {
+			totals.TargetPlatforms[platform]++
 		}
-		return db.exts[:1], 1, nil
 	}
-	return db.exts, len(db.exts), nil
+	return totals
 }
@@ -3,26 +3,42 @@ package testutil
 import (
 	"context"
 	"errors"
+	"io"
 	"net/http"
 	"os"
 	"sort"
+	"strings"
+	"sync"
 
 	"github.com/coder/code-marketplace/storage"
 )
 
 var _ storage.Storage = (*MockStorage)(nil)
 
-// MockStorage implements storage.Storage for tests.
-type MockStorage struct{}
+// MockStorage implements storage.Storage for tests.  State files are kept in
+// memory.
+type MockStorage struct {
+	// HealthError is returned from Health.
+	HealthError error
+	// Seeding is returned from SeedStatus.
+	Seeding *storage.SeedStatus
+
+	state      map[string][]byte
+	stateMutex sync.Mutex
+}
 
 func NewMockStorage() *MockStorage {
-	return &MockStorage{}
+	return &MockStorage{state: map[string][]byte{}}
 }
 
 func (s *MockStorage) AddExtension(ctx context.Context, manifest *storage.VSIXManifest, vsix []byte, extra ...storage.File) (string, error) {
 	return "", errors.New("not implemented")
 }
 
+func (s *MockStorage) Health(ctx context.Context) error {
+	return s.HealthError
+}
+
 func (s *MockStorage) FileServer() http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/nonexistent" {
@@ -49,8 +65,51 @@ func (s *MockStorage) Manifest(ctx context.Context, publisher, name string, vers
 	return nil, os.ErrNotExist
 }
 
+func (s *MockStorage) Open(ctx context.Context, publisher, name string, version storage.Version, path string) (io.ReadCloser, error) {
+	for _, ext := range Extensions {
+		if ext.Publisher == publisher && ext.Name == name && ext.Readme != "" && path == "README.md" {
+			return io.NopCloser(strings.NewReader(ext.Readme)), nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+func (s *MockStorage) ReadState(ctx context.Context, name string) ([]byte, error) {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+	content, ok := s.state[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return content, nil
+}
+
+// RemoveExtension checks that the version exists but does not remove anything
+// since the extensions are shared between tests.
 func (s *MockStorage) RemoveExtension(ctx context.Context, publisher, name string, version storage.Version) error {
-	return errors.New("not implemented")
+	versions, err := s.Versions(ctx, publisher, name)
+	if err != nil {
+		return err
+	}
+	if len(storage.MatchVersions(versions, version)) == 0 {
+		return os.ErrNotExist
+	}
+	return nil
+}
+
+func (s *MockStorage) RemoveState(ctx context.Context, name string) error {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+	delete(s.state, name)
+	return nil
+}
+
+func (s *MockStorage) Seed(ctx context.Context) error {
+	return nil
+}
+
+func (s *MockStorage) SeedStatus() *storage.SeedStatus {
+	return s.Seeding
 }
 
 func (s *MockStorage) WalkExtensions(ctx context.Context, fn func(manifest *storage.VSIXManifest, versions []storage.Version) error) error {
@@ -66,5 +125,20 @@ func (s *MockStorage) WalkExtensions(ctx context.Context, fn func(manifest *stor
 }
 
 func (s *MockStorage) Versions(ctx context.Context, publisher, name string) ([]storage.Version, error) {
-	return nil, errors.New("not implemented")
+	for _, ext := range Extensions {
+		if ext.Publisher == publisher && ext.Name == name {
+			versions := make([]storage.Version, len(ext.Versions))
+			copy(versions, ext.Versions)
+			sort.Sort(storage.ByVersion(versions))
+			return versions, nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+func (s *MockStorage) WriteState(ctx context.Context, name string, content []byte) error {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+	s.state[name] = content
+	return nil
 }
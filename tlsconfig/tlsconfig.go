@@ -0,0 +1,144 @@
+// Package tlsconfig serves the marketplace over TLS with certificates that can
+// be replaced without restarting.
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+)
+
+// WatchIntervalDefault is how often certificate files are checked for changes.
+const WatchIntervalDefault = 10 * time.Second
+
+// Reloader holds a certificate and key pair that is loaded again when the files
+// change.  If loading fails the previous pair keeps being served.
+type Reloader struct {
+	certFile string
+	keyFile  string
+	logger   slog.Logger
+
+	mutex   sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewReloader loads the certificate and key pair, returning an error if they
+// cannot be loaded.
+func NewReloader(certFile, keyFile string, logger slog.Logger) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		logger:   logger,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate.  It can be used as
+// tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.cert, nil
+}
+
+// Reload loads the certificate and key pair from disk.
+func (r *Reloader) Reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return xerrors.Errorf("load key pair: %w", err)
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+// Watch reloads the certificate and key pair whenever either file changes until
+// the context is canceled.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		modTime, err := r.latestModTime()
+		if err != nil {
+			r.logger.Warn(ctx, "Unable to check certificate", slog.Error(err))
+			continue
+		}
+		r.mutex.RLock()
+		changed := !modTime.Equal(r.modTime)
+		r.mutex.RUnlock()
+		if !changed {
+			continue
+		}
+		if err := r.Reload(); err != nil {
+			r.logger.Error(ctx, "Unable to reload certificate", slog.Error(err))
+			// Record the time anyway so a broken pair is not retried every tick.
+			// The next write to either file will try again.
+			r.mutex.Lock()
+			r.modTime = modTime
+			r.mutex.Unlock()
+			continue
+		}
+		r.logger.Info(ctx, "Reloaded certificate", slog.F("cert", r.certFile))
+	}
+}
+
+// latestModTime returns the most recent modification time of the certificate
+// and key files.
+func (r *Reloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		stat, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if stat.ModTime().After(latest) {
+			latest = stat.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// New returns a TLS config serving the reloader's certificate over HTTP/2 and
+// HTTP/1.1, requiring client certificates if a client CA is configured.
+func New(reloader *Reloader, clientCAFile string) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, xerrors.Errorf("read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, xerrors.Errorf("no certificates found in %q", clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
@@ -0,0 +1,249 @@
+package tlsconfig_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"cdr.dev/slog/sloggers/slogtest"
+	"github.com/coder/code-marketplace/tlsconfig"
+)
+
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+	pem  []byte
+}
+
+func newAuthority(t *testing.T) *authority {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &authority{
+		cert: cert,
+		key:  key,
+		pool: pool,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue returns a PEM certificate and key signed by the authority.
+func (a *authority) issue(t *testing.T, serial int64, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.cert, &key.PublicKey, a.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeServerCert writes a server certificate with the serial to the files.
+// The modification time is moved forward so changes are always noticed.
+func (a *authority) writeServerCert(t *testing.T, serial int64, certFile, keyFile string) {
+	t.Helper()
+	certPEM, keyPEM := a.issue(t, serial, x509.ExtKeyUsageServerAuth)
+	require.NoError(t, os.WriteFile(certFile, certPEM, 0o600))
+	require.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+	modTime := time.Now().Add(time.Duration(serial) * time.Second)
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+}
+
+// serve starts a TLS server using the config and returns its URL.
+func serve(t *testing.T, config *tls.Config) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rw.WriteHeader(http.StatusOK)
+		}),
+		TLSConfig: config,
+	}
+	go func() {
+		_ = server.ServeTLS(listener, "", "")
+	}()
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+	return "https://" + listener.Addr().String()
+}
+
+func client(pool *x509.CertPool, certs ...tls.Certificate) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			ForceAttemptHTTP2: true,
+			TLSClientConfig: &tls.Config{
+				RootCAs:      pool,
+				Certificates: certs,
+			},
+		},
+	}
+}
+
+// get returns the serial of the server certificate along with the protocol.
+func get(t *testing.T, c *http.Client, url string) (int64, string) {
+	t.Helper()
+	resp, err := c.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	return resp.TLS.PeerCertificates[0].SerialNumber.Int64(), resp.Proto
+}
+
+func TestReloader(t *testing.T) {
+	t.Parallel()
+
+	ca := newAuthority(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	ca.writeServerCert(t, 1, certFile, keyFile)
+
+	logger := slogtest.Make(t, &slogtest.Options{IgnoreErrors: true})
+	reloader, err := tlsconfig.NewReloader(certFile, keyFile, logger)
+	require.NoError(t, err)
+	config, err := tlsconfig.New(reloader, "")
+	require.NoError(t, err)
+	url := serve(t, config)
+
+	serial, proto := get(t, client(ca.pool), url)
+	require.Equal(t, int64(1), serial)
+	require.Equal(t, "HTTP/2.0", proto)
+
+	// Reloading picks up the new certificate for new connections.
+	ca.writeServerCert(t, 2, certFile, keyFile)
+	require.NoError(t, reloader.Reload())
+	serial, _ = get(t, client(ca.pool), url)
+	require.Equal(t, int64(2), serial)
+
+	// A broken pair fails to load and leaves the previous one in place.
+	require.NoError(t, os.WriteFile(keyFile, []byte("invalid"), 0o600))
+	require.Error(t, reloader.Reload())
+	serial, _ = get(t, client(ca.pool), url)
+	require.Equal(t, int64(2), serial)
+}
+
+func TestReloaderWatch(t *testing.T) {
+	t.Parallel()
+
+	ca := newAuthority(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	ca.writeServerCert(t, 1, certFile, keyFile)
+
+	logger := slogtest.Make(t, &slogtest.Options{IgnoreErrors: true})
+	reloader, err := tlsconfig.NewReloader(certFile, keyFile, logger)
+	require.NoError(t, err)
+	config, err := tlsconfig.New(reloader, "")
+	require.NoError(t, err)
+	url := serve(t, config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go reloader.Watch(ctx, 10*time.Millisecond)
+
+	ca.writeServerCert(t, 3, certFile, keyFile)
+	require.Eventually(t, func() bool {
+		serial, _ := get(t, client(ca.pool), url)
+		return serial == 3
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestNewReloader(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	logger := slogtest.Make(t, &slogtest.Options{IgnoreErrors: true})
+	_, err := tlsconfig.NewReloader(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), logger)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, []byte("invalid"), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, []byte("invalid"), 0o600))
+	_, err = tlsconfig.NewReloader(certFile, keyFile, logger)
+	require.ErrorContains(t, err, "load key pair")
+}
+
+func TestClientCA(t *testing.T) {
+	t.Parallel()
+
+	ca := newAuthority(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	ca.writeServerCert(t, 1, certFile, keyFile)
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, ca.pem, 0o600))
+
+	logger := slogtest.Make(t, &slogtest.Options{IgnoreErrors: true})
+	reloader, err := tlsconfig.NewReloader(certFile, keyFile, logger)
+	require.NoError(t, err)
+	config, err := tlsconfig.New(reloader, caFile)
+	require.NoError(t, err)
+	url := serve(t, config)
+
+	// Without a client certificate the handshake fails.
+	_, err = client(ca.pool).Get(url)
+	require.Error(t, err)
+
+	// A certificate from another authority is rejected too.
+	other := newAuthority(t)
+	certPEM, keyPEM := other.issue(t, 1, x509.ExtKeyUsageClientAuth)
+	otherCert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	_, err = client(ca.pool, otherCert).Get(url)
+	require.Error(t, err)
+
+	certPEM, keyPEM = ca.issue(t, 2, x509.ExtKeyUsageClientAuth)
+	clientCert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	serial, _ := get(t, client(ca.pool, clientCert), url)
+	require.Equal(t, int64(1), serial)
+
+	// The bundle must contain certificates.
+	emptyFile := filepath.Join(dir, "empty.pem")
+	require.NoError(t, os.WriteFile(emptyFile, []byte{}, 0o600))
+	_, err = tlsconfig.New(reloader, emptyFile)
+	require.ErrorContains(t, err, "no certificates found")
+}
@@ -0,0 +1,90 @@
+// Package tracing sets up OpenTelemetry tracing for the marketplace.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"golang.org/x/xerrors"
+)
+
+// InstrumentationName identifies the marketplace's spans.
+const InstrumentationName = "github.com/coder/code-marketplace"
+
+// Propagator reads and writes W3C trace context headers.  Baggage is left out
+// since it comes from untrusted clients and would be forwarded to Artifactory.
+var Propagator propagation.TextMapPropagator = propagation.TraceContext{}
+
+// Tracer returns the marketplace's tracer from the provider.  A nil provider
+// returns a tracer that records nothing.
+func Tracer(provider trace.TracerProvider) trace.Tracer {
+	if provider == nil {
+		provider = noop.NewTracerProvider()
+	}
+	return provider.Tracer(InstrumentationName)
+}
+
+// End records the error on the span, if there is one, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Sampler samples a fraction of requests by their trace ID, ignoring whether
+// the client marked the trace as sampled, and the spans within a request along
+// with the request.
+func Sampler(ratio float64) sdktrace.Sampler {
+	ratioBased := sdktrace.TraceIDRatioBased(ratio)
+	return sdktrace.ParentBased(ratioBased,
+		sdktrace.WithRemoteParentSampled(ratioBased),
+		sdktrace.WithRemoteParentNotSampled(ratioBased),
+	)
+}
+
+type Options struct {
+	// Endpoint is the URL of an OTLP/HTTP collector, for example
+	// http://localhost:4318.  The standard OTEL_EXPORTER_OTLP_* environment
+	// variables can set headers and other exporter options.
+	Endpoint string
+	// SampleRatio is the fraction of requests to sample.  It also applies to
+	// requests continuing a trace since clients choose the sampled flag in the
+	// traceparent they send.
+	SampleRatio float64
+	// ServiceVersion is reported along with the service name.
+	ServiceVersion string
+}
+
+// NewProvider returns a provider that batches spans and exports them over
+// OTLP.  Shut it down to flush remaining spans.
+func NewProvider(ctx context.Context, options Options) (*sdktrace.TracerProvider, error) {
+	if options.Endpoint == "" {
+		return nil, xerrors.New("an OTLP endpoint is required")
+	}
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(options.Endpoint))
+	if err != nil {
+		return nil, xerrors.Errorf("create OTLP exporter: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName("code-marketplace"),
+		semconv.ServiceVersion(options.ServiceVersion),
+	))
+	if err != nil {
+		return nil, xerrors.Errorf("create resource: %w", err)
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(Sampler(options.SampleRatio)),
+	), nil
+}
@@ -0,0 +1,154 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/xerrors"
+
+	"github.com/coder/code-marketplace/tracing"
+)
+
+func TestTracer(t *testing.T) {
+	t.Parallel()
+
+	// A nil provider should still produce a usable tracer.
+	_, span := tracing.Tracer(nil).Start(context.Background(), "span")
+	require.False(t, span.SpanContext().IsValid())
+	tracing.End(span, xerrors.New("ignored"))
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	_, span = tracing.Tracer(provider).Start(context.Background(), "ok")
+	tracing.End(span, nil)
+	_, span = tracing.Tracer(provider).Start(context.Background(), "failed")
+	tracing.End(span, xerrors.New("uh oh"))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	require.Equal(t, tracing.InstrumentationName, spans[0].InstrumentationScope.Name)
+	require.Equal(t, codes.Unset, spans[0].Status.Code)
+	require.Equal(t, codes.Error, spans[1].Status.Code)
+	require.Equal(t, "uh oh", spans[1].Status.Description)
+	require.Len(t, spans[1].Events, 1)
+}
+
+func TestNewProvider(t *testing.T) {
+	t.Parallel()
+
+	t.Run("NoEndpoint", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := tracing.NewProvider(context.Background(), tracing.Options{})
+		require.ErrorContains(t, err, "endpoint is required")
+	})
+
+	t.Run("Export", func(t *testing.T) {
+		t.Parallel()
+
+		var exports atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v1/traces" && r.Method == http.MethodPost {
+				exports.Add(1)
+			}
+			rw.Header().Set("Content-Type", "application/x-protobuf")
+			rw.WriteHeader(http.StatusOK)
+		}))
+		t.Cleanup(server.Close)
+
+		provider, err := tracing.NewProvider(context.Background(), tracing.Options{
+			Endpoint:    server.URL,
+			SampleRatio: 1,
+		})
+		require.NoError(t, err)
+		_, span := tracing.Tracer(provider).Start(context.Background(), "span")
+		span.End()
+
+		// Shutting down flushes the batch.
+		require.NoError(t, provider.Shutdown(context.Background()))
+		require.Equal(t, int32(1), exports.Load())
+	})
+
+	t.Run("NotSampled", func(t *testing.T) {
+		t.Parallel()
+
+		provider, err := tracing.NewProvider(context.Background(), tracing.Options{
+			Endpoint:    "http://127.0.0.1:0",
+			SampleRatio: 0,
+		})
+		require.NoError(t, err)
+		_, span := tracing.Tracer(provider).Start(context.Background(), "span")
+		require.False(t, span.IsRecording())
+		span.End()
+		require.NoError(t, provider.Shutdown(context.Background()))
+	})
+}
+
+func TestSampler(t *testing.T) {
+	t.Parallel()
+
+	remote := func(sampled bool) context.Context {
+		flags := trace.TraceFlags(0)
+		if sampled {
+			flags = trace.FlagsSampled
+		}
+		return trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{1},
+			SpanID:     trace.SpanID{1},
+			TraceFlags: flags,
+			Remote:     true,
+		}))
+	}
+
+	tests := []struct {
+		name    string
+		ratio   float64
+		ctx     context.Context
+		sampled bool
+	}{
+		{name: "Root", ratio: 1, ctx: context.Background(), sampled: true},
+		{name: "RootNever", ratio: 0, ctx: context.Background()},
+		// Clients cannot force sampling by marking their trace as sampled.
+		{name: "RemoteSampled", ratio: 0, ctx: remote(true)},
+		{name: "RemoteNotSampled", ratio: 1, ctx: remote(false), sampled: true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSampler(tracing.Sampler(test.ratio)))
+			ctx, span := tracing.Tracer(provider).Start(test.ctx, "request")
+			require.Equal(t, test.sampled, span.IsRecording())
+			// Spans within the request follow the request.
+			_, child := tracing.Tracer(provider).Start(ctx, "child")
+			require.Equal(t, test.sampled, child.IsRecording())
+			child.End()
+			span.End()
+		})
+	}
+}
+
+func TestPropagator(t *testing.T) {
+	t.Parallel()
+
+	// Baggage from clients is not passed on.
+	header := http.Header{}
+	header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	header.Set("baggage", "user=alice")
+	ctx := tracing.Propagator.Extract(context.Background(), propagation.HeaderCarrier(header))
+	out := http.Header{}
+	tracing.Propagator.Inject(ctx, propagation.HeaderCarrier(out))
+	require.Equal(t, header.Get("traceparent"), out.Get("traceparent"))
+	require.Empty(t, out.Get("baggage"))
+}
@@ -0,0 +1,143 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+)
+
+// delivery is a queued webhook for a single URL.  It holds everything needed
+// to make the delivery since it might be made by another process sharing the
+// queue, which can have different webhooks configured.
+type delivery struct {
+	ID    string          `json:"id"`
+	URL   string          `json:"url"`
+	Event Event           `json:"event"`
+	Body  json.RawMessage `json:"body"`
+	// Signature is the value of the signature header, if the process that
+	// queued the delivery has a secret.
+	Signature   string    `json:"signature,omitempty"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"nextAttempt"`
+}
+
+func newDeliveryID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// queue stores each delivery as a file in a directory.  Files are written to a
+// temporary file first then renamed so a crash never leaves a partial delivery
+// behind.  Files that cannot be parsed anyway, for example because they were
+// edited by hand, are renamed with a .bad extension so they do not block the
+// rest of the queue.
+type queue struct {
+	dir    string
+	logger slog.Logger
+}
+
+func newQueue(dir string, logger slog.Logger) (*queue, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, xerrors.Errorf("create webhook queue: %w", err)
+	}
+	return &queue{dir: dir, logger: logger}, nil
+}
+
+func (q *queue) path(id string) string {
+	return filepath.Join(q.dir, id+".json")
+}
+
+func (q *queue) put(d *delivery) error {
+	content, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(q.dir, ".tmp-*")
+	if err != nil {
+		return xerrors.Errorf("queue webhook: %w", err)
+	}
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), q.path(d.ID))
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return xerrors.Errorf("queue webhook: %w", err)
+	}
+	return nil
+}
+
+func (q *queue) remove(id string) error {
+	err := os.Remove(q.path(id))
+	// Another process might have already delivered it.
+	if err != nil && !os.IsNotExist(err) {
+		return xerrors.Errorf("dequeue webhook: %w", err)
+	}
+	return nil
+}
+
+// list returns the queued deliveries ordered by when they are next due.
+func (q *queue) list() ([]*delivery, error) {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, xerrors.Errorf("read webhook queue: %w", err)
+	}
+	deliveries := []*delivery{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != ".json" {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(q.dir, name))
+		// Another process might have delivered it since the directory was read.
+		if err != nil && os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, xerrors.Errorf("read webhook queue: %w", err)
+		}
+		var d delivery
+		err = json.Unmarshal(content, &d)
+		if err == nil && d.ID+".json" != name {
+			err = xerrors.Errorf("delivery ID %q does not match the file name", d.ID)
+		}
+		if err != nil {
+			q.moveAside(name, err)
+			continue
+		}
+		deliveries = append(deliveries, &d)
+	}
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].NextAttempt.Before(deliveries[j].NextAttempt)
+	})
+	return deliveries, nil
+}
+
+// moveAside renames a queued file that cannot be parsed so it is skipped from
+// then on but kept for inspection.
+func (q *queue) moveAside(name string, err error) {
+	ctx := context.Background()
+	path := filepath.Join(q.dir, name)
+	q.logger.Error(ctx, "Unable to parse queued webhook, moving it aside",
+		slog.F("path", path+".bad"),
+		slog.Error(err))
+	if err := os.Rename(path, path+".bad"); err != nil && !os.IsNotExist(err) {
+		q.logger.Error(ctx, "Unable to move queued webhook aside", slog.F("path", path), slog.Error(err))
+	}
+}
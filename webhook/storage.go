@@ -0,0 +1,118 @@
+package webhook
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"strings"
+
+	"cdr.dev/slog"
+	"github.com/coder/code-marketplace/storage"
+)
+
+var (
+	_ storage.Storage   = (*Storage)(nil)
+	_ storage.Unwrapper = (*Storage)(nil)
+)
+
+// Storage is a storage wrapper that queues webhooks after extensions are
+// successfully added or removed.
+type Storage struct {
+	Dispatcher *Dispatcher
+	Logger     slog.Logger
+	// PublicURL is the URL the marketplace is reachable at, used to build
+	// download URLs.  Download URLs are omitted if it is blank.
+	PublicURL string
+	storage.Storage
+}
+
+func NewStorage(s storage.Storage, dispatcher *Dispatcher, publicURL string, logger slog.Logger) *Storage {
+	return &Storage{
+		Dispatcher: dispatcher,
+		Logger:     logger,
+		PublicURL:  publicURL,
+		Storage:    s,
+	}
+}
+
+func (s *Storage) AddExtension(ctx context.Context, manifest *storage.VSIXManifest, vsix []byte, extra ...storage.File) (string, error) {
+	location, err := s.Storage.AddExtension(ctx, manifest, vsix, extra...)
+	if err != nil {
+		return "", err
+	}
+
+	identity := manifest.Metadata.Identity
+	version := storage.Version{Version: identity.Version, TargetPlatform: identity.TargetPlatform}
+	payload := Payload{
+		Event:          EventAdded,
+		ID:             storage.ExtensionIDWithoutVersion(identity.Publisher, identity.ID),
+		Version:        version.Version,
+		TargetPlatform: version.TargetPlatform,
+		DownloadURL:    s.downloadURL(identity.Publisher, identity.ID, version),
+	}
+	for _, prop := range manifest.Metadata.Properties.Property {
+		if prop.ID == storage.DependencyPropertyType && prop.Value != "" {
+			payload.Dependencies = append(payload.Dependencies, strings.Split(prop.Value, ",")...)
+		}
+	}
+	s.enqueue(ctx, payload)
+
+	return location, nil
+}
+
+func (s *Storage) RemoveExtension(ctx context.Context, publisher, name string, version storage.Version) error {
+	// Find out which builds are being removed first since they will be gone
+	// afterward.
+	versions, err := s.Storage.Versions(ctx, publisher, name)
+	if err != nil {
+		versions = nil
+	}
+
+	err = s.Storage.RemoveExtension(ctx, publisher, name, version)
+	if err != nil {
+		return err
+	}
+
+	for _, removed := range storage.MatchVersions(versions, version) {
+		platform := removed.TargetPlatform
+		if removed.IsUniversal() {
+			platform = ""
+		}
+		s.enqueue(ctx, Payload{
+			Event:          EventRemoved,
+			ID:             storage.ExtensionIDWithoutVersion(publisher, name),
+			Version:        removed.Version,
+			TargetPlatform: platform,
+		})
+	}
+	return nil
+}
+
+// enqueue queues a webhook.  Failing to queue it is logged rather than
+// returned since the change it is about has already been made.
+func (s *Storage) enqueue(ctx context.Context, payload Payload) {
+	err := s.Dispatcher.Enqueue(payload)
+	if err != nil {
+		s.Logger.Error(ctx, "Unable to queue webhook", slog.Error(err),
+			slog.F("event", payload.Event),
+			slog.F("id", payload.ID),
+			slog.F("version", payload.Version))
+	}
+}
+
+func (s *Storage) downloadURL(publisher, name string, version storage.Version) string {
+	if s.PublicURL == "" {
+		return ""
+	}
+	base, err := url.Parse(s.PublicURL)
+	if err != nil {
+		return ""
+	}
+	base.Path = path.Join(base.Path, "assets", publisher, name, version.String(), string(storage.VSIXAssetType))
+	return base.String()
+}
+
+// Unwrap returns the wrapped storage.
+func (s *Storage) Unwrap() storage.Storage {
+	return s.Storage
+}
@@ -0,0 +1,320 @@
+// Package webhook notifies other services when extensions are added to or
+// removed from the marketplace.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"cdr.dev/slog"
+	"github.com/coder/code-marketplace/storage"
+)
+
+// Event is the kind of change a webhook is notifying about.
+type Event string
+
+const (
+	EventAdded   Event = "extension.added"
+	EventRemoved Event = "extension.removed"
+)
+
+const (
+	// EventHeader holds the event of the delivery.
+	EventHeader = "X-Marketplace-Event"
+	// DeliveryHeader holds an ID that is the same across retries of a delivery
+	// so receivers can ignore deliveries they have already handled.
+	DeliveryHeader = "X-Marketplace-Delivery"
+	// SignatureHeader holds `sha256=` followed by the hex-encoded HMAC-SHA256 of
+	// the body using the webhook secret.
+	SignatureHeader = "X-Marketplace-Signature"
+)
+
+const (
+	MaxAttemptsDefault = 10
+	MinBackoffDefault  = 5 * time.Second
+	MaxBackoffDefault  = time.Hour
+	// pollInterval is how often the queue is checked for deliveries added by
+	// other processes, like the add and remove commands.
+	pollInterval = time.Minute
+)
+
+// Payload is the body of a webhook.
+type Payload struct {
+	Event Event     `json:"event"`
+	Time  time.Time `json:"time"`
+	// ID is the extension ID (publisher.name).
+	ID             string           `json:"id"`
+	Version        string           `json:"version"`
+	TargetPlatform storage.Platform `json:"targetPlatform,omitempty"`
+	// DownloadURL is only set for added extensions and only when the public URL
+	// of the marketplace is known.
+	DownloadURL  string   `json:"downloadUrl,omitempty"`
+	Dependencies []string `json:"dependencies,omitempty"`
+}
+
+// Sign returns the value of the signature header for the body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify returns true if the signature header value matches the body.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+type Options struct {
+	// URLs receive every event.
+	URLs []string
+	// Secret, if set, is used to sign deliveries.
+	Secret string
+	// QueueDir holds deliveries until they succeed so they survive restarts.
+	QueueDir string
+	Logger   slog.Logger
+	// Client defaults to a client with a ten second timeout.
+	Client *http.Client
+	// MaxAttempts is how many times a delivery is attempted before giving up.
+	MaxAttempts int
+	// Failed deliveries are retried after MinBackoff, doubling after each
+	// attempt up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// Dispatcher queues and delivers webhooks.  Delivery is at least once; a
+// delivery might be repeated if it is flushed by more than one process at the
+// same time or if recording its success fails.  Deliveries are made as they
+// were queued, so ones queued by another process sharing the queue go to that
+// process's URLs and are signed with its secret.
+type Dispatcher struct {
+	client      *http.Client
+	flushMutex  sync.Mutex
+	logger      slog.Logger
+	maxAttempts int
+	maxBackoff  time.Duration
+	minBackoff  time.Duration
+	queue       *queue
+	secret      string
+	urls        []string
+	wake        chan struct{}
+}
+
+func NewDispatcher(options *Options) (*Dispatcher, error) {
+	if options.QueueDir == "" {
+		return nil, xerrors.New("a queue directory is required")
+	}
+	for _, u := range options.URLs {
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, xerrors.Errorf("%q is not a valid webhook URL", u)
+		}
+	}
+	queue, err := newQueue(options.QueueDir, options.Logger)
+	if err != nil {
+		return nil, err
+	}
+	d := &Dispatcher{
+		client:      options.Client,
+		logger:      options.Logger,
+		maxAttempts: options.MaxAttempts,
+		maxBackoff:  options.MaxBackoff,
+		minBackoff:  options.MinBackoff,
+		queue:       queue,
+		secret:      options.Secret,
+		urls:        options.URLs,
+		wake:        make(chan struct{}, 1),
+	}
+	if d.client == nil {
+		d.client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if d.maxAttempts <= 0 {
+		d.maxAttempts = MaxAttemptsDefault
+	}
+	if d.minBackoff <= 0 {
+		d.minBackoff = MinBackoffDefault
+	}
+	if d.maxBackoff <= 0 {
+		d.maxBackoff = MaxBackoffDefault
+	}
+	return d, nil
+}
+
+// Enqueue persists a delivery of the payload for each URL.  Deliveries are
+// made by Run or Flush.
+func (d *Dispatcher) Enqueue(payload Payload) error {
+	if payload.Time.IsZero() {
+		payload.Time = time.Now().UTC()
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	signature := ""
+	if d.secret != "" {
+		signature = Sign(d.secret, body)
+	}
+	for _, u := range d.urls {
+		id, err := newDeliveryID()
+		if err != nil {
+			return err
+		}
+		err = d.queue.put(&delivery{
+			ID:          id,
+			URL:         u,
+			Event:       payload.Event,
+			Body:        body,
+			Signature:   signature,
+			NextAttempt: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run delivers queued deliveries, including any left from previous runs, until
+// the context is canceled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		next, err := d.flush(ctx)
+		if err != nil && ctx.Err() == nil {
+			d.logger.Error(ctx, "Unable to flush webhook queue", slog.Error(err))
+		}
+		wait := pollInterval
+		if !next.IsZero() && time.Until(next) < wait {
+			wait = time.Until(next)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-d.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// Flush attempts every delivery that is due once and returns the number of
+// deliveries still queued.
+func (d *Dispatcher) Flush(ctx context.Context) (int, error) {
+	_, err := d.flush(ctx)
+	if err != nil {
+		return 0, err
+	}
+	deliveries, err := d.queue.list()
+	return len(deliveries), err
+}
+
+// flush attempts every delivery that is due and returns when the next one will
+// be due, or a zero time if the queue is empty.
+func (d *Dispatcher) flush(ctx context.Context) (time.Time, error) {
+	d.flushMutex.Lock()
+	defer d.flushMutex.Unlock()
+
+	deliveries, err := d.queue.list()
+	if err != nil {
+		return time.Time{}, err
+	}
+	var next time.Time
+	for _, del := range deliveries {
+		if ctx.Err() != nil {
+			return time.Time{}, ctx.Err()
+		}
+		if time.Now().Before(del.NextAttempt) {
+			if next.IsZero() || del.NextAttempt.Before(next) {
+				next = del.NextAttempt
+			}
+			continue
+		}
+		retry, err := d.attempt(ctx, del)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if retry && (next.IsZero() || del.NextAttempt.Before(next)) {
+			next = del.NextAttempt
+		}
+	}
+	return next, nil
+}
+
+// attempt makes a delivery and updates the queue with the result, returning
+// whether it will be retried.
+func (d *Dispatcher) attempt(ctx context.Context, del *delivery) (bool, error) {
+	ctx = slog.With(ctx,
+		slog.F("delivery", del.ID),
+		slog.F("url", del.URL),
+		slog.F("event", del.Event))
+
+	err := d.deliver(ctx, del)
+	if err == nil {
+		d.logger.Debug(ctx, "Delivered webhook")
+		return false, d.queue.remove(del.ID)
+	}
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+
+	del.Attempts++
+	if del.Attempts >= d.maxAttempts {
+		d.logger.Error(ctx, "Giving up on webhook delivery", slog.Error(err), slog.F("attempts", del.Attempts))
+		return false, d.queue.remove(del.ID)
+	}
+	del.NextAttempt = time.Now().Add(d.backoff(del.Attempts))
+	d.logger.Warn(ctx, "Webhook delivery failed; will retry", slog.Error(err),
+		slog.F("attempts", del.Attempts),
+		slog.F("next_attempt", del.NextAttempt))
+	return true, d.queue.put(del)
+}
+
+// backoff returns how long to wait after the provided number of failed
+// attempts.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	backoff := d.minBackoff
+	for i := 1; i < attempts && backoff < d.maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, d.maxBackoff)
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, del *delivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, del.URL, bytes.NewReader(del.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "code-marketplace")
+	req.Header.Set(EventHeader, string(del.Event))
+	req.Header.Set(DeliveryHeader, del.ID)
+	if del.Signature != "" {
+		req.Header.Set(SignatureHeader, del.Signature)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return xerrors.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,404 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"cdr.dev/slog"
+	"cdr.dev/slog/sloggers/slogtest"
+	"github.com/coder/code-marketplace/storage"
+	"github.com/coder/code-marketplace/testutil"
+	"github.com/coder/code-marketplace/webhook"
+)
+
+const secret = "hunter2"
+
+type request struct {
+	body   []byte
+	header http.Header
+}
+
+// receiver records webhooks it receives and responds with the status returned
+// by the provided function, which is given the number of the request starting
+// at one.
+type receiver struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	requests []request
+	received chan struct{}
+}
+
+func newReceiver(t *testing.T, status func(n int) int) *receiver {
+	r := &receiver{received: make(chan struct{}, 100)}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		r.mutex.Lock()
+		r.requests = append(r.requests, request{body: body, header: req.Header.Clone()})
+		n := len(r.requests)
+		r.mutex.Unlock()
+		rw.WriteHeader(status(n))
+		r.received <- struct{}{}
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiver) get() []request {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]request{}, r.requests...)
+}
+
+func (r *receiver) payloads(t *testing.T) []webhook.Payload {
+	payloads := []webhook.Payload{}
+	for _, req := range r.get() {
+		var payload webhook.Payload
+		require.NoError(t, json.Unmarshal(req.body, &payload))
+		payloads = append(payloads, payload)
+	}
+	return payloads
+}
+
+func always(status int) func(int) int {
+	return func(int) int {
+		return status
+	}
+}
+
+func newDispatcher(t *testing.T, dir string, urls ...string) *webhook.Dispatcher {
+	dispatcher, err := webhook.NewDispatcher(&webhook.Options{
+		URLs:        urls,
+		Secret:      secret,
+		QueueDir:    dir,
+		Logger:      slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}).Leveled(slog.LevelDebug),
+		MaxAttempts: 3,
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+	})
+	require.NoError(t, err)
+	return dispatcher
+}
+
+// flush flushes until the queue is empty, waiting out any backoff.
+func flush(t *testing.T, dispatcher *webhook.Dispatcher) {
+	require.Eventually(t, func() bool {
+		pending, err := dispatcher.Flush(context.Background())
+		require.NoError(t, err)
+		return pending == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSign(t *testing.T) {
+	t.Parallel()
+
+	body := []byte(`{"event":"extension.added"}`)
+	signature := webhook.Sign(secret, body)
+	require.Regexp(t, "^sha256=[0-9a-f]{64}$", signature)
+	require.True(t, webhook.Verify(secret, body, signature))
+	require.False(t, webhook.Verify("wrong", body, signature))
+	require.False(t, webhook.Verify(secret, []byte(`{}`), signature))
+}
+
+func TestNewDispatcher(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		dir   string
+		urls  []string
+		error string
+	}{
+		{
+			name: "OK",
+			dir:  t.TempDir(),
+			urls: []string{"http://localhost:8080/hook", "https://domain.tld"},
+		},
+		{
+			name:  "NoDir",
+			urls:  []string{"http://localhost:8080/hook"},
+			error: "queue directory is required",
+		},
+		{
+			name:  "BadScheme",
+			dir:   t.TempDir(),
+			urls:  []string{"ftp://domain.tld"},
+			error: "not a valid webhook URL",
+		},
+		{
+			name:  "NoHost",
+			dir:   t.TempDir(),
+			urls:  []string{"http://"},
+			error: "not a valid webhook URL",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := webhook.NewDispatcher(&webhook.Options{URLs: test.urls, QueueDir: test.dir})
+			if test.error != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), test.error)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	t.Parallel()
+
+	r1 := newReceiver(t, always(http.StatusNoContent))
+	r2 := newReceiver(t, always(http.StatusOK))
+	dispatcher := newDispatcher(t, t.TempDir(), r1.URL, r2.URL)
+
+	payload := webhook.Payload{
+		Event:   webhook.EventAdded,
+		ID:      "foo.bar",
+		Version: "1.0.0",
+	}
+	require.NoError(t, dispatcher.Enqueue(payload))
+	flush(t, dispatcher)
+
+	for _, r := range []*receiver{r1, r2} {
+		requests := r.get()
+		require.Len(t, requests, 1)
+		req := requests[0]
+		require.Equal(t, "application/json", req.header.Get("Content-Type"))
+		require.Equal(t, string(webhook.EventAdded), req.header.Get(webhook.EventHeader))
+		require.NotEmpty(t, req.header.Get(webhook.DeliveryHeader))
+		require.True(t, webhook.Verify(secret, req.body, req.header.Get(webhook.SignatureHeader)))
+
+		payloads := r.payloads(t)
+		require.Equal(t, payload.ID, payloads[0].ID)
+		require.Equal(t, payload.Version, payloads[0].Version)
+		require.False(t, payloads[0].Time.IsZero())
+	}
+	// Each URL gets its own delivery.
+	require.NotEqual(t,
+		r1.get()[0].header.Get(webhook.DeliveryHeader),
+		r2.get()[0].header.Get(webhook.DeliveryHeader))
+}
+
+func TestRetry(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Succeeds", func(t *testing.T) {
+		t.Parallel()
+
+		r := newReceiver(t, func(n int) int {
+			if n < 3 {
+				return http.StatusServiceUnavailable
+			}
+			return http.StatusOK
+		})
+		dispatcher := newDispatcher(t, t.TempDir(), r.URL)
+		require.NoError(t, dispatcher.Enqueue(webhook.Payload{Event: webhook.EventRemoved, ID: "foo.bar"}))
+		flush(t, dispatcher)
+
+		requests := r.get()
+		require.Len(t, requests, 3)
+		// Retries reuse the delivery ID and body.
+		for _, req := range requests[1:] {
+			require.Equal(t, requests[0].header.Get(webhook.DeliveryHeader), req.header.Get(webhook.DeliveryHeader))
+			require.Equal(t, requests[0].body, req.body)
+		}
+	})
+
+	t.Run("GivesUp", func(t *testing.T) {
+		t.Parallel()
+
+		r := newReceiver(t, always(http.StatusInternalServerError))
+		dispatcher := newDispatcher(t, t.TempDir(), r.URL)
+		require.NoError(t, dispatcher.Enqueue(webhook.Payload{Event: webhook.EventRemoved, ID: "foo.bar"}))
+		flush(t, dispatcher)
+
+		// MaxAttempts is three.
+		require.Len(t, r.get(), 3)
+	})
+}
+
+func TestPersistence(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mutex sync.Mutex
+		up    bool
+	)
+	r := newReceiver(t, func(int) int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if up {
+			return http.StatusOK
+		}
+		return http.StatusBadGateway
+	})
+
+	dir := t.TempDir()
+	dispatcher := newDispatcher(t, dir, r.URL)
+	require.NoError(t, dispatcher.Enqueue(webhook.Payload{Event: webhook.EventAdded, ID: "foo.bar"}))
+	pending, err := dispatcher.Flush(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, pending)
+
+	mutex.Lock()
+	up = true
+	mutex.Unlock()
+
+	// A new dispatcher, as if the server restarted, should pick up the delivery.
+	restarted := newDispatcher(t, dir, r.URL)
+	flush(t, restarted)
+	requests := r.get()
+	require.Len(t, requests, 2)
+	require.Equal(t, requests[0].header.Get(webhook.DeliveryHeader), requests[1].header.Get(webhook.DeliveryHeader))
+
+	// Deliveries are made as they were queued even by a process with other
+	// webhooks configured, like a command sharing the server's queue.
+	require.NoError(t, restarted.Enqueue(webhook.Payload{Event: webhook.EventAdded, ID: "foo.bar"}))
+	other := newReceiver(t, always(http.StatusOK))
+	reconfigured, err := webhook.NewDispatcher(&webhook.Options{
+		URLs:     []string{other.URL},
+		QueueDir: dir,
+		Logger:   slogtest.Make(t, &slogtest.Options{IgnoreErrors: true}),
+	})
+	require.NoError(t, err)
+	flush(t, reconfigured)
+	requests = r.get()
+	require.Len(t, requests, 3)
+	require.True(t, webhook.Verify(secret, requests[2].body, requests[2].header.Get(webhook.SignatureHeader)))
+	require.Empty(t, other.get())
+}
+
+func TestCorruptQueue(t *testing.T) {
+	t.Parallel()
+
+	r := newReceiver(t, always(http.StatusOK))
+	dir := t.TempDir()
+	dispatcher := newDispatcher(t, dir, r.URL)
+
+	// Unparseable files are moved aside instead of blocking the queue.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "truncated.json"), []byte(`{"id":"trunc`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "garbage.json"), []byte("garbage"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "renamed.json"), []byte(`{"id":"other"}`), 0o600))
+	require.NoError(t, dispatcher.Enqueue(webhook.Payload{Event: webhook.EventAdded, ID: "foo.bar"}))
+	flush(t, dispatcher)
+	require.Len(t, r.get(), 1)
+
+	for _, name := range []string{"truncated.json", "garbage.json", "renamed.json"} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		require.True(t, os.IsNotExist(err), name)
+		_, err = os.Stat(filepath.Join(dir, name+".bad"))
+		require.NoError(t, err, name)
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	r := newReceiver(t, always(http.StatusOK))
+	dispatcher := newDispatcher(t, t.TempDir(), r.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		dispatcher.Run(ctx)
+		close(done)
+	}()
+
+	require.NoError(t, dispatcher.Enqueue(webhook.Payload{Event: webhook.EventAdded, ID: "foo.bar"}))
+	select {
+	case <-r.received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for webhook")
+	}
+
+	cancel()
+	<-done
+}
+
+func TestStorage(t *testing.T) {
+	t.Parallel()
+
+	logger := slogtest.Make(t, &slogtest.Options{IgnoreErrors: true})
+	local, err := storage.NewLocalStorage(&storage.LocalOptions{ExtDir: t.TempDir()}, logger)
+	require.NoError(t, err)
+
+	r := newReceiver(t, always(http.StatusOK))
+	dispatcher := newDispatcher(t, t.TempDir(), r.URL)
+	store := webhook.NewStorage(local, dispatcher, "https://marketplace.tld/sub", logger)
+	ctx := context.Background()
+
+	ext := testutil.Extensions[0]
+	versions := []storage.Version{
+		{Version: "3.0.0"},
+		{Version: "3.0.0", TargetPlatform: storage.PlatformLinuxX64},
+	}
+	for _, version := range versions {
+		manifest := testutil.ConvertExtensionToManifest(ext, version)
+		_, err = store.AddExtension(ctx, manifest, testutil.CreateVSIXFromManifest(t, manifest))
+		require.NoError(t, err)
+	}
+	flush(t, dispatcher)
+
+	payloads := r.payloads(t)
+	require.Len(t, payloads, 2)
+	sort.Slice(payloads, func(i, j int) bool {
+		return payloads[i].TargetPlatform < payloads[j].TargetPlatform
+	})
+	require.Equal(t, webhook.EventAdded, payloads[0].Event)
+	require.Equal(t, "foo.zany", payloads[0].ID)
+	require.Equal(t, "3.0.0", payloads[0].Version)
+	require.Empty(t, payloads[0].TargetPlatform)
+	require.Equal(t, "https://marketplace.tld/sub/assets/foo/zany/3.0.0/Microsoft.VisualStudio.Services.VSIXPackage", payloads[0].DownloadURL)
+	require.Equal(t, []string{"d.e"}, payloads[0].Dependencies)
+	require.Equal(t, storage.PlatformLinuxX64, payloads[1].TargetPlatform)
+	require.Equal(t, "https://marketplace.tld/sub/assets/foo/zany/3.0.0@linux-x64/Microsoft.VisualStudio.Services.VSIXPackage", payloads[1].DownloadURL)
+
+	// Failing to add does not send anything.
+	_, err = store.AddExtension(ctx, &storage.VSIXManifest{}, nil)
+	require.Error(t, err)
+
+	// Removing every platform sends a webhook for each build.
+	err = store.RemoveExtension(ctx, ext.Publisher, ext.Name, storage.Version{Version: "3.0.0"})
+	require.NoError(t, err)
+	flush(t, dispatcher)
+
+	payloads = r.payloads(t)[2:]
+	require.Len(t, payloads, 2)
+	sort.Slice(payloads, func(i, j int) bool {
+		return payloads[i].TargetPlatform < payloads[j].TargetPlatform
+	})
+	for i, payload := range payloads {
+		require.Equal(t, webhook.EventRemoved, payload.Event)
+		require.Equal(t, "foo.zany", payload.ID)
+		require.Equal(t, "3.0.0", payload.Version)
+		require.Empty(t, payload.DownloadURL)
+		if i == 0 {
+			require.Empty(t, payload.TargetPlatform)
+		} else {
+			require.Equal(t, storage.PlatformLinuxX64, payload.TargetPlatform)
+		}
+	}
+
+	// Failing to remove does not send anything.
+	err = store.RemoveExtension(ctx, ext.Publisher, ext.Name, storage.Version{Version: "3.0.0"})
+	require.Error(t, err)
+	pending, err := dispatcher.Flush(ctx)
+	require.NoError(t, err)
+	require.Zero(t, pending)
+	require.Len(t, r.get(), 4)
+}